@@ -0,0 +1,107 @@
+// Package main implements the aad-authd daemon, serving the cache to the PAM module, NSS and aad-cli.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/config"
+	"github.com/ubuntu/aad-auth/internal/consts"
+	"github.com/ubuntu/aad-auth/internal/daemon"
+	"github.com/ubuntu/aad-auth/internal/logger"
+)
+
+func main() {
+	var socketPath, configFile string
+
+	cmd := cobra.Command{
+		Use:   "aad-authd",
+		Short: "Azure AD authentication daemon",
+		Long: `Azure AD authentication daemon
+
+Serve the Azure AD cache over a Unix socket to the PAM module, NSS and aad-cli,
+which otherwise open the cache databases directly.
+The socket passed by systemd is used on socket activation.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			verbosity, _ := cmd.Flags().GetCount("verbose")
+			ctx := ctxWithLogger(context.Background(), verbosity)
+			defer logger.CloseLoggerFromContext(ctx)
+
+			return run(ctx, socketPath, configFile)
+		},
+	}
+	cmd.Flags().CountP("verbose", "v", "issue INFO (-v), DEBUG (-vv) or DEBUG with caller (-vvv) output")
+	cmd.Flags().StringVar(&socketPath, "socket", consts.DefaultSocketPath, "path to the socket to listen on, when not socket activated")
+	cmd.Flags().StringVar(&configFile, "config", consts.DefaultConfigPath, "path to the configuration file")
+
+	if err := cmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// ctxWithLogger attaches the logger to ctx: the journal, with the fields of the messages, when running as a systemd
+// service, and stderr otherwise.
+func ctxWithLogger(ctx context.Context, verbosity int) context.Context {
+	if logger.JournalStream() {
+		priority := logger.PriorityWarning
+		if verbosity == 1 {
+			priority = logger.PriorityInfo
+		} else if verbosity > 1 {
+			priority = logger.PriorityDebug
+		}
+		l, err := logger.NewJournalLogger("aad-authd", priority)
+		if err == nil {
+			return logger.CtxWithLogger(ctx, l)
+		}
+		fmt.Fprintf(os.Stderr, "Can't log to the journal, logging to stderr: %v\n", err)
+	}
+
+	logger.SetVerboseMode(verbosity)
+	logrus.SetFormatter(&logger.LogrusFormatter{})
+	return logger.CtxWithLogger(ctx, logger.LogrusLogger{FieldLogger: logrus.StandardLogger()})
+}
+
+// run serves the cache until the daemon is asked to stop.
+func run(ctx context.Context, socketPath, configFile string) error {
+	// Expired users are purged according to the default offline credentials expiration, as the PAM module does
+	// for users without a domain specific one, and listed according to the enumeration policy.
+	var cacheOpts []cache.Option
+	cfg, err := config.Parse(ctx, configFile)
+	if err != nil {
+		logger.Warn(ctx, "Using default offline credentials expiration and enumeration: %v", err)
+	} else {
+		cacheOpts = append(cacheOpts, cache.WithEnumeration(cfg.Enumeration))
+		if aad, err := cfg.Domain(ctx, ""); err != nil {
+			logger.Warn(ctx, "Using default offline credentials expiration: %v", err)
+		} else if aad.OfflineCredentialsExpiration != nil {
+			cacheOpts = append(cacheOpts, cache.WithOfflineCredentialsExpiration(*aad.OfflineCredentialsExpiration))
+		}
+	}
+
+	s, err := daemon.New(ctx, socketPath, daemon.WithCacheOptions(cacheOpts))
+	if err != nil {
+		return err
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(c)
+	go func() {
+		<-c
+		logger.Info(ctx, "Stopping aad-authd")
+		if err := s.Stop(ctx); err != nil {
+			logger.Warn(ctx, "Could not stop cleanly: %v", err)
+		}
+	}()
+
+	return s.Serve(ctx)
+}
@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/ubuntu/aad-auth/internal/aad"
+	"github.com/ubuntu/aad-auth/internal/config"
+	"github.com/ubuntu/aad-auth/internal/pam"
+	"golang.org/x/term"
+)
+
+const (
+	pamSuccess     = "PAM_SUCCESS"
+	pamAuthErr     = "PAM_AUTH_ERR"
+	pamSystemErr   = "PAM_SYSTEM_ERR"
+	pamPermDenied  = "PAM_PERM_DENIED"
+	pamIgnore      = "PAM_IGNORE"
+	pamUserUnknown = "PAM_USER_UNKNOWN"
+)
+
+// authenticator is the interface that wraps the Authenticate method used against AAD.
+type authenticator interface {
+	Authenticate(ctx context.Context, cfg config.AAD, username, password string) (aad.UserInfo, error)
+}
+
+func (a *App) installAuth() {
+	cmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Troubleshoot Azure AD authentication",
+		Args:  cobra.NoArgs,
+		RunE:  func(cmd *cobra.Command, args []string) error { return cmd.Usage() },
+	}
+
+	testCmd := &cobra.Command{
+		Use:   "test USER",
+		Short: "Run the PAM authentication decision path for an user without logging in",
+		Long: `Run the PAM authentication decision path for an user without logging in
+
+The password is prompted for and the same steps as the PAM module are executed: configuration
+resolution, online authentication, Azure AD error interpretation and offline cache check.
+Each step is printed, followed by the PAM result the module would return.
+The PAM service and remote host can be passed to apply the matching login policies of the configuration.
+
+The cache is not modified unless --update is passed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			update, _ := cmd.Flags().GetBool("update")
+			service, _ := cmd.Flags().GetString("service")
+			remoteHost, _ := cmd.Flags().GetString("remote-host")
+
+			password, err := readPassword(fmt.Sprintf("Password for %s: ", args[0]))
+			if err != nil {
+				return err
+			}
+
+			result := a.testAuthentication(args[0], password, config.Login{Service: service, RemoteHost: remoteHost}, update)
+			fmt.Println("PAM result:", result)
+			if result != pamSuccess {
+				return fmt.Errorf("authentication would fail with %s", result)
+			}
+			return nil
+		},
+	}
+	testCmd.Flags().BoolP("update", "u", false, "update the cache on successful online authentication, as the PAM module does")
+	testCmd.Flags().StringP("service", "s", "", "PAM service the user would log in through")
+	testCmd.Flags().StringP("remote-host", "r", "", "host the user would log in from, as PAM_RHOST")
+
+	cmd.AddCommand(testCmd)
+	a.rootCmd.AddCommand(cmd)
+}
+
+// testAuthentication runs the authentication of the PAM module for login, printing each step. The cache is not
+// modified unless update is true, and no metrics are written. It returns the PAM result the module would return.
+func (a *App) testAuthentication(username, password string, login config.Login, update bool) string {
+	opts := []pam.Option{
+		pam.WithAuthenticator(a.options.auth),
+		pam.WithSocketPath(a.options.socketPath),
+		pam.WithLogin(login.Service, login.RemoteHost),
+		pam.WithMetricsDir(""),
+		pam.WithSteps(func(step, outcome string) { fmt.Printf("%s: %s\n", step, outcome) }),
+	}
+	if a.options.cache != nil {
+		opts = append(opts, pam.WithCache(a.options.cache))
+	}
+	if !update {
+		opts = append(opts, pam.WithDryRun())
+	}
+
+	return pamResult(pam.Authenticate(a.ctx, username, password, a.options.configFile, opts...))
+}
+
+// pamResult returns the name of the PAM result matching the error returned by the PAM module.
+func pamResult(err error) string {
+	switch {
+	case err == nil:
+		return pamSuccess
+	case errors.Is(err, pam.ErrPamSystem):
+		return pamSystemErr
+	case errors.Is(err, pam.ErrPamPermDenied):
+		return pamPermDenied
+	case errors.Is(err, pam.ErrPamIgnore):
+		return pamIgnore
+	case errors.Is(err, pam.ErrPamUserUnknown):
+		return pamUserUnknown
+	}
+	return pamAuthErr
+}
+
+// readPassword prompts for a password on stderr and reads it from stdin.
+// Echo is disabled if stdin is a terminal.
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		p, err := term.ReadPassword(fd)
+		if err != nil {
+			return "", fmt.Errorf("could not read password: %w", err)
+		}
+		return string(p), nil
+	}
+
+	p, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("could not read password: %w", err)
+	}
+	return strings.TrimSuffix(p, "\n"), nil
+}
@@ -0,0 +1,125 @@
+package cli_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/cmd/aad-cli/cli"
+	"github.com/ubuntu/aad-auth/internal/aad"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+func TestAuthTest(t *testing.T) {
+	tests := map[string]struct {
+		username   string
+		password   string
+		configFile string
+		update     bool
+		cachedName string
+		service    string
+		remoteHost string
+
+		wantInCache bool
+		wantErr     bool
+	}{
+		"online authentication does not update the cache":      {},
+		"online authentication updates the cache if requested": {update: true, wantInCache: true},
+		"offline authentication of a cached user":              {username: "myuser@domain.com", configFile: "forceoffline.conf"},
+		"down-level logon name is normalized":                  {username: `DOMAIN\Success`, configFile: "name-normalization.conf", update: true, cachedName: "success@domain.com", wantInCache: true},
+		"guest user gets its friendly name":                    {username: "Success_Guest.com#EXT#@domain.com", update: true, cachedName: "success_guest.com", wantInCache: true},
+		"offline authentication of a local login":              {username: "myuser@domain.com", configFile: "forceoffline-login-policies.conf", service: "gdm-password"},
+
+		// error cases
+		"error on invalid credentials":                           {username: "invalid credentials", wantErr: true},
+		"error on unknown user":                                  {username: "no such user", wantErr: true},
+		"error on password expired":                              {username: "password expired", wantErr: true},
+		"error on account disabled":                              {username: "account disabled", wantErr: true},
+		"error on token of another user":                         {username: "token of another user", wantErr: true},
+		"error on deleted user would revoke offline credentials": {username: "myuser@domain.com", wantErr: true},
+		"error on deleted user revokes offline credentials":      {username: "myuser@domain.com", update: true, wantErr: true},
+		"error on deleted user not in cache revokes nothing":     {username: "no such user", update: true, wantErr: true},
+		"error on offline with wrong password":                   {username: "myuser@domain.com", password: "wrong password", configFile: "forceoffline.conf", wantErr: true},
+		"error on offline with uncached user":                    {configFile: "forceoffline.conf", wantErr: true},
+		"error on invalid configuration":                         {configFile: "missing-required.conf", wantErr: true},
+		"error on guest users denied":                            {username: "success_guest.com#ext#@domain.com", configFile: "guest-users-denied.conf", wantErr: true},
+		"error on nonexistent configuration":                     {configFile: "nonexistent.conf", wantErr: true},
+		"error on domain not allowed in strict domain mode":      {username: "success@otherdomain.com", configFile: "strict-domains.conf", wantErr: true},
+		"error on local user in strict domain mode":              {username: "localuser", configFile: "strict-domains.conf", wantErr: true},
+		"error on denied service":                                {configFile: "login-policies.conf", service: "cron", wantErr: true},
+		"error on denied remote login":                           {configFile: "login-policies.conf", service: "sshd", remoteHost: "192.0.2.1", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			if tc.username == "" {
+				tc.username = "success@domain.com"
+			}
+			if tc.password == "" {
+				tc.password = "my password"
+			}
+			if tc.configFile == "" {
+				tc.configFile = "aad.conf"
+			}
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+			c := cli.New(cli.WithCache(testutils.NewCacheForTests(t, cacheDir)),
+				cli.WithConfigFile(filepath.Join("testdata", tc.configFile)),
+				cli.WithAuthenticator(aad.NewWithMockClient()))
+
+			args := []string{"auth", "test", tc.username}
+			if tc.update {
+				args = append(args, "--update")
+			}
+			if tc.service != "" {
+				args = append(args, "--service", tc.service)
+			}
+			if tc.remoteHost != "" {
+				args = append(args, "--remote-host", tc.remoteHost)
+			}
+
+			setStdin(t, tc.password+"\n")
+			got, err := testutils.RunApp(t, c, args...)
+			if tc.wantErr {
+				require.Error(t, err, "expected command to return an error")
+			} else {
+				require.NoError(t, err, "expected command to succeed")
+			}
+
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "expected output to match golden file")
+
+			cache := testutils.NewCacheForTests(t, cacheDir)
+			if tc.cachedName == "" {
+				tc.cachedName = tc.username
+			}
+			_, err = cache.GetUserByName(context.Background(), tc.cachedName)
+			if tc.wantInCache || tc.username == "myuser@domain.com" {
+				require.NoError(t, err, "expected user to be in the cache")
+				return
+			}
+			require.Error(t, err, "expected user to not be in the cache")
+		})
+	}
+}
+
+// setStdin replaces stdin with a pipe containing content for the duration of the test.
+func setStdin(t *testing.T, content string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err, "Setup: pipe shouldn't fail")
+	_, err = w.WriteString(content)
+	require.NoError(t, err, "Setup: could not write to stdin pipe")
+	w.Close()
+
+	orig := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = orig
+		r.Close()
+	})
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/config"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/aad-auth/internal/metrics"
+)
+
+func (a *App) installCache() {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Maintain the Azure AD cache",
+		Args:  cobra.NoArgs,
+	}
+
+	gcCmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Purge expired users and compact the cache",
+		Long: `Purge expired users and compact the cache
+
+Users who didn't authenticate online for twice the offline_credentials_expiration of the configuration
+section of their domain are removed, together with any orphaned entry. Users who didn't open a session for
+inactive_users_expiration days are removed too, if it is set. The databases are then checkpointed
+and vacuumed. Nothing is removed if the configuration is invalid.
+The number of users and the size of the cache are written to the metrics, if metrics_dir is set.
+This is run periodically by the aad-cache-gc systemd timer, and requires root privileges.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.gcCache()
+		},
+	}
+	cmd.AddCommand(gcCmd)
+
+	a.rootCmd.AddCommand(cmd)
+}
+
+// gcCache runs the cache maintenance and prints what was removed.
+func (a *App) gcCache() (err error) {
+	// Users would be purged with the wrong expiration if we fell back to the default one.
+	cfg, err := config.Parse(a.ctx, a.options.configFile)
+	if err != nil {
+		return err
+	}
+
+	c := a.options.cache
+	if c == nil {
+		if c, err = cache.New(a.ctx); err != nil {
+			return err
+		}
+		defer c.Close(a.ctx)
+	}
+
+	r, err := c.GC(a.ctx,
+		cache.WithDomainExpiration(func(domain string) (int, error) {
+			return offlineCredentialsExpiration(a.ctx, cfg, domain)
+		}),
+		cache.WithDomainInactivityExpiration(func(domain string) (int, error) {
+			d, err := cfg.Domain(a.ctx, domain)
+			if err != nil {
+				return 0, err
+			}
+			return d.InactiveUsersExpiration, nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d expired users, %d inactive users and %d orphaned entries from the cache.\n", r.ExpiredUsers, r.InactiveUsers, r.OrphanedEntries)
+
+	writeCacheMetrics(a.ctx, cfg, c, r)
+	return nil
+}
+
+// offlineCredentialsExpiration returns the offline credentials expiration in days of the users of domain.
+// It is -1 when unset, so that they are purged after the default expiration, as when offline authentication is
+// disabled.
+func offlineCredentialsExpiration(ctx context.Context, cfg *config.Config, domain string) (int, error) {
+	d, err := cfg.Domain(ctx, domain)
+	if err != nil {
+		return 0, err
+	}
+	if d.OfflineCredentialsExpiration == nil {
+		return -1, nil
+	}
+	return *d.OfflineCredentialsExpiration, nil
+}
+
+// writeCacheMetrics writes the users purged by the maintenance and the size of the cache to the metrics.
+// Failures are only logged, as the maintenance succeeded.
+func writeCacheMetrics(ctx context.Context, cfg *config.Config, c *cache.Cache, r cache.GCReport) {
+	m := metrics.New(cfg.MetricsDir)
+	if m == nil {
+		return
+	}
+	defer m.Flush(ctx)
+
+	m.AddPurgedUsers(int(r.ExpiredUsers + r.InactiveUsers))
+	s, err := c.Stats(ctx)
+	if err != nil {
+		logger.Warn(ctx, "Not writing cache metrics: %v", err)
+		return
+	}
+	m.SetCache(s.Users, s.DatabaseSizes)
+}
@@ -0,0 +1,85 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/cmd/aad-cli/cli"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+func TestCacheGC(t *testing.T) {
+	tests := map[string]struct {
+		initialCache       string
+		conf               string
+		shadowNotAvailable bool
+		withMetrics        bool
+
+		wantMetrics []string
+		wantErr     bool
+	}{
+		"purge expired users and orphaned entries": {initialCache: "db_with_orphans"},
+		"nothing to remove":                        {initialCache: "users_in_db"},
+		"purge with expiration of user domain":     {initialCache: "db_with_orphans", conf: "gc-domain-expiration.conf"},
+		"purge inactive users":                     {initialCache: "users_with_login_history", conf: "gc-inactive-users.conf"},
+		"write cache metrics": {initialCache: "db_with_orphans", withMetrics: true, wantMetrics: []string{
+			"aad_auth_cache_users ",
+			`aad_auth_cache_size_bytes{db="passwd"} `,
+			`aad_auth_cache_size_bytes{db="shadow"} `,
+			"aad_auth_cache_purged_users_total 1\n",
+		}},
+
+		// error cases
+		"error on shadow not writable":     {initialCache: "users_in_db", shadowNotAvailable: true, wantErr: true},
+		"error on invalid configuration":   {initialCache: "db_with_orphans", conf: "malformed.conf", wantErr: true},
+		"error on missing configuration":   {initialCache: "db_with_orphans", conf: "doesnotexist.conf", wantErr: true},
+		"error on missing required values": {initialCache: "db_with_orphans", conf: "missing-required.conf", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, tc.initialCache)
+
+			var opts []cache.Option
+			if tc.shadowNotAvailable {
+				opts = append(opts, cache.WithShadowMode(0))
+			}
+			if tc.conf == "" {
+				tc.conf = "aad.conf"
+			}
+			configFile := filepath.Join("testdata", tc.conf)
+			metricsDir := t.TempDir()
+			if tc.withMetrics {
+				conf, err := os.ReadFile(configFile)
+				require.NoError(t, err, "Setup: could not read configuration")
+				configFile = filepath.Join(t.TempDir(), "aad.conf")
+				err = os.WriteFile(configFile, append([]byte("metrics_dir = "+metricsDir+"\n"), conf...), 0600)
+				require.NoError(t, err, "Setup: could not write configuration")
+			}
+			c := cli.New(cli.WithCache(testutils.NewCacheForTests(t, cacheDir, opts...)), cli.WithConfigFile(configFile))
+
+			got, err := testutils.RunApp(t, c, "cache", "gc")
+			if tc.wantErr {
+				require.Error(t, err, "cache gc should have failed")
+				return
+			}
+			require.NoError(t, err, "cache gc should succeed")
+
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "cache gc should print the removed entries")
+
+			if !tc.withMetrics {
+				return
+			}
+			m, err := os.ReadFile(filepath.Join(metricsDir, "aad_auth.prom"))
+			require.NoError(t, err, "cache gc should have written the metrics")
+			for _, w := range tc.wantMetrics {
+				require.Contains(t, string(m), w, "cache gc should have written the cache metrics")
+			}
+		})
+	}
+}
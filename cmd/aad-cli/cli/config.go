@@ -25,15 +25,19 @@ func (a *App) installConfig() {
 		Short: "Manage aad-auth configuration",
 		Long: fmt.Sprintf(`Manage aad-auth configuration
 
-Edit or print the configuration file at %s.`, a.options.configFile),
+Edit, validate or print the configuration file at %s.
+Printed values are the effective ones, after merging the *.conf files of %s in lexical order.
+When a domain is passed, the section matching it, exactly, through an alias or through a wildcard, is explained.`,
+			a.options.configFile, a.options.configFile+".d"),
 		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			edit, _ := cmd.Flags().GetBool("edit")
 			domain, _ := cmd.Flags().GetString("domain")
+			showOrigin, _ := cmd.Flags().GetBool("show-origin")
 
 			// Handle config printing if editing wasn't requested
 			if !edit {
-				return printConfig(a.ctx, a.options.configFile, domain)
+				return printConfig(a.ctx, a.options.configFile, domain, showOrigin)
 			}
 
 			// Otherwise, edit the config file
@@ -42,10 +46,37 @@ Edit or print the configuration file at %s.`, a.options.configFile),
 	}
 	cmd.Flags().BoolP("edit", "e", false, "Edit the configuration file in an external editor")
 	cmd.Flags().StringP("domain", "d", getDefaultDomain(), "Domain to use for parsing configuration")
+	cmd.Flags().Bool("show-origin", false, "Show the file each effective value comes from")
 	cmd.MarkFlagsMutuallyExclusive("edit", "domain")
+	cmd.MarkFlagsMutuallyExclusive("edit", "show-origin")
+
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the configuration file",
+		Long: `Validate the configuration file
+
+Every key and value of the configuration file and of its drop-in fragments is checked.
+All the errors found are reported, with the file, line and section they are located in.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return validateConfig(a.ctx, a.options.configFile)
+		},
+	}
+	cmd.AddCommand(validateCmd)
+
 	a.rootCmd.AddCommand(cmd)
 }
 
+// validateConfig validates the configuration file, merged with its drop-in fragments.
+func validateConfig(ctx context.Context, configFile string) error {
+	if err := config.Validate(ctx, configFile); err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+
+	fmt.Println("The configuration at", configFile, "is valid.")
+	return nil
+}
+
 // editConfig opens the configuration file in an external editor for editing.
 func editConfig(ctx context.Context, configFile, editor string) error {
 	// Create a temporary file with the previous config file contents
@@ -62,8 +93,9 @@ func editConfig(ctx context.Context, configFile, editor string) error {
 		return fmt.Errorf("failed to edit config: %w", err)
 	}
 
-	// Replace the current config with the temporary file if it has changed and is valid
-	if err := config.Validate(ctx, tempfile); err != nil {
+	// Replace the current config with the temporary file if it has changed and is valid.
+	// The drop-in fragments of the current config are merged for validation.
+	if err := config.Validate(ctx, tempfile, config.WithDropInDir(configFile+".d")); err != nil {
 		return fmt.Errorf("invalid config: %w\nThe temporary file was saved at: %s", err, tempfile)
 	}
 	if err := os.Rename(tempfile, configFile); err != nil {
@@ -127,9 +159,14 @@ func getDefaultEditor() string {
 }
 
 // printConfig prints the current configuration from the passed domain in the
-// ini format.
-func printConfig(ctx context.Context, path, domain string) error {
-	config, err := config.Load(ctx, path, domain)
+// ini format, preceded by the section of the configuration file which matched the domain.
+// If showOrigin is true, each value is preceded by a comment with the file it comes from.
+func printConfig(ctx context.Context, path, domain string, showOrigin bool) error {
+	c, err := config.Parse(ctx, path)
+	if err != nil {
+		return err
+	}
+	cfgDomain, err := c.Domain(ctx, domain)
 	if err != nil {
 		return err
 	}
@@ -137,14 +174,27 @@ func printConfig(ctx context.Context, path, domain string) error {
 	domainSection := "default"
 	if domain != "" {
 		domainSection = domain
+
+		// Explain which section of the configuration applies to the domain.
+		fmt.Println("#", c.MatchSection(domain))
 	}
 
 	buf := new(bytes.Buffer)
-	cfg, err := config.ToIni()
+	cfg, err := cfgDomain.ToIni()
 	if err != nil {
 		return err
 	}
 
+	if showOrigin {
+		origins, err := config.Origins(ctx, path, domain)
+		if err != nil {
+			return err
+		}
+		for _, k := range cfg.Section("").Keys() {
+			k.Comment = "from " + origins[k.Name()]
+		}
+	}
+
 	if _, err := cfg.WriteTo(buf); err != nil {
 		return fmt.Errorf("could not write config to buffer: %w", err)
 	}
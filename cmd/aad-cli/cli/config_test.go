@@ -18,6 +18,7 @@ func TestConfigPrint(t *testing.T) {
 	tests := map[string]struct {
 		configFile string
 		domain     string
+		showOrigin bool
 
 		wantErr bool
 	}{
@@ -25,6 +26,11 @@ func TestConfigPrint(t *testing.T) {
 		"custom domain":  {domain: "example.com"},
 		"homedir and shell optional fields missing":       {configFile: "missing-homedir-and-shell-fields.conf"},
 		"required entries only present in default domain": {domain: "example.com", configFile: "required-present-in-default-domain.conf"},
+		"values merged from drop-in fragments":            {domain: "example.com", configFile: "with-drop-in.conf"},
+		"show origin of values":                           {domain: "example.com", configFile: "with-drop-in.conf", showOrigin: true},
+		"section matched by alias":                        {domain: "example.org", configFile: "with-wildcards.conf"},
+		"section matched by wildcard":                     {domain: "eu.example.com", configFile: "with-wildcards.conf"},
+		"no section matching the domain":                  {domain: "example.net", configFile: "with-wildcards.conf"},
 
 		// error cases
 		"missing required entries": {configFile: "missing-required.conf", wantErr: true},
@@ -40,6 +46,9 @@ func TestConfigPrint(t *testing.T) {
 			if tc.domain != "" {
 				cmdArgs = append(cmdArgs, "--domain", tc.domain)
 			}
+			if tc.showOrigin {
+				cmdArgs = append(cmdArgs, "--show-origin")
+			}
 
 			if tc.configFile == "" {
 				tc.configFile = "aad.conf"
@@ -62,9 +71,10 @@ func TestConfigPrint(t *testing.T) {
 }
 
 func TestConfigEdit(t *testing.T) {
-	requiredConfig := "tenant_id = something\napp_id = something"
-	badConfig := "tenant_id = something"
+	requiredConfig := "tenant_id = 11111111-1111-1111-1111-111111111111\napp_id = 22222222-2222-2222-2222-222222222222"
+	badConfig := "tenant_id = 11111111-1111-1111-1111-111111111111"
 	malformedConfig := "aaaaaaaaaaaaa"
+	invalidValuesConfig := "tenant_id = something\napp_id = something"
 
 	tests := map[string]struct {
 		configFile       string
@@ -85,6 +95,7 @@ func TestConfigEdit(t *testing.T) {
 		"editor returns an error":         {wantEditorErr: true, wantErr: true},
 		"cfg validation returns an error": {newConfigContent: badConfig, wantErr: true},
 		"cfg loading returns an error":    {newConfigContent: malformedConfig, wantErr: true},
+		"cfg with invalid values":         {newConfigContent: invalidValuesConfig, wantErr: true},
 	}
 	for name, tc := range tests {
 		tc := tc
@@ -118,6 +129,45 @@ func TestConfigEdit(t *testing.T) {
 	}
 }
 
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		configFile string
+
+		wantErr bool
+	}{
+		"valid config":                      {},
+		"valid config with drop-in":         {configFile: "with-drop-in.conf"},
+		"required entries only in defaults": {configFile: "required-present-in-default-domain.conf"},
+
+		// error cases
+		"missing required entries": {configFile: "missing-required.conf", wantErr: true},
+		"invalid values":           {configFile: "invalid-values.conf", wantErr: true},
+		"malformed config":         {configFile: "malformed.conf", wantErr: true},
+		"non-existent config":      {configFile: "non-existent.conf", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			if tc.configFile == "" {
+				tc.configFile = "aad.conf"
+			}
+			tc.configFile = filepath.Join("testdata", tc.configFile)
+
+			c := cli.New(cli.WithConfigFile(tc.configFile))
+			got, err := testutils.RunApp(t, c, "config", "validate")
+			if tc.wantErr {
+				require.Error(t, err, "expected command to return an error")
+				got = err.Error()
+			} else {
+				require.NoError(t, err, "expected command to succeed")
+			}
+
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "expected output to match golden file")
+		})
+	}
+}
+
 func TestConfigEditor(t *testing.T) {
 	// Custom editor
 	err := os.Setenv("EDITOR", "vim")
@@ -18,6 +18,27 @@ func WithCache(c *cache.Cache) func(o *options) {
 	}
 }
 
+// WithSocketPath specifies the path to the socket of the aad-authd daemon.
+func WithSocketPath(p string) func(o *options) {
+	return func(o *options) {
+		o.socketPath = p
+	}
+}
+
+// WithSudoersPath specifies the managed sudoers file to install the sudo rules in.
+func WithSudoersPath(p string) func(o *options) {
+	return func(o *options) {
+		o.sudoersPath = p
+	}
+}
+
+// WithVisudoCmd specifies a custom visudo command to check the sudo rules with.
+func WithVisudoCmd(p string) func(o *options) {
+	return func(o *options) {
+		o.visudoCmd = p
+	}
+}
+
 // WithEditor specifies a custom editor to use when editing the config file.
 // Will probably only be used in tests.
 func WithEditor(p string) func(o *options) {
@@ -47,6 +68,13 @@ func WithCurrentUser(p string) func(o *options) {
 	}
 }
 
+// WithAuthenticator specifies a custom authenticator to use for the auth command.
+func WithAuthenticator(auth authenticator) func(o *options) {
+	return func(o *options) {
+		o.auth = auth
+	}
+}
+
 // Editor returns the editor used by the program.
 func (a App) Editor() string {
 	return a.options.editor
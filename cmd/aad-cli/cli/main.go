@@ -6,9 +6,11 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/ubuntu/aad-auth/internal/aad"
 	"github.com/ubuntu/aad-auth/internal/cache"
 	"github.com/ubuntu/aad-auth/internal/consts"
 	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/aad-auth/internal/sudoers"
 )
 
 // App encapsulates commands and options of the application.
@@ -26,7 +28,11 @@ type options struct {
 	dpkgQueryCmd string
 	procFs       string
 	currentUser  string
+	socketPath   string
+	sudoersPath  string
+	visudoCmd    string
 	cache        *cache.Cache
+	auth         authenticator
 }
 type option func(*options)
 
@@ -38,7 +44,11 @@ func New(opts ...option) *App {
 		configFile:   consts.DefaultConfigPath,
 		dpkgQueryCmd: "dpkg-query",
 		currentUser:  getDefaultUser(),
+		socketPath:   consts.DefaultSocketPath,
+		sudoersPath:  sudoers.DefaultPath,
+		visudoCmd:    "visudo",
 		procFs:       "/proc",
+		auth:         aad.AAD{},
 	}
 
 	for _, o := range opts {
@@ -65,8 +75,12 @@ func New(opts ...option) *App {
 
 	a.rootCmd.PersistentFlags().CountP("verbose", "v", "issue INFO (-v), DEBUG (-vv) or DEBUG with caller (-vvv) output")
 
+	a.installAuth()
+	a.installCache()
 	a.installUser()
 	a.installConfig()
+	a.installSSH()
+	a.installSudoers()
 	a.installVersion()
 
 	return &a
@@ -0,0 +1,260 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/config"
+	"github.com/ubuntu/aad-auth/internal/daemon"
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/aad-auth/internal/user"
+	"github.com/ubuntu/decorate"
+)
+
+const (
+	// sshService is the PAM service sshd logs users in through, whose policy applies to the logins with SSH keys.
+	sshService = "sshd"
+	// sshUnknownRemoteHost is the remote host of the logins through sshd when it is not passed: they are remote anyway.
+	sshUnknownRemoteHost = "unknown"
+)
+
+func (a *App) installSSH() {
+	cmd := &cobra.Command{
+		Use:   "ssh",
+		Short: "Integrate Azure AD users with the SSH server",
+		Args:  cobra.NoArgs,
+		RunE:  func(cmd *cobra.Command, args []string) error { return cmd.Usage() },
+	}
+
+	authorizedKeysCmd := &cobra.Command{
+		Use:   "authorized-keys USER",
+		Short: "Print the SSH public keys an user can log in with",
+		Long: `Print the SSH public keys an user can log in with
+
+This is meant to be the AuthorizedKeysCommand of sshd, which must run it as root or as a member of the shadow group:
+    AuthorizedKeysCommand /usr/bin/aad-cli ssh authorized-keys %u
+    AuthorizedKeysCommandUser root
+
+The keys are the ones added with aad-cli user ssh-keys. They are only printed if the user can authenticate offline:
+no key is printed if their offline credentials are revoked or expired, or if the login policies of the configuration
+deny their logins through sshd. Nothing is printed for users who are not in the cache, nor for users of domains which
+are not authenticated with strict_domains.
+Logins through sshd are always remote ones: the remote section of the configuration applies, even without --remote-host.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			remoteHost, _ := cmd.Flags().GetString("remote-host")
+
+			keys, err := a.authorizedKeys(args[0], remoteHost)
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				fmt.Println(k.Key)
+			}
+			return nil
+		},
+	}
+	authorizedKeysCmd.Flags().StringP("remote-host", "r", "", "host the user is logging in from")
+	cmd.AddCommand(authorizedKeysCmd)
+
+	a.rootCmd.AddCommand(cmd)
+}
+
+// authorizedKeys returns the SSH public keys username can log in with through sshd from remoteHost, which may be
+// unknown. Users who are not in the cache, users of domains which are not authenticated, and names which are not
+// the ones of Azure AD users, have no key.
+func (a *App) authorizedKeys(username, remoteHost string) (keys []cache.SSHKey, err error) {
+	defer decorate.OnError(&err, i18n.G("can't get authorized keys of %q"), username)
+
+	login := config.Login{Service: sshService, RemoteHost: remoteHost}
+	if !login.Remote() {
+		login.RemoteHost = sshUnknownRemoteHost
+	}
+	conf, err := config.Parse(a.ctx, a.options.configFile, config.WithLogin(login))
+	if err != nil {
+		return nil, err
+	}
+	n := conf.NameNormalization
+	username = user.NormalizeName(username, n.UserOptions()...)
+	_, domain, found := strings.Cut(username, "@")
+	if !found {
+		logger.Debug(a.ctx, "%q is not an Azure AD user", username)
+		return nil, nil
+	}
+	// The PAM module leaves the users of these domains to the other modules: they can't log in with our keys.
+	if !conf.Domains.Accepts(domain) {
+		logger.Debug(a.ctx, "Domain %q is not configured, %q has no key", domain, username)
+		return nil, nil
+	}
+	posixName, err := user.PosixName(username, n.UserOptions()...)
+	if err != nil {
+		logger.Debug(a.ctx, "%q is not an Azure AD user: %v", username, err)
+		return nil, nil
+	}
+
+	cfg, err := conf.Domain(a.ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	// sshd runs the command on each login: it only reads the cache.
+	cacheOpts := []cache.Option{cache.WithReadOnly()}
+	var daemonOpts []daemon.ClientOption
+	if cfg.OfflineCredentialsExpiration != nil {
+		cacheOpts = append(cacheOpts, cache.WithOfflineCredentialsExpiration(*cfg.OfflineCredentialsExpiration))
+		daemonOpts = append(daemonOpts, daemon.WithOfflineCredentialsExpiration(*cfg.OfflineCredentialsExpiration))
+	}
+	c, err := a.getCache(daemonOpts, cacheOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close(a.ctx)
+
+	keys, err = c.AuthorizedKeys(a.ctx, posixName)
+	if errors.Is(err, cache.ErrNoEnt) {
+		logger.Debug(a.ctx, "%q is not in the cache", posixName)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Logins with SSH keys don't go through the authentication of the PAM module, which enforces the same policies.
+	if cfg.Denied() {
+		return nil, errors.New(i18n.G("logins through sshd are denied by the configuration"))
+	}
+	if _, guest := user.GuestName(username); guest && !cfg.AllowsGuestUsers() {
+		return nil, fmt.Errorf(i18n.G("guest users are not allowed for domain %q"), domain)
+	}
+
+	return keys, nil
+}
+
+// sshKeysCmd returns the user subcommand managing the SSH public keys of users.
+func (a *App) sshKeysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ssh-keys",
+		Short: "Manage the SSH public keys of an user",
+		Long: `Manage the SSH public keys of an user
+
+The keys are stored in the cache and served to sshd by aad-cli ssh authorized-keys.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error { return cmd.Usage() },
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the SSH public keys of an user, with their fingerprint",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.withUserCache(cmd, func(c userCache, username string) error {
+				keys, err := c.SSHKeys(a.ctx, username)
+				if err != nil {
+					return err
+				}
+				for _, k := range keys {
+					fmt.Println(k.Fingerprint, k.Key)
+				}
+				return nil
+			})
+		},
+	}
+
+	addCmd := &cobra.Command{
+		Use:   "add [KEY]",
+		Short: "Add SSH public keys to an user",
+		Long: `Add SSH public keys to an user
+
+The key is passed in the authorized_keys format, like the content of ~/.ssh/id_ed25519.pub.
+If it is omitted or -, the keys are read from the standard input, one per line. This requires root privileges.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys := args
+			if len(args) == 0 || args[0] == "-" {
+				var err error
+				if keys, err = readSSHKeys(os.Stdin); err != nil {
+					return err
+				}
+			}
+			return a.withUserCache(cmd, func(c userCache, username string) error {
+				for _, key := range keys {
+					k, err := c.AddSSHKey(a.ctx, username, key)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("Added key %s to %s.\n", k.Fingerprint, username)
+				}
+				return nil
+			})
+		},
+	}
+
+	removeCmd := &cobra.Command{
+		Use:   "remove KEY|FINGERPRINT",
+		Short: "Remove an SSH public key of an user",
+		Long: `Remove an SSH public key of an user
+
+The key is passed in the authorized_keys format, or as its SHA256 fingerprint printed by list.
+This requires root privileges.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.withUserCache(cmd, func(c userCache, username string) error {
+				return c.RemoveSSHKey(a.ctx, username, args[0])
+			})
+		},
+	}
+
+	for _, sub := range []*cobra.Command{listCmd, addCmd, removeCmd} {
+		sub.Flags().StringP("name", "n", a.options.currentUser, "username to operate on")
+		if err := sub.RegisterFlagCompletionFunc("name", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			return a.completeWithAvailableUsers()
+		}); err != nil {
+			logger.Warn(a.ctx, "Unable to register completion for ssh-keys command: %v", err)
+		}
+		cmd.AddCommand(sub)
+	}
+
+	return cmd
+}
+
+// withUserCache runs f on the cache with the POSIX name of the user passed to the --name flag of cmd.
+func (a *App) withUserCache(cmd *cobra.Command, f func(c userCache, username string) error) error {
+	username, _ := cmd.Flags().GetString("name")
+	username, err := a.posixName(username)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.getCache(nil)
+	if err != nil {
+		return err
+	}
+	defer c.Close(a.ctx)
+
+	return f(c, username)
+}
+
+// readSSHKeys returns the SSH public keys of r, one per line. Empty lines and comments are skipped.
+func readSSHKeys(r io.Reader) (keys []string, err error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, errors.New(i18n.G("no SSH public key to add"))
+	}
+	return keys, nil
+}
@@ -0,0 +1,153 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/cmd/aad-cli/cli"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+func TestSSHAuthorizedKeys(t *testing.T) {
+	tests := map[string]struct {
+		args          string
+		configFile    string
+		throughDaemon bool
+
+		wantErr bool
+	}{
+		"keys of user":                              {args: "myuser@domain.com"},
+		"keys of user with unnormalized name":       {args: "MyUser@Domain.COM"},
+		"keys of user through aad-authd":            {args: "myuser@domain.com", throughDaemon: true},
+		"keys of user on allowed remote login":      {args: "myuser@domain.com --remote-host remote.example.com"},
+		"no key for user without keys":              {args: "user@otherdomain.com"},
+		"no key for user not in cache":              {args: "nouser@domain.com"},
+		"no key for local user":                     {args: "root"},
+		"no key for user with invalid name":         {args: "my:user@domain.com"},
+		"no key for user not in cache, sshd denied": {args: "nouser@domain.com", configFile: "sshd-denied.conf"},
+		"no key for user of domain not allowed":     {args: "myuser@domain.com", configFile: "strict-domains-other-domain.conf"},
+
+		// error cases
+		"error on revoked user":                                      {args: "otheruser@domain.com", wantErr: true},
+		"error on expired user":                                      {args: "expireduser@domain.com", wantErr: true},
+		"error on revoked user through aad-authd":                    {args: "otheruser@domain.com", throughDaemon: true, wantErr: true},
+		"error on logins through sshd denied":                        {args: "myuser@domain.com", configFile: "sshd-denied.conf", wantErr: true},
+		"error on remote logins denied":                              {args: "myuser@domain.com --remote-host remote.example.com", configFile: "login-policies.conf", wantErr: true},
+		"error on remote logins denied without remote host":          {args: "myuser@domain.com", configFile: "login-policies.conf", wantErr: true},
+		"error on offline authentication disabled for remote logins": {args: "myuser@domain.com", configFile: "remote-offline-disabled.conf", throughDaemon: true, wantErr: true},
+		"error on invalid configuration":                             {args: "myuser@domain.com", configFile: "nonexistent.conf", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			if tc.configFile == "" {
+				tc.configFile = "aad.conf"
+			}
+			configFile := filepath.Join("testdata", tc.configFile)
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_with_ssh_keys")
+			c := cli.New(cli.WithCache(testutils.NewCacheForTests(t, cacheDir)), cli.WithConfigFile(configFile))
+			if tc.throughDaemon {
+				socket := testutils.TempSocketPath(t)
+				testutils.StartDaemon(t, socket, testutils.CacheOptionsForTests(t, cacheDir))
+				c = cli.New(cli.WithSocketPath(socket), cli.WithConfigFile(configFile))
+			}
+
+			args := append([]string{"ssh", "authorized-keys"}, strings.Split(tc.args, " ")...)
+			got, err := testutils.RunApp(t, c, args...)
+			if tc.wantErr {
+				require.Error(t, err, "ssh authorized-keys should have failed")
+				require.Empty(t, got, "ssh authorized-keys should not print any key on failure")
+				return
+			}
+			require.NoError(t, err, "ssh authorized-keys should succeed")
+
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "ssh authorized-keys should print the keys of the user")
+		})
+	}
+}
+
+func TestUserSSHKeys(t *testing.T) {
+	// rsaKey is a key none of the users of the users_with_ssh_keys cache has.
+	const rsaKey = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDsbdC8tih2bTYV5Xl4XvYzpH6vePrgByTxevAu6jq9fwLmyY2sBaEtFkd1B1+jL/BVNmhMFohZYXR5dl47pPQSkPdZWIgrElDLkaZt1/R7RaiXjfIPncfVayaEHLoecL4r5yYCq94UeXZW0+12OB6BFN9eW6Sg7mdWW84wejqqpKXDEgu3UXhnkmd+JTu8Md8ZRQ6XocLQJKqVw/JxdZFZt/XLrm4/YCqpqB3GTM1KWlyoQQ5/hZRo2MsKS+nX9xWDHyh4vHG3RjUGd++dbd1KxDkEvinJI08V1xQJs9ppHsajtU9opgzg7Pd8vsDKEQty3wZeBAouV8o15hIqPsPd rsa@example.com"
+
+	tests := map[string]struct {
+		args          []string
+		stdin         string
+		throughDaemon bool
+
+		wantErr bool
+	}{
+		"list keys": {args: []string{"list", "--name", "myuser@domain.com"}},
+		"list keys of user with unnormalized name": {args: []string{"list", "--name", "MyUser@Domain.COM"}},
+		"list keys of user without keys":           {args: []string{"list", "--name", "user@otherdomain.com"}},
+		"list keys through aad-authd":              {args: []string{"list", "--name", "myuser@domain.com"}, throughDaemon: true},
+		"add key":                                  {args: []string{"add", "--name", "myuser@domain.com", rsaKey}},
+		"add keys from stdin":                      {args: []string{"add", "--name", "user@otherdomain.com"}, stdin: "# my keys\n" + rsaKey + "\n\nssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDnJ5xSY/GA53Oo4wEaJBbX8oZ/DeLeQ+yRxkmQ1U4bf a@example.com\n"},
+		"add keys from stdin with dash":            {args: []string{"add", "--name", "user@otherdomain.com", "-"}, stdin: rsaKey},
+		"add key through aad-authd":                {args: []string{"add", "--name", "myuser@domain.com", rsaKey}, throughDaemon: true},
+		"remove key by fingerprint":                {args: []string{"remove", "--name", "myuser@domain.com", "SHA256:sXtXL1f98zioUEWe6RbqRYzwCYwEULcS62c0XIYaIvc"}},
+		"remove key":                               {args: []string{"remove", "--name", "myuser@domain.com", "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDnJ5xSY/GA53Oo4wEaJBbX8oZ/DeLeQ+yRxkmQ1U4bf"}},
+
+		// error cases
+		"error on list keys of unknown user":    {args: []string{"list", "--name", "nouser@domain.com"}, wantErr: true},
+		"error on add invalid key":              {args: []string{"add", "--name", "myuser@domain.com", "ssh-ed25519 notbase64"}, wantErr: true},
+		"error on add key already added":        {args: []string{"add", "--name", "myuser@domain.com", "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDnJ5xSY/GA53Oo4wEaJBbX8oZ/DeLeQ+yRxkmQ1U4bf"}, wantErr: true},
+		"error on add without key on stdin":     {args: []string{"add", "--name", "myuser@domain.com"}, stdin: "# no key\n", wantErr: true},
+		"error on add key to unknown user":      {args: []string{"add", "--name", "nouser@domain.com", rsaKey}, wantErr: true},
+		"error on remove key not added":         {args: []string{"remove", "--name", "myuser@domain.com", rsaKey}, wantErr: true},
+		"error on remove without key":           {args: []string{"remove", "--name", "myuser@domain.com"}, wantErr: true},
+		"error on list keys of invalid name":    {args: []string{"list", "--name", "my:user@domain.com"}, wantErr: true},
+		"error on remove key through aad-authd": {args: []string{"remove", "--name", "myuser@domain.com", rsaKey}, throughDaemon: true, wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_with_ssh_keys")
+			// The app closes the cache it operates on: each one has its own.
+			newApp := func() *cli.App {
+				return cli.New(cli.WithCache(testutils.NewCacheForTests(t, cacheDir)), cli.WithConfigFile(filepath.Join("testdata", "aad.conf")))
+			}
+			c := newApp()
+			if tc.throughDaemon {
+				socket := testutils.TempSocketPath(t)
+				testutils.StartDaemon(t, socket, testutils.CacheOptionsForTests(t, cacheDir))
+				c = cli.New(cli.WithSocketPath(socket), cli.WithConfigFile(filepath.Join("testdata", "aad.conf")))
+			}
+
+			if tc.stdin != "" {
+				r, w, err := os.Pipe()
+				require.NoError(t, err, "Setup: pipe shouldn't fail")
+				_, err = w.WriteString(tc.stdin)
+				require.NoError(t, err, "Setup: writing to stdin shouldn't fail")
+				w.Close()
+				orig := os.Stdin
+				os.Stdin = r
+				t.Cleanup(func() { os.Stdin = orig })
+			}
+
+			got, err := testutils.RunApp(t, c, append([]string{"user", "ssh-keys"}, tc.args...)...)
+			if tc.wantErr {
+				require.Error(t, err, "user ssh-keys should have failed")
+				return
+			}
+			require.NoError(t, err, "user ssh-keys should succeed")
+
+			// Print the keys of the user after the change.
+			if tc.args[0] != "list" {
+				listed, err := testutils.RunApp(t, newApp(), "user", "ssh-keys", "list", "--name", tc.args[2])
+				require.NoError(t, err, "Setup: user ssh-keys list should succeed")
+				got += listed
+			}
+
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "user ssh-keys should print the expected output")
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/config"
+	"github.com/ubuntu/aad-auth/internal/sudoers"
+)
+
+func (a *App) installSudoers() {
+	cmd := &cobra.Command{
+		Use:   "sudoers",
+		Short: "Manage the sudo rules of Azure AD users",
+		Long: fmt.Sprintf(`Manage the sudo rules of Azure AD users
+
+The [sudo:domain] sections of the configuration map the Azure AD groups of the domain, prefixed with %%, and its
+users, named without it, to the commands they can run with sudo. Rules are granted to the groups and users of the
+cache, and installed in %s.`, a.options.sudoersPath),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error { return cmd.Usage() },
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the sudo rules granted to the groups and users of the cache",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rules, err := a.sudoRules()
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(sudoers.Render(rules)))
+			return nil
+		},
+	}
+	cmd.AddCommand(showCmd)
+
+	updateCmd := &cobra.Command{
+		Use:   "update",
+		Short: "Install the sudo rules granted to the groups and users of the cache",
+		Long: fmt.Sprintf(`Install the sudo rules granted to the groups and users of the cache
+
+The rules are checked with visudo -c before replacing %s, which is removed if there is no rule.
+This is run by the aad-sudoers systemd path unit whenever the cache changes, and requires root privileges.`, a.options.sudoersPath),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rules, err := a.sudoRules()
+			if err != nil {
+				return err
+			}
+			changed, err := sudoers.Update(a.ctx, rules, sudoers.WithPath(a.options.sudoersPath), sudoers.WithVisudoCmd(a.options.visudoCmd))
+			if err != nil {
+				return err
+			}
+			if changed {
+				fmt.Printf("Installed %d sudo rules in %s.\n", len(rules), a.options.sudoersPath)
+			}
+			return nil
+		},
+	}
+	cmd.AddCommand(updateCmd)
+
+	a.rootCmd.AddCommand(cmd)
+}
+
+// sudoRules returns the rules of the configuration granted to the groups with members and the users of the cache,
+// sorted by config.SortSudoRules.
+func (a *App) sudoRules() (rules []config.SudoRule, err error) {
+	cfg, err := config.Parse(a.ctx, a.options.configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c := a.options.cache
+	if c == nil {
+		if c, err = cache.New(a.ctx); err != nil {
+			return nil, err
+		}
+		defer c.Close(a.ctx)
+	}
+
+	logins, err := c.GetAllUserNames(a.ctx)
+	if err != nil {
+		return nil, err
+	}
+	inCache := make(map[string]bool)
+	for _, login := range logins {
+		inCache[login] = true
+	}
+
+	// Rules are loaded once per domain, and only granted to the groups and users which are in the cache.
+	// Guest users are named without domain, so no rule applies to them.
+	domainRules := make(map[string][]config.SudoRule)
+	for _, login := range logins {
+		_, domain, found := strings.Cut(login, "@")
+		if !found {
+			continue
+		}
+		if _, loaded := domainRules[domain]; loaded {
+			continue
+		}
+		if domainRules[domain], err = cfg.SudoRules(domain); err != nil {
+			return nil, err
+		}
+		for _, r := range domainRules[domain] {
+			if r.Group == "" {
+				if inCache[r.Login] {
+					rules = append(rules, r)
+				}
+				continue
+			}
+			// Groups without member are not returned by the cache.
+			if _, err := c.GetGroupByName(a.ctx, r.Group); errors.Is(err, cache.ErrNoEnt) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			rules = append(rules, r)
+		}
+	}
+	config.SortSudoRules(rules)
+
+	return rules, nil
+}
@@ -0,0 +1,106 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/cmd/aad-cli/cli"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+func TestSudoersShow(t *testing.T) {
+	tests := map[string]struct {
+		initialCache string
+		configFile   string
+
+		wantErr bool
+	}{
+		"rules of the groups and users in cache": {initialCache: "users_with_groups"},
+		"rules of the users in cache":            {initialCache: "users_in_db"},
+		"no rule without user in cache":          {initialCache: "empty"},
+		"no rule without sudo section":           {initialCache: "users_in_db", configFile: "aad.conf"},
+
+		// error cases
+		"error on invalid configuration": {initialCache: "users_in_db", configFile: "nonexistent.conf", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			if tc.configFile == "" {
+				tc.configFile = "sudo-rules.conf"
+			}
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, tc.initialCache)
+			c := cli.New(cli.WithCache(testutils.NewCacheForTests(t, cacheDir)),
+				cli.WithConfigFile(filepath.Join("testdata", tc.configFile)))
+
+			got, err := testutils.RunApp(t, c, "sudoers", "show")
+			if tc.wantErr {
+				require.Error(t, err, "sudoers show should have failed")
+				return
+			}
+			require.NoError(t, err, "sudoers show should succeed")
+
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "sudoers show should print the rules of the users in cache")
+		})
+	}
+}
+
+func TestSudoersUpdate(t *testing.T) {
+	tests := map[string]struct {
+		visudoCmd string
+		twice     bool
+
+		wantErr bool
+	}{
+		"install rules":                 {},
+		"nothing printed if up to date": {twice: true},
+
+		// error cases
+		"error on rules rejected by visudo": {visudoCmd: "false", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			if tc.visudoCmd == "" {
+				tc.visudoCmd = "true"
+			}
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+			sudoersPath := filepath.Join(t.TempDir(), "aad")
+			newApp := func() *cli.App {
+				return cli.New(cli.WithCache(testutils.NewCacheForTests(t, cacheDir)),
+					cli.WithConfigFile(filepath.Join("testdata", "sudo-rules.conf")),
+					cli.WithSudoersPath(sudoersPath),
+					cli.WithVisudoCmd(tc.visudoCmd))
+			}
+
+			if tc.twice {
+				_, err := testutils.RunApp(t, newApp(), "sudoers", "update")
+				require.NoError(t, err, "Setup: first sudoers update should succeed")
+			}
+			got, err := testutils.RunApp(t, newApp(), "sudoers", "update")
+			if tc.wantErr {
+				require.Error(t, err, "sudoers update should have failed")
+				_, err = os.Stat(sudoersPath)
+				require.ErrorIs(t, err, os.ErrNotExist, "Rejected rules should not be installed")
+				return
+			}
+			require.NoError(t, err, "sudoers update should succeed")
+			got = strings.ReplaceAll(got, sudoersPath, "SUDOERS_PATH")
+
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "sudoers update should print whether rules were installed")
+
+			rules, err := os.ReadFile(sudoersPath)
+			require.NoError(t, err, "sudoers update should have installed the rules")
+			require.Contains(t, string(rules), `"myuser@domain.com" ALL=(ALL:ALL) ALL`, "sudoers update should have installed the rules")
+		})
+	}
+}
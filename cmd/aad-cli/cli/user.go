@@ -2,6 +2,7 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -11,6 +12,8 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/config"
+	"github.com/ubuntu/aad-auth/internal/daemon"
 	"github.com/ubuntu/aad-auth/internal/i18n"
 	"github.com/ubuntu/aad-auth/internal/logger"
 	"github.com/ubuntu/aad-auth/internal/user"
@@ -30,7 +33,11 @@ When called without arguments, this command will retrieve the cache record for t
 Specific values can be retrieved by passing an attribute name.
 Values can be set by passing an attribute name and a value.
 
-Currently the only modifiable attributes are: %s.`, strings.Join(cache.PasswdUpdateAttributes, ", ")),
+Currently the only modifiable attributes are: %s.
+Setting gecos stops it from being refreshed from the ID token on the next logins. Set it empty to restore the refresh.
+Modifying attributes requires root privileges. When aad-authd is running, users can also change the shell, to one
+listed in /etc/shells, and the gecos of their own account, like with chsh and chfn:
+    aad-cli user shell /bin/zsh`, strings.Join(cache.PasswdUpdateAttributes, ", ")),
 		Args: cobra.MaximumNArgs(2),
 		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 			switch len(args) {
@@ -52,7 +59,7 @@ Currently the only modifiable attributes are: %s.`, strings.Join(cache.PasswdUpd
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			c, err := a.getCache()
+			c, err := a.getCache(nil)
 			if err != nil {
 				return err
 			}
@@ -61,6 +68,10 @@ Currently the only modifiable attributes are: %s.`, strings.Join(cache.PasswdUpd
 			allUsers, _ := cmd.Flags().GetBool("all")
 			moveHome, _ := cmd.Flags().GetBool("move-home")
 
+			if username, err = a.posixName(username); err != nil {
+				return err
+			}
+
 			return runUser(a.ctx, args, c, a.options.procFs, username, allUsers, moveHome)
 		},
 	}
@@ -77,12 +88,14 @@ Currently the only modifiable attributes are: %s.`, strings.Join(cache.PasswdUpd
 		logger.Warn(a.ctx, "Unable to register completion for user command: %v", err)
 	}
 
+	cmd.AddCommand(a.sshKeysCmd())
+
 	a.rootCmd.AddCommand(cmd)
 }
 
 // completeWithAvailableUsers returns a list of users available in the local cache.
 func (a App) completeWithAvailableUsers() ([]string, cobra.ShellCompDirective) {
-	c, err := a.getCache()
+	c, err := a.getCache(nil)
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveNoFileComp
 	}
@@ -96,14 +109,40 @@ func (a App) completeWithAvailableUsers() ([]string, cobra.ShellCompDirective) {
 	return users, cobra.ShellCompDirectiveNoFileComp
 }
 
-// getCache returns the cache, either from the options field if overridden or
-// a newly created one.
-func (a *App) getCache() (*cache.Cache, error) {
+// userCache is the cache aad-cli operates on: the aad-authd daemon if it is running, or the cache databases otherwise.
+type userCache interface {
+	GetUserByName(ctx context.Context, username string) (cache.UserRecord, error)
+	GetAllUserNames(ctx context.Context) ([]string, error)
+	QueryPasswdAttribute(ctx context.Context, login, attr string) (any, error)
+	UpdateUserAttribute(ctx context.Context, login, attr string, value any) error
+	ShadowReadable() bool
+	CanAuthenticate(ctx context.Context, username, password string) error
+	OfflineCredentialsExpiry(ctx context.Context, username string) (time.Time, error)
+	Revoke(ctx context.Context, username, upn, reason string) error
+	Revocation(ctx context.Context, username string) (cache.RevocationRecord, error)
+	LoginHistory(ctx context.Context, username string) (cache.LoginHistory, error)
+	AddSSHKey(ctx context.Context, username, key string) (cache.SSHKey, error)
+	RemoveSSHKey(ctx context.Context, username, key string) error
+	SSHKeys(ctx context.Context, username string) ([]cache.SSHKey, error)
+	AuthorizedKeys(ctx context.Context, username string) ([]cache.SSHKey, error)
+	Update(ctx context.Context, username, password, homeDirPattern, shell string, opts ...cache.UpdateOption) error
+	Close(ctx context.Context) error
+}
+
+// getCache returns the cache, either from the options field if overridden, the aad-authd daemon if it is running
+// or a newly created one with the given options. daemonOpts are the equivalent of opts for the daemon.
+func (a *App) getCache(daemonOpts []daemon.ClientOption, opts ...cache.Option) (userCache, error) {
 	if a.options.cache != nil {
 		return a.options.cache, nil
 	}
 
-	return cache.New(a.ctx)
+	c, err := daemon.Dial(a.ctx, a.options.socketPath, daemonOpts...)
+	if err == nil {
+		return c, nil
+	}
+	logger.Debug(a.ctx, "Accessing the cache directly: %v", err)
+
+	return cache.New(a.ctx, opts...)
 }
 
 // getDefaultUser returns the current user name or a blank string if an error occurs.
@@ -116,8 +155,20 @@ func getDefaultUser() string {
 	return u.Username
 }
 
+// posixName returns the name username is known as in the cache.
+// The user name normalisation configuration is used if it can be loaded, and the defaults otherwise.
+func (a *App) posixName(username string) (string, error) {
+	var n config.NameNormalization
+	if cfg, err := config.Parse(a.ctx, a.options.configFile); err != nil {
+		logger.Debug(a.ctx, "Using default user name normalisation: %v", err)
+	} else {
+		n = cfg.NameNormalization
+	}
+	return user.PosixName(username, n.UserOptions()...)
+}
+
 // runUser executes a specific user action based on the arguments passed to the command.
-func runUser(ctx context.Context, args []string, c *cache.Cache, procFs, username string, allUsers bool, moveHome bool) error {
+func runUser(ctx context.Context, args []string, c userCache, procFs, username string, allUsers bool, moveHome bool) error {
 	var err error
 	var key string
 	var value any
@@ -133,6 +184,9 @@ func runUser(ctx context.Context, args []string, c *cache.Cache, procFs, usernam
 			var user cache.UserRecord
 			user, err = c.GetUserByName(ctx, username)
 			value, _ = user.IniString()
+			if err == nil {
+				value = fmt.Sprint(value) + revocationIniString(ctx, c, username) + loginHistoryIniString(ctx, c, username)
+			}
 		}
 	case 1:
 		// Return the value for the given key
@@ -174,9 +228,48 @@ func runUser(ctx context.Context, args []string, c *cache.Cache, procFs, usernam
 	return nil
 }
 
+// revocationIniString returns the ini section describing why the offline credentials of username were revoked, or an
+// empty string if they are not revoked or if the peer can't read it.
+func revocationIniString(ctx context.Context, c userCache, username string) string {
+	if !c.ShadowReadable() {
+		return ""
+	}
+	r, err := c.Revocation(ctx, username)
+	if err != nil {
+		if !errors.Is(err, cache.ErrNoEnt) {
+			logger.Warn(ctx, "Can't check if offline credentials of %q are revoked: %v", username, err)
+		}
+		return ""
+	}
+	s, err := r.IniString()
+	if err != nil {
+		return ""
+	}
+	return "\n[revocation]\n" + s
+}
+
+// loginHistoryIniString returns the ini section describing the sessions opened by username, or an empty string if it
+// can't be read, like the history of other users by unprivileged ones. It is stored in the shadow database, which
+// only aad-authd reads for the users themselves.
+func loginHistoryIniString(ctx context.Context, c userCache, username string) string {
+	h, err := c.LoginHistory(ctx, username)
+	if errors.Is(err, daemon.ErrPermissionDenied) || (err != nil && !c.ShadowReadable()) {
+		logger.Debug(ctx, "Not showing login history of %q: %v", username, err)
+		return ""
+	} else if err != nil {
+		logger.Warn(ctx, "Can't get login history of %q: %v", username, err)
+		return ""
+	}
+	s, err := h.IniString()
+	if err != nil {
+		return ""
+	}
+	return "\n[login_history]\n" + s
+}
+
 // updateUserAttribute updates the given attribute for an user to the specified value.
 // For some attributes such as home, additional actions are performed.
-func updateUserAttribute(ctx context.Context, c *cache.Cache, procFs, username, key string, value any, moveHome bool) (err error) {
+func updateUserAttribute(ctx context.Context, c userCache, procFs, username, key string, value any, moveHome bool) (err error) {
 	defer decorate.OnError(&err, i18n.G("couldn't update attribute"))
 
 	prevValue, err := c.QueryPasswdAttribute(ctx, username, key)
@@ -184,7 +277,8 @@ func updateUserAttribute(ctx context.Context, c *cache.Cache, procFs, username,
 		return err
 	}
 
-	if prevValue == value {
+	// Setting the GECOS field to its current value still pins it.
+	if prevValue == value && key != "gecos" {
 		logger.Debug(ctx, "No change to %q for %s", key, username)
 		return nil
 	}
@@ -52,7 +52,9 @@ func TestUserShellCompletion(t *testing.T) {
 func TestUser(t *testing.T) {
 	tests := map[string]struct {
 		args               string
+		cacheDB            string
 		shadowNotAvailable bool
+		throughDaemon      bool
 
 		wantErr bool
 	}{
@@ -70,10 +72,29 @@ func TestUser(t *testing.T) {
 		"get last_online_auth": {args: "--name myuser@domain.com last_online_auth"},
 		"get shadow_password":  {args: "--name myuser@domain.com shadow_password"},
 
+		"get user with unnormalized name": {args: "--name MyUser@Domain.COM login"},
+
+		"get user with login history":                       {args: "--name myuser@domain.com", cacheDB: "users_with_login_history"},
+		"get user who never logged in":                      {args: "--name otheruser@domain.com", cacheDB: "users_with_login_history"},
+		"get user with login history, shadow not available": {args: "--name myuser@domain.com", cacheDB: "users_with_login_history", shadowNotAvailable: true},
+		"get user with login history through aad-authd":     {args: "--name myuser@domain.com", cacheDB: "users_with_login_history", throughDaemon: true},
+
+		"get revoked user":                       {args: "--name myuser@domain.com", cacheDB: "users_with_revoked_user"},
+		"get revoked user, shadow not available": {args: "--name myuser@domain.com", cacheDB: "users_with_revoked_user", shadowNotAvailable: true},
+		"get revoked user through aad-authd":     {args: "--name myuser@domain.com", cacheDB: "users_with_revoked_user", throughDaemon: true},
+
+		"get all users through aad-authd":        {args: "--all", throughDaemon: true},
+		"get user through aad-authd":             {args: "--name myuser@domain.com", throughDaemon: true},
+		"get uid through aad-authd":              {args: "--name myuser@domain.com uid", throughDaemon: true},
+		"get shadow_password through aad-authd":  {args: "--name myuser@domain.com shadow_password", throughDaemon: true},
+		"get last_online_auth through aad-authd": {args: "--name myuser@domain.com last_online_auth", throughDaemon: true},
+
 		// error cases
 		"get nonexistent user":                      {args: "--name nouser@domain.com", wantErr: true},
 		"get bad_attribute":                         {args: "--name myuser@domain.com bad_attribute", wantErr: true},
+		"get last_login, not a passwd attribute":    {args: "--name myuser@domain.com last_login", cacheDB: "users_with_login_history", wantErr: true},
 		"get shadow_password, shadow not available": {args: "--name myuser@domain.com shadow_password", shadowNotAvailable: true, wantErr: true},
+		"get nonexistent user through aad-authd":    {args: "--name nouser@domain.com", throughDaemon: true, wantErr: true},
 	}
 	for name, tc := range tests {
 		tc := tc
@@ -82,8 +103,10 @@ func TestUser(t *testing.T) {
 			args = append(args, strings.Split(tc.args, " ")...)
 
 			cacheDir := t.TempDir()
-			cacheDB := "users_in_db"
-			testutils.PrepareDBsForTests(t, cacheDir, cacheDB)
+			if tc.cacheDB == "" {
+				tc.cacheDB = "users_in_db"
+			}
+			testutils.PrepareDBsForTests(t, cacheDir, tc.cacheDB)
 
 			shadowMode := -1
 			if tc.shadowNotAvailable {
@@ -91,6 +114,11 @@ func TestUser(t *testing.T) {
 			}
 			cache := testutils.NewCacheForTests(t, cacheDir, cache.WithShadowMode(shadowMode))
 			c := cli.New(cli.WithCache(cache))
+			if tc.throughDaemon {
+				socket := testutils.TempSocketPath(t)
+				testutils.StartDaemon(t, socket, testutils.CacheOptionsForTests(t, cacheDir))
+				c = cli.New(cli.WithSocketPath(socket))
+			}
 
 			got, err := testutils.RunApp(t, c, args...)
 			if tc.wantErr {
@@ -100,7 +128,7 @@ func TestUser(t *testing.T) {
 			require.NoError(t, err, "expected command to succeed")
 
 			if slices.Contains(args, "--name") {
-				username := args[slices.Index(args, "--name")+1]
+				username := strings.ToLower(args[slices.Index(args, "--name")+1])
 				user, err := cache.GetUserByName(context.Background(), username)
 				require.NoError(t, err, "Setup: failed to get user from cache")
 
@@ -110,6 +138,8 @@ func TestUser(t *testing.T) {
 				}
 
 				got = testutils.TimestampToWildcard(t, got, user.LastOnlineAuth)
+				got = testutils.TimestampToWildcard(t, got, time.Unix(1700000000, 0))
+				got = testutils.TimestampToWildcard(t, got, time.Unix(1700086400, 0))
 			}
 			want := testutils.LoadWithUpdateFromGolden(t, got)
 			require.Equal(t, want, got, "expected output to match golden file")
@@ -183,6 +213,34 @@ func TestUserSetAttribute(t *testing.T) {
 	}
 }
 
+func TestUserSetGECOSPinsIt(t *testing.T) {
+	tests := map[string]struct {
+		value string
+
+		wantPinned int64
+	}{
+		"new value pins it":     {value: "newvalue", wantPinned: 1},
+		"current value pins it": {value: "My User", wantPinned: 1},
+		"empty value unpins it": {value: ""},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+			cache := testutils.NewCacheForTests(t, cacheDir)
+			c := cli.New(cli.WithCache(cache))
+
+			_, err := testutils.RunApp(t, c, "user", "--name", "myuser@domain.com", "gecos", tc.value)
+			require.NoError(t, err, "expected command to succeed")
+
+			got, err := cache.QueryPasswdAttribute(context.Background(), "myuser@domain.com", "gecos_pinned")
+			require.NoError(t, err, "Setup: failed to query gecos_pinned")
+			require.Equal(t, tc.wantPinned, got, "GECOS should be pinned when set by an administrator")
+		})
+	}
+}
+
 func TestUserMoveHomeDirectory(t *testing.T) {
 	tests := map[string]struct {
 		prevHomeDir  string
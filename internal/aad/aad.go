@@ -7,11 +7,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
 
 	msalErrors "github.com/AzureAD/microsoft-authentication-library-for-go/apps/errors"
 	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/public"
 	"github.com/ubuntu/aad-auth/internal/config"
 	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/aad-auth/internal/user"
 )
 
 const (
@@ -22,6 +27,15 @@ const (
 	noSuchUserCode     = 50034
 	noConsentCode      = 65001
 	noClientSecretCode = 7000218
+
+	passwordExpiredCode          = 50055
+	onPremPasswordExpiredCode    = 50144
+	accountLockedCode            = 50053
+	accountDisabledCode          = 50057
+	notAssignedToAppCode         = 50105
+	conditionalAccessBlockedCode = 53003
+	deviceNotCompliantCode       = 53000
+	deviceNotDomainJoinedCode    = 53001
 )
 
 var (
@@ -29,8 +43,66 @@ var (
 	ErrNoNetwork = errors.New("NO NETWORK")
 	// ErrDeny is returned in case of denial returned by AAD.
 	ErrDeny = errors.New("DENY")
+	// ErrInvalidCredentials is returned when the password of the user is wrong. It matches ErrDeny with errors.Is.
+	ErrInvalidCredentials = fmt.Errorf("INVALID CREDENTIALS: %w", ErrDeny)
+	// ErrNoSuchUser is returned when the user doesn't exist in the tenant. It matches ErrDeny with errors.Is.
+	ErrNoSuchUser = fmt.Errorf("NO SUCH USER: %w", ErrDeny)
+	// ErrInvalidClaims is returned when the ID token was not issued by the configured tenant, or for another user.
+	// It matches ErrDeny with errors.Is.
+	ErrInvalidClaims = fmt.Errorf("INVALID ID TOKEN CLAIMS: %w", ErrDeny)
+
+	// ErrPasswordExpired is returned when the password of the user expired and must be changed.
+	ErrPasswordExpired = &AccountError{msg: "PASSWORD EXPIRED"}
+	// ErrAccountLocked is returned when the account is locked after too many failed sign-in attempts.
+	ErrAccountLocked = &AccountError{msg: "ACCOUNT LOCKED"}
+	// ErrAccountDisabled is returned when the account has been disabled by an administrator.
+	ErrAccountDisabled = &AccountError{msg: "ACCOUNT DISABLED"}
+	// ErrNotAssignedToApp is returned when the user is not assigned to the Azure AD application.
+	ErrNotAssignedToApp = &AccountError{msg: "NOT ASSIGNED TO APPLICATION"}
+	// ErrConditionalAccess is returned when the sign-in is blocked by a Conditional Access policy.
+	ErrConditionalAccess = &AccountError{msg: "BLOCKED BY CONDITIONAL ACCESS"}
 )
 
+// AccountError is a denial returned by AAD because of the state of the account, rather than of the credentials.
+// All account errors match ErrDeny with errors.Is.
+type AccountError struct {
+	msg string
+}
+
+// Error returns the description of the account error.
+func (e *AccountError) Error() string {
+	return e.msg
+}
+
+// Is makes account errors match ErrDeny.
+func (e *AccountError) Is(target error) bool {
+	return target == ErrDeny
+}
+
+// DefinitiveDenial returns why the user was denied if err means they won't be able to authenticate until their account
+// is restored in Azure AD, so that their offline credentials can be revoked.
+func DefinitiveDenial(err error) (reason string, ok bool) {
+	switch {
+	case errors.Is(err, ErrNoSuchUser):
+		return "the user doesn't exist in Azure AD", true
+	case errors.Is(err, ErrAccountDisabled):
+		return "the account is disabled in Azure AD", true
+	}
+	return "", false
+}
+
+// accountErrors maps the AAD error codes related to the account state to their error.
+var accountErrors = map[int]error{
+	passwordExpiredCode:          ErrPasswordExpired,
+	onPremPasswordExpiredCode:    ErrPasswordExpired,
+	accountLockedCode:            ErrAccountLocked,
+	accountDisabledCode:          ErrAccountDisabled,
+	notAssignedToAppCode:         ErrNotAssignedToApp,
+	conditionalAccessBlockedCode: ErrConditionalAccess,
+	deviceNotCompliantCode:       ErrConditionalAccess,
+	deviceNotDomainJoinedCode:    ErrConditionalAccess,
+}
+
 type aadErr struct {
 	ErrorCodes []int `json:"error_codes"`
 }
@@ -39,13 +111,95 @@ type publicClient interface {
 	AcquireTokenByUsernamePassword(ctx context.Context, scopes []string, username string, password string, opts ...public.AcquireByUsernamePasswordOption) (public.AuthResult, error)
 }
 
+// UserInfo holds the information about the user returned by Azure AD on successful authentication.
+type UserInfo struct {
+	// ObjectID is the immutable identifier of the user in the tenant. It is empty if no ID token was returned.
+	ObjectID string
+	// UPN is the user principal name of the user in the ID token, normalized as user names are. It differs from
+	// the name the user authenticated with for aliases and proxy addresses, and is empty if no ID token was returned.
+	UPN string
+	// Claims are the string claims of the ID token, like name or upn, by claim name.
+	Claims map[string]string
+	// Groups are the values of the groups claim of the ID token: the Azure AD groups of the user, named as configured
+	// for the application. They are nil if the ID token has no groups claim, like when the application doesn't emit
+	// it or when the user is in too many groups for the token.
+	Groups []string
+}
+
+// GECOS returns the GECOS field filled with the values of claims, one per comma separated subfield.
+// Empty claim names, and claims missing from the ID token, leave their subfield empty. Characters which can't be stored
+// in a subfield are replaced with spaces. It returns an empty string if none of the claims has a value.
+func (u UserInfo) GECOS(claims []string) string {
+	var fields []string
+	for _, claim := range claims {
+		fields = append(fields, sanitizeGECOSField(u.Claims[claim]))
+	}
+	// Trailing empty subfields are omitted, as chfn does.
+	for len(fields) > 0 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return strings.Join(fields, ",")
+}
+
+// sanitizeGECOSField replaces the separators of the passwd entry and its GECOS field, and control characters, with
+// spaces, and collapses consecutive spaces.
+func sanitizeGECOSField(v string) string {
+	v = strings.Map(func(r rune) rune {
+		if r == ':' || r == ',' || unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, v)
+	return strings.Join(strings.Fields(v), " ")
+}
+
+// idTokenClaims returns the string claims of the ID token of res.
+func idTokenClaims(res public.AuthResult) map[string]string {
+	claims := make(map[string]string)
+	for k, v := range res.IDToken.AdditionalFields {
+		if s, ok := v.(string); ok {
+			claims[k] = s
+		}
+	}
+	for k, v := range map[string]string{
+		"name":               res.IDToken.Name,
+		"given_name":         res.IDToken.GivenName,
+		"family_name":        res.IDToken.FamilyName,
+		"middle_name":        res.IDToken.MiddleName,
+		"preferred_username": res.IDToken.PreferredUsername,
+		"upn":                res.IDToken.UPN,
+		"email":              res.IDToken.Email,
+	} {
+		if v != "" {
+			claims[k] = v
+		}
+	}
+	return claims
+}
+
+// idTokenGroups returns the groups claim of the ID token of res, or nil if it has none.
+func idTokenGroups(res public.AuthResult) []string {
+	values, ok := res.IDToken.AdditionalFields["groups"].([]interface{})
+	if !ok {
+		return nil
+	}
+	groups := []string{}
+	for _, v := range values {
+		if s, ok := v.(string); ok && s != "" {
+			groups = append(groups, s)
+		}
+	}
+	return groups
+}
+
 // AAD holds the authentication mechanism (real or mock).
 type AAD struct {
-	newPublicClient func(clientID string, options ...public.Option) (publicClient, error)
+	newPublicClient func(clientID, authority string) (publicClient, error)
 }
 
 // Authenticate tries to authenticate username against AAD.
-func (auth AAD) Authenticate(ctx context.Context, cfg config.AAD, username, password string) error {
+// On success, it returns the information about the user contained in the ID token.
+func (auth AAD) Authenticate(ctx context.Context, cfg config.AAD, username, password string) (UserInfo, error) {
 	authority := fmt.Sprintf("%s/%s", endpoint, cfg.TenantID)
 	logger.Debug(ctx, "Connecting to %q, with clientID %q for user %q", authority, cfg.AppID, username)
 
@@ -54,50 +208,59 @@ func (auth AAD) Authenticate(ctx context.Context, cfg config.AAD, username, pass
 	}
 
 	// Get client from network
-	app, errAcquireToken := auth.newPublicClient(cfg.AppID, public.WithAuthority(authority))
+	app, errAcquireToken := auth.newPublicClient(cfg.AppID, authority)
 	if errAcquireToken != nil {
 		logger.Err(ctx, "Connection to authority failed: %v", errAcquireToken)
-		return ErrNoNetwork
+		return UserInfo{}, ErrNoNetwork
 	}
 
 	// Authentify the user
-	_, errAcquireToken = app.AcquireTokenByUsernamePassword(ctx, []string{"openid", "profile"}, username, password)
+	res, errAcquireToken := app.AcquireTokenByUsernamePassword(ctx, []string{"openid", "profile"}, username, password)
 
 	var callErr msalErrors.CallErr
 	if errors.As(errAcquireToken, &callErr) {
 		data, err := io.ReadAll(callErr.Resp.Body)
 		if err != nil {
 			logger.Err(ctx, "Can't read server response: %v", err)
-			return ErrDeny
+			return UserInfo{}, ErrDeny
 		}
 		var addErrWithCodes aadErr
 		if err := json.Unmarshal(data, &addErrWithCodes); err != nil {
 			logger.Err(ctx, "Invalid server response, not a json object: %v", err)
-			return ErrDeny
+			return UserInfo{}, ErrDeny
 		}
 		for _, errcode := range addErrWithCodes.ErrorCodes {
 			if errcode == invalidCredCode {
 				logger.Debug(ctx, "Got response: Invalid credentials")
-				return ErrDeny
+				return UserInfo{}, ErrInvalidCredentials
 			}
 			if errcode == noSuchUserCode {
 				logger.Debug(ctx, "Got response: User doesn't exist")
-				return ErrDeny
+				return UserInfo{}, ErrNoSuchUser
 			}
 			if errcode == requiresMFACode {
+				// There is no ID token to validate: only the tenant the credentials were checked by is known.
+				if err := validateTenant(cfg.TenantID); err != nil {
+					logger.Warn(ctx, "Denying authentication of %q requiring MFA: %v", username, err)
+					return UserInfo{}, fmt.Errorf("%w: %v", ErrInvalidClaims, err)
+				}
 				logger.Debug(ctx, "Authentication successful even if requiring MFA")
-				return nil
+				return UserInfo{}, nil
 			}
 			if errcode == noConsentCode {
 				logger.Err(ctx, "Azure AD application requires consent, either from tenant, or from user. "+
 					"If you're a tenant's administrator, go to: %s/adminconsent?client_id=%s",
 					authority, cfg.AppID)
-				return ErrDeny
+				return UserInfo{}, ErrDeny
 			}
 			if errcode == noClientSecretCode {
 				logger.Err(ctx, "Azure AD application requires enabling 'Allow public client flows'. "+
 					"https://learn.microsoft.com/en-us/azure/active-directory/develop/scenario-desktop-app-registration#redirect-uris")
-				return ErrDeny
+				return UserInfo{}, ErrDeny
+			}
+			if err, ok := accountErrors[errcode]; ok {
+				logger.Debug(ctx, "Got response: %v (error code %d)", err, errcode)
+				return UserInfo{}, err
 			}
 		}
 		logger.Err(ctx, "Unknown error code(s) from server: %v", addErrWithCodes.ErrorCodes)
@@ -107,18 +270,72 @@ func (auth AAD) Authenticate(ctx context.Context, cfg config.AAD, username, pass
 			logger.Debug(ctx, "- Error code %d: https://login.microsoftonline.com/error?code=%d", errcode, errcode)
 		}
 
-		return ErrDeny
+		return UserInfo{}, ErrDeny
 	}
 
 	if errAcquireToken != nil {
 		logger.Debug(ctx, "acquiring token failed: %v", errAcquireToken)
-		return ErrNoNetwork
+		return UserInfo{}, ErrNoNetwork
+	}
+
+	upn, err := validateClaims(res, cfg.TenantID, username)
+	if err != nil {
+		logger.Warn(ctx, "Denying ID token of %q: %v", username, err)
+		return UserInfo{}, fmt.Errorf("%w: %v", ErrInvalidClaims, err)
 	}
 
 	logger.Debug(ctx, "Authentication successful with user/password")
+	return UserInfo{ObjectID: res.IDToken.Oid, UPN: upn, Claims: idTokenClaims(res), Groups: idTokenGroups(res)}, nil
+}
+
+// validateTenant checks that tenantID designates a single tenant, so that only its users are authenticated.
+func validateTenant(tenantID string) error {
+	if !config.IsTenant(tenantID) {
+		return fmt.Errorf("%q is neither a tenant ID nor a domain of a tenant", tenantID)
+	}
 	return nil
 }
 
-func publicNewRealClient(clientID string, options ...public.Option) (publicClient, error) {
-	return public.New(clientID, options...)
+// validateClaims checks that the ID token of res was issued by tenantID for username, matching either its upn or
+// its preferred_username claim. It returns the normalized UPN of the token, or preferred_username if it has none.
+// tenantID can be a domain of the tenant, like contoso.onmicrosoft.com: the token was then requested from it, and its
+// tenant ID is checked against its issuer only.
+func validateClaims(res public.AuthResult, tenantID, username string) (upn string, err error) {
+	if err := validateTenant(tenantID); err != nil {
+		return "", err
+	}
+	if !config.IsGUID(tenantID) {
+		tenantID = res.IDToken.TenantID
+	}
+	if !strings.EqualFold(res.IDToken.TenantID, tenantID) {
+		return "", fmt.Errorf("token issued for tenant %q instead of %q", res.IDToken.TenantID, tenantID)
+	}
+	iss, err := url.Parse(res.IDToken.Issuer)
+	if err != nil {
+		return "", fmt.Errorf("invalid issuer %q: %v", res.IDToken.Issuer, err)
+	}
+	if issTenant, _, _ := strings.Cut(strings.TrimPrefix(iss.Path, "/"), "/"); !strings.EqualFold(issTenant, tenantID) {
+		return "", fmt.Errorf("token issued by %q, not by tenant %q", res.IDToken.Issuer, tenantID)
+	}
+
+	username = user.NormalizeName(username)
+	var names []string
+	for _, claim := range []string{res.IDToken.UPN, res.IDToken.PreferredUsername} {
+		if claim != "" && !slices.Contains(names, claim) {
+			names = append(names, claim)
+		}
+	}
+	if len(names) == 0 {
+		return "", errors.New("token doesn't contain the name of the user")
+	}
+	for _, name := range names {
+		if user.NormalizeName(name) == username {
+			return user.NormalizeName(names[0]), nil
+		}
+	}
+	return "", fmt.Errorf("token issued for %s instead of %q", strings.Join(names, " and "), username)
+}
+
+func publicNewRealClient(clientID, authority string) (publicClient, error) {
+	return public.New(clientID, public.WithAuthority(authority))
 }
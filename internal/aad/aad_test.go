@@ -3,6 +3,7 @@ package aad_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -10,17 +11,30 @@ import (
 	"github.com/ubuntu/aad-auth/internal/config"
 )
 
+const mockObjectID = "11111111-2222-3333-4444-555555555555"
+
 func TestAuthenticate(t *testing.T) {
 	t.Parallel()
 
+	mockGroups := []string{"group1", "group2"}
+
 	tests := map[string]struct {
 		appID    string
+		tenantID string
 		username string
 
-		wantErr error
+		wantObjectID string
+		wantName     string
+		wantUPN      string
+		wantGroups   []string
+		wantErr      error
 	}{
-		"can authenticate with password only":     {},
+		"can authenticate with password only":     {wantObjectID: mockObjectID, wantName: "Success User", wantUPN: "success@domain.com", wantGroups: mockGroups},
+		"no groups without groups claim":          {username: "token without groups@domain.com", wantObjectID: mockObjectID, wantName: "Success User", wantUPN: "token without groups@domain.com"},
 		"can authenticate even with mfa required": {username: "requireMFA@domain.com"},
+		"returns the normalized upn of the token": {username: "success@otherdomain.com", wantObjectID: mockObjectID, wantName: "Success User", wantUPN: "success@otherdomain.com", wantGroups: mockGroups},
+		"returns the upn of aliases":              {username: "alias@domain.com", wantObjectID: mockObjectID, wantName: "Success User", wantUPN: "success@domain.com", wantGroups: mockGroups},
+		"can authenticate guest users":            {username: "success_guest.com#ext#@domain.com", wantObjectID: mockObjectID, wantName: "Success User", wantUPN: "success_guest.com#ext#@domain.com", wantGroups: mockGroups},
 
 		// error cases
 		"can't connect to authority": {appID: "connection failed", wantErr: aad.ErrNoNetwork},
@@ -28,14 +42,36 @@ func TestAuthenticate(t *testing.T) {
 		"no tenant-wide consent":     {appID: "no tenant-wide consent", wantErr: aad.ErrDeny},
 		"unreadable server response": {username: "unreadable server response", wantErr: aad.ErrDeny},
 		"invalid server response":    {username: "invalid server response", wantErr: aad.ErrDeny},
-		"invalid credentials":        {username: "invalid credentials", wantErr: aad.ErrDeny},
-		"no such user":               {username: "no such user", wantErr: aad.ErrDeny},
+		"invalid credentials":        {username: "invalid credentials", wantErr: aad.ErrInvalidCredentials},
+		"no such user":               {username: "no such user", wantErr: aad.ErrNoSuchUser},
 		"unknown error code":         {username: "unknown error code", wantErr: aad.ErrDeny},
 		"unknown error type":         {username: "unknown error type", wantErr: aad.ErrNoNetwork},
 
+		// account state error cases
+		"password expired":              {username: "password expired", wantErr: aad.ErrPasswordExpired},
+		"on-premises password expired":  {username: "on-premises password expired", wantErr: aad.ErrPasswordExpired},
+		"account locked":                {username: "account locked", wantErr: aad.ErrAccountLocked},
+		"account disabled":              {username: "account disabled", wantErr: aad.ErrAccountDisabled},
+		"not assigned to application":   {username: "not assigned to application", wantErr: aad.ErrNotAssignedToApp},
+		"blocked by conditional access": {username: "blocked by conditional access", wantErr: aad.ErrConditionalAccess},
+		"device not compliant":          {username: "device not compliant", wantErr: aad.ErrConditionalAccess},
+
 		// multiple error cases
 		"multiple errors, first known (here mfa) wins":                 {username: "multiple errors, first known is mfa", wantErr: nil},
-		"multiple errors, first known (here invalid credentials) wins": {username: "multiple errors, first known is invalid credential", wantErr: aad.ErrDeny},
+		"multiple errors, first known (here invalid credentials) wins": {username: "multiple errors, first known is invalid credential", wantErr: aad.ErrInvalidCredentials},
+
+		// invalid claims
+		"token of another tenant":        {username: "token of another tenant", wantErr: aad.ErrInvalidClaims},
+		"token issued by another tenant": {username: "token issued by another tenant", wantErr: aad.ErrInvalidClaims},
+		"token of another user":          {username: "token of another user", wantErr: aad.ErrInvalidClaims},
+		"token without user name":        {username: "token without user name", wantErr: aad.ErrInvalidClaims},
+
+		// tenants
+		"can authenticate with a tenant domain":          {tenantID: "domain.onmicrosoft.com", wantObjectID: mockObjectID, wantName: "Success User", wantUPN: "success@domain.com", wantGroups: mockGroups},
+		"can authenticate with mfa and a tenant domain":  {tenantID: "domain.onmicrosoft.com", username: "requireMFA@domain.com"},
+		"token issued by another tenant of the domain":   {tenantID: "domain.onmicrosoft.com", username: "token issued by another tenant", wantErr: aad.ErrInvalidClaims},
+		"multi-tenant authority is refused":              {tenantID: "organizations", wantErr: aad.ErrInvalidClaims},
+		"multi-tenant authority is refused even for mfa": {tenantID: "common", username: "requireMFA@domain.com", wantErr: aad.ErrInvalidClaims},
 	}
 	for name, tc := range tests {
 		tc := tc
@@ -45,22 +81,103 @@ func TestAuthenticate(t *testing.T) {
 			if tc.appID == "" {
 				tc.appID = "valid"
 			}
+			if tc.tenantID == "" {
+				tc.tenantID = "aaaaaaaa-aaaa-aaaa-aaaa-aaaaaaaaaaaa"
+			}
 			if tc.username == "" {
 				tc.username = "success@domain.com"
 			}
 
 			auth := aad.NewWithMockClient()
 			cfg := config.AAD{
-				TenantID: "tenant id",
+				TenantID: tc.tenantID,
 				AppID:    tc.appID,
 			}
-			err := auth.Authenticate(context.Background(), cfg, tc.username, "password")
+			got, err := auth.Authenticate(context.Background(), cfg, tc.username, "password")
 			if tc.wantErr != nil {
 				require.Error(t, err)
 				require.True(t, errors.Is(err, tc.wantErr), "Error should be %v", tc.wantErr)
+				if errors.Is(tc.wantErr, aad.ErrDeny) {
+					require.ErrorIs(t, err, aad.ErrDeny, "Account errors should be denials")
+				}
 				return
 			}
 			require.NoError(t, err)
+			require.Equal(t, tc.wantObjectID, got.ObjectID, "Authenticate should return the object ID of the user")
+			require.Equal(t, tc.wantName, got.Claims["name"], "Authenticate should return the claims of the ID token")
+			require.Equal(t, tc.wantUPN, got.UPN, "Authenticate should return the normalized UPN of the ID token")
+			if tc.wantObjectID != "" {
+				require.Equal(t, tc.wantGroups, got.Groups, "Authenticate should return the groups claim of the ID token")
+			}
+		})
+	}
+}
+
+func TestUserInfoGECOS(t *testing.T) {
+	t.Parallel()
+
+	claims := map[string]string{
+		"name":            "Jane Doe",
+		"office":          "Building 1, Room 42",
+		"telephoneNumber": "+1 555 0100",
+		"colon":           "a:b",
+		"control":         "line1\nline2\t ",
+		"empty":           "",
+	}
+
+	tests := map[string]struct {
+		claims []string
+
+		want string
+	}{
+		"full name":                            {claims: []string{"name"}, want: "Jane Doe"},
+		"full name, office and phone":          {claims: []string{"name", "office", "telephoneNumber"}, want: "Jane Doe,Building 1 Room 42,+1 555 0100"},
+		"skipped subfield":                     {claims: []string{"name", "", "telephoneNumber"}, want: "Jane Doe,,+1 555 0100"},
+		"missing claim leaves subfield empty":  {claims: []string{"name", "missing", "telephoneNumber"}, want: "Jane Doe,,+1 555 0100"},
+		"trailing empty subfields are omitted": {claims: []string{"name", "missing", "empty"}, want: "Jane Doe"},
+		"colons are replaced":                  {claims: []string{"colon"}, want: "a b"},
+		"control characters are replaced":      {claims: []string{"control"}, want: "line1 line2"},
+		"no claim has a value":                 {claims: []string{"missing", "empty"}, want: ""},
+		"no claims":                            {want: ""},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := aad.UserInfo{Claims: claims}.GECOS(tc.claims)
+			require.Equal(t, tc.want, got, "GECOS should return the expected field")
+		})
+	}
+}
+
+func TestDefinitiveDenial(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		err error
+
+		want bool
+	}{
+		"user doesn't exist":  {err: aad.ErrNoSuchUser, want: true},
+		"account disabled":    {err: aad.ErrAccountDisabled, want: true},
+		"wrapped denial":      {err: fmt.Errorf("wrapped: %w", aad.ErrAccountDisabled), want: true},
+		"invalid credentials": {err: aad.ErrInvalidCredentials},
+		"account locked":      {err: aad.ErrAccountLocked},
+		"password expired":    {err: aad.ErrPasswordExpired},
+		"no network":          {err: aad.ErrNoNetwork},
+		"no error":            {},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			reason, got := aad.DefinitiveDenial(tc.err)
+			require.Equal(t, tc.want, got, "DefinitiveDenial should report if the denial is definitive")
+			if tc.want {
+				require.NotEmpty(t, reason, "DefinitiveDenial should describe definitive denials")
+			}
 		})
 	}
 }
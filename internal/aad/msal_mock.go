@@ -10,6 +10,7 @@ import (
 
 	msalErrors "github.com/AzureAD/microsoft-authentication-library-for-go/apps/errors"
 	"github.com/AzureAD/microsoft-authentication-library-for-go/apps/public"
+	"github.com/ubuntu/aad-auth/internal/config"
 )
 
 // NewWithMockClient returns a mock AAD client that can be controlled through input for tests.
@@ -19,7 +20,19 @@ func NewWithMockClient() AAD {
 	}
 }
 
-func publicNewMockClient(clientID string, _ ...public.Option) (publicClient, error) {
+// mockObjectID is the object ID of the users successfully authenticated by the mock.
+const mockObjectID = "11111111-2222-3333-4444-555555555555"
+
+// mockName is the display name of the users successfully authenticated by the mock.
+const mockName = "Success User"
+
+// otherTenantID is the tenant of the ID tokens issued by the mock for another tenant.
+const otherTenantID = "00000000-0000-0000-0000-000000000000"
+
+// mockTenantID is the tenant of the ID tokens issued by the mock when the authority is a domain of the tenant.
+const mockTenantID = "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"
+
+func publicNewMockClient(clientID, authority string) (publicClient, error) {
 	var forceOffline bool
 	var publicClientDisallowed bool
 	var noTenantWideConsent bool
@@ -36,6 +49,7 @@ func publicNewMockClient(clientID string, _ ...public.Option) (publicClient, err
 	}
 
 	return publicClientMock{
+		tenantID:               strings.TrimPrefix(authority, endpoint+"/"),
 		forceOffline:           forceOffline,
 		publicClientDisallowed: publicClientDisallowed,
 		noTenantWideConsent:    noTenantWideConsent,
@@ -43,6 +57,7 @@ func publicNewMockClient(clientID string, _ ...public.Option) (publicClient, err
 }
 
 type publicClientMock struct {
+	tenantID               string
 	forceOffline           bool
 	publicClientDisallowed bool
 	noTenantWideConsent    bool
@@ -68,9 +83,37 @@ func (m publicClientMock) AcquireTokenByUsernamePassword(_ context.Context, _ []
 		return r, callErr
 	}
 
+	// ID tokens are issued by the tenant of the authority, for username. Authorities named after a domain are
+	// resolved to mockTenantID.
+	tenantID, issuerTenantID := m.tenantID, m.tenantID
+	if !config.IsGUID(tenantID) {
+		tenantID, issuerTenantID = mockTenantID, mockTenantID
+	}
+	upn, preferredUsername := username, username
+	groups := []interface{}{"group1", "group2"}
+
 	switch username {
 	case "success@domain.com":
 	case "success@otherdomain.com":
+		// Azure AD returns the UPN with its original case.
+		upn, preferredUsername = "Success@OtherDomain.com", "Success@OtherDomain.com"
+	case "success_guest.com#ext#@domain.com":
+		// preferred_username is the external identity of guest users.
+		upn, preferredUsername = "success_guest.com#EXT#@domain.com", "success@guest.com"
+	case "alias@domain.com":
+		// Logging in with an alias or a proxy address returns the UPN of the account.
+		upn = "Success@Domain.com"
+	case "token of another tenant":
+		tenantID, issuerTenantID = otherTenantID, otherTenantID
+	case "token issued by another tenant":
+		issuerTenantID = otherTenantID
+	case "token of another user":
+		upn, preferredUsername = "someoneelse@domain.com", "someoneelse@domain.com"
+	case "token without user name":
+		upn, preferredUsername = "", ""
+	case "token without groups@domain.com":
+		// The groups claim is missing when the application doesn't emit it, or when the user is in too many groups.
+		groups = nil
 	case "requireMFA@domain.com":
 		callErr.Resp.Body = io.NopCloser(strings.NewReader(fmt.Sprintf("{\"error_codes\": [%d]}", requiresMFACode)))
 		return r, callErr
@@ -86,6 +129,27 @@ func (m publicClientMock) AcquireTokenByUsernamePassword(_ context.Context, _ []
 	case "no such user":
 		callErr.Resp.Body = io.NopCloser(strings.NewReader(fmt.Sprintf("{\"error_codes\": [%d]}", noSuchUserCode)))
 		return r, callErr
+	case "password expired":
+		callErr.Resp.Body = io.NopCloser(strings.NewReader(fmt.Sprintf("{\"error_codes\": [%d]}", passwordExpiredCode)))
+		return r, callErr
+	case "on-premises password expired":
+		callErr.Resp.Body = io.NopCloser(strings.NewReader(fmt.Sprintf("{\"error_codes\": [%d]}", onPremPasswordExpiredCode)))
+		return r, callErr
+	case "account locked":
+		callErr.Resp.Body = io.NopCloser(strings.NewReader(fmt.Sprintf("{\"error_codes\": [%d]}", accountLockedCode)))
+		return r, callErr
+	case "account disabled":
+		callErr.Resp.Body = io.NopCloser(strings.NewReader(fmt.Sprintf("{\"error_codes\": [%d]}", accountDisabledCode)))
+		return r, callErr
+	case "not assigned to application":
+		callErr.Resp.Body = io.NopCloser(strings.NewReader(fmt.Sprintf("{\"error_codes\": [%d]}", notAssignedToAppCode)))
+		return r, callErr
+	case "blocked by conditional access":
+		callErr.Resp.Body = io.NopCloser(strings.NewReader(fmt.Sprintf("{\"error_codes\": [%d]}", conditionalAccessBlockedCode)))
+		return r, callErr
+	case "device not compliant":
+		callErr.Resp.Body = io.NopCloser(strings.NewReader(fmt.Sprintf("{\"error_codes\": [%d]}", deviceNotCompliantCode)))
+		return r, callErr
 	case "unknown error code":
 		callErr.Resp.Body = io.NopCloser(strings.NewReader("{\"error_codes\": [4242]}"))
 		return r, callErr
@@ -103,6 +167,19 @@ func (m publicClientMock) AcquireTokenByUsernamePassword(_ context.Context, _ []
 		return r, callErr
 	}
 
+	r.IDToken.Oid = mockObjectID
+	r.IDToken.TenantID = tenantID
+	r.IDToken.Issuer = fmt.Sprintf("%s/%s/v2.0", endpoint, issuerTenantID)
+	r.IDToken.UPN = upn
+	r.IDToken.PreferredUsername = preferredUsername
+	r.IDToken.Name = mockName
+	r.IDToken.AdditionalFields = map[string]interface{}{
+		"physicalDeliveryOfficeName": "Building 1, Room 42",
+		"telephoneNumber":            "+1 555 0100",
+	}
+	if groups != nil {
+		r.IDToken.AdditionalFields["groups"] = groups
+	}
 	return r, nil
 }
 
@@ -11,13 +11,13 @@ import (
 	"os"
 	"os/user"
 	"strconv"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/ubuntu/aad-auth/internal/i18n"
 	"github.com/ubuntu/aad-auth/internal/logger"
+	aaduser "github.com/ubuntu/aad-auth/internal/user"
 	"github.com/ubuntu/decorate"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -29,6 +29,13 @@ var (
 	ErrOfflineCredentialsExpired = errors.New("offline credentials expired")
 	// ErrOfflineAuthDisabled is returned when offline authentication is disabled by using a negative value in aad.conf.
 	ErrOfflineAuthDisabled = errors.New("offline authentication is disabled")
+	// ErrInvalidPassword is returned when the password doesn't match the cached one.
+	ErrInvalidPassword = errors.New("password does not match")
+	// ErrUPNMismatch is returned when a cached user is updated with a different UPN than the one it is bound to.
+	ErrUPNMismatch = errors.New("user principal name mismatch")
+	// ErrObjectIDMismatch is returned when a cached user is updated with a different Azure AD object ID than the one
+	// it is bound to, like when a new account reuses the UPN of a deleted one.
+	ErrObjectIDMismatch = errors.New("object ID mismatch")
 )
 
 const (
@@ -44,11 +51,20 @@ const (
 type Cache struct {
 	db         *sql.DB
 	shadowMode int
+	cacheDir   string
 
 	// offlineCredentialsExpiration is the number of days we allow to user to login without online verification.
 	// Note that users will be purged from cache when exceeding twice this time.
 	offlineCredentialsExpiration int
 
+	// enumeration is the policy restricting the users and groups returned by the iterators.
+	enumeration string
+
+	// localConflicts is the policy applied when a new user conflicts with a local account.
+	localConflicts string
+	// localAccounts looks up the local accounts new users are checked against.
+	localAccounts *localAccounts
+
 	cursorPasswd *sql.Rows
 	cursorGroup  *sql.Rows
 	cursorShadow *sql.Rows
@@ -68,6 +84,11 @@ type options struct {
 	passwdPermission fs.FileMode
 	shadowPermission fs.FileMode
 	teardownDuration time.Duration
+	cleanUpOnOpen    bool
+	readOnly         bool
+	enumeration      string
+	localConflicts   string
+	localAccounts    *localAccounts
 
 	offlineCredentialsExpiration int
 }
@@ -132,6 +153,36 @@ func WithOfflineCredentialsExpiration(days int) func(o *options) error {
 	}
 }
 
+// WithCleanUpOnOpen controls whether expired users are purged from the cache when opening it in read/write mode.
+// This is disabled by default: the purge is done by GC, out of the login path.
+func WithCleanUpOnOpen(enabled bool) func(o *options) error {
+	return func(o *options) error {
+		o.cleanUpOnOpen = enabled
+		return nil
+	}
+}
+
+// WithReadOnly opens the cache without modifying it: it is neither created nor upgraded, and both databases are
+// opened read-only, even for root.
+func WithReadOnly() func(o *options) error {
+	return func(o *options) error {
+		o.readOnly = true
+		return nil
+	}
+}
+
+// WithLocalConflicts sets the policy applied when a new user conflicts with a local account: one of
+// LocalConflictsRefuse, LocalConflictsRemap or LocalConflictsAdopt. It defaults to LocalConflictsRemap.
+func WithLocalConflicts(policy string) func(o *options) error {
+	return func(o *options) error {
+		if policy != LocalConflictsRefuse && policy != LocalConflictsRemap && policy != LocalConflictsAdopt {
+			return fmt.Errorf(i18n.G("unknown local conflicts policy %q"), policy)
+		}
+		o.localConflicts = policy
+		return nil
+	}
+}
+
 var (
 	openedCaches   = make(map[options]*Cache)
 	openedCachesMu sync.RWMutex
@@ -162,6 +213,8 @@ func New(ctx context.Context, opts ...Option) (c *Cache, err error) {
 		shadowPermission: 0640,
 
 		teardownDuration: 30 * time.Second,
+		localConflicts:   LocalConflictsRemap,
+		localAccounts:    nssAccounts,
 
 		offlineCredentialsExpiration: defaultCredentialsExpiration,
 	}
@@ -200,26 +253,23 @@ func New(ctx context.Context, opts ...Option) (c *Cache, err error) {
 		}
 	}
 
-	db, shadowMode, err := initDB(ctx, o.cacheDir, o.rootUID, o.rootGID, o.shadowGID, o.forceShadowMode, o.passwdPermission, o.shadowPermission)
+	db, shadowMode, err := initDB(ctx, o.cacheDir, o.rootUID, o.rootGID, o.shadowGID, o.forceShadowMode, o.passwdPermission, o.shadowPermission, o.readOnly)
 	if err != nil {
 		return nil, err
 	}
 
 	logger.Debug(ctx, "Shadow db mode: %v", shadowMode)
 
-	if shadowMode == shadowRWMode && o.offlineCredentialsExpiration != 0 {
-		d := o.offlineCredentialsExpiration
-		if o.offlineCredentialsExpiration < 0 {
-			d = defaultCredentialsExpiration
-		}
-		days := uint64(d) * expirationPurgeMultiplier
-
-		maxCacheEntryDuration := time.Duration(days * 24 * uint64(time.Hour))
-		if err := cleanUpDB(ctx, db, maxCacheEntryDuration); err != nil {
+	if !o.cleanUpOnOpen {
+		logger.Debug(ctx, "Cache won't be cleaned up on open, it is left to aad-cli cache gc")
+	} else if d, ok := purgeDuration(o.offlineCredentialsExpiration); !ok {
+		logger.Debug(ctx, "Cache won't be cleaned up as credentials expiration is set to 0")
+	} else if shadowMode == shadowRWMode {
+		if purged, err := cleanUpDB(ctx, db, d); err != nil {
 			return nil, err
+		} else if purged > 0 {
+			touchGroupsStamp(ctx, o.cacheDir)
 		}
-	} else if o.offlineCredentialsExpiration == 0 {
-		logger.Debug(ctx, "Cache won't be cleaned up as credentials expiration is set to 0")
 	}
 
 	// reset shadowGid to initial value as the detection may have changed it after initialization, to retest
@@ -228,8 +278,12 @@ func New(ctx context.Context, opts ...Option) (c *Cache, err error) {
 	c = &Cache{
 		db:         db,
 		shadowMode: shadowMode,
+		cacheDir:   o.cacheDir,
 
 		offlineCredentialsExpiration: o.offlineCredentialsExpiration,
+		enumeration:                  o.enumeration,
+		localConflicts:               o.localConflicts,
+		localAccounts:                o.localAccounts,
 
 		usedBy:           1,
 		teardownDuration: o.teardownDuration,
@@ -312,53 +366,156 @@ func (c *Cache) CanAuthenticate(ctx context.Context, username, password string)
 	if err != nil {
 		return err
 	}
+	if isLocked(user.ShadowPasswd) {
+		return ErrCredentialsRevoked
+	}
 
 	// ensure that we checked credential online recently.
 	logger.Debug(ctx, "Last online login was: %s. Current time: %s.", user.LastOnlineAuth, time.Now())
-	if c.offlineCredentialsExpiration > 0 {
+	if expiry := c.credentialsExpiry(user); !expiry.IsZero() {
 		logger.Debug(ctx, "Online revalidation needed every %d days", c.offlineCredentialsExpiration)
-		if time.Now().After(user.LastOnlineAuth.Add(time.Duration(uint64(c.offlineCredentialsExpiration) * 24 * uint64(time.Hour)))) {
+		if time.Now().After(expiry) {
 			return ErrOfflineCredentialsExpired
 		}
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.ShadowPasswd), []byte(password)); err != nil {
-		return fmt.Errorf("password does not match: %w", err)
+		return fmt.Errorf("%w: %w", ErrInvalidPassword, err)
 	}
 
 	return nil
 }
 
+// OfflineCredentialsExpiry returns when username won't be able to authenticate offline anymore, unless they
+// authenticate online before. It returns the zero time if offline credentials never expire.
+func (c *Cache) OfflineCredentialsExpiry(ctx context.Context, username string) (expiry time.Time, err error) {
+	defer decorate.OnError(&err, i18n.G("can't get offline credentials expiry of user %q"), username)
+
+	if c.offlineCredentialsExpiration < 0 {
+		return time.Time{}, ErrOfflineAuthDisabled
+	}
+
+	user, err := c.GetUserByName(ctx, username)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return c.credentialsExpiry(user), nil
+}
+
+// credentialsExpiry returns when the offline credentials of user expire, or the zero time if they never expire.
+func (c *Cache) credentialsExpiry(user UserRecord) time.Time {
+	if c.offlineCredentialsExpiration <= 0 {
+		return time.Time{}
+	}
+	return user.LastOnlineAuth.Add(time.Duration(uint64(c.offlineCredentialsExpiration) * 24 * uint64(time.Hour)))
+}
+
+type updateOptions struct {
+	objectID string
+	upn      string
+	gecos    string
+	groups   []string
+}
+
+// UpdateOption represents an optional function to add information about the user on Update.
+type UpdateOption func(*updateOptions)
+
+// WithObjectID sets the Azure AD object ID of the user, which the cached user is bound to, and which is used by the
+// %o home directory modifier.
+func WithObjectID(objectID string) UpdateOption {
+	return func(o *updateOptions) {
+		o.objectID = objectID
+	}
+}
+
+// WithUPN sets the user principal name of the user in Azure AD, which is kept as an attribute of the cached user.
+// Update then refuses to update a cached user bound to another UPN.
+func WithUPN(upn string) UpdateOption {
+	return func(o *updateOptions) {
+		o.upn = upn
+	}
+}
+
+// WithGECOS sets the GECOS field of the user, built from the claims of Azure AD. It is stored on creation and
+// refreshed on updates, unless an administrator set it. An empty value leaves the GECOS field unchanged.
+func WithGECOS(gecos string) UpdateOption {
+	return func(o *updateOptions) {
+		o.gecos = gecos
+	}
+}
+
+// WithGroups sets the Azure AD groups of the user, named as in the cache, with their domain. They replace the groups
+// the user is a member of, except for their private group, and are created if needed. Groups named after a cached
+// user are skipped, as its private group has its name. nil leaves the groups of the user unchanged.
+func WithGroups(groups []string) UpdateOption {
+	return func(o *updateOptions) {
+		o.groups = groups
+	}
+}
+
+// UpdateOptionsValues returns the object ID, the UPN, the GECOS field and the groups set by opts, so that an update
+// can be forwarded to the process owning the cache.
+func UpdateOptionsValues(opts ...UpdateOption) (objectID, upn, gecos string, groups []string) {
+	var o updateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o.objectID, o.upn, o.gecos, o.groups
+}
+
 // Update creates and update user nss cache when there has been an online verification.
-func (c *Cache) Update(ctx context.Context, username, password, homeDirPattern, shell string) (err error) {
+func (c *Cache) Update(ctx context.Context, username, password, homeDirPattern, shell string, opts ...UpdateOption) (err error) {
 	defer decorate.OnError(&err, i18n.G("couldn't create/open cache for nss database"))
 
+	var o updateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	user, err := c.GetUserByName(ctx, username)
 	if errors.Is(err, ErrNoEnt) {
-		// Try creating the user
-		id, err := c.generateUIDForUser(ctx, username)
+		// Try creating the user, unless it conflicts with a local account.
+		user = UserRecord{
+			Name:  username,
+			Gecos: o.gecos,
+			Shell: shell,
+			UPN:   o.upn,
+		}
+		adopted, err := c.adoptLocalAccount(ctx, &user)
 		if err != nil {
 			return err
 		}
+		if !adopted {
+			id, err := c.generateUIDForUser(ctx, username)
+			if err != nil {
+				return err
+			}
+			user.UID, user.GID = int64(id), int64(id)
+		}
 
-		home, err := parseHomeDir(ctx, homeDirPattern, username, fmt.Sprintf("%d", id))
+		logger.Debug(ctx, "Getting home directory for %s", user.Name)
+		user.Home, err = aaduser.HomeDir(homeDirPattern, user.Name, user.UID, user.GID, o.objectID)
 		if err != nil {
 			return err
 		}
 
-		user = UserRecord{
-			Name:  username,
-			UID:   int64(id),
-			GID:   int64(id),
-			Home:  home,
-			Shell: shell,
-		}
-
-		if err := c.insertUser(ctx, user); err != nil {
+		if err := c.insertUser(ctx, user, o.objectID); err != nil {
 			return err
 		}
 	} else if err != nil {
 		return err
+	} else if err := c.bindAccount(ctx, user, o.objectID, o.upn); err != nil {
+		return err
+	}
+	if o.gecos != "" && user.Gecos != o.gecos {
+		if err := c.updateGECOS(ctx, user.UID, username, o.gecos); err != nil {
+			return err
+		}
+	}
+	if o.groups != nil {
+		if err := c.updateGroups(ctx, user, o.groups); err != nil {
+			return err
+		}
 	}
 
 	encryptedPassword, err := encryptPassword(ctx, username, password)
@@ -410,13 +567,7 @@ func (c *Cache) generateUIDForUser(ctx context.Context, username string) (uid ui
 
 	logger.Debug(ctx, "generate user id for user %q", username)
 
-	// compute uid for user
-	var offset uint32 = 100000
-	uid = 1
-	for _, c := range username {
-		uid = (uid * uint32(c)) % math.MaxUint32
-	}
-	uid = uid%(math.MaxUint32-offset) + offset
+	uid = idFromName(username)
 
 	// check collision or increment
 	for {
@@ -426,6 +577,15 @@ func (c *Cache) generateUIDForUser(ctx context.Context, username string) (uid ui
 			uid++
 			continue
 		}
+		if local := c.localIDOwner(ctx, uid); local != "" {
+			if c.localConflicts == LocalConflictsRefuse {
+				logger.Warn(ctx, "Refusing to create %q: its user id %d is used by local %s", username, uid, local)
+				return 0, fmt.Errorf(i18n.G("user id %d is already used by local %s: %w"), uid, local, ErrLocalConflict)
+			}
+			logger.Warn(ctx, "User id %d of %q is used by local %s, remapping it", uid, username, local)
+			uid++
+			continue
+		}
 
 		break
 	}
@@ -435,61 +595,48 @@ func (c *Cache) generateUIDForUser(ctx context.Context, username string) (uid ui
 	return uid, nil
 }
 
-// ShadowReadable returns true if shadow database is readable.
-func (c *Cache) ShadowReadable() bool {
-	return c.shadowMode > shadowNotAvailableMode
-}
+// generateGIDForGroup returns an unique gid for the Azure AD group to create. Unlike users, groups are always
+// remapped when their gid is used by a local account.
+func (c *Cache) generateGIDForGroup(ctx context.Context, name string) (gid uint32, err error) {
+	defer decorate.OnError(&err, i18n.G("failed to generate gid for group %q"), name)
 
-// parseHomeDir returns a string containing the homedir path generated by parsing homeDirPattern.
-// In case there are any invalid modifiers, returns an error.
-func parseHomeDir(ctx context.Context, homeDirPattern, username, uid string) (home string, err error) {
-	defer decorate.OnError(&err, i18n.G("couldn't parse home directory"))
+	logger.Debug(ctx, "generate group id for group %q", name)
 
-	logger.Debug(ctx, "Getting home directory for %s", username)
+	gid = idFromName(name)
 
-	var afterModifier bool
-	for _, c := range homeDirPattern {
-		s := string(c)
-
-		// treat % and %% cases.
-		if c == '%' && !afterModifier {
-			afterModifier = true
+	// check collision or increment
+	for {
+		if exists, err := uidOrGidExists(c.db, gid, name); err != nil {
+			return 0, err
+		} else if exists {
+			gid++
 			continue
-		} else if c == '%' && afterModifier {
-			afterModifier = false // second % is now considered as a "normal" character to append.
 		}
-
-		// treat special modifiers.
-		if afterModifier {
-			s, err = parseHomeDirPattern(s, username, uid)
-			if err != nil {
-				return "", err
-			}
+		if local := c.localIDOwner(ctx, gid); local != "" {
+			logger.Warn(ctx, "Group id %d of %q is used by local %s, remapping it", gid, name, local)
+			gid++
+			continue
 		}
 
-		// append converted characters or normal ones to the path, as if.
-		afterModifier = false
-		home += s
+		break
 	}
-	return home, nil
+
+	logger.Info(ctx, "group id for %q is %d", name, gid)
+
+	return gid, nil
 }
 
-// parseHomeDirPattern returns the string that matches the given pattern.
-// If the pattern is not recognized, an error is returned.
-func parseHomeDirPattern(pattern, username, uid string) (string, error) {
-	switch pattern {
-	case "f":
-		return username, nil
-	case "U":
-		return uid, nil
-	case "l":
-		return string(username[0]), nil
-	case "u", "d":
-		user, domain, _ := strings.Cut(username, "@")
-		if pattern == "u" {
-			return user, nil
-		}
-		return domain, nil
+// idFromName returns the id derived from the name of a user or group, before checking collisions.
+func idFromName(name string) uint32 {
+	var offset uint32 = 100000
+	id := uint32(1)
+	for _, c := range name {
+		id = (id * uint32(c)) % math.MaxUint32
 	}
-	return "", fmt.Errorf("%%%s is not a valid pattern", pattern)
+	return id%(math.MaxUint32-offset) + offset
+}
+
+// ShadowReadable returns true if shadow database is readable.
+func (c *Cache) ShadowReadable() bool {
+	return c.shadowMode > shadowNotAvailableMode
 }
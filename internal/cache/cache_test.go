@@ -2,11 +2,14 @@ package cache_test
 
 import (
 	"context"
+	"database/sql"
 	"flag"
 	"fmt"
 	"io/fs"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
@@ -32,6 +35,9 @@ func TestNew(t *testing.T) {
 		changeFilePerm            string
 		shadowCreationFilePerm    *fs.FileMode
 
+		readOnly       bool
+		reOpenReadOnly bool
+
 		wantShadowMode *int
 		wantErr        bool
 		wantErrReopen  bool
@@ -47,6 +53,10 @@ func TestNew(t *testing.T) {
 		// error cases
 		"can't create DB not being root UID or GID": {isNotRootUIDGID: true, wantErr: true},
 		"can't create a cache with Shadow group":    {cantChownShadowOnCreation: true, wantErr: true},
+		"can't create a cache read-only":            {readOnly: true, wantErr: true},
+
+		// read-only
+		"reopen existing cache read-only": {waitForClose: true, reOpenCache: true, reOpenReadOnly: true},
 
 		// tempered/permission errors
 		"can't open existing cache with wrong passwd permission": {changeFilePerm: cache.PasswdDB, waitForClose: true, reOpenCache: true, wantErrReopen: true},
@@ -79,6 +89,10 @@ func TestNew(t *testing.T) {
 				opts = append(opts, cache.WithTeardownDuration(time.Second*0))
 			}
 
+			if tc.readOnly {
+				opts = append(opts, cache.WithReadOnly())
+			}
+
 			c, err := cache.New(context.Background(), opts...)
 			if tc.wantErr {
 				require.Error(t, err, "New should have returned an error but hasn’t")
@@ -106,6 +120,10 @@ func TestNew(t *testing.T) {
 				require.NoError(t, os.Chmod(filepath.Join(cacheDir, tc.changeFilePerm), 0400), "Setup: could not make file Read Only")
 			}
 
+			if tc.reOpenReadOnly {
+				opts = append(opts, cache.WithReadOnly())
+			}
+
 			c2, err := cache.New(context.Background(), opts...)
 			if tc.wantErrReopen {
 				require.Error(t, err, "New should have returned an error but hasn’t")
@@ -114,6 +132,12 @@ func TestNew(t *testing.T) {
 			require.NoError(t, err, "New should have not returned an error but did")
 			defer c2.Close(context.Background())
 
+			if tc.reOpenReadOnly {
+				require.Equal(t, cache.ShadowROMode, c2.ShadowMode(), "Shadow should be attached read-only")
+				err := c2.Update(context.Background(), "myuser@domain.com", "my password", "/home/%u", "/bin/bash")
+				require.Error(t, err, "Update should fail on a read-only cache")
+			}
+
 			// c and c2 should be the same object
 			if !tc.waitForClose {
 				require.Equal(t, c2, c, "cache should still be the same object")
@@ -201,12 +225,14 @@ func TestCleanupDB(t *testing.T) {
 
 	tests := map[string]struct {
 		offlineCredentialsExpirationTime *int
+		cleanUpOnOpen                    bool
 
 		wantKeepOldUsers bool
 	}{
-		"clean up old users":                             {},
-		"clean up old users with default cleanup policy": {offlineCredentialsExpirationTime: &offlineAuthDisabled},
-		"do not clean up anyone":                         {offlineCredentialsExpirationTime: &zeroDuration, wantKeepOldUsers: true},
+		"clean up old users":                             {cleanUpOnOpen: true},
+		"clean up old users with default cleanup policy": {cleanUpOnOpen: true, offlineCredentialsExpirationTime: &offlineAuthDisabled},
+		"do not clean up anyone":                         {cleanUpOnOpen: true, offlineCredentialsExpirationTime: &zeroDuration, wantKeepOldUsers: true},
+		"do not clean up anyone on open by default":      {wantKeepOldUsers: true},
 	}
 	for name, tc := range tests {
 		tc := tc
@@ -222,10 +248,13 @@ func TestCleanupDB(t *testing.T) {
 			if tc.offlineCredentialsExpirationTime != nil {
 				opts = append(opts, cache.WithOfflineCredentialsExpiration(*tc.offlineCredentialsExpirationTime))
 			}
+			if tc.cleanUpOnOpen {
+				opts = append(opts, cache.WithCleanUpOnOpen(true))
+			}
 
 			testutils.PrepareDBsForTests(t, cacheDir, "db_with_expired_users")
 
-			// This triggers a database cleanup if offlineCredentialsExpirationTime is not 0
+			// This triggers a database cleanup if enabled and offlineCredentialsExpirationTime is not 0
 			c, err := cache.New(context.Background(), opts...)
 			require.NoError(t, err, "Should be able to create a cache and clean up")
 			t.Cleanup(func() { c.Close(context.Background()) })
@@ -304,6 +333,7 @@ func TestUpdate(t *testing.T) {
 				// Check the user exists in DB
 				u, err := c.GetUserByName(context.Background(), n)
 				require.NoError(t, err, "GetUserByName should get the user we just inserted")
+				require.FileExists(t, filepath.Join(cacheDir, "groups.stamp"), "Inserting a user should mark the groups as changed")
 
 				if lastUID != 0 && tc.wantUIDCollision {
 					assert.Equal(t, lastUID+1, u.UID, "Colliding user should have existing user UID+1")
@@ -326,6 +356,7 @@ func TestUpdate(t *testing.T) {
 
 				// we need one second as we are storing an unix timestamp for last online auth
 				time.Sleep(time.Second)
+				require.NoError(t, os.Remove(filepath.Join(cacheDir, "groups.stamp")), "Setup: could not remove groups stamp")
 
 				err = c.Update(context.Background(), n, "other password", "/home/%f", "/bin/bash")
 				if tc.wantErrRefresh {
@@ -340,11 +371,404 @@ func TestUpdate(t *testing.T) {
 
 				require.NotEqual(t, u.ShadowPasswd, firstEncryptedPass, "Password should have been updated")
 				require.True(t, firstOnlineLoginTime.Before(u.LastOnlineAuth), "Should have updated last login time")
+				require.NoFileExists(t, filepath.Join(cacheDir, "groups.stamp"), "Refreshing a user should not mark the groups as changed")
+			}
+		})
+	}
+}
+
+func TestUpdateUPN(t *testing.T) {
+	t.Parallel()
+
+	// myUserObjectID is the object ID myuser@domain.com is bound to in the users_with_upn cache.
+	const myUserObjectID = "11111111-2222-3333-4444-555555555555"
+	const otherObjectID = "99999999-8888-7777-6666-555555555555"
+
+	tests := map[string]struct {
+		initialCache string
+		userName     string
+		upn          string
+		objectID     string
+
+		wantUPN     string
+		wantErrType error
+	}{
+		"new user is bound to its UPN":               {userName: "bob_gmail.com", upn: "bob_gmail.com#ext#@contoso.onmicrosoft.com", wantUPN: "bob_gmail.com#ext#@contoso.onmicrosoft.com"},
+		"new user without UPN":                       {userName: "myuser@domain.com"},
+		"existing user without UPN is bound to it":   {initialCache: "users_in_db", userName: "myuser@domain.com", upn: "myuser@domain.com", wantUPN: "myuser@domain.com"},
+		"existing user is updated with the same UPN": {initialCache: "users_with_upn", userName: "success_guest.com", upn: "success_guest.com#ext#@otherdomain.com", wantUPN: "success_guest.com#ext#@otherdomain.com"},
+		"existing user is updated without UPN":       {initialCache: "users_with_upn", userName: "success_guest.com", wantUPN: "success_guest.com#ext#@otherdomain.com"},
+		"existing user is bound to its object ID":    {initialCache: "users_with_upn", userName: "success_guest.com", upn: "success_guest.com#ext#@otherdomain.com", objectID: otherObjectID, wantUPN: "success_guest.com#ext#@otherdomain.com"},
+		"renamed user is bound to its new UPN":       {initialCache: "users_with_upn", userName: "myuser@domain.com", upn: "renamed@domain.com", objectID: myUserObjectID, wantUPN: "renamed@domain.com"},
+
+		// error cases
+		"error on existing user bound to another UPN":                   {initialCache: "users_with_upn", userName: "success_guest.com", upn: "success_guest.com#ext#@domain.com", wantErrType: cache.ErrUPNMismatch},
+		"error on existing user without object ID bound to another UPN": {initialCache: "users_with_upn", userName: "success_guest.com", upn: "success_guest.com#ext#@domain.com", objectID: otherObjectID, wantErrType: cache.ErrUPNMismatch},
+		"error on existing user bound to another object ID":             {initialCache: "users_with_upn", userName: "myuser@domain.com", upn: "myuser@domain.com", objectID: otherObjectID, wantErrType: cache.ErrObjectIDMismatch},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			if tc.initialCache != "" {
+				testutils.PrepareDBsForTests(t, cacheDir, tc.initialCache)
+			}
+			c := testutils.NewCacheForTests(t, cacheDir)
+
+			err := c.Update(context.Background(), tc.userName, "my password", "/home/%f", "/bin/bash", cache.WithUPN(tc.upn), cache.WithObjectID(tc.objectID))
+			if tc.wantErrType != nil {
+				require.ErrorIs(t, err, tc.wantErrType, "Update should have returned the expected mismatch error")
+				return
+			}
+			require.NoError(t, err, "Update should not have returned an error but has")
+
+			u, err := c.GetUserByName(context.Background(), tc.userName)
+			require.NoError(t, err, "GetUserByName should get the user we just updated")
+			require.Equal(t, tc.wantUPN, u.UPN, "User should be bound to the expected UPN")
+		})
+	}
+}
+
+func TestUpdateGECOS(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		initialCache string
+		userName     string
+		pinGECOS     bool
+		pinnedGECOS  string
+		gecos        string
+
+		wantGECOS string
+	}{
+		"new user gets its GECOS":                       {userName: "newuser@domain.com", gecos: "Jane Doe,Room 42", wantGECOS: "Jane Doe,Room 42"},
+		"new user without GECOS":                        {userName: "newuser@domain.com"},
+		"existing user GECOS is refreshed":              {initialCache: "users_in_db", userName: "myuser@domain.com", gecos: "Jane Doe", wantGECOS: "Jane Doe"},
+		"existing user GECOS is kept without new GECOS": {initialCache: "users_in_db", userName: "myuser@domain.com", wantGECOS: "My User"},
+		"pinned GECOS is not refreshed":                 {initialCache: "users_in_db", userName: "myuser@domain.com", pinGECOS: true, pinnedGECOS: "Pinned User", gecos: "Jane Doe", wantGECOS: "Pinned User"},
+		"pinned GECOS set to its value is kept":         {initialCache: "users_in_db", userName: "myuser@domain.com", pinGECOS: true, pinnedGECOS: "My User", gecos: "Jane Doe", wantGECOS: "My User"},
+		"unpinned GECOS is refreshed":                   {initialCache: "users_in_db", userName: "myuser@domain.com", pinGECOS: true, gecos: "Jane Doe", wantGECOS: "Jane Doe"},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			if tc.initialCache != "" {
+				testutils.PrepareDBsForTests(t, cacheDir, tc.initialCache)
 			}
+			c := testutils.NewCacheForTests(t, cacheDir)
+
+			if tc.pinGECOS {
+				err := c.UpdateUserAttribute(context.Background(), tc.userName, "gecos", tc.pinnedGECOS)
+				require.NoError(t, err, "Setup: UpdateUserAttribute should not have returned an error but has")
+			}
+
+			err := c.Update(context.Background(), tc.userName, "my password", "/home/%f", "/bin/bash", cache.WithGECOS(tc.gecos))
+			require.NoError(t, err, "Update should not have returned an error but has")
+
+			u, err := c.GetUserByName(context.Background(), tc.userName)
+			require.NoError(t, err, "GetUserByName should get the user we just updated")
+			require.Equal(t, tc.wantGECOS, u.Gecos, "User should have the expected GECOS")
 		})
 	}
 }
 
+func TestUpdateGroups(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		previousGroups map[string][]string
+		groups         []string
+
+		wantMembers      map[string][]string
+		wantGroupsChange bool
+	}{
+		"new groups are created with the user as member": {groups: []string{"admins@domain.com", "devs@domain.com"}, wantMembers: map[string][]string{
+			"admins@domain.com": {"myuser@domain.com"}, "devs@domain.com": {"myuser@domain.com"}, "myuser@domain.com": {"myuser@domain.com"}}, wantGroupsChange: true},
+		"existing groups get the user as member": {previousGroups: map[string][]string{"otheruser@domain.com": {"admins@domain.com"}}, groups: []string{"admins@domain.com"}, wantMembers: map[string][]string{
+			"admins@domain.com": {"myuser@domain.com", "otheruser@domain.com"}}, wantGroupsChange: true},
+		"groups of the user are replaced": {previousGroups: map[string][]string{"myuser@domain.com": {"admins@domain.com", "devs@domain.com"}}, groups: []string{"devs@domain.com", "ops@domain.com"}, wantMembers: map[string][]string{
+			"admins@domain.com": nil, "devs@domain.com": {"myuser@domain.com"}, "ops@domain.com": {"myuser@domain.com"}, "myuser@domain.com": {"myuser@domain.com"}}, wantGroupsChange: true},
+		"groups of the user are kept without groups": {previousGroups: map[string][]string{"myuser@domain.com": {"admins@domain.com"}}, wantMembers: map[string][]string{
+			"admins@domain.com": {"myuser@domain.com"}}},
+		"groups of the user are removed with no group": {previousGroups: map[string][]string{"myuser@domain.com": {"admins@domain.com"}}, groups: []string{}, wantMembers: map[string][]string{
+			"admins@domain.com": nil, "myuser@domain.com": {"myuser@domain.com"}}, wantGroupsChange: true},
+		"groups of the user are kept when unchanged": {previousGroups: map[string][]string{"myuser@domain.com": {"admins@domain.com", "devs@domain.com"}}, groups: []string{"devs@domain.com", "admins@domain.com", "devs@domain.com"}, wantMembers: map[string][]string{
+			"admins@domain.com": {"myuser@domain.com"}, "devs@domain.com": {"myuser@domain.com"}}},
+		"groups named after a user are skipped": {groups: []string{"otheruser@domain.com", "admins@domain.com"}, wantMembers: map[string][]string{
+			"otheruser@domain.com": {"otheruser@domain.com"}, "admins@domain.com": {"myuser@domain.com"}}, wantGroupsChange: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+			c := testutils.NewCacheForTests(t, cacheDir)
+
+			for user, groups := range tc.previousGroups {
+				err := c.Update(context.Background(), user, "my password", "/home/%f", "/bin/bash", cache.WithGroups(groups))
+				require.NoError(t, err, "Setup: Update should not have returned an error but has")
+			}
+			stamp := filepath.Join(cacheDir, "groups.stamp")
+			require.NoError(t, os.RemoveAll(stamp), "Setup: could not remove groups stamp")
+
+			err := c.Update(context.Background(), "myuser@domain.com", "my password", "/home/%f", "/bin/bash", cache.WithGroups(tc.groups))
+			require.NoError(t, err, "Update should not have returned an error but has")
+			if tc.wantGroupsChange {
+				require.FileExists(t, stamp, "Update should mark the groups as changed")
+			} else {
+				require.NoFileExists(t, stamp, "Update should not mark the groups as changed")
+			}
+
+			for group, members := range tc.wantMembers {
+				g, err := c.GetGroupByName(context.Background(), group)
+				if members == nil {
+					require.ErrorIs(t, err, cache.ErrNoEnt, "Group %q should have no member", group)
+					continue
+				}
+				require.NoError(t, err, "GetGroupByName should get group %q", group)
+				require.ElementsMatch(t, members, g.Members, "Group %q should have the expected members", group)
+			}
+		})
+	}
+}
+
+func TestUpdateLocalConflicts(t *testing.T) {
+	t.Parallel()
+
+	// newUserUID is the UID generated for newuser@domain.com when nothing collides.
+	const newUserUID = 4109883040
+	uid := strconv.Itoa(newUserUID)
+
+	tests := map[string]struct {
+		initialCache string
+		policy       string
+		localUsers   []user.User
+		localGroups  []user.Group
+
+		wantUID int64
+		wantGID int64
+		wantErr bool
+	}{
+		"no conflict with local accounts": {localUsers: []user.User{{Username: "localuser", Uid: "1000", Gid: "1000"}},
+			wantUID: newUserUID, wantGID: newUserUID},
+		"UID of a local user is remapped by default": {localUsers: []user.User{{Username: "localuser", Uid: uid, Gid: "1000"}},
+			wantUID: newUserUID + 1, wantGID: newUserUID + 1},
+		"UID of a local group is remapped by default": {localGroups: []user.Group{{Name: "localgroup", Gid: uid}},
+			wantUID: newUserUID + 1, wantGID: newUserUID + 1},
+		"UID of a local user is remapped when adopting": {policy: cache.LocalConflictsAdopt, localUsers: []user.User{{Username: "localuser", Uid: uid, Gid: "1000"}},
+			wantUID: newUserUID + 1, wantGID: newUserUID + 1},
+		"local user with the same name is adopted": {policy: cache.LocalConflictsAdopt, localUsers: []user.User{{Username: "newuser@domain.com", Uid: "1001", Gid: "1002"}},
+			wantUID: 1001, wantGID: 1002},
+		"accounts of the cache are not local": {initialCache: "users_in_db", policy: cache.LocalConflictsRefuse,
+			localUsers:  []user.User{{Username: "newuser@domain.com", Uid: "165119648", Gid: "165119648"}},
+			localGroups: []user.Group{{Name: "newuser@domain.com", Gid: "165119648"}},
+			wantUID:     newUserUID, wantGID: newUserUID},
+
+		// error cases
+		"error on UID of a local user with refuse policy":       {policy: cache.LocalConflictsRefuse, localUsers: []user.User{{Username: "localuser", Uid: uid, Gid: "1000"}}, wantErr: true},
+		"error on UID of a local group with refuse policy":      {policy: cache.LocalConflictsRefuse, localGroups: []user.Group{{Name: "localgroup", Gid: uid}}, wantErr: true},
+		"error on name of a local user by default":              {localUsers: []user.User{{Username: "newuser@domain.com", Uid: "1001", Gid: "1001"}}, wantErr: true},
+		"error on name of a local user with refuse policy":      {policy: cache.LocalConflictsRefuse, localUsers: []user.User{{Username: "newuser@domain.com", Uid: "1001", Gid: "1001"}}, wantErr: true},
+		"error on name of a local group even with adopt policy": {policy: cache.LocalConflictsAdopt, localGroups: []user.Group{{Name: "newuser@domain.com", Gid: "1001"}}, wantErr: true},
+		"error on adopting root":                                {policy: cache.LocalConflictsAdopt, localUsers: []user.User{{Username: "newuser@domain.com", Uid: "0", Gid: "0"}}, wantErr: true},
+		"error on adopting a system user":                       {policy: cache.LocalConflictsAdopt, localUsers: []user.User{{Username: "newuser@domain.com", Uid: "999", Gid: "999"}}, wantErr: true},
+		"error on adopting a user of the root group":            {policy: cache.LocalConflictsAdopt, localUsers: []user.User{{Username: "newuser@domain.com", Uid: "1001", Gid: "0"}}, wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			if tc.initialCache != "" {
+				testutils.PrepareDBsForTests(t, cacheDir, tc.initialCache)
+			}
+			opts := []cache.Option{cache.WithLocalAccounts(tc.localUsers, tc.localGroups)}
+			if tc.policy != "" {
+				opts = append(opts, cache.WithLocalConflicts(tc.policy))
+			}
+			c := testutils.NewCacheForTests(t, cacheDir, opts...)
+
+			err := c.Update(context.Background(), "newuser@domain.com", "my password", "/home/%f", "/bin/bash")
+			if tc.wantErr {
+				require.ErrorIs(t, err, cache.ErrLocalConflict, "Update should have refused the conflicting user")
+				_, err = c.GetUserByName(context.Background(), "newuser@domain.com")
+				require.ErrorIs(t, err, cache.ErrNoEnt, "Conflicting user should not have been created")
+				return
+			}
+			require.NoError(t, err, "Update should not have returned an error but has")
+
+			u, err := c.GetUserByName(context.Background(), "newuser@domain.com")
+			require.NoError(t, err, "GetUserByName should get the user we just inserted")
+			require.Equal(t, tc.wantUID, u.UID, "User should have the expected UID")
+			require.Equal(t, tc.wantGID, u.GID, "User should have the expected GID")
+		})
+	}
+}
+
+func TestUIDMin(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		loginDefs string
+
+		want uint64
+	}{
+		"UID_MIN of login.defs":              {loginDefs: "# Min/max values for automatic uid selection in useradd\nUID_MIN\t\t\t 2000\nUID_MAX\t\t\t60000\n", want: 2000},
+		"default without login.defs":         {want: 1000},
+		"default without UID_MIN":            {loginDefs: "UID_MAX 60000\n", want: 1000},
+		"default with commented out UID_MIN": {loginDefs: "#UID_MIN 2000\n", want: 1000},
+		"default with invalid UID_MIN":       {loginDefs: "UID_MIN two\n", want: 1000},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p := filepath.Join(t.TempDir(), "login.defs")
+			if tc.loginDefs != "" {
+				require.NoError(t, os.WriteFile(p, []byte(tc.loginDefs), 0600), "Setup: could not write login.defs")
+			}
+
+			require.Equal(t, tc.want, cache.UIDMin(p), "UIDMin should return the expected UID")
+		})
+	}
+}
+
+func TestWithLocalConflictsRejectsUnknownPolicy(t *testing.T) {
+	t.Parallel()
+
+	_, err := cache.New(context.Background(), testutils.CacheOptionsForTests(t, t.TempDir(), cache.WithLocalConflicts("share"))...)
+	require.Error(t, err, "New should refuse an unknown local conflicts policy")
+}
+
+func TestUpgradeCacheWithoutUPN(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := t.TempDir()
+	testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+	cache.WaitForCacheDirClosed(cacheDir)
+
+	// Revert the passwd database to its schema before UPNs were recorded.
+	db, err := sql.Open("sqlite3", filepath.Join(cacheDir, cache.PasswdDB))
+	require.NoError(t, err, "Setup: could not open passwd database")
+	_, err = db.Exec(`DROP INDEX idx_upn; ALTER TABLE passwd DROP COLUMN upn`)
+	require.NoError(t, err, "Setup: could not drop upn column")
+	require.NoError(t, db.Close(), "Setup: could not close passwd database")
+
+	c := testutils.NewCacheForTests(t, cacheDir)
+
+	err = c.Update(context.Background(), "myuser@domain.com", "my password", "/home/%f", "/bin/bash", cache.WithUPN("myuser@domain.com"))
+	require.NoError(t, err, "Update should upgrade the cache and not return an error")
+
+	u, err := c.GetUserByUPN(context.Background(), "myuser@domain.com")
+	require.NoError(t, err, "GetUserByUPN should get the user we just updated")
+	require.Equal(t, "myuser@domain.com", u.Name, "User should be found by its UPN")
+}
+
+func TestUpgradeCacheWithoutLoginHistory(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := t.TempDir()
+	testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+	cache.WaitForCacheDirClosed(cacheDir)
+
+	// Revert the shadow database to its schema before logins were recorded.
+	db, err := sql.Open("sqlite3", filepath.Join(cacheDir, cache.ShadowDB))
+	require.NoError(t, err, "Setup: could not open shadow database")
+	_, err = db.Exec(`DROP TABLE login_history`)
+	require.NoError(t, err, "Setup: could not drop login_history table")
+	require.NoError(t, db.Close(), "Setup: could not close shadow database")
+
+	c := testutils.NewCacheForTests(t, cacheDir)
+
+	err = c.RecordLogin(context.Background(), "myuser@domain.com", "")
+	require.NoError(t, err, "RecordLogin should upgrade the cache and not return an error")
+
+	h, err := c.LoginHistory(context.Background(), "myuser@domain.com")
+	require.NoError(t, err, "LoginHistory should get the login we just recorded")
+	require.Equal(t, int64(1), h.LoginCount, "Login should be recorded in the upgraded cache")
+}
+
+func TestUpgradeCacheWithoutSSHKeys(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := t.TempDir()
+	testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+	cache.WaitForCacheDirClosed(cacheDir)
+
+	// Revert the shadow database to its schema before SSH keys were stored.
+	db, err := sql.Open("sqlite3", filepath.Join(cacheDir, cache.ShadowDB))
+	require.NoError(t, err, "Setup: could not open shadow database")
+	_, err = db.Exec(`DROP TABLE ssh_keys`)
+	require.NoError(t, err, "Setup: could not drop ssh_keys table")
+	require.NoError(t, db.Close(), "Setup: could not close shadow database")
+
+	c := testutils.NewCacheForTests(t, cacheDir)
+
+	_, err = c.AddSSHKey(context.Background(), "myuser@domain.com", "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDnJ5xSY/GA53Oo4wEaJBbX8oZ/DeLeQ+yRxkmQ1U4bf")
+	require.NoError(t, err, "AddSSHKey should upgrade the cache and not return an error")
+
+	keys, err := c.SSHKeys(context.Background(), "myuser@domain.com")
+	require.NoError(t, err, "SSHKeys should get the key we just added")
+	require.Len(t, keys, 1, "Key should be stored in the upgraded cache")
+}
+
+func TestUpgradeCacheWithoutPinnedGECOS(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := t.TempDir()
+	testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+	cache.WaitForCacheDirClosed(cacheDir)
+
+	// Revert the passwd database to its schema before GECOS could be pinned.
+	db, err := sql.Open("sqlite3", filepath.Join(cacheDir, cache.PasswdDB))
+	require.NoError(t, err, "Setup: could not open passwd database")
+	_, err = db.Exec(`ALTER TABLE passwd DROP COLUMN gecos_pinned`)
+	require.NoError(t, err, "Setup: could not drop gecos_pinned column")
+	require.NoError(t, db.Close(), "Setup: could not close passwd database")
+
+	c := testutils.NewCacheForTests(t, cacheDir)
+
+	err = c.Update(context.Background(), "myuser@domain.com", "my password", "/home/%f", "/bin/bash", cache.WithGECOS("Jane Doe"))
+	require.NoError(t, err, "Update should upgrade the cache and not return an error")
+
+	u, err := c.GetUserByName(context.Background(), "myuser@domain.com")
+	require.NoError(t, err, "GetUserByName should get the user we just updated")
+	require.Equal(t, "Jane Doe", u.Gecos, "GECOS should be refreshed in the upgraded cache")
+}
+
+func TestUpgradeCacheWithoutObjectID(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := t.TempDir()
+	testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+	cache.WaitForCacheDirClosed(cacheDir)
+
+	// Revert the passwd database to its schema before object IDs were recorded.
+	db, err := sql.Open("sqlite3", filepath.Join(cacheDir, cache.PasswdDB))
+	require.NoError(t, err, "Setup: could not open passwd database")
+	_, err = db.Exec(`ALTER TABLE passwd DROP COLUMN object_id`)
+	require.NoError(t, err, "Setup: could not drop object_id column")
+	require.NoError(t, db.Close(), "Setup: could not close passwd database")
+
+	c := testutils.NewCacheForTests(t, cacheDir)
+
+	const objectID = "11111111-2222-3333-4444-555555555555"
+	err = c.Update(context.Background(), "myuser@domain.com", "my password", "/home/%f", "/bin/bash", cache.WithObjectID(objectID))
+	require.NoError(t, err, "Update should upgrade the cache and not return an error")
+
+	err = c.Update(context.Background(), "myuser@domain.com", "my password", "/home/%f", "/bin/bash", cache.WithObjectID("99999999-8888-7777-6666-555555555555"))
+	require.ErrorIs(t, err, cache.ErrObjectIDMismatch, "User should be bound to its object ID in the upgraded cache")
+}
+
 func TestCanAuthenticate(t *testing.T) {
 	t.Parallel()
 
@@ -409,6 +833,10 @@ func TestCanAuthenticate(t *testing.T) {
 					if tc.disabledOfflineAuth {
 						require.ErrorIs(t, err, cache.ErrOfflineAuthDisabled, "CanAuthenticate should return a certain error type for disabled offline authentication")
 					}
+
+					if password == "wrong password" {
+						require.ErrorIs(t, err, cache.ErrInvalidPassword, "CanAuthenticate should return a certain error type for wrong passwords")
+					}
 					return
 				}
 				assert.NoError(t, err, "CanAuthenticate should not have returned an error but has")
@@ -417,6 +845,62 @@ func TestCanAuthenticate(t *testing.T) {
 	}
 }
 
+func TestOfflineCredentialsExpiry(t *testing.T) {
+	t.Parallel()
+
+	defaultExpiration, zeroDuration, offlineAuthDisabled := 90, 0, -1
+
+	tests := map[string]struct {
+		username   string
+		expiration *int
+
+		wantNoExpiry bool
+		wantErr      error
+	}{
+		"expire after the offline credentials expiration":     {},
+		"expire after the default expiration":                 {expiration: &defaultExpiration},
+		"never expire if offline credentials expiration is 0": {expiration: &zeroDuration, wantNoExpiry: true},
+
+		// error cases
+		"error on unknown user":                    {username: "doesnotexist@domain.com", wantErr: cache.ErrNoEnt},
+		"error on offline authentication disabled": {expiration: &offlineAuthDisabled, wantErr: cache.ErrOfflineAuthDisabled},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.username == "" {
+				tc.username = "myuser@domain.com"
+			}
+			days := 5
+			if tc.expiration != nil {
+				days = *tc.expiration
+			}
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+			c := testutils.NewCacheForTests(t, cacheDir, cache.WithOfflineCredentialsExpiration(days))
+
+			got, err := c.OfflineCredentialsExpiry(context.Background(), tc.username)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr, "OfflineCredentialsExpiry should have failed")
+				return
+			}
+			require.NoError(t, err, "OfflineCredentialsExpiry should succeed")
+
+			if tc.wantNoExpiry {
+				require.True(t, got.IsZero(), "Offline credentials should never expire")
+				return
+			}
+			u, err := c.GetUserByName(context.Background(), tc.username)
+			require.NoError(t, err, "Setup: GetUserByName should succeed")
+			require.Equal(t, u.LastOnlineAuth.Add(time.Duration(days)*24*time.Hour), got,
+				"Offline credentials should expire the given number of days after the last online authentication")
+		})
+	}
+}
+
 func TestUpdateUserAttribute(t *testing.T) {
 	t.Parallel()
 
@@ -26,6 +26,10 @@ const (
 	passwdDB         = "passwd.db" // root:root 644
 	shadowDB         = "shadow.db" // root:shadow 640
 	dbConnArgs       = "?_journal_mode=wal"
+	// dbReadOnlyConnArgs opens the databases read-only, leaving their journal mode as is.
+	dbReadOnlyConnArgs = "?mode=ro"
+	// groupsStamp is rewritten when users are added, removed or change groups, so that their sudo rules are updated.
+	groupsStamp = "groups.stamp" // root:root 644
 )
 
 var (
@@ -40,7 +44,7 @@ type rowScanner interface {
 	Scan(...any) error
 }
 
-func initDB(ctx context.Context, cacheDir string, rootUID, rootGID, shadowGID, forceShadowMode int, passwdPermission, shadowPermission fs.FileMode) (db *sql.DB, shadowMode int, err error) {
+func initDB(ctx context.Context, cacheDir string, rootUID, rootGID, shadowGID, forceShadowMode int, passwdPermission, shadowPermission fs.FileMode, readOnly bool) (db *sql.DB, shadowMode int, err error) {
 	defer decorate.OnError(&err, i18n.G("couldn't initiate database"))
 
 	logger.Debug(ctx, "Opening cache in %s", cacheDir)
@@ -65,6 +69,10 @@ func initDB(ctx context.Context, cacheDir string, rootUID, rootGID, shadowGID, f
 		}
 	}
 
+	if needsCreate && readOnly {
+		return nil, 0, fmt.Errorf("cache doesn't exist and can't be created read-only")
+	}
+
 	// Ensure that the partial cache (if exists) is cleaned up before creating it
 	if needsCreate {
 		if os.Geteuid() != rootUID || os.Getegid() != rootGID {
@@ -106,7 +114,11 @@ func initDB(ctx context.Context, cacheDir string, rootUID, rootGID, shadowGID, f
 	}
 
 	// Open existing cache
-	db, err = sql.Open("sqlite3", passwdPath+dbConnArgs)
+	dsn, shadowDSN := passwdPath+dbConnArgs, shadowPath
+	if readOnly {
+		dsn, shadowDSN = "file:"+passwdPath+dbReadOnlyConnArgs, "file:"+shadowPath+dbReadOnlyConnArgs
+	}
+	db, err = sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -122,18 +134,117 @@ func initDB(ctx context.Context, cacheDir string, rootUID, rootGID, shadowGID, f
 			shadowMode = shadowRWMode
 		}
 	}
+	if readOnly && shadowMode > shadowROMode {
+		shadowMode = shadowROMode
+	}
+	// Upgrade caches created by previous versions, which is only possible with write access.
+	if !readOnly && unix.Faccessat(unix.AT_FDCWD, passwdPath, unix.W_OK, unix.AT_EACCESS) == nil {
+		if err := upgradeDB(ctx, db); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	if shadowMode > shadowNotAvailableMode {
-		_, err = db.Exec(fmt.Sprintf("attach database '%s' as shadow;", shadowPath))
+		_, err = db.Exec(fmt.Sprintf("attach database '%s' as shadow;", shadowDSN))
 		if err != nil {
 			return nil, 0, err
 		}
 	}
+	if shadowMode == shadowRWMode {
+		if err := upgradeShadowDB(ctx, db); err != nil {
+			return nil, 0, err
+		}
+	}
 
 	return db, shadowMode, nil
 }
 
-// insertUser insert newUser in cache databases.
-func (c *Cache) insertUser(ctx context.Context, newUser UserRecord) (err error) {
+// passwdUpgrades are the columns added to the passwd table after its creation, with the statements adding them.
+var passwdUpgrades = []struct {
+	column     string
+	statements []string
+}{
+	{"upn", []string{`ALTER TABLE passwd ADD COLUMN upn TEXT DEFAULT ""`, `CREATE INDEX IF NOT EXISTS idx_upn ON passwd ("upn")`}},
+	{"gecos_pinned", []string{`ALTER TABLE passwd ADD COLUMN gecos_pinned INTEGER DEFAULT 0`}},
+	{"object_id", []string{`ALTER TABLE passwd ADD COLUMN object_id TEXT DEFAULT ""`}},
+}
+
+// upgradeDB adds to the passwd database the columns and tables introduced after its creation.
+func upgradeDB(ctx context.Context, db *sql.DB) (err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't upgrade database"))
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // The rollback will be ignored if the tx has been committed later in the function.
+
+	for _, u := range passwdUpgrades {
+		var exists bool
+		row := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info('passwd') WHERE name = ?)", u.column)
+		if err := row.Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		logger.Info(ctx, "Adding %s column to the passwd database", u.column)
+		for _, st := range u.statements {
+			if _, err := tx.Exec(st); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// shadowUpgrades are the tables added to the shadow database after its creation, with the statements creating them.
+// They hold the data only root and the shadow group can read.
+var shadowUpgrades = []struct {
+	table     string
+	statement string
+}{
+	{"revocations", `CREATE TABLE IF NOT EXISTS shadow.revocations (
+	uid             INTEGER NOT NULL UNIQUE,
+	revoked_at      INTEGER NOT NULL,
+	reason          TEXT    NOT NULL,
+	PRIMARY KEY("uid")
+)`},
+	{"login_history", `CREATE TABLE IF NOT EXISTS shadow.login_history (
+	uid             INTEGER NOT NULL UNIQUE,
+	first_login     INTEGER NOT NULL,
+	last_login      INTEGER NOT NULL,
+	last_remote_host TEXT   NOT NULL,
+	login_count     INTEGER NOT NULL,
+	PRIMARY KEY("uid")
+)`},
+	{"ssh_keys", `CREATE TABLE IF NOT EXISTS shadow.ssh_keys (
+	uid             INTEGER NOT NULL,
+	fingerprint     TEXT    NOT NULL,
+	key             TEXT    NOT NULL,
+	added_at        INTEGER NOT NULL,
+	PRIMARY KEY("uid", "fingerprint")
+)`},
+}
+
+// upgradeShadowDB adds to the shadow database the tables introduced after its creation.
+func upgradeShadowDB(ctx context.Context, db *sql.DB) (err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't upgrade shadow database"))
+
+	for _, u := range shadowUpgrades {
+		logger.Debug(ctx, "Ensuring the %s table exists in the shadow database", u.table)
+		if _, err := db.Exec(u.statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertUser insert newUser in cache databases, bound to its Azure AD objectID.
+func (c *Cache) insertUser(ctx context.Context, newUser UserRecord, objectID string) (err error) {
 	defer decorate.OnError(&err, i18n.G("failed to insert user %q in local cache"), newUser.Name)
 
 	logger.Debug(ctx, "inserting in cache user %q", newUser.Name)
@@ -150,8 +261,8 @@ func (c *Cache) insertUser(ctx context.Context, newUser UserRecord) (err error)
 
 	lastLoginAuth := newUser.LastOnlineAuth.Unix()
 	// passwd table
-	if _, err = tx.Exec("INSERT INTO passwd (login, uid, gid, home, shell, last_online_auth) VALUES(?,?,?,?,?,?)",
-		newUser.Name, newUser.UID, newUser.GID, newUser.Home, newUser.Shell, lastLoginAuth); err != nil {
+	if _, err = tx.Exec("INSERT INTO passwd (login, uid, gid, gecos, home, shell, last_online_auth, upn, object_id) VALUES(?,?,?,?,?,?,?,?,?)",
+		newUser.Name, newUser.UID, newUser.GID, newUser.Gecos, newUser.Home, newUser.Shell, lastLoginAuth, newUser.UPN, objectID); err != nil {
 		return err
 	}
 	// shadow db table
@@ -170,7 +281,11 @@ func (c *Cache) insertUser(ctx context.Context, newUser UserRecord) (err error)
 		return err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	touchGroupsStamp(ctx, c.cacheDir)
+	return nil
 }
 
 // userExists checks if username exists in passwd.
@@ -207,39 +322,218 @@ func (c *Cache) updateOnlineAuthAndPassword(ctx context.Context, uid int64, user
 	if _, err = tx.Exec("UPDATE shadow.shadow SET password = ? WHERE uid = ?", shadowPasswd, uid); err != nil {
 		return err
 	}
+	// Azure AD accepted the user again: the offline credentials are not revoked anymore.
+	if _, err = tx.Exec("DELETE FROM shadow.revocations WHERE uid = ?", uid); err != nil {
+		return err
+	}
 
 	return tx.Commit()
 }
 
-func cleanUpDB(ctx context.Context, db *sql.DB, maxCacheEntryDuration time.Duration) error {
+// bindAccount checks that the cached user is the Azure AD account with objectID and upn, and binds it to them.
+// Users are bound to their object ID, so that they keep their account when they are renamed in Azure AD, and their UPN
+// follows. Without object ID, like when MFA is required and there is no ID token, and for the users cached before
+// object IDs were recorded, users are bound to the first UPN they authenticate with.
+func (c *Cache) bindAccount(ctx context.Context, user UserRecord, objectID, upn string) (err error) {
+	var boundObjectID string
+	if err := c.db.QueryRow("SELECT object_id FROM passwd WHERE uid = ?", user.UID).Scan(&boundObjectID); err != nil {
+		return err
+	}
+
+	if objectID == "" || boundObjectID == "" {
+		if upn != "" && user.UPN != "" && user.UPN != upn {
+			return fmt.Errorf(i18n.G("user %q is already bound to %q, not to %q: %w"), user.Name, user.UPN, upn, ErrUPNMismatch)
+		}
+	} else if boundObjectID != objectID {
+		return fmt.Errorf(i18n.G("user %q is already bound to object ID %q, not to %q: %w"), user.Name, boundObjectID, objectID, ErrObjectIDMismatch)
+	} else if upn != "" && user.UPN != "" && user.UPN != upn {
+		logger.Info(ctx, "User %q was renamed from %q to %q in Azure AD", user.Name, user.UPN, upn)
+	}
+
+	if objectID != "" && boundObjectID == "" {
+		logger.Debug(ctx, "binding user %q to object ID %q", user.Name, objectID)
+		if _, err := c.db.Exec("UPDATE passwd SET object_id = ? WHERE uid = ?", objectID, user.UID); err != nil {
+			return err
+		}
+	}
+	if upn != "" && user.UPN != upn {
+		return c.updateUPN(ctx, user.UID, user.Name, upn)
+	}
+	return nil
+}
+
+// updateUPN sets the user principal name of a user which was cached without it, or which was renamed.
+func (c *Cache) updateUPN(ctx context.Context, uid int64, username, upn string) (err error) {
+	defer decorate.OnError(&err, i18n.G("failed to update UPN of user %q in local cache"), username)
+
+	logger.Debug(ctx, "setting UPN %q for user %q", upn, username)
+
+	_, err = c.db.Exec("UPDATE passwd SET upn = ? WHERE uid = ?", upn, uid)
+	return err
+}
+
+// updateGECOS refreshes the GECOS field of the user from Azure AD, unless it was pinned by an administrator.
+func (c *Cache) updateGECOS(ctx context.Context, uid int64, username, gecos string) (err error) {
+	defer decorate.OnError(&err, i18n.G("failed to update GECOS of user %q in local cache"), username)
+
+	logger.Debug(ctx, "refreshing GECOS %q of user %q unless pinned", gecos, username)
+
+	_, err = c.db.Exec("UPDATE passwd SET gecos = ? WHERE uid = ? AND gecos_pinned = 0", gecos, uid)
+	return err
+}
+
+// updateGroups replaces the Azure AD groups of the user with groups, creating the groups which are not in the cache.
+// The private group of the user is kept, and groups named after a cached user are skipped.
+func (c *Cache) updateGroups(ctx context.Context, user UserRecord, groups []string) (err error) {
+	defer decorate.OnError(&err, i18n.G("failed to update groups of user %q in local cache"), user.Name)
+
+	logger.Debug(ctx, "updating groups of user %q to %v", user.Name, groups)
+
+	if c.shadowMode != shadowRWMode {
+		return fmt.Errorf("shadow database is not accessible for writing: %v", c.shadowMode)
+	}
+
+	current, err := userGroups(c.db, user)
+	if err != nil {
+		return err
+	}
+
+	// Groups are created one by one, so that the gid of each new group is checked against the previous ones.
+	// Groups left without member if the update fails are removed by GC.
+	var gids []int64
+	for _, name := range groups {
+		if exists, err := userExists(c.db, name); err != nil {
+			return err
+		} else if exists {
+			logger.Warn(ctx, "Not adding %q to group %q: it is named after a user", user.Name, name)
+			continue
+		}
+
+		var gid int64
+		err := c.db.QueryRow("SELECT gid FROM groups WHERE name = ?", name).Scan(&gid)
+		if errors.Is(err, sql.ErrNoRows) {
+			id, err := c.generateGIDForGroup(ctx, name)
+			if err != nil {
+				return err
+			}
+			gid = int64(id)
+			if _, err := c.db.Exec("INSERT INTO groups (name, gid) VALUES (?,?)", name, gid); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		gids = append(gids, gid)
+	}
+
+	sorted := slices.Clone(gids)
+	slices.Sort(sorted)
+	if slices.Equal(slices.Compact(sorted), current) {
+		logger.Debug(ctx, "groups of user %q are up to date", user.Name)
+		return nil
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // The rollback will be ignored if the tx has been committed later in the function.
+
+	if _, err := tx.Exec("DELETE FROM uid_gid WHERE uid = ? AND gid != ?", user.UID, user.GID); err != nil {
+		return err
+	}
+	for _, gid := range gids {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO uid_gid (uid, gid) VALUES (?,?)", user.UID, gid); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	touchGroupsStamp(ctx, c.cacheDir)
+	return nil
+}
+
+// userGroups returns the sorted gids of the groups of user, except for its private group.
+func userGroups(db *sql.DB, user UserRecord) (gids []int64, err error) {
+	rows, err := db.Query("SELECT gid FROM uid_gid WHERE uid = ? AND gid != ? ORDER BY gid", user.UID, user.GID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var gid int64
+		if err := rows.Scan(&gid); err != nil {
+			return nil, err
+		}
+		gids = append(gids, gid)
+	}
+	return gids, rows.Err()
+}
+
+// touchGroupsStamp rewrites the groupsStamp file in cacheDir, so that the sudo rules are updated for the new users
+// and groups of the cache. Failing to do so only delays the update of the rules, so it doesn't fail the cache update.
+func touchGroupsStamp(ctx context.Context, cacheDir string) {
+	p := filepath.Join(cacheDir, groupsStamp)
+	// #nosec:G306 - the stamp only holds the time of the last change, which is public.
+	if err := os.WriteFile(p, []byte(time.Now().Format(time.RFC3339)+"\n"), 0644); err != nil {
+		logger.Warn(ctx, "Could not mark the groups of the cache as changed in %s: %v", p, err)
+	}
+}
+
+// cleanUpDB purges the users who last authenticated online more than maxCacheEntryDuration ago, and their groups.
+// It returns the number of purged users.
+func cleanUpDB(ctx context.Context, db *sql.DB, maxCacheEntryDuration time.Duration) (purged int64, err error) {
 	logger.Debug(ctx, "Cleaning up db. Removing entries that last authenticated online more than %d days ago", maxCacheEntryDuration/(24*time.Hour))
 
+	return purgeUsers(db, "last_online_auth < ?", time.Now().Add(-maxCacheEntryDuration).Unix())
+}
+
+// purgeUsers removes the users matching the where condition on the passwd table, with all their entries.
+// It returns the number of purged users.
+func purgeUsers(db *sql.DB, where string, args ...any) (purged int64, err error) {
 	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback() // The rollback will be ignored if the tx has been committed later in the function.
 
-	entryPurgeTime := time.Now().Add(-maxCacheEntryDuration).Unix()
+	// #nosec:G202 - where is one of our conditions, with its values passed as arguments.
+	users := "SELECT uid FROM passwd WHERE " + where
 
 	// Shadow cleanup
-	if _, err := tx.Exec("DELETE FROM shadow.shadow WHERE uid IN (SELECT uid FROM passwd WHERE last_online_auth < ?)", entryPurgeTime); err != nil {
-		return err
+	if _, err := tx.Exec("DELETE FROM shadow.shadow WHERE uid IN ("+users+")", args...); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM shadow.revocations WHERE uid IN ("+users+")", args...); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM shadow.login_history WHERE uid IN ("+users+")", args...); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM shadow.ssh_keys WHERE uid IN ("+users+")", args...); err != nil {
+		return 0, err
 	}
 	// uid_gid cleanup
-	if _, err := tx.Exec("DELETE FROM uid_gid WHERE uid IN (SELECT uid FROM passwd WHERE last_online_auth < ?)", entryPurgeTime); err != nil {
-		return err
+	if _, err := tx.Exec("DELETE FROM uid_gid WHERE uid IN ("+users+")", args...); err != nil {
+		return 0, err
 	}
 	// passwd cleanup
-	if _, err := tx.Exec("DELETE FROM passwd WHERE last_online_auth < ?", entryPurgeTime); err != nil {
-		return err
+	res, err := tx.Exec("DELETE FROM passwd WHERE "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	if purged, err = res.RowsAffected(); err != nil {
+		return 0, err
 	}
 	// empty groups cleanup
 	if _, err := tx.Exec("DELETE FROM groups WHERE gid NOT IN (SELECT DISTINCT gid FROM uid_gid)"); err != nil {
-		return err
+		return 0, err
 	}
 
-	return tx.Commit()
+	return purged, tx.Commit()
 }
 
 /*func updateUid()   {}
@@ -274,6 +568,13 @@ func (c *Cache) UpdateUserAttribute(ctx context.Context, login, attr string, val
 		return err
 	}
 
+	// A GECOS set by an administrator is not overwritten by the claims of the next logins, until it is unset.
+	if attr == "gecos" {
+		if _, err = tx.Exec("UPDATE passwd SET gecos_pinned = ? WHERE login = ?", value != "", login); err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
 
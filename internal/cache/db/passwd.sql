@@ -8,9 +8,13 @@ CREATE TABLE IF NOT EXISTS passwd (
 	home				TEXT DEFAULT "",
 	shell				TEXT DEFAULT "/bin/bash",
 	last_online_auth 	INTEGER,	-- Last time user has been authenticated against a server
+	upn					TEXT DEFAULT "",	-- User principal name of the user in Azure AD
+	gecos_pinned		INTEGER DEFAULT 0,	-- 1 if gecos was set by an administrator, and isn't refreshed from Azure AD
+	object_id			TEXT DEFAULT "",	-- Object ID of the user in Azure AD, which is kept when the user is renamed
 	PRIMARY KEY("uid")
 );
 CREATE UNIQUE INDEX idx_login ON passwd ("login");
+CREATE INDEX idx_upn ON passwd ("upn");
 
 CREATE TABLE IF NOT EXISTS groups (
 	name		TEXT NOT NULL UNIQUE,
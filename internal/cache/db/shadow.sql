@@ -8,4 +8,28 @@ CREATE TABLE IF NOT EXISTS shadow (
 	pwd_inactivity	INTEGER NOT NULL DEFAULT -1,
 	expiration_date	INTEGER NOT NULL DEFAULT -1,
 	PRIMARY KEY("uid")
+);
+
+CREATE TABLE IF NOT EXISTS revocations (
+	uid             INTEGER NOT NULL UNIQUE,
+	revoked_at      INTEGER NOT NULL,  -- Time the offline credentials were revoked
+	reason          TEXT    NOT NULL,  -- Denial returned by Azure AD
+	PRIMARY KEY("uid")
+);
+
+CREATE TABLE IF NOT EXISTS login_history (
+	uid             INTEGER NOT NULL UNIQUE,
+	first_login     INTEGER NOT NULL,  -- First time user opened a session
+	last_login      INTEGER NOT NULL,  -- Last time user opened a session
+	last_remote_host TEXT   NOT NULL,  -- Host the last session was opened from, empty for local sessions
+	login_count     INTEGER NOT NULL,  -- Number of sessions opened by user
+	PRIMARY KEY("uid")
+);
+
+CREATE TABLE IF NOT EXISTS ssh_keys (
+	uid             INTEGER NOT NULL,
+	fingerprint     TEXT    NOT NULL,  -- SHA256 fingerprint of the public key
+	key             TEXT    NOT NULL,  -- Public key in the authorized_keys format, with its comment
+	added_at        INTEGER NOT NULL,  -- Time the key was added
+	PRIMARY KEY("uid", "fingerprint")
 );
\ No newline at end of file
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// EnumerateAll lets every cached user and group be enumerated. This is the default.
+	EnumerateAll = "all"
+	// EnumerateNone disables the enumeration of cached users and groups.
+	EnumerateNone = "none"
+
+	// enumerationSeparator separates the user and group names of an enumeration policy.
+	enumerationSeparator = ","
+)
+
+// WithEnumeration restricts the entries returned by GetAllUserNames, NextPasswdEntry, NextGroupEntry and
+// NextShadowEntry.
+// policy is EnumerateAll, EnumerateNone or a comma separated list of user and group names: only the listed
+// users and the members of the listed groups are then enumerated, along with their groups.
+// Lookups by name or ID are not affected.
+func WithEnumeration(policy string) func(o *options) error {
+	return func(o *options) error {
+		o.enumeration = policy
+		return nil
+	}
+}
+
+// enumerationFilter returns the SQL condition on uidColumn restricting the enumeration to the users allowed by
+// policy, with its arguments.
+func enumerationFilter(policy, uidColumn string) (cond string, args []any) {
+	switch policy {
+	case "", EnumerateAll:
+		return "1", nil
+	case EnumerateNone:
+		return "0", nil
+	}
+
+	var names []any
+	for _, n := range strings.Split(policy, enumerationSeparator) {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		return "0", nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(names)), ",")
+	cond = fmt.Sprintf(`%s IN (
+		SELECT uid FROM passwd WHERE login IN (%s)
+		UNION
+		SELECT uid FROM uid_gid WHERE gid IN (SELECT gid FROM groups WHERE name IN (%s))
+	)`, uidColumn, placeholders, placeholders)
+
+	return cond, append(names, names...)
+}
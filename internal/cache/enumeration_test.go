@@ -0,0 +1,140 @@
+package cache_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+func TestEnumeration(t *testing.T) {
+	t.Parallel()
+
+	allUsers := []string{"myuser@domain.com", "otheruser@domain.com", "user@otherdomain.com"}
+
+	tests := map[string]struct {
+		policy string
+
+		wantUsers  []string
+		wantGroups map[string][]string
+	}{
+		"all users and groups are enumerated by default": {
+			wantUsers: allUsers,
+			wantGroups: map[string][]string{
+				"admins":               {"myuser@domain.com", "otheruser@domain.com"},
+				"myuser@domain.com":    {"myuser@domain.com"},
+				"otheruser@domain.com": {"otheruser@domain.com"},
+				"user@otherdomain.com": {"user@otherdomain.com"},
+			},
+		},
+		"all users and groups are enumerated": {
+			policy:    cache.EnumerateAll,
+			wantUsers: allUsers,
+			wantGroups: map[string][]string{
+				"admins":               {"myuser@domain.com", "otheruser@domain.com"},
+				"myuser@domain.com":    {"myuser@domain.com"},
+				"otheruser@domain.com": {"otheruser@domain.com"},
+				"user@otherdomain.com": {"user@otherdomain.com"},
+			},
+		},
+		"enumeration is disabled": {policy: cache.EnumerateNone},
+		"only listed users are enumerated, with their groups": {
+			policy:    "myuser@domain.com, user@otherdomain.com",
+			wantUsers: []string{"myuser@domain.com", "user@otherdomain.com"},
+			wantGroups: map[string][]string{
+				"admins":               {"myuser@domain.com"},
+				"myuser@domain.com":    {"myuser@domain.com"},
+				"user@otherdomain.com": {"user@otherdomain.com"},
+			},
+		},
+		"members of listed groups are enumerated": {
+			policy:    "admins",
+			wantUsers: []string{"myuser@domain.com", "otheruser@domain.com"},
+			wantGroups: map[string][]string{
+				"admins":               {"myuser@domain.com", "otheruser@domain.com"},
+				"myuser@domain.com":    {"myuser@domain.com"},
+				"otheruser@domain.com": {"otheruser@domain.com"},
+			},
+		},
+		"unknown names are ignored": {
+			policy:    "doesnotexist@domain.com, user@otherdomain.com",
+			wantUsers: []string{"user@otherdomain.com"},
+			wantGroups: map[string][]string{
+				"user@otherdomain.com": {"user@otherdomain.com"},
+			},
+		},
+		"empty list disables enumeration": {policy: " , "},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+
+			// Add a group shared by two users.
+			db, err := sql.Open("sqlite3", filepath.Join(cacheDir, cache.PasswdDB))
+			require.NoError(t, err, "Setup: could not open passwd database")
+			_, err = db.Exec(`INSERT INTO groups (name, gid) VALUES ('admins', 4242);
+				INSERT INTO uid_gid (uid, gid) VALUES (1929326240, 4242), (165119648, 4242)`)
+			require.NoError(t, err, "Setup: could not add shared group")
+			require.NoError(t, db.Close(), "Setup: could not close passwd database")
+
+			c := testutils.NewCacheForTests(t, cacheDir, cache.WithEnumeration(tc.policy))
+
+			names, err := c.GetAllUserNames(context.Background())
+			require.NoError(t, err, "GetAllUserNames should not return an error")
+			require.ElementsMatch(t, tc.wantUsers, names, "GetAllUserNames should return the enumerated users")
+
+			var users, shadowUsers []string
+			for {
+				u, err := c.NextPasswdEntry(context.Background())
+				if errors.Is(err, cache.ErrNoEnt) {
+					break
+				}
+				require.NoError(t, err, "NextPasswdEntry should not return an error")
+				users = append(users, u.Name)
+			}
+			require.ElementsMatch(t, tc.wantUsers, users, "NextPasswdEntry should return the enumerated users")
+
+			for {
+				s, err := c.NextShadowEntry(context.Background())
+				if errors.Is(err, cache.ErrNoEnt) {
+					break
+				}
+				require.NoError(t, err, "NextShadowEntry should not return an error")
+				shadowUsers = append(shadowUsers, s.Name)
+			}
+			require.ElementsMatch(t, tc.wantUsers, shadowUsers, "NextShadowEntry should return the enumerated users")
+
+			groups := make(map[string][]string)
+			for {
+				g, err := c.NextGroupEntry(context.Background())
+				if errors.Is(err, cache.ErrNoEnt) {
+					break
+				}
+				require.NoError(t, err, "NextGroupEntry should not return an error")
+				groups[g.Name] = g.Members
+			}
+			if tc.wantGroups == nil {
+				tc.wantGroups = make(map[string][]string)
+			}
+			require.Equal(t, len(tc.wantGroups), len(groups), "NextGroupEntry should return the groups of the enumerated users")
+			for n, members := range tc.wantGroups {
+				require.ElementsMatch(t, members, groups[n], "Group %q should list its enumerated members", n)
+			}
+
+			// Direct lookups are not affected.
+			for _, n := range allUsers {
+				_, err := c.GetUserByName(context.Background(), n)
+				require.NoError(t, err, "GetUserByName should find %q whatever the enumeration policy is", n)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package cache
 
 import (
 	"io/fs"
+	"os/user"
+	"strconv"
 	"time"
 )
 
@@ -33,6 +35,49 @@ func WithShadowPermission(perm fs.FileMode) func(o *options) error {
 	}
 }
 
+// WithLocalAccounts replaces the NSS lookups of the local accounts new users are checked against by users and groups.
+func WithLocalAccounts(users []user.User, groups []user.Group) func(o *options) error {
+	return func(o *options) error {
+		o.localAccounts = &localAccounts{
+			lookupUser: func(name string) (*user.User, error) {
+				for _, u := range users {
+					if u.Username == name {
+						return &u, nil
+					}
+				}
+				return nil, user.UnknownUserError(name)
+			},
+			lookupUserID: func(uid string) (*user.User, error) {
+				for _, u := range users {
+					if u.Uid == uid {
+						return &u, nil
+					}
+				}
+				id, _ := strconv.Atoi(uid)
+				return nil, user.UnknownUserIdError(id)
+			},
+			lookupGroup: func(name string) (*user.Group, error) {
+				for _, g := range groups {
+					if g.Name == name {
+						return &g, nil
+					}
+				}
+				return nil, user.UnknownGroupError(name)
+			},
+			lookupGroupID: func(gid string) (*user.Group, error) {
+				for _, g := range groups {
+					if g.Gid == gid {
+						return &g, nil
+					}
+				}
+				return nil, user.UnknownGroupIdError(gid)
+			},
+			uidMin: func() uint64 { return defaultUIDMin },
+		}
+		return nil
+	}
+}
+
 func (c *Cache) WaitForCacheClosed() {
 	for {
 		openedCachesMu.Lock()
@@ -45,6 +90,31 @@ func (c *Cache) WaitForCacheClosed() {
 	}
 }
 
+// WaitForCacheDirClosed waits for the caches opened in cacheDir to be torn down, so that their databases can be
+// modified behind their back.
+func WaitForCacheDirClosed(cacheDir string) {
+	for {
+		openedCachesMu.Lock()
+		var opened bool
+		for sig := range openedCaches {
+			if sig.cacheDir == cacheDir {
+				opened = true
+				break
+			}
+		}
+		openedCachesMu.Unlock()
+		if !opened {
+			return
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+}
+
 func (c *Cache) ShadowMode() int {
 	return c.shadowMode
 }
+
+// UIDMin returns the UID_MIN set in the login.defs file at path.
+func UIDMin(path string) uint64 {
+	return uidMin(path)
+}
@@ -0,0 +1,239 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/decorate"
+)
+
+// GCReport summarizes what GC removed from the cache.
+type GCReport struct {
+	// ExpiredUsers is the number of users purged as they didn't authenticate online for too long.
+	ExpiredUsers int64
+	// InactiveUsers is the number of users purged as they didn't open a session for too long.
+	InactiveUsers int64
+	// OrphanedEntries is the number of shadow, revocation, login history, SSH key, group and membership entries which
+	// didn't belong to any user.
+	OrphanedEntries int64
+}
+
+type gcOptions struct {
+	domainExpiration func(domain string) (int, error)
+	domainInactivity func(domain string) (int, error)
+}
+
+// GCOption represents an optional function to change how GC purges expired users.
+type GCOption func(*gcOptions)
+
+// WithDomainExpiration purges the users of each domain according to the offline credentials expiration in days
+// returned by expiration for it, instead of the one of the cache. The domain of a user is the one of its UPN, or
+// of its name for users cached without UPN. GC fails if expiration returns an error.
+func WithDomainExpiration(expiration func(domain string) (int, error)) GCOption {
+	return func(o *gcOptions) {
+		o.domainExpiration = expiration
+	}
+}
+
+// WithDomainInactivityExpiration also purges the users of each domain who didn't open a session for the number of
+// days returned by expiration for it, or 0 to keep them. Users who never opened a session are only purged on their
+// offline credentials expiration. GC fails if expiration returns an error.
+func WithDomainInactivityExpiration(expiration func(domain string) (int, error)) GCOption {
+	return func(o *gcOptions) {
+		o.domainInactivity = expiration
+	}
+}
+
+// GC runs the cache maintenance: it removes orphaned entries, purges expired users, then checkpoints the write-ahead
+// log and vacuums the databases to give back the freed space.
+// Users are purged when exceeding twice the offline credentials expiration, unless it is 0, and when they didn't open
+// a session for too long with WithDomainInactivityExpiration.
+// It is meant to run periodically out of the login path, and requires write access to the cache.
+func (c *Cache) GC(ctx context.Context, opts ...GCOption) (r GCReport, err error) {
+	defer decorate.OnError(&err, i18n.G("cache maintenance failed"))
+
+	o := gcOptions{}
+	for _, f := range opts {
+		f(&o)
+	}
+
+	if c.shadowMode != shadowRWMode {
+		return GCReport{}, errors.New(i18n.G("the cache can only be maintained by root"))
+	}
+
+	// Orphans are removed first, so that the groups of purged users are not accounted as orphaned.
+	if r.OrphanedEntries, err = removeOrphans(ctx, c.db); err != nil {
+		return GCReport{}, err
+	}
+
+	if o.domainExpiration != nil {
+		if r.ExpiredUsers, err = purgeExpiredUsersByDomain(ctx, c.db, o.domainExpiration); err != nil {
+			return r, err
+		}
+	} else if d, ok := purgeDuration(c.offlineCredentialsExpiration); ok {
+		if r.ExpiredUsers, err = cleanUpDB(ctx, c.db, d); err != nil {
+			return r, err
+		}
+	} else {
+		logger.Debug(ctx, "Not purging expired users as credentials expiration is set to 0")
+	}
+
+	if o.domainInactivity != nil {
+		if r.InactiveUsers, err = purgeInactiveUsersByDomain(ctx, c.db, o.domainInactivity); err != nil {
+			return r, err
+		}
+	}
+
+	if r.ExpiredUsers > 0 || r.InactiveUsers > 0 {
+		touchGroupsStamp(ctx, c.cacheDir)
+	}
+
+	logger.Debug(ctx, "Checkpointing and vacuuming databases")
+	for _, schema := range []string{"main", "shadow"} {
+		// #nosec:G202 - schema is one of our constant database names.
+		if _, err := c.db.Exec("PRAGMA " + schema + ".wal_checkpoint(TRUNCATE)"); err != nil {
+			return r, err
+		}
+		if _, err := c.db.Exec("VACUUM " + schema); err != nil {
+			return r, err
+		}
+	}
+
+	return r, nil
+}
+
+// removeOrphans removes the shadow, revocation, login history, SSH key, group and membership entries which don't
+// belong to any user anymore. It returns the number of removed entries.
+func removeOrphans(ctx context.Context, db *sql.DB) (removed int64, err error) {
+	logger.Debug(ctx, "Removing orphaned entries")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // The rollback will be ignored if the tx has been committed later in the function.
+
+	for _, q := range []string{
+		"DELETE FROM shadow.shadow WHERE uid NOT IN (SELECT uid FROM passwd)",
+		"DELETE FROM shadow.revocations WHERE uid NOT IN (SELECT uid FROM passwd)",
+		"DELETE FROM shadow.login_history WHERE uid NOT IN (SELECT uid FROM passwd)",
+		"DELETE FROM shadow.ssh_keys WHERE uid NOT IN (SELECT uid FROM passwd)",
+		"DELETE FROM uid_gid WHERE uid NOT IN (SELECT uid FROM passwd) OR gid NOT IN (SELECT gid FROM groups)",
+		"DELETE FROM groups WHERE gid NOT IN (SELECT DISTINCT gid FROM uid_gid)",
+	} {
+		res, err := tx.Exec(q)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		removed += n
+	}
+
+	return removed, tx.Commit()
+}
+
+// purgeExpiredUsersByDomain purges the users exceeding twice the offline credentials expiration of their domain,
+// as returned by expiration. It returns the number of purged users.
+func purgeExpiredUsersByDomain(ctx context.Context, db *sql.DB, expiration func(domain string) (int, error)) (purged int64, err error) {
+	logger.Debug(ctx, "Cleaning up db. Removing entries that last authenticated online too long ago for their domain")
+
+	expired, err := usersOlderByDomain(db, "SELECT uid, login, upn, last_online_auth FROM passwd WHERE last_online_auth > 0", func(domain string) (time.Duration, error) {
+		days, err := expiration(domain)
+		if err != nil {
+			return 0, fmt.Errorf(i18n.G("could not get offline credentials expiration of domain %q: %w"), domain, err)
+		}
+		d, _ := purgeDuration(days)
+		return d, nil
+	})
+	if err != nil || len(expired) == 0 {
+		return 0, err
+	}
+
+	return purgeUsers(db, "uid IN (?"+strings.Repeat(",?", len(expired)-1)+")", expired...)
+}
+
+// purgeInactiveUsersByDomain purges the users who didn't open a session for the number of days returned by
+// expiration for their domain. It returns the number of purged users.
+func purgeInactiveUsersByDomain(ctx context.Context, db *sql.DB, expiration func(domain string) (int, error)) (purged int64, err error) {
+	logger.Debug(ctx, "Cleaning up db. Removing entries that last opened a session too long ago for their domain")
+
+	// The login history is in the shadow database, which GC requires write access to.
+	inactive, err := usersOlderByDomain(db, `
+	SELECT p.uid, p.login, p.upn, l.last_login
+	FROM passwd p, shadow.login_history l
+	WHERE p.uid = l.uid AND l.last_login > 0`, func(domain string) (time.Duration, error) {
+		days, err := expiration(domain)
+		if err != nil {
+			return 0, fmt.Errorf(i18n.G("could not get inactive users expiration of domain %q: %w"), domain, err)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	})
+	if err != nil || len(inactive) == 0 {
+		return 0, err
+	}
+
+	return purgeUsers(db, "uid IN (?"+strings.Repeat(",?", len(inactive)-1)+")", inactive...)
+}
+
+// usersOlderByDomain returns the UIDs of the users selected by query, as uid, login, upn and a time, whose time is
+// older than the duration returned by duration for their domain. Users of domains with a duration of 0 are kept.
+func usersOlderByDomain(db *sql.DB, query string, duration func(domain string) (time.Duration, error)) (uids []any, err error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Durations of the domains, 0 if their users are kept.
+	durations := make(map[string]time.Duration)
+	for rows.Next() {
+		var uid, t int64
+		var login, upn string
+		if err := rows.Scan(&uid, &login, &upn, &t); err != nil {
+			return nil, err
+		}
+
+		name := upn
+		if name == "" {
+			name = login
+		}
+		_, domain, _ := strings.Cut(name, "@")
+
+		d, found := durations[domain]
+		if !found {
+			if d, err = duration(domain); err != nil {
+				return nil, err
+			}
+			durations[domain] = d
+		}
+
+		if d > 0 && time.Unix(t, 0).Before(time.Now().Add(-d)) {
+			uids = append(uids, uid)
+		}
+	}
+
+	return uids, rows.Err()
+}
+
+// purgeDuration returns the time after which users are purged from the cache, for the given offline credentials
+// expiration in days. It returns false if users should never be purged.
+func purgeDuration(offlineCredentialsExpiration int) (time.Duration, bool) {
+	if offlineCredentialsExpiration == 0 {
+		return 0, false
+	}
+	d := offlineCredentialsExpiration
+	if d < 0 {
+		d = defaultCredentialsExpiration
+	}
+	days := uint64(d) * expirationPurgeMultiplier
+	return time.Duration(days * 24 * uint64(time.Hour)), true
+}
@@ -0,0 +1,147 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+func TestGC(t *testing.T) {
+	t.Parallel()
+
+	var zeroDuration int
+	offlineAuthDisabled := -1
+
+	tests := map[string]struct {
+		initialCache     string
+		expiration       *int
+		domainExpiration map[string]int
+		shadowMode       *int
+
+		wantReport         cache.GCReport
+		wantKeepPurgedUser bool
+		wantErr            bool
+	}{
+		"purge expired users and orphaned entries":              {initialCache: "db_with_orphans", wantReport: cache.GCReport{ExpiredUsers: 1, OrphanedEntries: 4}},
+		"only remove orphaned entries if expiration is 0":       {initialCache: "db_with_orphans", expiration: &zeroDuration, wantReport: cache.GCReport{OrphanedEntries: 4}, wantKeepPurgedUser: true},
+		"purge with default policy if offline auth is disabled": {initialCache: "db_with_orphans", expiration: &offlineAuthDisabled, wantReport: cache.GCReport{ExpiredUsers: 1, OrphanedEntries: 4}},
+		"nothing to remove":                    {initialCache: "users_in_db"},
+		"purge with expiration of user domain": {initialCache: "db_with_orphans", expiration: &zeroDuration, domainExpiration: map[string]int{"domain.com": 90}, wantReport: cache.GCReport{ExpiredUsers: 1, OrphanedEntries: 4}},
+		"keep users of domains never expiring": {initialCache: "db_with_orphans", domainExpiration: map[string]int{"domain.com": 0}, wantReport: cache.GCReport{OrphanedEntries: 4}, wantKeepPurgedUser: true},
+
+		// error cases
+		"error on shadow not writable":             {initialCache: "db_with_orphans", shadowMode: &cache.ShadowROMode, wantErr: true},
+		"error on domain expiration not available": {initialCache: "db_with_orphans", domainExpiration: map[string]int{}, wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, tc.initialCache)
+
+			var opts []cache.Option
+			if tc.expiration != nil {
+				opts = append(opts, cache.WithOfflineCredentialsExpiration(*tc.expiration))
+			}
+			if tc.shadowMode != nil {
+				opts = append(opts, cache.WithShadowMode(*tc.shadowMode))
+			}
+			c := testutils.NewCacheForTests(t, cacheDir, opts...)
+
+			var gcOpts []cache.GCOption
+			if tc.domainExpiration != nil {
+				gcOpts = append(gcOpts, cache.WithDomainExpiration(func(domain string) (int, error) {
+					days, ok := tc.domainExpiration[domain]
+					if !ok {
+						return 0, errors.New("no expiration for domain")
+					}
+					return days, nil
+				}))
+			}
+
+			r, err := c.GC(context.Background(), gcOpts...)
+			if tc.wantErr {
+				require.Error(t, err, "GC should have failed")
+				return
+			}
+			require.NoError(t, err, "GC should succeed")
+			require.Equal(t, tc.wantReport, r, "GC should report the removed entries")
+			if stamp := filepath.Join(cacheDir, "groups.stamp"); tc.wantReport.ExpiredUsers > 0 {
+				require.FileExists(t, stamp, "GC should mark the groups as changed when purging users")
+			} else {
+				require.NoFileExists(t, stamp, "GC should not mark the groups as changed without purging users")
+			}
+
+			_, err = c.GetUserByName(context.Background(), "purgeduser@domain.com")
+			if tc.wantKeepPurgedUser {
+				require.NoError(t, err, "Very old user should be kept")
+			} else {
+				require.ErrorIs(t, err, cache.ErrNoEnt, "Very old user should be purged")
+			}
+
+			r, err = c.GC(context.Background(), gcOpts...)
+			require.NoError(t, err, "GC should succeed a second time")
+			require.Equal(t, cache.GCReport{}, r, "Second GC should have nothing to remove")
+		})
+	}
+}
+
+func TestGCInactiveUsers(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		domainInactivity map[string]int
+
+		wantReport cache.GCReport
+		wantKept   []string
+		wantErr    bool
+	}{
+		"purge users without session for too long": {domainInactivity: map[string]int{"domain.com": 30, "otherdomain.com": 30}, wantReport: cache.GCReport{InactiveUsers: 2}, wantKept: []string{"otheruser@domain.com"}},
+		"keep users of domains never expiring":     {domainInactivity: map[string]int{"domain.com": 30, "otherdomain.com": 0}, wantReport: cache.GCReport{InactiveUsers: 1}, wantKept: []string{"otheruser@domain.com", "user@otherdomain.com"}},
+		"keep users with a recent session":         {domainInactivity: map[string]int{"domain.com": 36500, "otherdomain.com": 36500}, wantKept: []string{"otheruser@domain.com", "myuser@domain.com", "user@otherdomain.com"}},
+
+		// error cases
+		"error on inactivity expiration not available": {domainInactivity: map[string]int{"domain.com": 30}, wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_with_login_history")
+			c := testutils.NewCacheForTests(t, cacheDir)
+
+			r, err := c.GC(context.Background(), cache.WithDomainInactivityExpiration(func(domain string) (int, error) {
+				days, ok := tc.domainInactivity[domain]
+				if !ok {
+					return 0, errors.New("no inactivity expiration for domain")
+				}
+				return days, nil
+			}))
+			if tc.wantErr {
+				require.Error(t, err, "GC should have failed")
+				return
+			}
+			require.NoError(t, err, "GC should succeed")
+			require.Equal(t, tc.wantReport, r, "GC should report the purged users")
+
+			for _, name := range []string{"otheruser@domain.com", "myuser@domain.com", "user@otherdomain.com"} {
+				_, err := c.GetUserByName(context.Background(), name)
+				if slices.Contains(tc.wantKept, name) {
+					require.NoError(t, err, "User %q should be kept", name)
+				} else {
+					require.ErrorIs(t, err, cache.ErrNoEnt, "User %q should be purged", name)
+				}
+			}
+		})
+	}
+}
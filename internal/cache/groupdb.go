@@ -79,18 +79,21 @@ func (c *Cache) NextGroupEntry(ctx context.Context) (g GroupRecord, err error) {
 	logger.Debug(ctx, "request next group entry in db")
 
 	if c.cursorGroup == nil {
-		query := `
+		// Members which are not enumerated are not listed either.
+		cond, args := enumerationFilter(c.enumeration, "u.uid")
+		query := fmt.Sprintf(`
 		SELECT * FROM (
 			SELECT g.name, g.password, g.gid, group_concat(p.login, ',') as members
 			FROM groups g, uid_gid u, passwd p
 			WHERE u.gid = g.gid
 			AND p.uid = u.uid
+			AND %s
 			GROUP BY g.name
 		) WHERE name IS NOT NULL
 		ORDER BY name
-		`
+		`, cond)
 
-		c.cursorGroup, err = c.db.Query(query)
+		c.cursorGroup, err = c.db.Query(query, args...)
 		if err != nil {
 			return g, err
 		}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/logger"
+)
+
+// Policies applied when a new user conflicts with a local account, by name or by ID.
+const (
+	// LocalConflictsRefuse refuses to create the user.
+	LocalConflictsRefuse = "refuse"
+	// LocalConflictsRemap gives the user another UID when its own is used by a local user or group.
+	// Users named after a local account are refused, as their name can't be changed.
+	LocalConflictsRemap = "remap"
+	// LocalConflictsAdopt gives the user the UID and GID of the local user with the same name, so that it owns
+	// its files. UIDs used by other local accounts are remapped. System users, below UID_MIN of login.defs, and
+	// users of the root group are never adopted.
+	LocalConflictsAdopt = "adopt"
+
+	// loginDefsPath is the configuration of the shadow utilities, setting the range of UIDs of regular users.
+	loginDefsPath = "/etc/login.defs"
+	// defaultUIDMin is the lowest UID of regular users when login.defs doesn't set UID_MIN.
+	defaultUIDMin = 1000
+)
+
+// ErrLocalConflict is returned when a new user conflicts with a local account and the policy refuses it.
+var ErrLocalConflict = errors.New("conflict with a local account")
+
+// localAccounts looks up the accounts of the system, like the ones of /etc/passwd and /etc/group.
+type localAccounts struct {
+	lookupUser    func(name string) (*user.User, error)
+	lookupUserID  func(uid string) (*user.User, error)
+	lookupGroup   func(name string) (*user.Group, error)
+	lookupGroupID func(gid string) (*user.Group, error)
+	// uidMin returns the lowest UID of regular users, which can be adopted.
+	uidMin func() uint64
+}
+
+// nssAccounts looks up the local accounts through all the NSS sources of the system.
+var nssAccounts = &localAccounts{
+	lookupUser:    user.Lookup,
+	lookupUserID:  user.LookupId,
+	lookupGroup:   user.LookupGroup,
+	lookupGroupID: user.LookupGroupId,
+	uidMin:        func() uint64 { return uidMin(loginDefsPath) },
+}
+
+// adoptLocalAccount checks that no local user or group has the name of the new user u.
+// With the adopt policy, u takes the UID and GID of the local user with its name instead, and adopted is true.
+func (c *Cache) adoptLocalAccount(ctx context.Context, u *UserRecord) (adopted bool, err error) {
+	if lu, err := c.localAccounts.lookupUser(u.Name); found(ctx, err) && c.isLocal(ctx, lu.Uid) {
+		if c.localConflicts != LocalConflictsAdopt {
+			logger.Warn(ctx, "Refusing to create %q: a local user has the same name, with UID %s", u.Name, lu.Uid)
+			return false, fmt.Errorf(i18n.G("%q is already the name of a local user with UID %s: %w"), u.Name, lu.Uid, ErrLocalConflict)
+		}
+		if u.UID, err = strconv.ParseInt(lu.Uid, 10, 64); err != nil {
+			return false, fmt.Errorf(i18n.G("invalid UID of local user %q: %v"), u.Name, err)
+		}
+		if u.GID, err = strconv.ParseInt(lu.Gid, 10, 64); err != nil {
+			return false, fmt.Errorf(i18n.G("invalid GID of local user %q: %v"), u.Name, err)
+		}
+		// Adopting a system user or the root group would give its privileges to the Azure AD user.
+		if uidMin := c.localAccounts.uidMin(); u.UID < int64(uidMin) || u.GID == 0 {
+			logger.Warn(ctx, "Refusing to adopt the local user %q: UID %d and GID %d are the ones of a system account", u.Name, u.UID, u.GID)
+			return false, fmt.Errorf(i18n.G("%q is already the name of the system user with UID %s and GID %s, which can't be adopted: %w"),
+				u.Name, lu.Uid, lu.Gid, ErrLocalConflict)
+		}
+		logger.Warn(ctx, "Adopting the local user %q: the Azure AD user gets its UID %d and GID %d", u.Name, u.UID, u.GID)
+		return true, nil
+	}
+
+	if lg, err := c.localAccounts.lookupGroup(u.Name); found(ctx, err) && c.isLocal(ctx, lg.Gid) {
+		logger.Warn(ctx, "Refusing to create %q: a local group has the same name, with GID %s", u.Name, lg.Gid)
+		return false, fmt.Errorf(i18n.G("%q is already the name of a local group with GID %s: %w"), u.Name, lg.Gid, ErrLocalConflict)
+	}
+
+	logger.Debug(ctx, "No local account is named %q", u.Name)
+	return false, nil
+}
+
+// localIDOwner returns the description of the local user or group using id, or an empty string if there is none.
+func (c *Cache) localIDOwner(ctx context.Context, id uint32) string {
+	sid := strconv.FormatUint(uint64(id), 10)
+	if lu, err := c.localAccounts.lookupUserID(sid); found(ctx, err) && c.isLocal(ctx, sid) {
+		return fmt.Sprintf("user %q", lu.Username)
+	}
+	if lg, err := c.localAccounts.lookupGroupID(sid); found(ctx, err) && c.isLocal(ctx, sid) {
+		return fmt.Sprintf("group %q", lg.Name)
+	}
+	return ""
+}
+
+// found returns true if a lookup returning err found an account. Failures other than unknown accounts are logged
+// and ignored, so that an unreachable NSS source doesn't prevent Azure AD users from logging in.
+func found(ctx context.Context, err error) bool {
+	if err == nil {
+		return true
+	}
+	var unknownUser user.UnknownUserError
+	var unknownUserID user.UnknownUserIdError
+	var unknownGroup user.UnknownGroupError
+	var unknownGroupID user.UnknownGroupIdError
+	if !errors.As(err, &unknownUser) && !errors.As(err, &unknownUserID) && !errors.As(err, &unknownGroup) && !errors.As(err, &unknownGroupID) {
+		logger.Warn(ctx, "Could not look up local accounts, ignoring them: %v", err)
+	}
+	return false
+}
+
+// isLocal returns true if the account with ID id is not one of the cache, served by our own NSS module.
+func (c *Cache) isLocal(ctx context.Context, id string) bool {
+	v, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		logger.Warn(ctx, "Ignoring local account with invalid ID %q", id)
+		return false
+	}
+	cached, err := uidOrGidExists(c.db, uint32(v), "")
+	if err != nil {
+		logger.Warn(ctx, "Could not check if ID %d is in the cache: %v", v, err)
+	}
+	return !cached
+}
+
+// uidMin returns the UID_MIN set in the login.defs file at path, or defaultUIDMin if it is not set or can't be read.
+func uidMin(path string) uint64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return defaultUIDMin
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || fields[0] != "UID_MIN" {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 32); err == nil {
+			return v
+		}
+	}
+	return defaultUIDMin
+}
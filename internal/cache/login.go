@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-ini/ini"
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/decorate"
+)
+
+// LoginHistory describes the sessions opened by a user on this machine.
+type LoginHistory struct {
+	FirstLogin     time.Time `ini:"first_login,omitempty"`
+	LastLogin      time.Time `ini:"last_login,omitempty"`
+	LastRemoteHost string    `ini:"last_remote_host,omitempty"`
+	LoginCount     int64     `ini:"login_count"`
+}
+
+// IniString returns an ini representation of the login history as a string.
+func (h LoginHistory) IniString() (string, error) {
+	buf := new(bytes.Buffer)
+	out := ini.Empty()
+	if err := ini.ReflectFrom(out, &h); err != nil {
+		return "", err
+	}
+
+	if _, err := out.WriteTo(buf); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// RecordLogin records that username opened a session from remoteHost, empty for local sessions.
+// It returns ErrNoEnt if username is not in the cache.
+func (c *Cache) RecordLogin(ctx context.Context, username, remoteHost string) (err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't record login of user %q"), username)
+
+	if c.shadowMode != shadowRWMode {
+		return errors.New(i18n.G("logins can only be recorded by root"))
+	}
+
+	logger.Debug(ctx, "Recording login of user %q from %q", username, remoteHost)
+
+	var uid int64
+	if err := c.db.QueryRow("SELECT uid FROM passwd WHERE login = ?", username).Scan(&uid); errors.Is(err, sql.ErrNoRows) {
+		return ErrNoEnt
+	} else if err != nil {
+		return err
+	}
+
+	// The history is in the shadow database, as the passwd one is readable by everyone.
+	now := time.Now().Unix()
+	_, err = c.db.Exec(`
+	INSERT INTO shadow.login_history (uid, first_login, last_login, last_remote_host, login_count)
+	VALUES (?, ?, ?, ?, 1)
+	ON CONFLICT(uid) DO UPDATE SET
+		last_login = excluded.last_login,
+		last_remote_host = excluded.last_remote_host,
+		login_count = login_count + 1`, uid, now, now, remoteHost)
+	return err
+}
+
+// LoginHistory returns the sessions opened by username. The times are zero if they never opened one.
+// It requires read access to the shadow database.
+func (c *Cache) LoginHistory(ctx context.Context, username string) (h LoginHistory, err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't get login history of user %q"), username)
+
+	logger.Debug(ctx, "getting login history from cache for %q", username)
+
+	if c.shadowMode < shadowROMode {
+		return h, errors.New("shadow database is not available for reading")
+	}
+
+	var firstLogin, lastLogin int64
+	row := c.db.QueryRow(`
+	SELECT IFNULL(l.first_login, 0), IFNULL(l.last_login, 0), IFNULL(l.last_remote_host, ""), IFNULL(l.login_count, 0)
+	FROM passwd p
+	LEFT JOIN shadow.login_history l ON p.uid = l.uid
+	WHERE p.login = ?`, username)
+	if err := row.Scan(&firstLogin, &lastLogin, &h.LastRemoteHost, &h.LoginCount); errors.Is(err, sql.ErrNoRows) {
+		return h, ErrNoEnt
+	} else if err != nil && strings.Contains(err.Error(), "no such table") {
+		// Caches created by previous versions only get the table once opened by root: no session was recorded.
+		if exists, err := userExists(c.db, username); err != nil {
+			return h, err
+		} else if !exists {
+			return h, ErrNoEnt
+		}
+		return h, nil
+	} else if err != nil {
+		return h, err
+	}
+	if firstLogin != 0 {
+		h.FirstLogin = time.Unix(firstLogin, 0)
+	}
+	if lastLogin != 0 {
+		h.LastLogin = time.Unix(lastLogin, 0)
+	}
+
+	return h, nil
+}
@@ -0,0 +1,125 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+func TestRecordLogin(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		username     string
+		remoteHost   string
+		initialCache string
+		shadowMode   *int
+
+		wantFirstLoginKept bool
+		wantLoginCount     int64
+
+		wantErr     bool
+		wantErrType error
+	}{
+		"record first login of user":             {wantLoginCount: 1},
+		"record remote login of user":            {remoteHost: "remote.example.com", wantLoginCount: 1},
+		"record login of user who logged before": {initialCache: "users_with_login_history", wantFirstLoginKept: true, wantLoginCount: 43},
+
+		// error cases
+		"error on unknown user":        {username: "doesnotexist@domain.com", wantErr: true, wantErrType: cache.ErrNoEnt},
+		"error on shadow not writable": {shadowMode: &cache.ShadowROMode, wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.username == "" {
+				tc.username = "myuser@domain.com"
+			}
+			if tc.initialCache == "" {
+				tc.initialCache = "users_in_db"
+			}
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, tc.initialCache)
+			var opts []cache.Option
+			if tc.shadowMode != nil {
+				opts = append(opts, cache.WithShadowMode(*tc.shadowMode))
+			}
+			c := testutils.NewCacheForTests(t, cacheDir, opts...)
+			ctx := context.Background()
+
+			start := time.Now().Truncate(time.Second)
+			err := c.RecordLogin(ctx, tc.username, tc.remoteHost)
+			if tc.wantErr {
+				require.Error(t, err, "RecordLogin should have failed")
+				if tc.wantErrType != nil {
+					require.ErrorIs(t, err, tc.wantErrType, "RecordLogin should have returned the expected error")
+				}
+				return
+			}
+			require.NoError(t, err, "RecordLogin should succeed")
+
+			h, err := c.LoginHistory(ctx, tc.username)
+			require.NoError(t, err, "LoginHistory should succeed")
+			end := time.Now()
+
+			require.True(t, testutils.TimeBetweenOrEquals(h.LastLogin, start, end), "RecordLogin should record the last login")
+			if tc.wantFirstLoginKept {
+				require.Equal(t, time.Unix(1700000000, 0), h.FirstLogin, "RecordLogin should keep the first login")
+			} else {
+				require.Equal(t, h.LastLogin, h.FirstLogin, "RecordLogin should record the first login")
+			}
+			require.Equal(t, tc.remoteHost, h.LastRemoteHost, "RecordLogin should record the remote host of the last login")
+			require.Equal(t, tc.wantLoginCount, h.LoginCount, "RecordLogin should count logins")
+		})
+	}
+}
+
+func TestLoginHistory(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		username string
+
+		want        cache.LoginHistory
+		wantErrType error
+	}{
+		"user who logged in remotely": {
+			username: "myuser@domain.com",
+			want: cache.LoginHistory{
+				FirstLogin:     time.Unix(1700000000, 0),
+				LastLogin:      time.Unix(1700086400, 0),
+				LastRemoteHost: "remote.example.com",
+				LoginCount:     42,
+			},
+		},
+		"user who never logged in": {username: "otheruser@domain.com"},
+
+		// error cases
+		"error on unknown user": {username: "doesnotexist@domain.com", wantErrType: cache.ErrNoEnt},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_with_login_history")
+			c := testutils.NewCacheForTests(t, cacheDir)
+
+			h, err := c.LoginHistory(context.Background(), tc.username)
+			if tc.wantErrType != nil {
+				require.ErrorIs(t, err, tc.wantErrType, "LoginHistory should have returned the expected error")
+				return
+			}
+			require.NoError(t, err, "LoginHistory should succeed")
+			require.Equal(t, tc.want, h, "LoginHistory should return the recorded sessions")
+		})
+	}
+}
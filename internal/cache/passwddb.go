@@ -23,6 +23,7 @@ type UserRecord struct {
 	Home           string    `ini:"home"`
 	Shell          string    `ini:"shell"`
 	LastOnlineAuth time.Time `ini:"last_online_auth"`
+	UPN            string    `ini:"upn"`
 
 	// if shadow is opened
 	ShadowPasswd string `ini:"shadow_password"`
@@ -54,6 +55,8 @@ var PasswdQueryAttributes = []string{
 	"home",
 	"shell",
 	"last_online_auth",
+	"upn",
+	"gecos_pinned",
 }
 
 // PasswdUpdateAttributes returns a list of attributes that can be modified in
@@ -79,7 +82,8 @@ SELECT login,
 	gecos,
 	home,
 	shell,
-	last_online_auth
+	last_online_auth,
+	upn
 	%s
 FROM   passwd p
 %s
@@ -100,17 +104,36 @@ WHERE login = ?
 	return u, nil
 }
 
-// GetAllUserNames returns a list of all user names in the cache.
+// GetUserByUPN returns given user struct by its user principal name in Azure AD.
+// It returns an error if we couldn’t fetch the user (does not exist or not connected).
+// shadowPasswd is populated only if the shadow database is accessible.
+func (c *Cache) GetUserByUPN(ctx context.Context, upn string) (user UserRecord, err error) {
+	logger.Debug(ctx, "getting user information from cache for UPN %q", upn)
+
+	row := c.db.QueryRow("SELECT login FROM passwd WHERE upn = ?", upn)
+	var login string
+	if err := row.Scan(&login); errors.Is(err, sql.ErrNoRows) {
+		return UserRecord{}, fmt.Errorf(i18n.G("error when getting UPN %q from cache: %w"), upn, ErrNoEnt)
+	} else if err != nil {
+		return UserRecord{}, fmt.Errorf(i18n.G("error when getting UPN %q from cache: %w"), upn, err)
+	}
+
+	return c.GetUserByName(ctx, login)
+}
+
+// GetAllUserNames returns a list of all user names in the cache allowed by the enumeration policy.
 // It returns an error if we couldn’t fetch the users.
 func (c *Cache) GetAllUserNames(ctx context.Context) (users []string, err error) {
 	logger.Debug(ctx, "getting all users information from cache")
 
-	rows, err := c.db.Query("SELECT login FROM passwd")
+	cond, args := enumerationFilter(c.enumeration, "uid")
+	rows, err := c.db.Query(fmt.Sprintf("SELECT login FROM passwd WHERE %s", cond), args...)
 	if err != nil {
 		return nil, fmt.Errorf("error when getting all users from cache: %w", err)
 	}
 
-	var names []string
+	// Not nil, so that an empty list can be sent by aad-authd.
+	names := []string{}
 	defer rows.Close()
 	for rows.Next() {
 		var name string
@@ -138,7 +161,8 @@ SELECT login,
 	gecos,
 	home,
 	shell,
-	last_online_auth
+	last_online_auth,
+	upn
 	%s
 FROM   passwd p
 %s
@@ -170,11 +194,13 @@ func (c *Cache) NextPasswdEntry(ctx context.Context) (u UserRecord, err error) {
 	logger.Debug(ctx, "request next passwd entry in db")
 
 	if c.cursorPasswd == nil {
-		query := `
-		SELECT login, password, uid, gid, gecos, home, shell, last_online_auth, ''
+		cond, args := enumerationFilter(c.enumeration, "uid")
+		query := fmt.Sprintf(`
+		SELECT login, password, uid, gid, gecos, home, shell, last_online_auth, upn, ''
 		FROM passwd
-		ORDER BY login`
-		c.cursorPasswd, err = c.db.Query(query)
+		WHERE %s
+		ORDER BY login`, cond)
+		c.cursorPasswd, err = c.db.Query(query, args...)
 		if err != nil {
 			return u, err
 		}
@@ -210,7 +236,7 @@ func (c *Cache) ClosePasswdIterator(ctx context.Context) error {
 // It returns ErrNoEnt in case of no element found.
 func newUserFromScanner(r rowScanner) (u UserRecord, err error) {
 	var lastlogin int64
-	if err := r.Scan(&u.Name, &u.Passwd, &u.UID, &u.GID, &u.Gecos, &u.Home, &u.Shell, &lastlogin, &u.ShadowPasswd); err != nil {
+	if err := r.Scan(&u.Name, &u.Passwd, &u.UID, &u.GID, &u.Gecos, &u.Home, &u.Shell, &lastlogin, &u.UPN, &u.ShadowPasswd); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			err = ErrNoEnt
 		}
@@ -223,7 +249,7 @@ func newUserFromScanner(r rowScanner) (u UserRecord, err error) {
 
 // uidOrGidExists check if uid in passwd or gid in groups does exists.
 func uidOrGidExists(db *sql.DB, id uint32, username string) (bool, error) {
-	row := db.QueryRow("SELECT login,'',-1,-1,-1,-1,-1,-1,-1 from passwd where uid = ? UNION SELECT name,'',-1,-1,-1,-1,-1,-1,-1 from groups where gid = ?", id, id)
+	row := db.QueryRow("SELECT login,'',-1,-1,-1,-1,-1,-1,'',-1 from passwd where uid = ? UNION SELECT name,'',-1,-1,-1,-1,-1,-1,'',-1 from groups where gid = ?", id, id)
 
 	u, err := newUserFromScanner(row)
 	if errors.Is(err, ErrNoEnt) {
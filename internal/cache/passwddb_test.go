@@ -76,6 +76,46 @@ func TestGetUserByName(t *testing.T) {
 	}
 }
 
+func TestGetUserByUPN(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		upn string
+
+		wantName string
+		wantErr  bool
+	}{
+		"get existing user by UPN":           {upn: "myuser@domain.com", wantName: "myuser@domain.com"},
+		"get existing guest user by UPN":     {upn: "success_guest.com#ext#@otherdomain.com", wantName: "success_guest.com"},
+		"get existing user by differing UPN": {upn: "foo bar@domain.com", wantName: "foo.bar@domain.com"},
+
+		// error cases
+		"error on non existing UPN":      {upn: "notexist@domain.com", wantErr: true},
+		"error on POSIX name not an UPN": {upn: "foo.bar@domain.com", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_with_upn")
+
+			c := testutils.NewCacheForTests(t, cacheDir)
+
+			u, err := c.GetUserByUPN(context.Background(), tc.upn)
+			if tc.wantErr {
+				require.Error(t, err, "GetUserByUPN should have returned an error and hasn’t")
+				assert.ErrorIs(t, err, cache.ErrNoEnt, "Known error returned should be of type ErrNoEnt")
+				return
+			}
+			require.NoError(t, err, "GetUserByUPN should not have returned an error and has")
+			require.Equal(t, tc.wantName, u.Name, "GetUserByUPN should return the user bound to the UPN")
+			require.Equal(t, tc.upn, u.UPN, "GetUserByUPN should return the UPN of the user")
+		})
+	}
+}
+
 func TestGetUserByUID(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-ini/ini"
+	"github.com/ubuntu/aad-auth/internal/consts"
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/decorate"
+)
+
+// ErrCredentialsRevoked is returned when the offline credentials of the user were revoked after a definitive denial
+// from Azure AD.
+var ErrCredentialsRevoked = errors.New("offline credentials revoked")
+
+// lockedPasswordPrefix is prepended to the hash of locked shadow passwords, as passwd -l does.
+const lockedPasswordPrefix = "!"
+
+// RevocationRecord describes why and when the offline credentials of a user were revoked.
+type RevocationRecord struct {
+	RevokedAt time.Time `ini:"revoked_at"`
+	Reason    string    `ini:"reason"`
+}
+
+// IniString returns an ini representation of the revocation record as a string.
+func (r RevocationRecord) IniString() (string, error) {
+	buf := new(bytes.Buffer)
+	out := ini.Empty()
+	if err := ini.ReflectFrom(out, &r); err != nil {
+		return "", err
+	}
+
+	if _, err := out.WriteTo(buf); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// Revoke locks the cached password of username so that they can't authenticate offline anymore, and records the
+// reason. Their passwd entry is kept, so that the ownership of their files still resolves.
+// If upn is not empty, username is only revoked if it is bound to upn, or to no UPN at all.
+// A successful online authentication through Update lifts the revocation.
+func (c *Cache) Revoke(ctx context.Context, username, upn, reason string) (err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't revoke offline credentials of user %q"), username)
+
+	if c.shadowMode != shadowRWMode {
+		return errors.New(i18n.G("the offline credentials can only be revoked by root"))
+	}
+
+	user, err := c.GetUserByName(ctx, username)
+	if err != nil {
+		return err
+	}
+	if upn != "" && user.UPN != "" && user.UPN != upn {
+		return fmt.Errorf(i18n.G("user %q is bound to %q, not to %q: %w"), username, user.UPN, upn, ErrUPNMismatch)
+	}
+
+	logger.Warn(logger.CtxWithMessageID(ctx, consts.MessageIDCredentialsRevoked), "Revoking offline credentials of user %q: %s", username, reason)
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // The rollback will be ignored if the tx has been committed later in the function.
+
+	if _, err := tx.Exec("UPDATE shadow.shadow SET password = ? || password WHERE uid = ? AND password NOT LIKE ?",
+		lockedPasswordPrefix, user.UID, lockedPasswordPrefix+"%"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO shadow.revocations (uid, revoked_at, reason) VALUES (?, ?, ?)",
+		user.UID, time.Now().Unix(), reason); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Revocation returns why and when the offline credentials of username were revoked.
+// It returns ErrNoEnt if they are not revoked.
+func (c *Cache) Revocation(ctx context.Context, username string) (r RevocationRecord, err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't get revocation of user %q"), username)
+
+	logger.Debug(ctx, "getting revocation information from cache for %q", username)
+
+	if c.shadowMode < shadowROMode {
+		return r, errors.New("shadow database is not available for reading")
+	}
+
+	var revokedAt int64
+	row := c.db.QueryRow(`
+	SELECT r.revoked_at, r.reason
+	FROM passwd p, shadow.revocations r
+	WHERE p.uid = r.uid
+	AND p.login = ?`, username)
+	if err := row.Scan(&revokedAt, &r.Reason); errors.Is(err, sql.ErrNoRows) {
+		return r, ErrNoEnt
+	} else if err != nil && strings.Contains(err.Error(), "no such table") {
+		// Caches created by previous versions only get the table once opened by root.
+		return r, ErrNoEnt
+	} else if err != nil {
+		return r, err
+	}
+	r.RevokedAt = time.Unix(revokedAt, 0)
+
+	return r, nil
+}
+
+// isLocked returns true if the shadow password was locked by Revoke.
+func isLocked(shadowPasswd string) bool {
+	return strings.HasPrefix(shadowPasswd, lockedPasswordPrefix)
+}
@@ -0,0 +1,109 @@
+package cache_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+func TestRevoke(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		username     string
+		upn          string
+		initialCache string
+		revokeTwice  bool
+		shadowMode   *int
+
+		wantErr     bool
+		wantErrType error
+	}{
+		"revoke cached user":                   {},
+		"revoke twice only locks once":         {revokeTwice: true},
+		"revoke user bound to the same UPN":    {initialCache: "users_with_upn", upn: "myuser@domain.com"},
+		"revoke user not bound to any UPN yet": {upn: "myuser@domain.com"},
+
+		// error cases
+		"error on unknown user":              {username: "doesnotexist@domain.com", wantErr: true, wantErrType: cache.ErrNoEnt},
+		"error on user bound to another UPN": {initialCache: "users_with_upn", upn: "other@domain.com", wantErr: true, wantErrType: cache.ErrUPNMismatch},
+		"error on shadow not writable":       {shadowMode: &cache.ShadowROMode, wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.username == "" {
+				tc.username = "myuser@domain.com"
+			}
+			if tc.initialCache == "" {
+				tc.initialCache = "users_in_db"
+			}
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, tc.initialCache)
+			var opts []cache.Option
+			if tc.shadowMode != nil {
+				opts = append(opts, cache.WithShadowMode(*tc.shadowMode))
+			}
+			c := testutils.NewCacheForTests(t, cacheDir, opts...)
+			ctx := context.Background()
+
+			start := time.Now().Truncate(time.Second)
+			err := c.Revoke(ctx, tc.username, tc.upn, "account disabled")
+			if tc.wantErr {
+				require.Error(t, err, "Revoke should have failed")
+				if tc.wantErrType != nil {
+					require.ErrorIs(t, err, tc.wantErrType, "Revoke should have returned the expected error")
+				}
+				return
+			}
+			require.NoError(t, err, "Revoke should succeed")
+			if tc.revokeTwice {
+				require.NoError(t, c.Revoke(ctx, tc.username, tc.upn, "no such user"), "Revoke should succeed a second time")
+			}
+
+			err = c.CanAuthenticate(ctx, tc.username, "my password")
+			require.ErrorIs(t, err, cache.ErrCredentialsRevoked, "Revoked user should not authenticate offline")
+
+			u, err := c.GetUserByName(ctx, tc.username)
+			require.NoError(t, err, "Revoked user should still be in passwd")
+			require.Equal(t, 1, strings.Count(u.ShadowPasswd, "!"), "Shadow password should be locked once")
+
+			r, err := c.Revocation(ctx, tc.username)
+			require.NoError(t, err, "Revocation should be recorded")
+			wantReason := "account disabled"
+			if tc.revokeTwice {
+				wantReason = "no such user"
+			}
+			require.Equal(t, wantReason, r.Reason, "Revocation should record the reason")
+			require.True(t, testutils.TimeBetweenOrEquals(r.RevokedAt, start, time.Now()), "Revocation should record when it happened")
+
+			// A successful online authentication lifts the revocation.
+			require.NoError(t, c.Update(ctx, tc.username, "new password", "/home/%f", "/bin/bash"), "Update should succeed")
+			require.NoError(t, c.CanAuthenticate(ctx, tc.username, "new password"), "User should authenticate offline after an online authentication")
+			_, err = c.Revocation(ctx, tc.username)
+			require.ErrorIs(t, err, cache.ErrNoEnt, "Revocation should be lifted after an online authentication")
+		})
+	}
+}
+
+func TestRevocation(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := t.TempDir()
+	testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+	c := testutils.NewCacheForTests(t, cacheDir)
+
+	_, err := c.Revocation(context.Background(), "myuser@domain.com")
+	require.ErrorIs(t, err, cache.ErrNoEnt, "Revocation should return ErrNoEnt for users not revoked")
+
+	_, err = c.Revocation(context.Background(), "doesnotexist@domain.com")
+	require.ErrorIs(t, err, cache.ErrNoEnt, "Revocation should return ErrNoEnt for unknown users")
+}
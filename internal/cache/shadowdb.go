@@ -56,13 +56,16 @@ func (c *Cache) NextShadowEntry(ctx context.Context) (swr ShadowRecord, err erro
 	logger.Debug(ctx, "request next shadow entry in db")
 
 	if c.cursorShadow == nil {
-		query := `
+		cond, args := enumerationFilter(c.enumeration, "p.uid")
+		query := fmt.Sprintf(`
 		SELECT p.login, s.password, s.last_pwd_change, s.min_pwd_age, s.max_pwd_age, s.pwd_warn_period, s.pwd_inactivity, s.expiration_date
 		FROM passwd p, shadow.shadow s
 		WHERE p.uid = s.uid
-		`
+		AND %s
+		ORDER BY p.login
+		`, cond)
 
-		c.cursorShadow, err = c.db.Query(query)
+		c.cursorShadow, err = c.db.Query(query, args...)
 		if err != nil {
 			return swr, err
 		}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/decorate"
+	"golang.org/x/crypto/ssh"
+)
+
+// fingerprintPrefix prefixes the SHA256 fingerprints of SSH public keys, as printed by ssh-keygen -l.
+const fingerprintPrefix = "SHA256:"
+
+// SSHKey is an SSH public key of a user.
+type SSHKey struct {
+	// Key is the public key in the authorized_keys format, with its comment if any.
+	Key string
+	// Fingerprint is the SHA256 fingerprint of the key.
+	Fingerprint string
+	// AddedAt is when the key was added.
+	AddedAt time.Time
+}
+
+// parseSSHKey returns the public key of the authorized_keys line key, normalised and with its fingerprint.
+// Key options are refused, as they would be applied to every login of the user.
+func parseSSHKey(key string) (SSHKey, error) {
+	pub, comment, options, rest, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return SSHKey{}, fmt.Errorf(i18n.G("invalid SSH public key: %v"), err)
+	}
+	if len(options) > 0 {
+		return SSHKey{}, errors.New(i18n.G("SSH public keys with options are not supported"))
+	}
+	if len(strings.TrimSpace(string(rest))) > 0 {
+		return SSHKey{}, errors.New(i18n.G("only one SSH public key can be passed"))
+	}
+
+	k := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		k += " " + comment
+	}
+	return SSHKey{Key: k, Fingerprint: ssh.FingerprintSHA256(pub)}, nil
+}
+
+// AddSSHKey adds the SSH public key, in the authorized_keys format, to the keys username can log in with.
+// It returns the added key, or ErrNoEnt if username is not in the cache.
+func (c *Cache) AddSSHKey(ctx context.Context, username, key string) (k SSHKey, err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't add SSH key of user %q"), username)
+
+	if c.shadowMode != shadowRWMode {
+		return k, errors.New(i18n.G("SSH keys can only be added by root"))
+	}
+
+	if k, err = parseSSHKey(key); err != nil {
+		return k, err
+	}
+
+	user, err := c.GetUserByName(ctx, username)
+	if err != nil {
+		return k, err
+	}
+
+	logger.Debug(ctx, "Adding SSH key %s of user %q", k.Fingerprint, username)
+
+	var exists bool
+	row := c.db.QueryRow("SELECT EXISTS(SELECT 1 FROM shadow.ssh_keys WHERE uid = ? AND fingerprint = ?)", user.UID, k.Fingerprint)
+	if err := row.Scan(&exists); err != nil {
+		return k, err
+	}
+	if exists {
+		return k, fmt.Errorf(i18n.G("key %s is already added"), k.Fingerprint)
+	}
+
+	k.AddedAt = time.Unix(time.Now().Unix(), 0)
+	if _, err := c.db.Exec("INSERT INTO shadow.ssh_keys (uid, fingerprint, key, added_at) VALUES (?, ?, ?, ?)",
+		user.UID, k.Fingerprint, k.Key, k.AddedAt.Unix()); err != nil {
+		return k, err
+	}
+
+	return k, nil
+}
+
+// RemoveSSHKey removes an SSH public key of username, passed either in the authorized_keys format or as its SHA256
+// fingerprint. It returns ErrNoEnt if username is not in the cache or doesn't have this key.
+func (c *Cache) RemoveSSHKey(ctx context.Context, username, key string) (err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't remove SSH key of user %q"), username)
+
+	if c.shadowMode != shadowRWMode {
+		return errors.New(i18n.G("SSH keys can only be removed by root"))
+	}
+
+	fingerprint := strings.TrimSpace(key)
+	if !strings.HasPrefix(fingerprint, fingerprintPrefix) {
+		k, err := parseSSHKey(key)
+		if err != nil {
+			return err
+		}
+		fingerprint = k.Fingerprint
+	}
+
+	user, err := c.GetUserByName(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug(ctx, "Removing SSH key %s of user %q", fingerprint, username)
+
+	res, err := c.db.Exec("DELETE FROM shadow.ssh_keys WHERE uid = ? AND fingerprint = ?", user.UID, fingerprint)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf(i18n.G("no key %s: %w"), fingerprint, ErrNoEnt)
+	}
+
+	return nil
+}
+
+// SSHKeys returns the SSH public keys of username, by order of addition. It requires read access to the shadow
+// database, which holds them. It returns ErrNoEnt if username is not in the cache.
+func (c *Cache) SSHKeys(ctx context.Context, username string) (keys []SSHKey, err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't get SSH keys of user %q"), username)
+
+	logger.Debug(ctx, "getting SSH keys from cache for %q", username)
+
+	if c.shadowMode < shadowROMode {
+		return nil, errors.New("shadow database is not available for reading")
+	}
+
+	exists, err := userExists(c.db, username)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNoEnt
+	}
+
+	rows, err := c.db.Query(`
+	SELECT fingerprint, key, added_at FROM shadow.ssh_keys
+	WHERE uid = (SELECT uid FROM passwd WHERE login = ?)
+	ORDER BY added_at, rowid`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k SSHKey
+		var addedAt int64
+		if err := rows.Scan(&k.Fingerprint, &k.Key, &addedAt); err != nil {
+			return nil, err
+		}
+		k.AddedAt = time.Unix(addedAt, 0)
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// AuthorizedKeys returns the SSH public keys username can log in with. They are only returned if username can
+// authenticate offline: no key is returned if their offline credentials are revoked or expired, as their account may
+// have been disabled in Azure AD since then.
+func (c *Cache) AuthorizedKeys(ctx context.Context, username string) (keys []SSHKey, err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't get authorized keys of user %q"), username)
+
+	logger.Info(ctx, "getting authorized keys of %q from cache", username)
+
+	// The account state is in the shadow database: refuse keys when it can't be checked.
+	if c.shadowMode < shadowROMode {
+		return nil, errors.New("shadow database is not available for reading")
+	}
+
+	if c.offlineCredentialsExpiration < 0 {
+		return nil, ErrOfflineAuthDisabled
+	}
+
+	user, err := c.GetUserByName(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if isLocked(user.ShadowPasswd) {
+		return nil, ErrCredentialsRevoked
+	}
+	if expiry := c.credentialsExpiry(user); !expiry.IsZero() && time.Now().After(expiry) {
+		return nil, ErrOfflineCredentialsExpired
+	}
+
+	return c.SSHKeys(ctx, username)
+}
@@ -0,0 +1,274 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+const (
+	// rsaKey is a key none of the users of the users_with_ssh_keys cache has.
+	rsaKey            = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDsbdC8tih2bTYV5Xl4XvYzpH6vePrgByTxevAu6jq9fwLmyY2sBaEtFkd1B1+jL/BVNmhMFohZYXR5dl47pPQSkPdZWIgrElDLkaZt1/R7RaiXjfIPncfVayaEHLoecL4r5yYCq94UeXZW0+12OB6BFN9eW6Sg7mdWW84wejqqpKXDEgu3UXhnkmd+JTu8Md8ZRQ6XocLQJKqVw/JxdZFZt/XLrm4/YCqpqB3GTM1KWlyoQQ5/hZRo2MsKS+nX9xWDHyh4vHG3RjUGd++dbd1KxDkEvinJI08V1xQJs9ppHsajtU9opgzg7Pd8vsDKEQty3wZeBAouV8o15hIqPsPd rsa@example.com"
+	rsaKeyFingerprint = "SHA256:tCARZ4uULOrHkKaJTIbGq0OfmyzKnyCZrgPr58nS4MA"
+
+	// myUserKey is the first key of myuser@domain.com in the users_with_ssh_keys cache.
+	myUserKey            = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDnJ5xSY/GA53Oo4wEaJBbX8oZ/DeLeQ+yRxkmQ1U4bf a@example.com"
+	myUserKeyFingerprint = "SHA256:sXtXL1f98zioUEWe6RbqRYzwCYwEULcS62c0XIYaIvc"
+	// myUserOtherKeyFingerprint is the fingerprint of the second key of myuser@domain.com.
+	myUserOtherKeyFingerprint = "SHA256:NGTiZecHrBq+i2ibp3ho6XlV3NmKRnnVzPQ2uiW7KfQ"
+)
+
+func TestAddSSHKey(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		username   string
+		key        string
+		shadowMode *int
+
+		wantKey         string
+		wantFingerprint string
+
+		wantErr     bool
+		wantErrType error
+	}{
+		"add key":                             {key: rsaKey},
+		"add key of user without keys":        {username: "user@otherdomain.com", key: rsaKey},
+		"add key already added to other user": {username: "user@otherdomain.com", key: myUserKey, wantKey: myUserKey, wantFingerprint: myUserKeyFingerprint},
+		"add key without comment":             {key: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDnJ5xSY/GA53Oo4wEaJBbX8oZ/DeLeQ+yRxkmQ1U4bf", username: "user@otherdomain.com", wantKey: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDnJ5xSY/GA53Oo4wEaJBbX8oZ/DeLeQ+yRxkmQ1U4bf", wantFingerprint: myUserKeyFingerprint},
+		"add key with extra spaces":           {key: "  " + rsaKey + "\n"},
+
+		// error cases
+		"error on key already added":   {key: myUserKey, wantErr: true},
+		"error on invalid key":         {key: "ssh-ed25519 notbase64", wantErr: true},
+		"error on empty key":           {key: "", wantErr: true},
+		"error on key with options":    {key: `from="10.0.0.1" ` + rsaKey, wantErr: true},
+		"error on multiple keys":       {key: rsaKey + "\n" + myUserKey, wantErr: true},
+		"error on unknown user":        {username: "doesnotexist@domain.com", key: rsaKey, wantErr: true, wantErrType: cache.ErrNoEnt},
+		"error on shadow not writable": {key: rsaKey, shadowMode: &cache.ShadowROMode, wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.username == "" {
+				tc.username = "myuser@domain.com"
+			}
+			if tc.wantKey == "" {
+				tc.wantKey, tc.wantFingerprint = rsaKey, rsaKeyFingerprint
+			}
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_with_ssh_keys")
+			var opts []cache.Option
+			if tc.shadowMode != nil {
+				opts = append(opts, cache.WithShadowMode(*tc.shadowMode))
+			}
+			c := testutils.NewCacheForTests(t, cacheDir, opts...)
+			ctx := context.Background()
+
+			start := time.Now().Truncate(time.Second)
+			k, err := c.AddSSHKey(ctx, tc.username, tc.key)
+			if tc.wantErr {
+				require.Error(t, err, "AddSSHKey should have failed")
+				if tc.wantErrType != nil {
+					require.ErrorIs(t, err, tc.wantErrType, "AddSSHKey should have returned the expected error")
+				}
+				return
+			}
+			require.NoError(t, err, "AddSSHKey should succeed")
+			end := time.Now()
+
+			require.Equal(t, tc.wantKey, k.Key, "AddSSHKey should return the normalised key")
+			require.Equal(t, tc.wantFingerprint, k.Fingerprint, "AddSSHKey should return the fingerprint of the key")
+			require.True(t, testutils.TimeBetweenOrEquals(k.AddedAt, start, end), "AddSSHKey should return when the key was added")
+
+			keys, err := c.SSHKeys(ctx, tc.username)
+			require.NoError(t, err, "SSHKeys should succeed")
+			require.Equal(t, k, keys[len(keys)-1], "AddSSHKey should have stored the key after the existing ones")
+		})
+	}
+}
+
+func TestRemoveSSHKey(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		username   string
+		key        string
+		shadowMode *int
+
+		wantErr     bool
+		wantErrType error
+	}{
+		"remove key by fingerprint": {key: myUserKeyFingerprint},
+		"remove key":                {key: myUserKey},
+		"remove key with other comment": {
+			key: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDnJ5xSY/GA53Oo4wEaJBbX8oZ/DeLeQ+yRxkmQ1U4bf other comment",
+		},
+
+		// error cases
+		"error on key not added":         {key: rsaKey, wantErr: true, wantErrType: cache.ErrNoEnt},
+		"error on key of other user":     {username: "user@otherdomain.com", key: myUserKeyFingerprint, wantErr: true, wantErrType: cache.ErrNoEnt},
+		"error on invalid key":           {key: "ssh-ed25519 notbase64", wantErr: true},
+		"error on unknown user":          {username: "doesnotexist@domain.com", key: myUserKeyFingerprint, wantErr: true, wantErrType: cache.ErrNoEnt},
+		"error on shadow not writable":   {key: myUserKeyFingerprint, shadowMode: &cache.ShadowROMode, wantErr: true},
+		"error on unknown fingerprint":   {key: rsaKeyFingerprint, wantErr: true, wantErrType: cache.ErrNoEnt},
+		"error on fingerprint with typo": {key: myUserKeyFingerprint + "x", wantErr: true, wantErrType: cache.ErrNoEnt},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.username == "" {
+				tc.username = "myuser@domain.com"
+			}
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_with_ssh_keys")
+			var opts []cache.Option
+			if tc.shadowMode != nil {
+				opts = append(opts, cache.WithShadowMode(*tc.shadowMode))
+			}
+			c := testutils.NewCacheForTests(t, cacheDir, opts...)
+			ctx := context.Background()
+
+			err := c.RemoveSSHKey(ctx, tc.username, tc.key)
+			if tc.wantErr {
+				require.Error(t, err, "RemoveSSHKey should have failed")
+				if tc.wantErrType != nil {
+					require.ErrorIs(t, err, tc.wantErrType, "RemoveSSHKey should have returned the expected error")
+				}
+				return
+			}
+			require.NoError(t, err, "RemoveSSHKey should succeed")
+
+			keys, err := c.SSHKeys(ctx, tc.username)
+			require.NoError(t, err, "SSHKeys should succeed")
+			require.Len(t, keys, 1, "RemoveSSHKey should only have removed one key")
+			require.Equal(t, myUserOtherKeyFingerprint, keys[0].Fingerprint, "RemoveSSHKey should have kept the other key")
+		})
+	}
+}
+
+func TestSSHKeys(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		username           string
+		shadowNotAvailable bool
+
+		wantFingerprints []string
+		wantFirstKey     string
+		wantErr          bool
+		wantErrType      error
+	}{
+		"keys by order of addition": {username: "myuser@domain.com", wantFingerprints: []string{myUserKeyFingerprint, myUserOtherKeyFingerprint}, wantFirstKey: myUserKey},
+		"user without keys":         {username: "user@otherdomain.com"},
+		"keys of revoked user":      {username: "otheruser@domain.com", wantFingerprints: []string{"SHA256:JSyBSMxVwur33zEEvdYKPDrCdzQIf2TRvjFIiMUQG3o"}},
+
+		// error cases
+		"error on unknown user":         {username: "doesnotexist@domain.com", wantErr: true, wantErrType: cache.ErrNoEnt},
+		"error on shadow not available": {username: "myuser@domain.com", shadowNotAvailable: true, wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_with_ssh_keys")
+			// Public keys are stored in the shadow database, which is enough to read them.
+			shadowMode := cache.ShadowROMode
+			if tc.shadowNotAvailable {
+				shadowMode = cache.ShadowNotAvailableMode
+			}
+			c := testutils.NewCacheForTests(t, cacheDir, cache.WithShadowMode(shadowMode))
+
+			keys, err := c.SSHKeys(context.Background(), tc.username)
+			if tc.wantErr {
+				require.Error(t, err, "SSHKeys should have failed")
+				if tc.wantErrType != nil {
+					require.ErrorIs(t, err, tc.wantErrType, "SSHKeys should have returned the expected error")
+				}
+				return
+			}
+			require.NoError(t, err, "SSHKeys should succeed")
+
+			var got []string
+			for _, k := range keys {
+				got = append(got, k.Fingerprint)
+			}
+			require.Equal(t, tc.wantFingerprints, got, "SSHKeys should return the keys of the user")
+			if tc.wantFirstKey != "" {
+				require.Equal(t, tc.wantFirstKey, keys[0].Key, "SSHKeys should return the keys in the authorized_keys format")
+				require.Equal(t, time.Unix(1700000000, 0), keys[0].AddedAt, "SSHKeys should return when the keys were added")
+			}
+		})
+	}
+}
+
+func TestAuthorizedKeys(t *testing.T) {
+	t.Parallel()
+
+	offlineAuthDisabled := -1
+	noExpiration := 0
+
+	tests := map[string]struct {
+		username   string
+		expiration *int
+		shadowMode *int
+
+		wantKeys    int
+		wantErr     bool
+		wantErrType error
+	}{
+		"keys of user":                              {username: "myuser@domain.com", wantKeys: 2},
+		"no keys for user without keys":             {username: "user@otherdomain.com"},
+		"keys of expired user if expiration is off": {username: "expireduser@domain.com", expiration: &noExpiration, wantKeys: 1},
+		"keys with shadow read only":                {username: "myuser@domain.com", shadowMode: &cache.ShadowROMode, wantKeys: 2},
+
+		// error cases
+		"error on revoked user":                      {username: "otheruser@domain.com", wantErr: true, wantErrType: cache.ErrCredentialsRevoked},
+		"error on expired user":                      {username: "expireduser@domain.com", wantErr: true, wantErrType: cache.ErrOfflineCredentialsExpired},
+		"error on offline auth disabled":             {username: "myuser@domain.com", expiration: &offlineAuthDisabled, wantErr: true, wantErrType: cache.ErrOfflineAuthDisabled},
+		"error on unknown user":                      {username: "doesnotexist@domain.com", wantErr: true, wantErrType: cache.ErrNoEnt},
+		"error on shadow not available":              {username: "myuser@domain.com", shadowMode: &cache.ShadowNotAvailableMode, wantErr: true},
+		"error on revoked user if expiration is off": {username: "otheruser@domain.com", expiration: &noExpiration, wantErr: true, wantErrType: cache.ErrCredentialsRevoked},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_with_ssh_keys")
+			var opts []cache.Option
+			if tc.expiration != nil {
+				opts = append(opts, cache.WithOfflineCredentialsExpiration(*tc.expiration))
+			}
+			if tc.shadowMode != nil {
+				opts = append(opts, cache.WithShadowMode(*tc.shadowMode))
+			}
+			c := testutils.NewCacheForTests(t, cacheDir, opts...)
+
+			keys, err := c.AuthorizedKeys(context.Background(), tc.username)
+			if tc.wantErr {
+				require.Error(t, err, "AuthorizedKeys should have failed")
+				require.Empty(t, keys, "AuthorizedKeys should not return any key on failure")
+				if tc.wantErrType != nil {
+					require.ErrorIs(t, err, tc.wantErrType, "AuthorizedKeys should have returned the expected error")
+				}
+				return
+			}
+			require.NoError(t, err, "AuthorizedKeys should succeed")
+			require.Len(t, keys, tc.wantKeys, "AuthorizedKeys should return the keys of the user")
+		})
+	}
+}
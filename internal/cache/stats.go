@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/decorate"
+)
+
+// Stats describes the content of the cache, as reported in the metrics.
+type Stats struct {
+	// Users is the number of users in the cache.
+	Users int
+	// DatabaseSizes is the size in bytes of each cache database, by name. The shadow database is only reported when
+	// it is readable.
+	DatabaseSizes map[string]int64
+}
+
+// Stats returns the number of users in the cache and the size of its databases.
+func (c *Cache) Stats(ctx context.Context) (s Stats, err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't get cache statistics"))
+
+	logger.Debug(ctx, "Getting cache statistics")
+
+	if err := c.db.QueryRow("SELECT COUNT(*) FROM passwd").Scan(&s.Users); err != nil {
+		return Stats{}, err
+	}
+
+	dbs := map[string]string{"passwd": "main"}
+	if c.shadowMode > shadowNotAvailableMode {
+		dbs["shadow"] = "shadow"
+	}
+	s.DatabaseSizes = make(map[string]int64)
+	for name, schema := range dbs {
+		var pages, pageSize int64
+		// #nosec:G202 - schema is one of our constant database names.
+		if err := c.db.QueryRow("PRAGMA " + schema + ".page_count").Scan(&pages); err != nil {
+			return Stats{}, err
+		}
+		// #nosec:G202 - schema is one of our constant database names.
+		if err := c.db.QueryRow("PRAGMA " + schema + ".page_size").Scan(&pageSize); err != nil {
+			return Stats{}, err
+		}
+		s.DatabaseSizes[name] = pages * pageSize
+	}
+
+	return s, nil
+}
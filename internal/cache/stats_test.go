@@ -0,0 +1,50 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		initialCache string
+		shadowMode   *int
+
+		wantUsers     int
+		wantDatabases []string
+	}{
+		"users in cache":      {initialCache: "users_in_db", wantUsers: 3, wantDatabases: []string{"passwd", "shadow"}},
+		"empty cache":         {wantDatabases: []string{"passwd", "shadow"}},
+		"shadow not readable": {initialCache: "users_in_db", shadowMode: &cache.ShadowNotAvailableMode, wantUsers: 3, wantDatabases: []string{"passwd"}},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			if tc.initialCache != "" {
+				testutils.PrepareDBsForTests(t, cacheDir, tc.initialCache)
+			}
+			var opts []cache.Option
+			if tc.shadowMode != nil {
+				opts = append(opts, cache.WithShadowMode(*tc.shadowMode))
+			}
+			c := testutils.NewCacheForTests(t, cacheDir, opts...)
+
+			s, err := c.Stats(context.Background())
+			require.NoError(t, err, "Stats should succeed")
+			require.Equal(t, tc.wantUsers, s.Users, "Stats should count the users")
+			require.Len(t, s.DatabaseSizes, len(tc.wantDatabases), "Stats should report the size of the readable databases")
+			for _, db := range tc.wantDatabases {
+				require.Positive(t, s.DatabaseSizes[db], "Stats should report the size of database %q", db)
+			}
+		})
+	}
+}
@@ -5,18 +5,65 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/go-ini/ini"
 	"github.com/ubuntu/aad-auth/internal/i18n"
 	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/aad-auth/internal/user"
 	"github.com/ubuntu/decorate"
 )
 
 const (
 	adduserConfPath = "/etc/adduser.conf"
 
+	// dropInDirSuffix is appended to the configuration file path to get the default drop-in directory.
+	dropInDirSuffix = ".d"
+	// builtinOrigin is the origin of values which are not set in any file.
+	builtinOrigin = "built-in default"
+
+	// netBIOSDomainsKey and invalidCharsReplacementKey are the keys of the user name normalisation configuration.
+	netBIOSDomainsKey          = "netbios_domains"
+	invalidCharsReplacementKey = "invalid_chars_replacement"
+	// enumerationKey is the key of the NSS enumeration policy.
+	enumerationKey = "enumeration"
+	// inlineCacheCleanupKey is the key restoring the purge of expired users when the cache is opened.
+	inlineCacheCleanupKey = "inline_cache_cleanup"
+	// strictDomainsKey and allowedDomainsKey are the keys restricting the domains users are authenticated for.
+	strictDomainsKey  = "strict_domains"
+	allowedDomainsKey = "allowed_domains"
+	// localConflictsKey is the key of the policy applied when a new user conflicts with a local account.
+	localConflictsKey = "local_conflicts"
+	// metricsDirKey is the key of the directory the metrics are written to, for the node exporter textfile collector.
+	metricsDirKey = "metrics_dir"
+	// gecosClaimsKey is the key of the ID token claims filling the GECOS field.
+	gecosClaimsKey = "gecos_claims"
+
+	// enumerateAll and enumerateNone are the values of the enumeration policy, besides a list of names, as accepted
+	// by cache.WithEnumeration.
+	enumerateAll  = "all"
+	enumerateNone = "none"
+	// localConflictsRefuse, localConflictsRemap and localConflictsAdopt are the policies applied when a new user
+	// conflicts with a local account, as accepted by cache.WithLocalConflicts.
+	localConflictsRefuse = "refuse"
+	localConflictsRemap  = "remap"
+	localConflictsAdopt  = "adopt"
+
+	// guestUsersAllow and guestUsersDeny are the accepted values of the guest_users policy.
+	guestUsersAllow = "allow"
+	guestUsersDeny  = "deny"
+
 	defaultHomePattern = "/home/%f"
 	defaultShell       = "/bin/bash"
+	// defaultOfflineExpirationWarning is the number of days before offline credentials expire to warn users.
+	defaultOfflineExpirationWarning = 7
+	// defaultGECOSClaims fills the full name of the GECOS field with the display name of the user.
+	defaultGECOSClaims = "name"
+	// maxGECOSClaims is the number of comma separated subfields of the GECOS field: full name, office, office phone,
+	// home phone and other.
+	maxGECOSClaims = 5
 )
 
 // AAD represents the configuration values that are used for AAD.
@@ -26,6 +73,47 @@ type AAD struct {
 	OfflineCredentialsExpiration *int   `ini:"offline_credentials_expiration"`
 	HomeDirPattern               string `ini:"homedir"`
 	Shell                        string `ini:"shell"`
+	GuestUsers                   string `ini:"guest_users"`
+	OfflineExpirationWarning     int    `ini:"offline_expiration_warning"`
+	Access                       string `ini:"access"`
+	GECOSClaims                  string `ini:"gecos_claims"`
+	InactiveUsersExpiration      int    `ini:"inactive_users_expiration"`
+}
+
+// GECOSClaimNames returns the names of the ID token claims filling the subfields of the GECOS field, in order.
+// Empty names leave their subfield empty. It returns nil if the GECOS field is not filled from the ID token.
+func (a AAD) GECOSClaimNames() []string {
+	claims, _ := parseGECOSClaims(a.GECOSClaims)
+	return claims
+}
+
+// AllowsGuestUsers returns true if Azure AD B2B guest users of the domain can authenticate.
+func (a AAD) AllowsGuestUsers() bool {
+	return a.GuestUsers != guestUsersDeny
+}
+
+// Denied returns true if Azure AD users can't log in, for the domain or the login the configuration was loaded for.
+func (a AAD) Denied() bool {
+	return a.Access == accessDeny
+}
+
+// NameNormalization represents the global configuration values used to normalize user names.
+// They are only read from the default section, as the domain is not known before normalisation.
+type NameNormalization struct {
+	// NetBIOSDomains maps NetBIOS domain names of down-level logon names to domains.
+	NetBIOSDomains map[string]string
+	// InvalidCharsReplacement replaces the characters which are invalid in POSIX user names.
+	// It is nil if not set in the configuration.
+	InvalidCharsReplacement *string
+}
+
+// UserOptions returns the options to pass to the user name normalisation functions.
+func (n NameNormalization) UserOptions() []user.Option {
+	opts := []user.Option{user.WithNetBIOSDomains(n.NetBIOSDomains)}
+	if n.InvalidCharsReplacement != nil {
+		opts = append(opts, user.WithInvalidCharsReplacement(*n.InvalidCharsReplacement))
+	}
+	return opts
 }
 
 // ToIni reflects the configuration values to an ini.File representation.
@@ -40,34 +128,158 @@ func (a AAD) ToIni() (*ini.File, error) {
 
 type options struct {
 	addUserConfPath string
+	dropInDir       string
+	shellsPath      string
+	login           Login
 }
 
 // Option represents the functional option passed to LoadDefaults.
 type Option func(*options)
 
-// Load returns the loaded configuration of the specified domain from p.
-// If there is no section for the specified domain, the values on the beginning of p are used as default.
-// Should some required values not exist, an error is returned.
-func Load(ctx context.Context, p, domain string, opts ...Option) (config AAD, err error) {
-	defer decorate.OnError(&err, i18n.G("could not load valid configuration from %s"), p)
-
-	logger.Debug(ctx, "Loading configuration from %s", p)
+// WithDropInDir overrides the drop-in directory, which defaults to the configuration file path followed by ".d".
+func WithDropInDir(p string) Option {
+	return func(o *options) {
+		o.dropInDir = p
+	}
+}
 
+// newOptions returns the options for configuration file p, with opts applied.
+func newOptions(p string, opts ...Option) options {
 	o := options{
 		addUserConfPath: adduserConfPath,
+		dropInDir:       p + dropInDirSuffix,
+		shellsPath:      shellsPath,
 	}
 	// applies options
 	for _, opt := range opts {
 		opt(&o)
 	}
+	return o
+}
+
+// Config is a configuration file merged with its drop-in directory, parsed once to load the configuration of any
+// domain. Its fields are the global values, which are only read from the default section as they apply before the
+// domain of the user is known, or to all domains.
+type Config struct {
+	// NameNormalization is the user name normalisation configuration.
+	NameNormalization NameNormalization
+	// Domains describes which domains the users are authenticated for.
+	Domains DomainPolicy
+	// Enumeration is the NSS enumeration policy, in the format expected by cache.WithEnumeration.
+	// Listed names are normalized as user names.
+	Enumeration string
+	// InlineCacheCleanup is true if expired users are purged from the cache on every login.
+	// They are otherwise only purged by aad-cli cache gc.
+	InlineCacheCleanup bool
+	// LocalConflicts is the policy applied when a new user conflicts with a local account, in the format expected by
+	// cache.WithLocalConflicts.
+	LocalConflicts string
+	// MetricsDir is the directory the authentication metrics are written to. It is empty if metrics are disabled.
+	MetricsDir string
+
+	path string
+	cfg  *ini.File
+	o    options
+}
+
+// Parse parses p, merging on top of it any *.conf file of its drop-in directory in lexical order, and loads its
+// global values.
+// Invalid user name normalisation and domain policies are errors, as users can't be matched to their configuration.
+// Invalid values of the options tuning the cache, the enumeration and the metrics are logged and replaced by their
+// defaults instead, so that users can still log in. aad-cli config validate reports all of them.
+func Parse(ctx context.Context, p string, opts ...Option) (c *Config, err error) {
+	defer decorate.OnError(&err, i18n.G("could not load valid configuration from %s"), p)
+
+	if c, err = parse(ctx, p, opts...); err != nil {
+		return nil, err
+	}
+
+	sec := c.cfg.Section(ini.DefaultSection)
+	if c.NameNormalization, err = parseNameNormalization(sec); err != nil {
+		return nil, err
+	}
+	if c.Domains, err = parseDomainPolicy(c.cfg); err != nil {
+		return nil, err
+	}
+
+	c.Enumeration = enumerateAll
+	if sec.HasKey(enumerationKey) {
+		if c.Enumeration, err = normalizeEnumeration(sec.Key(enumerationKey).String(), c.NameNormalization); err != nil {
+			logger.Warn(ctx, "Enumerating all users and groups: %v", err)
+			c.Enumeration = enumerateAll
+		}
+	}
+	if sec.HasKey(inlineCacheCleanupKey) {
+		if c.InlineCacheCleanup, err = sec.Key(inlineCacheCleanupKey).Bool(); err != nil {
+			logger.Warn(ctx, "Not cleaning up the cache on login: %v", err)
+		}
+	}
+	c.LocalConflicts = localConflictsRemap
+	if sec.HasKey(localConflictsKey) {
+		c.LocalConflicts = sec.Key(localConflictsKey).String()
+		if err := validateLocalConflicts(c.LocalConflicts); err != nil {
+			logger.Warn(ctx, "Remapping the IDs of new users conflicting with local accounts: %v", err)
+			c.LocalConflicts = localConflictsRemap
+		}
+	}
+	c.MetricsDir = sec.Key(metricsDirKey).String()
+	if err := validateMetricsDir(c.MetricsDir); err != nil {
+		logger.Warn(ctx, "Not writing metrics: %v", err)
+		c.MetricsDir = ""
+	}
+
+	return c, nil
+}
+
+// parse loads p merged with its drop-in directory, without loading any value.
+func parse(ctx context.Context, p string, opts ...Option) (*Config, error) {
+	logger.Debug(ctx, "Loading configuration from %s", p)
+
+	o := newOptions(p, opts...)
+	cfg, err := loadIni(ctx, p, o.dropInDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{path: p, cfg: cfg, o: o}, nil
+}
+
+// Load returns the configuration of the specified domain from p, merged with its drop-in directory, as described in
+// Config.Domain. Global values are not loaded: use Parse when they are needed too.
+func Load(ctx context.Context, p, domain string, opts ...Option) (config AAD, err error) {
+	defer decorate.OnError(&err, i18n.G("could not load valid configuration from %s"), p)
+
+	c, err := parse(ctx, p, opts...)
+	if err != nil {
+		return AAD{}, err
+	}
+	return c.domain(ctx, domain)
+}
+
+// Domain returns the configuration of the specified domain.
+// The section applying to the domain is selected as described in SectionMatch.
+// If there is no section for the specified domain, the values of the default section are used.
+// The policy keys of the service and remote sections matching the login passed with WithLogin override the domain
+// section.
+// Should some required values not exist, an error is returned.
+func (c *Config) Domain(ctx context.Context, domain string) (config AAD, err error) {
+	defer decorate.OnError(&err, i18n.G("could not load valid configuration from %s"), c.path)
+
+	return c.domain(ctx, domain)
+}
 
+// domain is Domain without error decoration, shared with Load.
+func (c *Config) domain(ctx context.Context, domain string) (config AAD, err error) {
 	config = AAD{
-		HomeDirPattern: defaultHomePattern,
-		Shell:          defaultShell,
+		HomeDirPattern:           defaultHomePattern,
+		Shell:                    defaultShell,
+		GuestUsers:               guestUsersAllow,
+		OfflineExpirationWarning: defaultOfflineExpirationWarning,
+		Access:                   accessAllow,
+		GECOSClaims:              defaultGECOSClaims,
 	}
 
 	// Tries to load the defaults from the adduser.conf
-	dh, ds := loadDefaultHomeAndShell(ctx, o.addUserConfPath)
+	dh, ds := loadDefaultHomeAndShell(ctx, c.o.addUserConfPath)
 	if dh != "" {
 		config.HomeDirPattern = dh
 	}
@@ -75,14 +287,25 @@ func Load(ctx context.Context, p, domain string, opts ...Option) (config AAD, er
 		config.Shell = ds
 	}
 
-	cfg, err := ini.Load(p)
-	if err != nil {
-		return AAD{}, fmt.Errorf("could not open file %s: %w", p, err)
+	// Load default section first, and then override with the keys of the section matching the domain,
+	// and with the policy keys of the sections matching the login.
+	m := c.MatchSection(domain)
+	logger.Debug(ctx, "Configuration section: %s", m)
+	for _, section := range []string{ini.DefaultSection, m.Section} {
+		if err := c.cfg.Section(section).StrictMapTo(&config); err != nil {
+			return AAD{}, err
+		}
+		// Empty values are skipped by the mapping, but an empty gecos_claims disables the GECOS field.
+		if sec := c.cfg.Section(section); sec.HasKey(gecosClaimsKey) {
+			config.GECOSClaims = sec.Key(gecosClaimsKey).String()
+		}
 	}
-
-	// Load default section first, and then override with domain specified keys.
-	for _, section := range []string{ini.DefaultSection, domain} {
-		if err := cfg.Section(section).StrictMapTo(&config); err != nil {
+	for _, section := range policySections(c.o.login) {
+		if !slices.Contains(c.cfg.SectionStrings(), section) {
+			continue
+		}
+		logger.Debug(ctx, "Applying login policy section [%s]", section)
+		if err := policyKeysOf(ctx, c.cfg.Section(section)).StrictMapTo(&config); err != nil {
 			return AAD{}, err
 		}
 	}
@@ -97,25 +320,196 @@ func Load(ctx context.Context, p, domain string, opts ...Option) (config AAD, er
 	return config, nil
 }
 
-// Validate validates a given configuration file.
-func Validate(ctx context.Context, p string) error {
-	cfg, err := ini.Load(p)
+// parseNameNormalization returns the user name normalisation configuration of the default section sec.
+func parseNameNormalization(sec *ini.Section) (n NameNormalization, err error) {
+	n.NetBIOSDomains = make(map[string]string)
+	if sec.HasKey(netBIOSDomainsKey) {
+		if n.NetBIOSDomains, err = parseNetBIOSDomains(sec.Key(netBIOSDomainsKey).String()); err != nil {
+			return NameNormalization{}, err
+		}
+	}
+	if sec.HasKey(invalidCharsReplacementKey) {
+		r := sec.Key(invalidCharsReplacementKey).String()
+		n.InvalidCharsReplacement = &r
+	}
+	return n, nil
+}
+
+// normalizeEnumeration parses an enumeration policy and normalizes the listed names as user names with n.
+func normalizeEnumeration(value string, n NameNormalization) (string, error) {
+	names, err := parseEnumeration(value)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if len(names) == 1 && (names[0] == enumerateAll || names[0] == enumerateNone) {
+		return names[0], nil
+	}
+	for i, name := range names {
+		if names[i], err = user.PosixName(name, n.UserOptions()...); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(names, ","), nil
+}
+
+// validateLocalConflicts returns an error if policy is not a local conflicts policy.
+func validateLocalConflicts(policy string) error {
+	if policy != localConflictsRefuse && policy != localConflictsRemap && policy != localConflictsAdopt {
+		return fmt.Errorf(i18n.G("%q is not one of %s, %s, %s"), policy, localConflictsRefuse, localConflictsRemap, localConflictsAdopt)
+	}
+	return nil
+}
+
+// validateMetricsDir returns an error if dir is set and not an absolute path.
+func validateMetricsDir(dir string) error {
+	if dir != "" && !filepath.IsAbs(dir) {
+		return fmt.Errorf(i18n.G("%q is not an absolute path"), dir)
+	}
+	return nil
+}
+
+// parseEnumeration parses an enumeration policy: all, none or a comma separated list of user and group names.
+func parseEnumeration(value string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf(i18n.G("no user or group listed, use %q to disable enumeration"), enumerateNone)
+	}
+	if len(names) > 1 && (slices.Contains(names, enumerateAll) || slices.Contains(names, enumerateNone)) {
+		return nil, fmt.Errorf(i18n.G("%q and %q can't be listed with user or group names"), enumerateAll, enumerateNone)
 	}
+	return names, nil
+}
 
-	// Config sections are domains, so check them all if present
-	for _, domain := range cfg.SectionStrings() {
-		// Skip default section if we have multiple domains, as users might set
-		// required options only in the domain sections
-		if domain == ini.DefaultSection && len(cfg.Sections()) > 1 {
+// parseGECOSClaims parses a comma separated list of claim names, one per subfield of the GECOS field.
+func parseGECOSClaims(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	claims := strings.Split(value, ",")
+	if len(claims) > maxGECOSClaims {
+		return nil, fmt.Errorf(i18n.G("%d claims listed, the GECOS field only has %d subfields"), len(claims), maxGECOSClaims)
+	}
+	for i, claim := range claims {
+		claims[i] = strings.TrimSpace(claim)
+		if strings.ContainsAny(claims[i], " \t=") {
+			return nil, fmt.Errorf(i18n.G("%q is not a claim name"), claims[i])
+		}
+	}
+	return claims, nil
+}
+
+// parseNetBIOSDomains parses a comma separated list of NETBIOS=domain pairs.
+func parseNetBIOSDomains(value string) (map[string]string, error) {
+	domains := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
 			continue
 		}
-		if _, err = Load(ctx, p, domain); err != nil {
-			return err
+		netBIOS, domain, found := strings.Cut(pair, "=")
+		netBIOS, domain = strings.TrimSpace(netBIOS), strings.TrimSpace(domain)
+		if !found || netBIOS == "" || domain == "" {
+			return nil, fmt.Errorf(i18n.G("%q is not a NETBIOS=domain pair"), pair)
 		}
+		domains[netBIOS] = domain
 	}
-	return nil
+	return domains, nil
+}
+
+// Origins returns, for each key of the configuration of the specified domain, the file its effective value comes from.
+// Values which are not set in any file have a built-in default origin.
+func Origins(ctx context.Context, p, domain string, opts ...Option) (origins map[string]string, err error) {
+	defer decorate.OnError(&err, i18n.G("could not load configuration origins from %s"), p)
+
+	o := newOptions(p, opts...)
+
+	origins = make(map[string]string)
+	for _, k := range knownKeys {
+		origins[k] = builtinOrigin
+	}
+	dh, ds := loadDefaultHomeAndShell(ctx, o.addUserConfPath)
+	if dh != "" {
+		origins["homedir"] = o.addUserConfPath
+	}
+	if ds != "" {
+		origins["shell"] = o.addUserConfPath
+	}
+
+	files, err := configFiles(p, o.dropInDir)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadIni(ctx, p, o.dropInDir)
+	if err != nil {
+		return nil, err
+	}
+	m := matchSection(cfg.SectionStrings(), domain)
+
+	// Domain section overrides default section, and login sections override both, whatever the file order is.
+	for _, section := range append([]string{ini.DefaultSection, m.Section}, policySections(o.login)...) {
+		for _, f := range files {
+			cfg, err := ini.Load(f)
+			if err != nil {
+				return nil, fmt.Errorf("could not open file %s: %w", f, err)
+			}
+			sec, err := cfg.GetSection(section)
+			if err != nil {
+				continue
+			}
+			for _, k := range sec.KeyStrings() {
+				// Only the policy keys of login sections are applied.
+				if isPolicySection(section) && !slices.Contains(policyKeys, k) {
+					continue
+				}
+				origins[k] = f
+			}
+		}
+	}
+
+	return origins, nil
+}
+
+// loadIni loads p and merges on top of it the drop-in fragments.
+func loadIni(ctx context.Context, p, dropInDir string) (*ini.File, error) {
+	files, err := configFiles(p, dropInDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 1 {
+		logger.Debug(ctx, "Merging configuration fragments: %v", files[1:])
+	}
+
+	others := make([]any, 0, len(files)-1)
+	for _, f := range files[1:] {
+		others = append(others, f)
+	}
+	cfg, err := ini.Load(files[0], others...)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file %s: %w", p, err)
+	}
+
+	return cfg, nil
+}
+
+// configFiles returns p followed by the *.conf fragments of dropInDir, in lexical order.
+// A missing drop-in directory is not an error.
+func configFiles(p, dropInDir string) ([]string, error) {
+	files := []string{p}
+	if dropInDir == "" {
+		return files, nil
+	}
+
+	fragments, err := filepath.Glob(filepath.Join(dropInDir, "*.conf"))
+	if err != nil {
+		return nil, fmt.Errorf("could not list configuration fragments in %s: %w", dropInDir, err)
+	}
+	sort.Strings(fragments)
+
+	return append(files, fragments...), nil
 }
 
 // loadDefaultHomeAndShell returns default home and shell patterns for all users.
@@ -9,6 +9,7 @@ import (
 
 	"github.com/go-ini/ini"
 	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/cache"
 	"github.com/ubuntu/aad-auth/internal/config"
 	"github.com/ubuntu/aad-auth/internal/testutils"
 )
@@ -21,6 +22,7 @@ func TestLoadConfig(t *testing.T) {
 		aadConfigPath string
 		addUserPath   string
 		domain        string
+		login         config.Login
 
 		wantErr bool
 	}{
@@ -94,6 +96,96 @@ func TestLoadConfig(t *testing.T) {
 			aadConfigPath: "aad-appId_only_in_domain.conf",
 		},
 
+		// Drop-in fragments
+		"aad.conf with drop-in fragments": {
+			aadConfigPath: "aad-with_drop_in_fragments.conf",
+		},
+		"aad.conf with drop-in fragments, mismatch domain": {
+			aadConfigPath: "aad-with_drop_in_fragments.conf",
+			domain:        "doesNotExist.com",
+		},
+
+		// Wildcard and alias sections
+		"aad.conf with wildcards and aliases, exact match": {
+			aadConfigPath: "aad-with_wildcards_and_aliases.conf",
+			domain:        "contoso.com",
+		},
+		"aad.conf with wildcards and aliases, alias match": {
+			aadConfigPath: "aad-with_wildcards_and_aliases.conf",
+			domain:        "contoso.onmicrosoft.com",
+		},
+		"aad.conf with wildcards and aliases, wildcard match": {
+			aadConfigPath: "aad-with_wildcards_and_aliases.conf",
+			domain:        "fr.contoso.com",
+		},
+		"aad.conf with wildcards and aliases, most specific wildcard match": {
+			aadConfigPath: "aad-with_wildcards_and_aliases.conf",
+			domain:        "de.eu.contoso.com",
+		},
+		"aad.conf with wildcards and aliases, exact match over wildcards": {
+			aadConfigPath: "aad-with_wildcards_and_aliases.conf",
+			domain:        "legacy.eu.contoso.com",
+		},
+		"aad.conf with wildcards and aliases, no match": {
+			aadConfigPath: "aad-with_wildcards_and_aliases.conf",
+			domain:        "fabrikam.com",
+		},
+
+		// Guest users policy
+		"aad.conf with 'guest_users' denied in domain": {
+			aadConfigPath: "aad-guest_users_denied_in_domain.conf",
+			domain:        "domain.com",
+		},
+		"aad.conf with 'guest_users' denied in another domain": {
+			aadConfigPath: "aad-guest_users_denied_in_domain.conf",
+			domain:        "otherdomain.com",
+		},
+
+		// Offline expiration warning
+		"aad.conf with 'offline_expiration_warning' disabled in domain": {
+			aadConfigPath: "aad-offline_expiration_warning_in_domain.conf",
+			domain:        "domain.com",
+		},
+		"aad.conf with 'offline_expiration_warning' in default section": {
+			aadConfigPath: "aad-offline_expiration_warning_in_domain.conf",
+			domain:        "otherdomain.com",
+		},
+
+		// GECOS claims
+		"aad.conf with 'gecos_claims' disabled in domain": {
+			aadConfigPath: "aad-gecos_claims_disabled_in_domain.conf",
+			domain:        "domain.com",
+		},
+		"aad.conf with 'gecos_claims' in default section": {
+			aadConfigPath: "aad-gecos_claims_disabled_in_domain.conf",
+			domain:        "otherdomain.com",
+		},
+
+		// Login policies
+		"aad.conf with login policies, no login": {
+			aadConfigPath: "aad-with_login_policies.conf",
+		},
+		"aad.conf with login policies, local login": {
+			aadConfigPath: "aad-with_login_policies.conf",
+			login:         config.Login{Service: "gdm-password"},
+		},
+		"aad.conf with login policies, remote login": {
+			aadConfigPath: "aad-with_login_policies.conf",
+			login:         config.Login{Service: "login", RemoteHost: "192.0.2.1"},
+		},
+		"aad.conf with login policies, service overrides remote login": {
+			aadConfigPath: "aad-with_login_policies.conf",
+			login:         config.Login{Service: "sshd", RemoteHost: "192.0.2.1"},
+		},
+		"aad.conf with login policies, denied service": {
+			aadConfigPath: "aad-with_login_policies.conf",
+			login:         config.Login{Service: "cron"},
+		},
+		"aad.conf with account keys in login sections ignores them": {
+			aadConfigPath: "aad-with_account_keys_in_login_sections.conf",
+			login:         config.Login{Service: "sshd", RemoteHost: "192.0.2.1"},
+		},
+
 		// Special Cases
 		"aad.conf with missing 'homedir' and 'shell' values, but valid adduser.conf": {
 			aadConfigPath: "aad-missing_homedirpattern_and_shell.conf",
@@ -140,7 +232,7 @@ func TestLoadConfig(t *testing.T) {
 				domain = tc.domain
 			}
 
-			got, err := config.Load(context.Background(), tc.aadConfigPath, domain, config.WithAddUserConfPath(tc.addUserPath))
+			got, err := config.Load(context.Background(), tc.aadConfigPath, domain, config.WithAddUserConfPath(tc.addUserPath), config.WithLogin(tc.login))
 			if tc.wantErr {
 				require.Error(t, err, "LoadConfig should have failed, but didn't")
 				return
@@ -154,6 +246,32 @@ func TestLoadConfig(t *testing.T) {
 	}
 }
 
+func TestGECOSClaimNames(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		gecosClaims string
+
+		want []string
+	}{
+		"full name only":              {gecosClaims: "name", want: []string{"name"}},
+		"several claims":              {gecosClaims: "name, physicalDeliveryOfficeName,telephoneNumber", want: []string{"name", "physicalDeliveryOfficeName", "telephoneNumber"}},
+		"empty subfields are kept":    {gecosClaims: "name,,telephoneNumber", want: []string{"name", "", "telephoneNumber"}},
+		"empty value disables GECOS":  {gecosClaims: "", want: nil},
+		"blank value disables GECOS":  {gecosClaims: "  ", want: nil},
+		"too many claims are ignored": {gecosClaims: "a,b,c,d,e,f", want: nil},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := config.AAD{GECOSClaims: tc.gecosClaims}.GECOSClaimNames()
+			require.Equal(t, tc.want, got, "GECOSClaimNames should return the claim names of each subfield")
+		})
+	}
+}
+
 func TestToIni(t *testing.T) {
 	t.Parallel()
 
@@ -177,13 +295,23 @@ func TestValidate(t *testing.T) {
 		configFile string
 		wantErr    bool
 	}{
-		"valid config, default domain":   {configFile: "valid.conf"},
-		"valid config, multiple domains": {configFile: "valid-multiple-domains.conf"},
+		"valid config, default domain":    {configFile: "valid.conf"},
+		"valid config, multiple domains":  {configFile: "valid-multiple-domains.conf"},
+		"valid config, domain in drop-in": {configFile: "valid-drop-in.conf"},
+		"valid config, login sections":    {configFile: "valid-login-sections.conf"},
+		"valid config, sudo sections":     {configFile: "valid-sudo-sections.conf"},
 
 		// Error cases
-		"invalid config, default domain":   {configFile: "invalid.conf", wantErr: true},
-		"invalid config, commented values": {configFile: "invalid-commented.conf", wantErr: true},
-		"invalid config, multiple domains": {configFile: "invalid-multiple-domains.conf", wantErr: true},
+		"invalid config, default domain":             {configFile: "invalid.conf", wantErr: true},
+		"invalid config, commented values":           {configFile: "invalid-commented.conf", wantErr: true},
+		"invalid config, multiple domains":           {configFile: "invalid-multiple-domains.conf", wantErr: true},
+		"invalid config, domain in drop-in":          {configFile: "invalid-drop-in.conf", wantErr: true},
+		"invalid config, invalid values":             {configFile: "invalid-values.conf", wantErr: true},
+		"invalid config, invalid values in drop-in":  {configFile: "invalid-values-drop-in.conf", wantErr: true},
+		"invalid config, configuration file missing": {configFile: "doesnotexist.conf", wantErr: true},
+		"invalid config, domain patterns":            {configFile: "invalid-domain-patterns.conf", wantErr: true},
+		"invalid config, login sections":             {configFile: "invalid-login-sections.conf", wantErr: true},
+		"invalid config, sudo sections":              {configFile: "invalid-sudo-sections.conf", wantErr: true},
 	}
 	for name, tc := range tests {
 		tc := tc
@@ -191,9 +319,11 @@ func TestValidate(t *testing.T) {
 			t.Parallel()
 
 			configFile := filepath.Join("testdata", tc.configFile)
-			err := config.Validate(context.Background(), configFile)
+			err := config.Validate(context.Background(), configFile, config.WithShellsPath(filepath.Join("testdata", "shells")))
 			if tc.wantErr {
 				require.Error(t, err, "Validate should have failed, but didn't")
+				want := testutils.LoadWithUpdateFromGolden(t, err.Error())
+				require.Equal(t, want, err.Error(), "Validate should report all errors with their location")
 				return
 			}
 			require.NoError(t, err, "Validate failed but shouldn't have")
@@ -201,6 +331,481 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func TestMatchSection(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		domain string
+
+		wantSection string
+		wantPattern string
+	}{
+		"exact match":                               {domain: "contoso.com", wantSection: "contoso.com, Contoso.onmicrosoft.com", wantPattern: "contoso.com"},
+		"alias match":                               {domain: "contoso.onmicrosoft.com", wantSection: "contoso.com, Contoso.onmicrosoft.com", wantPattern: "contoso.onmicrosoft.com"},
+		"match is case insensitive":                 {domain: "CONTOSO.com", wantSection: "contoso.com, Contoso.onmicrosoft.com", wantPattern: "contoso.com"},
+		"wildcard match":                            {domain: "fr.contoso.com", wantSection: "*.contoso.com", wantPattern: "*.contoso.com"},
+		"wildcard match on multiple levels":         {domain: "paris.fr.contoso.com", wantSection: "*.contoso.com", wantPattern: "*.contoso.com"},
+		"most specific wildcard wins":               {domain: "de.eu.contoso.com", wantSection: "*.eu.contoso.com", wantPattern: "*.eu.contoso.com"},
+		"exact match wins over wildcards":           {domain: "legacy.eu.contoso.com", wantSection: "legacy.eu.contoso.com", wantPattern: "legacy.eu.contoso.com"},
+		"wildcard does not match the domain itself": {domain: "eu.contoso.com", wantSection: "*.contoso.com", wantPattern: "*.contoso.com"},
+		"wildcard does not match on partial label":  {domain: "notcontoso.com", wantSection: "DEFAULT"},
+		"no match uses the default section":         {domain: "fabrikam.com", wantSection: "DEFAULT"},
+		"empty domain uses the default section":     {domain: "", wantSection: "DEFAULT"},
+		"login sections never match a domain":       {domain: "remote", wantSection: "DEFAULT"},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := config.Parse(context.Background(), filepath.Join("testdata", "match-sections.conf"))
+			require.NoError(t, err, "Parse should not have failed")
+
+			got := c.MatchSection(tc.domain)
+			require.Equal(t, tc.wantSection, got.Section, "MatchSection returned an unexpected section")
+			require.Equal(t, tc.wantPattern, got.Pattern, "MatchSection returned an unexpected pattern")
+			require.Equal(t, tc.domain, got.Domain, "MatchSection should return the requested domain")
+		})
+	}
+}
+
+func TestParseNameNormalization(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		configFile string
+
+		wantErr bool
+	}{
+		"all values":                     {configFile: "all-values.conf"},
+		"no values":                      {configFile: "no-values.conf"},
+		"empty replacement":              {configFile: "empty-replacement.conf"},
+		"values overridden from drop-in": {configFile: "with-drop-in.conf"},
+
+		// Error cases
+		"error on invalid netbios domains": {configFile: "invalid-netbios-domains.conf", wantErr: true},
+		"error on missing file":            {configFile: "doesnotexist.conf", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := config.Parse(context.Background(), filepath.Join("testdata", "TestParseNameNormalization", tc.configFile))
+			if tc.wantErr {
+				require.Error(t, err, "Parse should have failed, but didn't")
+				return
+			}
+			require.NoError(t, err, "Parse failed when it shouldn't")
+
+			got := c.NameNormalization
+			want := testutils.LoadYAMLWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "Got and expected name normalisation configurations are different")
+		})
+	}
+}
+
+func TestParseEnumeration(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		configFile string
+
+		want    string
+		wantErr bool
+	}{
+		"all entries are enumerated by default": {configFile: "no-values.conf", want: cache.EnumerateAll},
+		"enumeration is disabled":               {configFile: "none.conf", want: cache.EnumerateNone},
+		"listed names are normalized":           {configFile: "names.conf", want: "myuser@domain.com,admins,otheruser@contoso.com"},
+		"value overridden from drop-in":         {configFile: "with-drop-in.conf", want: cache.EnumerateNone},
+
+		// Syntax, shared with the NSS module tests
+		"inline comments are ignored":      {configFile: "inline-comment.conf", want: cache.EnumerateNone},
+		"colon is a key-value delimiter":   {configFile: "colon-delimiter.conf", want: cache.EnumerateNone},
+		"explicit default section header":  {configFile: "default-section-header.conf", want: cache.EnumerateNone},
+		"surrounding quotes are removed":   {configFile: "quoted.conf", want: "myuser@domain.com,otheruser@domain.com"},
+		"value continued on the next line": {configFile: "continuation.conf", want: "myuser@domain.com,otheruser@domain.com"},
+
+		"all entries are enumerated on empty list":           {configFile: "empty-list.conf", want: cache.EnumerateAll},
+		"all entries are enumerated on all mixed with names": {configFile: "all-with-names.conf", want: cache.EnumerateAll},
+
+		// Error cases
+		"error on invalid name normalisation": {configFile: "invalid-netbios-domains.conf", wantErr: true},
+		"error on invalid syntax":             {configFile: "invalid-syntax.conf", wantErr: true},
+		"error on missing file":               {configFile: "doesnotexist.conf", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := config.Parse(context.Background(), filepath.Join("testdata", "TestParseEnumeration", tc.configFile))
+			if tc.wantErr {
+				require.Error(t, err, "Parse should have failed, but didn't")
+				return
+			}
+			require.NoError(t, err, "Parse failed when it shouldn't")
+			require.Equal(t, tc.want, c.Enumeration, "Parse returned an unexpected enumeration policy")
+		})
+	}
+}
+
+func TestParseInlineCacheCleanup(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		configFile string
+
+		want    bool
+		wantErr bool
+	}{
+		"inline cleanup is disabled by default":       {configFile: "no-values.conf"},
+		"inline cleanup is enabled":                   {configFile: "enabled.conf", want: true},
+		"value overridden from drop-in":               {configFile: "with-drop-in.conf", want: true},
+		"inline cleanup is disabled on invalid value": {configFile: "invalid-value.conf"},
+		"inline comments are ignored":                 {configFile: "inline-comment.conf", want: true},
+
+		// Error cases
+		"error on missing file": {configFile: "doesnotexist.conf", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := config.Parse(context.Background(), filepath.Join("testdata", "TestParseInlineCacheCleanup", tc.configFile))
+			if tc.wantErr {
+				require.Error(t, err, "Parse should have failed, but didn't")
+				return
+			}
+			require.NoError(t, err, "Parse failed when it shouldn't")
+			require.Equal(t, tc.want, c.InlineCacheCleanup, "Parse returned an unexpected inline cache cleanup")
+		})
+	}
+}
+
+func TestParseLocalConflicts(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		configFile string
+
+		want    string
+		wantErr bool
+	}{
+		"conflicting UIDs are remapped by default":        {configFile: "no-values.conf", want: cache.LocalConflictsRemap},
+		"local accounts are adopted":                      {configFile: "adopt.conf", want: cache.LocalConflictsAdopt},
+		"value overridden from drop-in":                   {configFile: "with-drop-in.conf", want: cache.LocalConflictsRefuse},
+		"conflicting UIDs are remapped on unknown policy": {configFile: "invalid-value.conf", want: cache.LocalConflictsRemap},
+
+		// Error cases
+		"error on missing file": {configFile: "doesnotexist.conf", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := config.Parse(context.Background(), filepath.Join("testdata", "TestParseLocalConflicts", tc.configFile))
+			if tc.wantErr {
+				require.Error(t, err, "Parse should have failed, but didn't")
+				return
+			}
+			require.NoError(t, err, "Parse failed when it shouldn't")
+			require.Equal(t, tc.want, c.LocalConflicts, "Parse returned an unexpected local conflicts policy")
+		})
+	}
+}
+
+func TestParseMetricsDir(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		configFile string
+
+		want    string
+		wantErr bool
+	}{
+		"metrics are disabled by default":            {configFile: "no-values.conf"},
+		"metrics are enabled":                        {configFile: "enabled.conf", want: "/var/lib/prometheus/node-exporter"},
+		"value overridden from drop-in":              {configFile: "with-drop-in.conf", want: "/run/metrics"},
+		"metrics are disabled on relative directory": {configFile: "invalid-value.conf"},
+
+		// Error cases
+		"error on missing file": {configFile: "doesnotexist.conf", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := config.Parse(context.Background(), filepath.Join("testdata", "TestParseMetricsDir", tc.configFile))
+			if tc.wantErr {
+				require.Error(t, err, "Parse should have failed, but didn't")
+				return
+			}
+			require.NoError(t, err, "Parse failed when it shouldn't")
+			require.Equal(t, tc.want, c.MetricsDir, "Parse returned an unexpected metrics directory")
+		})
+	}
+}
+
+func TestParseDomainPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		configFile string
+
+		wantStrict   string
+		wantAccepted []string
+		wantRefused  []string
+		wantErr      bool
+	}{
+		"any domain is accepted by default": {configFile: "no-values.conf", wantStrict: config.StrictDomainsOff,
+			wantAccepted: []string{"domain.com", "otherdomain.com", ""}},
+		"only domains of sections and allowed domains are accepted in strict mode": {configFile: "strict.conf", wantStrict: config.StrictDomainsIgnore,
+			wantAccepted: []string{"domain.com", "Domain.Alias.com", "sub.wildcard.com", "contoso.com", "CONTOSO.COM", "eu.fabrikam.com"},
+			wantRefused:  []string{"otherdomain.com", "wildcard.com", "fabrikam.com", "sudoers.com", "sshd", "remote", ""}},
+		"unknown users can be reported in strict mode": {configFile: "strict-user-unknown.conf", wantStrict: config.StrictDomainsUserUnknown,
+			wantAccepted: []string{"domain.com"}, wantRefused: []string{"otherdomain.com"}},
+		"sections and allowed domains of drop-ins are accepted": {configFile: "with-drop-in.conf", wantStrict: config.StrictDomainsIgnore,
+			wantAccepted: []string{"domain.com", "dropin.com"}, wantRefused: []string{"otherdomain.com"}},
+
+		// Error cases
+		"error on invalid strict mode":    {configFile: "invalid-strict-domains.conf", wantErr: true},
+		"error on invalid allowed domain": {configFile: "invalid-allowed-domains.conf", wantErr: true},
+		"error on missing file":           {configFile: "doesnotexist.conf", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := config.Parse(context.Background(), filepath.Join("testdata", "TestParseDomainPolicy", tc.configFile))
+			if tc.wantErr {
+				require.Error(t, err, "Parse should have failed, but didn't")
+				return
+			}
+			require.NoError(t, err, "Parse failed when it shouldn't")
+			got := c.Domains
+			require.Equal(t, tc.wantStrict, got.Strict, "Parse returned an unexpected strict mode")
+			for _, d := range tc.wantAccepted {
+				require.True(t, got.Accepts(d), "Domain %q should be accepted", d)
+			}
+			for _, d := range tc.wantRefused {
+				require.False(t, got.Accepts(d), "Domain %q should be refused", d)
+			}
+		})
+	}
+}
+
+func TestSudoRules(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		configFile string
+		domain     string
+
+		want        []config.SudoRule
+		wantErrRule bool
+		wantErr     bool
+	}{
+		"rules of the matching section": {configFile: "sudo-sections.conf", domain: "contoso.com", want: []config.SudoRule{
+			{Group: "developers@contoso.com", Commands: "NOPASSWD: /usr/bin/apt"},
+			{Group: "linux_admins@contoso.com", Commands: "ALL"},
+			{Login: "developer@contoso.com", Commands: "NOPASSWD: /usr/bin/apt, /usr/bin/systemctl restart nginx"},
+			{Login: "john_doe@contoso.com", Commands: "sudoedit /etc/hosts"},
+			{Login: "linux.admin@contoso.com", Commands: "ALL"},
+		}},
+		"rules of the section matching domain with a wildcard": {configFile: "sudo-sections.conf", domain: "EU.Contoso.com", want: []config.SudoRule{
+			{Group: "operators@eu.contoso.com", Commands: "/usr/bin/journalctl"},
+			{Login: "operator@eu.contoso.com", Commands: "/usr/bin/journalctl"},
+		}},
+		"rules of a section listing several domains": {configFile: "sudo-sections.conf", domain: "fabrikam.com", want: []config.SudoRule{
+			{Group: "operators@fabrikam.com", Commands: "/usr/bin/journalctl"},
+			{Login: "operator@fabrikam.com", Commands: "/usr/bin/journalctl"},
+		}},
+		"rule overridden from drop-in": {configFile: "with-drop-in.conf", domain: "contoso.com", want: []config.SudoRule{
+			{Login: "developer@contoso.com", Commands: "ALL"},
+			{Login: "linux.admin@contoso.com", Commands: "ALL"},
+		}},
+		"no rule for domain without section": {configFile: "sudo-sections.conf", domain: "other.com"},
+		"no rule without sudo section":       {configFile: "no-sudo-section.conf", domain: "contoso.com"},
+
+		// Error cases
+		"error on invalid rule":                        {configFile: "invalid-rule.conf", domain: "contoso.com", wantErrRule: true},
+		"error on rules of the same user":              {configFile: "same-user.conf", domain: "contoso.com", wantErrRule: true},
+		"error on rules of the same group":             {configFile: "same-group.conf", domain: "contoso.com", wantErrRule: true},
+		"error on user name which can't be normalized": {configFile: "no-replacement.conf", domain: "contoso.com", wantErrRule: true},
+		"error on missing file":                        {configFile: "doesnotexist.conf", domain: "contoso.com", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := config.Parse(context.Background(), filepath.Join("testdata", "TestSudoRules", tc.configFile))
+			if tc.wantErr {
+				require.Error(t, err, "Parse should have failed, but didn't")
+				return
+			}
+			require.NoError(t, err, "Parse failed when it shouldn't")
+
+			got, err := c.SudoRules(tc.domain)
+			if tc.wantErrRule {
+				require.Error(t, err, "SudoRules should have failed, but didn't")
+				return
+			}
+			require.NoError(t, err, "SudoRules failed when it shouldn't")
+			require.Equal(t, tc.want, got, "SudoRules returned unexpected rules")
+		})
+	}
+}
+
+func TestOrigins(t *testing.T) {
+	t.Parallel()
+	testFilesPath := filepath.Join("testdata", "TestLoadConfig")
+
+	tests := map[string]struct {
+		aadConfigPath string
+		addUserPath   string
+		domain        string
+		login         config.Login
+
+		want    map[string]string
+		wantErr bool
+	}{
+		"values from main file and built-in defaults": {
+			aadConfigPath: "aad-all_values-with_domain.conf",
+			want: map[string]string{
+				"tenant_id":                      "aad-all_values-with_domain.conf",
+				"app_id":                         "aad-all_values-with_domain.conf",
+				"offline_credentials_expiration": "built-in default",
+				"homedir":                        "built-in default",
+				"shell":                          "built-in default",
+				"guest_users":                    "built-in default",
+				"offline_expiration_warning":     "built-in default",
+				"access":                         "built-in default",
+				"gecos_claims":                   "built-in default",
+				"inactive_users_expiration":      "built-in default",
+			},
+		},
+		"values from adduser.conf": {
+			aadConfigPath: "aad-missing_homedirpattern_and_shell.conf",
+			addUserPath:   "valid_adduser.conf",
+			want: map[string]string{
+				"tenant_id":                      "aad-missing_homedirpattern_and_shell.conf",
+				"app_id":                         "aad-missing_homedirpattern_and_shell.conf",
+				"offline_credentials_expiration": "built-in default",
+				"homedir":                        "valid_adduser.conf",
+				"shell":                          "valid_adduser.conf",
+				"guest_users":                    "built-in default",
+				"offline_expiration_warning":     "built-in default",
+				"access":                         "built-in default",
+				"gecos_claims":                   "built-in default",
+				"inactive_users_expiration":      "built-in default",
+			},
+		},
+		"domain values from drop-in fragments override default ones": {
+			aadConfigPath: "aad-with_drop_in_fragments.conf",
+			want: map[string]string{
+				"tenant_id":                      "aad-with_drop_in_fragments.conf.d/10-tenant.conf",
+				"app_id":                         "aad-with_drop_in_fragments.conf.d/20-domain.conf",
+				"offline_credentials_expiration": "aad-with_drop_in_fragments.conf.d/10-tenant.conf",
+				"homedir":                        "aad-with_drop_in_fragments.conf.d/30-override.conf",
+				"shell":                          "aad-with_drop_in_fragments.conf",
+				"guest_users":                    "built-in default",
+				"offline_expiration_warning":     "built-in default",
+				"access":                         "built-in default",
+				"gecos_claims":                   "built-in default",
+				"inactive_users_expiration":      "built-in default",
+			},
+		},
+		"default values from drop-in fragments on mismatch domain": {
+			aadConfigPath: "aad-with_drop_in_fragments.conf",
+			domain:        "doesNotExist.com",
+			want: map[string]string{
+				"tenant_id":                      "aad-with_drop_in_fragments.conf.d/10-tenant.conf",
+				"app_id":                         "aad-with_drop_in_fragments.conf",
+				"offline_credentials_expiration": "aad-with_drop_in_fragments.conf.d/10-tenant.conf",
+				"homedir":                        "built-in default",
+				"shell":                          "aad-with_drop_in_fragments.conf",
+				"guest_users":                    "built-in default",
+				"offline_expiration_warning":     "built-in default",
+				"access":                         "built-in default",
+				"gecos_claims":                   "built-in default",
+				"inactive_users_expiration":      "built-in default",
+			},
+		},
+
+		"login values override domain ones": {
+			aadConfigPath: "aad-with_login_policies.conf",
+			login:         config.Login{Service: "sshd", RemoteHost: "192.0.2.1"},
+			want: map[string]string{
+				"tenant_id":                      "aad-with_login_policies.conf",
+				"app_id":                         "aad-with_login_policies.conf",
+				"offline_credentials_expiration": "aad-with_login_policies.conf",
+				"homedir":                        "built-in default",
+				"shell":                          "built-in default",
+				"guest_users":                    "built-in default",
+				"offline_expiration_warning":     "aad-with_login_policies.conf",
+				"access":                         "built-in default",
+				"gecos_claims":                   "built-in default",
+				"inactive_users_expiration":      "built-in default",
+			},
+		},
+		"account keys of login sections are ignored": {
+			aadConfigPath: "aad-with_account_keys_in_login_sections.conf",
+			login:         config.Login{Service: "sshd", RemoteHost: "192.0.2.1"},
+			want: map[string]string{
+				"tenant_id":                      "aad-with_account_keys_in_login_sections.conf",
+				"app_id":                         "aad-with_account_keys_in_login_sections.conf",
+				"offline_credentials_expiration": "built-in default",
+				"homedir":                        "aad-with_account_keys_in_login_sections.conf",
+				"shell":                          "aad-with_account_keys_in_login_sections.conf",
+				"guest_users":                    "aad-with_account_keys_in_login_sections.conf",
+				"offline_expiration_warning":     "built-in default",
+				"access":                         "aad-with_account_keys_in_login_sections.conf",
+				"gecos_claims":                   "built-in default",
+				"inactive_users_expiration":      "built-in default",
+			},
+		},
+
+		// Error cases
+		"aad.conf does not exist": {aadConfigPath: "doestnotexists.conf", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			domain := "domain.com"
+			if tc.domain != "" {
+				domain = tc.domain
+			}
+			addUserPath := tc.addUserPath
+			if addUserPath != "" {
+				addUserPath = filepath.Join(testFilesPath, addUserPath)
+			}
+
+			got, err := config.Origins(context.Background(), filepath.Join(testFilesPath, tc.aadConfigPath), domain, config.WithAddUserConfPath(addUserPath), config.WithLogin(tc.login))
+			if tc.wantErr {
+				require.Error(t, err, "Origins should have failed, but didn't")
+				return
+			}
+			require.NoError(t, err, "Origins failed when it shouldn't")
+
+			for k, v := range tc.want {
+				if v != "built-in default" {
+					tc.want[k] = filepath.Join(testFilesPath, v)
+				}
+			}
+			require.Equal(t, tc.want, got, "Got origins and expected origins are different")
+		})
+	}
+}
+
 func TestMain(m *testing.M) {
 	testutils.InstallUpdateFlag()
 	flag.Parse()
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-ini/ini"
+	"github.com/ubuntu/aad-auth/internal/i18n"
+)
+
+const (
+	// wildcardPrefix prefixes the section patterns matching any subdomain of a domain.
+	wildcardPrefix = "*."
+	// aliasSeparator separates the domain patterns of a section name.
+	aliasSeparator = ","
+)
+
+// Accepted values of strict_domains.
+const (
+	// StrictDomainsOff authenticates the users of any domain, with the default section if no section matches.
+	StrictDomainsOff = "off"
+	// StrictDomainsIgnore leaves the users of domains without a section, and not allowed, to the other PAM modules.
+	StrictDomainsIgnore = "ignore"
+	// StrictDomainsUserUnknown reports the users of domains without a section, and not allowed, as unknown.
+	StrictDomainsUserUnknown = "user_unknown"
+)
+
+// DomainPolicy describes which domains the users are authenticated for.
+type DomainPolicy struct {
+	// Strict is one of StrictDomainsOff, StrictDomainsIgnore or StrictDomainsUserUnknown.
+	Strict string
+	// patterns are the patterns of the domain sections and of allowed_domains.
+	patterns []string
+}
+
+// Accepts returns true if the users of domain are authenticated. In strict mode, only the domains matching a
+// domain section or allowed_domains are, and users without a domain never are.
+func (p DomainPolicy) Accepts(domain string) bool {
+	if p.Strict == StrictDomainsOff {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if domain != "" && patternRank(pattern, domain) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDomainPolicy returns the domain policy from the default section and the domain sections of cfg.
+func parseDomainPolicy(cfg *ini.File) (policy DomainPolicy, err error) {
+	sec := cfg.Section(ini.DefaultSection)
+	policy.Strict = StrictDomainsOff
+	if sec.HasKey(strictDomainsKey) {
+		policy.Strict = sec.Key(strictDomainsKey).String()
+		if err := validateStrictDomains(policy.Strict); err != nil {
+			return DomainPolicy{}, err
+		}
+	}
+	if policy.patterns, err = parseAllowedDomains(sec.Key(allowedDomainsKey).String()); err != nil {
+		return DomainPolicy{}, err
+	}
+	for _, section := range cfg.SectionStrings() {
+		if section == ini.DefaultSection || isPolicySection(section) || isSudoSection(section) {
+			continue
+		}
+		policy.patterns = append(policy.patterns, domainPatterns(section)...)
+	}
+	return policy, nil
+}
+
+// validateStrictDomains returns an error if value is not an accepted value of strict_domains.
+func validateStrictDomains(value string) error {
+	if value != StrictDomainsOff && value != StrictDomainsIgnore && value != StrictDomainsUserUnknown {
+		return fmt.Errorf(i18n.G("%q is not one of %s, %s, %s"), value, StrictDomainsOff, StrictDomainsIgnore, StrictDomainsUserUnknown)
+	}
+	return nil
+}
+
+// parseAllowedDomains parses a comma separated list of domain patterns, as used in section names.
+func parseAllowedDomains(value string) ([]string, error) {
+	patterns := domainPatterns(value)
+	for _, pattern := range patterns {
+		if err := validateDomainPattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return patterns, nil
+}
+
+// SectionMatch describes which section of the configuration applies to a domain.
+//
+// A section name is a list of domain patterns separated by commas, like [contoso.com, contoso.onmicrosoft.com].
+// A pattern is either a domain, matched exactly, or a wildcard like *.contoso.com, matching any subdomain of
+// contoso.com but not contoso.com itself. Matching is case insensitive.
+// The [remote] and [service:...] sections apply to logins and never match a domain, nor do the [sudo:...] sections,
+// which are matched separately by Config.SudoRules.
+// The precedence is:
+//  1. a pattern matching the domain exactly;
+//  2. the wildcard pattern with the longest suffix, *.eu.contoso.com winning over *.contoso.com;
+//  3. the default section if no pattern matches.
+//
+// On equal precedence, the first section of the merged configuration wins.
+type SectionMatch struct {
+	// Domain is the domain the section was looked up for.
+	Domain string
+	// Section is the name of the matching section, ini.DefaultSection if none matches.
+	Section string
+	// Pattern is the domain pattern of the section which matched the domain.
+	Pattern string
+}
+
+// Wildcard returns true if the section matched through a wildcard pattern.
+func (m SectionMatch) Wildcard() bool {
+	return strings.HasPrefix(m.Pattern, wildcardPrefix)
+}
+
+// String explains why the section was selected.
+func (m SectionMatch) String() string {
+	switch {
+	case m.Section == ini.DefaultSection && m.Domain == "":
+		return i18n.G("no domain requested, using default values")
+	case m.Section == ini.DefaultSection:
+		return fmt.Sprintf(i18n.G("no section matches domain %q, using default values"), m.Domain)
+	case m.Wildcard():
+		return fmt.Sprintf(i18n.G("domain %q matches wildcard %q of section [%s]"), m.Domain, m.Pattern, m.Section)
+	}
+	return fmt.Sprintf(i18n.G("domain %q matches %q of section [%s]"), m.Domain, m.Pattern, m.Section)
+}
+
+// MatchSection returns the section of the configuration which applies to domain.
+func (c *Config) MatchSection(domain string) SectionMatch {
+	return matchSection(c.cfg.SectionStrings(), domain)
+}
+
+// matchSection returns the section among sections which applies to domain.
+func matchSection(sections []string, domain string) SectionMatch {
+	m := SectionMatch{Domain: domain, Section: ini.DefaultSection}
+	if domain == "" {
+		return m
+	}
+
+	var bestRank int
+	for _, section := range sections {
+		if section == ini.DefaultSection || isPolicySection(section) || isSudoSection(section) {
+			continue
+		}
+		for _, pattern := range domainPatterns(section) {
+			if rank := patternRank(pattern, domain); rank > bestRank {
+				bestRank = rank
+				m.Section, m.Pattern = section, pattern
+			}
+		}
+	}
+	return m
+}
+
+// domainPatterns returns the lowercased domain patterns listed in a section name.
+func domainPatterns(section string) (patterns []string) {
+	for _, p := range strings.Split(section, aliasSeparator) {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// patternRank returns how specifically pattern matches domain: 0 if it does not match,
+// the number of labels of the suffix for wildcards, and the highest rank for exact matches.
+func patternRank(pattern, domain string) int {
+	domain = strings.ToLower(domain)
+	if pattern == domain {
+		return math.MaxInt
+	}
+
+	suffix, ok := strings.CutPrefix(pattern, wildcardPrefix)
+	if !ok || !strings.HasSuffix(domain, "."+suffix) {
+		return 0
+	}
+	return strings.Count(suffix, ".") + 1
+}
+
+// validateDomainPattern returns an error if pattern is neither a domain nor a wildcard on a domain.
+func validateDomainPattern(pattern string) error {
+	d := strings.TrimPrefix(pattern, wildcardPrefix)
+	if d == "" || strings.ContainsAny(d, "*@ \t") || strings.HasPrefix(d, ".") || strings.HasSuffix(d, ".") || strings.Contains(d, "..") {
+		return fmt.Errorf(i18n.G("%q is not a valid domain or wildcard pattern"), pattern)
+	}
+	return nil
+}
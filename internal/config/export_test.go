@@ -6,3 +6,10 @@ func WithAddUserConfPath(path string) Option {
 		o.addUserConfPath = path
 	}
 }
+
+// WithShellsPath overrides /etc/shells path.
+func WithShellsPath(path string) Option {
+	return func(o *options) {
+		o.shellsPath = path
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-ini/ini"
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/logger"
+)
+
+const (
+	// servicePrefix prefixes the sections applying to the logins through a PAM service, like [service:sshd].
+	servicePrefix = "service:"
+	// remoteSection is the section applying to remote logins, for which PAM_RHOST is set.
+	remoteSection = "remote"
+
+	// accessAllow and accessDeny are the accepted values of the access policy.
+	accessAllow = "allow"
+	accessDeny  = "deny"
+)
+
+// policyKeys are the keys accepted in service and remote sections.
+// The other keys describe the account of the user, which must not depend on how they log in.
+var policyKeys = []string{"offline_credentials_expiration", "offline_expiration_warning", "guest_users", "access"}
+
+// Login describes how the user is logging in.
+type Login struct {
+	// Service is the PAM service the user is logging in through, like sshd or gdm-password.
+	Service string
+	// RemoteHost is the host the user is logging in from, empty for local logins.
+	RemoteHost string
+}
+
+// Remote returns true if the user is logging in from another host.
+func (l Login) Remote() bool {
+	return l.RemoteHost != ""
+}
+
+// WithLogin applies the service and remote sections matching l on top of the domain section.
+func WithLogin(l Login) Option {
+	return func(o *options) {
+		o.login = l
+	}
+}
+
+// policySections returns the sections applying to l, by increasing precedence: the remote section for remote logins,
+// then the section of its service.
+func policySections(l Login) (sections []string) {
+	if l.Remote() {
+		sections = append(sections, remoteSection)
+	}
+	if l.Service != "" {
+		sections = append(sections, servicePrefix+l.Service)
+	}
+	return sections
+}
+
+// isPolicySection returns true if section applies to a kind of login rather than to a domain.
+func isPolicySection(section string) bool {
+	return section == remoteSection || strings.HasPrefix(section, servicePrefix)
+}
+
+// validatePolicySection returns an error if section is a service section without a service name.
+func validatePolicySection(section string) error {
+	if s, ok := strings.CutPrefix(section, servicePrefix); ok && strings.TrimSpace(s) == "" {
+		return fmt.Errorf(i18n.G("%q has no service name"), section)
+	}
+	return nil
+}
+
+// validatePolicyKey returns an error if key can't be set in the policy section.
+func validatePolicyKey(section, key string) error {
+	if !isPolicySection(section) || slices.Contains(policyKeys, key) {
+		return nil
+	}
+	return fmt.Errorf(i18n.G("can't be set in [%s], supported keys are: %s"), section, strings.Join(policyKeys, ", "))
+}
+
+// policyKeysOf returns a copy of the policy section sec with only its policyKeys, so that a configuration which was not
+// validated can't change the account of the user depending on how they log in. The other keys are ignored.
+func policyKeysOf(ctx context.Context, sec *ini.Section) *ini.Section {
+	policy := ini.Empty().Section(sec.Name())
+	for _, k := range sec.Keys() {
+		if !slices.Contains(policyKeys, k.Name()) {
+			logger.Warn(ctx, "Ignoring %s in [%s]: it can only be set in domain sections", k.Name(), sec.Name())
+			continue
+		}
+		// The key name was already accepted in sec.
+		_, _ = policy.NewKey(k.Name(), k.Value())
+	}
+	return policy
+}
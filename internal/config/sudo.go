@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/user"
+	"github.com/ubuntu/decorate"
+)
+
+const (
+	// sudoPrefix prefixes the sections granting sudo privileges to the groups and users of domains, like
+	// [sudo:contoso.com]. The rest of the section name is a list of domain patterns, matched as described in
+	// SectionMatch.
+	sudoPrefix = "sudo:"
+	// sudoGroupPrefix prefixes the keys of sudo sections naming groups rather than users, as in sudoers.
+	sudoGroupPrefix = "%"
+)
+
+// SudoRule grants sudo privileges to the members of a group, or to a user.
+type SudoRule struct {
+	// Group is the name of the group in the cache, with its domain. It is empty for rules of users.
+	Group string
+	// Login is the name of the user in the cache, with its domain. It is empty for rules of groups.
+	Login string
+	// Commands are the commands the group members or the user can run as any user, in the sudoers format,
+	// like ALL or NOPASSWD: /usr/bin/apt, /usr/bin/systemctl.
+	Commands string
+}
+
+// SudoRules returns the sudo rules granted to the groups and users of domain, sorted by SortSudoRules, from the sudo
+// section of the configuration which applies to domain. Keys of the section are Azure AD group names prefixed with %,
+// or user names, without domain. They are normalized with it into the names of the groups and users in the cache.
+func (c *Config) SudoRules(domain string) (rules []SudoRule, err error) {
+	defer decorate.OnError(&err, i18n.G("could not load sudo rules of domain %q from %s"), domain, c.path)
+
+	cfg := c.cfg
+
+	// Sudo sections are matched as domain sections, on their domain patterns.
+	sections := make(map[string]string)
+	var patterns []string
+	for _, section := range cfg.SectionStrings() {
+		if d, ok := strings.CutPrefix(section, sudoPrefix); ok {
+			sections[d] = section
+			patterns = append(patterns, d)
+		}
+	}
+	section, ok := sections[matchSection(patterns, domain).Section]
+	if !ok {
+		return nil, nil
+	}
+
+	keys := make(map[string]string)
+	for _, k := range cfg.Section(section).Keys() {
+		if err := validateSudoRule(k.Name(), k.String()); err != nil {
+			return nil, fmt.Errorf("[%s] %s: %w", section, k.Name(), err)
+		}
+		group, isGroup := strings.CutPrefix(k.Name(), sudoGroupPrefix)
+		name, err := user.PosixName(strings.TrimSpace(group)+"@"+domain, c.NameNormalization.UserOptions()...)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] %s: %w", section, k.Name(), err)
+		}
+		r := SudoRule{Login: name, Commands: strings.TrimSpace(k.String())}
+		key := name
+		if isGroup {
+			r.Group, r.Login = name, ""
+			key = sudoGroupPrefix + name
+		}
+		if other, exists := keys[key]; exists {
+			return nil, fmt.Errorf(i18n.G("[%s] %s: same group or user as %q"), section, k.Name(), other)
+		}
+		keys[key] = k.Name()
+		rules = append(rules, r)
+	}
+	SortSudoRules(rules)
+
+	return rules, nil
+}
+
+// SortSudoRules sorts rules with the rules of groups first, sorted by group, then the rules of users, sorted by login.
+func SortSudoRules(rules []SudoRule) {
+	sort.Slice(rules, func(i, j int) bool {
+		if (rules[i].Group == "") != (rules[j].Group == "") {
+			return rules[i].Group != ""
+		}
+		return rules[i].Group+rules[i].Login < rules[j].Group+rules[j].Login
+	})
+}
+
+// isSudoSection returns true if section grants sudo privileges rather than configuring a domain.
+func isSudoSection(section string) bool {
+	return strings.HasPrefix(section, sudoPrefix)
+}
+
+// validateSudoRule returns an error if name is not a group name prefixed with % or a user name, without domain, or if
+// commands are empty or span several lines. The commands themselves are only checked by visudo, before the rules are
+// installed.
+func validateSudoRule(name, commands string) error {
+	n := strings.TrimSpace(strings.TrimPrefix(name, sudoGroupPrefix))
+	if n == "" || strings.Contains(n, "@") {
+		return fmt.Errorf(i18n.G("%q is not a group name prefixed with %s or a user name, without domain"), name, sudoGroupPrefix)
+	}
+
+	commands = strings.TrimSpace(commands)
+	if commands == "" {
+		return errors.New(i18n.G("no command listed, use ALL to allow every command"))
+	}
+	// A line break or a trailing backslash would let the value add other rules to the sudoers file.
+	if strings.Contains(commands, "\n") || strings.HasSuffix(commands, "\\") {
+		return fmt.Errorf(i18n.G("%q can't span several lines"), commands)
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package config
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-ini/ini"
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/user"
+)
+
+const (
+	shellsPath = "/etc/shells"
+
+	// maxExpirationDays is the maximum absolute value accepted for offline_credentials_expiration (100 years).
+	maxExpirationDays = 36500
+)
+
+// knownKeys are the keys accepted in any section of the configuration.
+var knownKeys = []string{"tenant_id", "app_id", "offline_credentials_expiration", "homedir", "shell", "guest_users", "offline_expiration_warning", "access", gecosClaimsKey, "inactive_users_expiration"}
+
+// globalKeys are the keys only accepted in the default section of the configuration.
+var globalKeys = []string{netBIOSDomainsKey, invalidCharsReplacementKey, enumerationKey, inlineCacheCleanupKey, metricsDirKey, strictDomainsKey, allowedDomainsKey, localConflictsKey}
+
+var guidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// IsGUID returns true if s is a GUID, like the ID of a tenant or of an application.
+func IsGUID(s string) bool {
+	return guidRegexp.MatchString(s)
+}
+
+// IsTenant returns true if s designates a single tenant, by its ID or by one of its domains, like
+// contoso.onmicrosoft.com. The multi-tenant authorities, like common or organizations, are not.
+func IsTenant(s string) bool {
+	return IsGUID(s) || (strings.Contains(s, ".") && !strings.ContainsAny(s, " /"))
+}
+
+// ValidationError is a semantic error found in a configuration file.
+type ValidationError struct {
+	File    string
+	Line    int
+	Section string
+	Key     string
+	Err     error
+}
+
+// Error returns the error prefixed with its location in the configuration.
+func (e ValidationError) Error() string {
+	loc := e.File
+	if e.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+	if e.Key == "" {
+		return fmt.Sprintf("%s: [%s] %v", loc, e.Section, e.Err)
+	}
+	return fmt.Sprintf("%s: [%s] %s: %v", loc, e.Section, e.Key, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Validate validates a given configuration file, merged with its drop-in directory.
+// Every file is checked for unknown keys and invalid values, and every domain for missing required values.
+// All the errors found are returned joined, each of them being a ValidationError when it can be located.
+func Validate(ctx context.Context, p string, opts ...Option) error {
+	o := newOptions(p, opts...)
+
+	files, err := configFiles(p, o.dropInDir)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	// sectionLines stores, for each section, the first file and line it is declared in.
+	sectionLines := make(map[string]ValidationError)
+	for _, f := range files {
+		cfg, err := ini.Load(f)
+		if err != nil {
+			return fmt.Errorf("could not open file %s: %w", f, err)
+		}
+		lines, err := keyLines(f)
+		if err != nil {
+			return err
+		}
+
+		for _, sec := range cfg.Sections() {
+			if _, exists := sectionLines[sec.Name()]; !exists && (sec.Name() != ini.DefaultSection || len(sec.Keys()) > 0) {
+				sectionLines[sec.Name()] = ValidationError{File: f, Line: lines[sec.Name()][""], Section: sec.Name()}
+			}
+			for _, k := range sec.Keys() {
+				validate := func() error { return validateKey(sec.Name(), k.Name(), k.String(), o.shellsPath) }
+				if isSudoSection(sec.Name()) {
+					validate = func() error { return validateSudoRule(k.Name(), k.String()) }
+				}
+				if err := validate(); err != nil {
+					errs = append(errs, ValidationError{File: f, Line: lines[sec.Name()][k.Name()], Section: sec.Name(), Key: k.Name(), Err: err})
+				}
+			}
+		}
+	}
+
+	cfg, err := loadIni(ctx, p, o.dropInDir)
+	if err != nil {
+		return err
+	}
+
+	// Domain patterns must be valid and can't be shared by different sections, of domains or of sudo rules.
+	// Login sections are not domains: they only need a valid name.
+	patternSections := make(map[string]string)
+	sudoPatternSections := make(map[string]string)
+	var domains []string
+	for _, section := range cfg.SectionStrings() {
+		if section == ini.DefaultSection {
+			continue
+		}
+		if isPolicySection(section) {
+			if err := validatePolicySection(section); err != nil {
+				e := sectionLines[section]
+				e.Err = err
+				errs = append(errs, e)
+			}
+			continue
+		}
+		names, patterns := patternSections, section
+		if d, ok := strings.CutPrefix(section, sudoPrefix); ok {
+			names, patterns = sudoPatternSections, d
+			if len(domainPatterns(d)) == 0 {
+				e := sectionLines[section]
+				e.Err = fmt.Errorf(i18n.G("%q has no domain"), section)
+				errs = append(errs, e)
+			}
+		} else {
+			domains = append(domains, section)
+		}
+		for _, pattern := range domainPatterns(patterns) {
+			e := sectionLines[section]
+			if err := validateDomainPattern(pattern); err != nil {
+				e.Err = err
+				errs = append(errs, e)
+				continue
+			}
+			if other, exists := names[pattern]; exists && other != section {
+				e.Err = fmt.Errorf(i18n.G("domain %q is already matched by section [%s]"), pattern, other)
+				errs = append(errs, e)
+				continue
+			}
+			names[pattern] = section
+		}
+	}
+
+	// Domain sections are checked if present. The default section is only checked if there are none,
+	// as users might set required options only in the domain sections.
+	if len(domains) == 0 {
+		domains = []string{ini.DefaultSection}
+	}
+	for _, domain := range domains {
+		for _, k := range []string{"tenant_id", "app_id"} {
+			if cfg.Section(domain).HasKey(k) || cfg.Section(ini.DefaultSection).HasKey(k) {
+				continue
+			}
+			e, ok := sectionLines[domain]
+			if !ok {
+				e = ValidationError{File: p, Section: domain}
+			}
+			e.Err = fmt.Errorf(i18n.G("missing required %q entry"), k)
+			errs = append(errs, e)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateKey returns an error if key is not supported in section or if its value is invalid.
+func validateKey(section, key, value, shellsPath string) error {
+	if slices.Contains(globalKeys, key) && section != ini.DefaultSection {
+		return errors.New(i18n.G("can only be set in the default section"))
+	}
+	if err := validatePolicyKey(section, key); err != nil {
+		return err
+	}
+
+	switch key {
+	case "tenant_id":
+		if !IsTenant(value) {
+			return fmt.Errorf(i18n.G("%q is neither a tenant ID nor a domain of a tenant"), value)
+		}
+	case "app_id":
+		if !IsGUID(value) {
+			return fmt.Errorf(i18n.G("%q is not a valid GUID"), value)
+		}
+	case "offline_credentials_expiration":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf(i18n.G("%q is not an integer"), value)
+		}
+		if v > maxExpirationDays || v < -maxExpirationDays {
+			return fmt.Errorf(i18n.G("%d is out of range [-%d, %d]"), v, maxExpirationDays, maxExpirationDays)
+		}
+	case "offline_expiration_warning", "inactive_users_expiration":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf(i18n.G("%q is not an integer"), value)
+		}
+		if v < 0 || v > maxExpirationDays {
+			return fmt.Errorf(i18n.G("%d is out of range [0, %d]"), v, maxExpirationDays)
+		}
+	case "homedir":
+		if !filepath.IsAbs(value) {
+			return fmt.Errorf(i18n.G("%q is not an absolute path"), value)
+		}
+		if err := user.ValidateHomeDirPattern(value); err != nil {
+			return err
+		}
+	case "shell":
+		return ValidateShell(value, shellsPath)
+	case "guest_users":
+		if value != guestUsersAllow && value != guestUsersDeny {
+			return fmt.Errorf(i18n.G("%q is not one of %s, %s"), value, guestUsersAllow, guestUsersDeny)
+		}
+	case "access":
+		if value != accessAllow && value != accessDeny {
+			return fmt.Errorf(i18n.G("%q is not one of %s, %s"), value, accessAllow, accessDeny)
+		}
+	case gecosClaimsKey:
+		_, err := parseGECOSClaims(value)
+		return err
+	case netBIOSDomainsKey:
+		_, err := parseNetBIOSDomains(value)
+		return err
+	case invalidCharsReplacementKey:
+		return user.ValidateInvalidCharsReplacement(value)
+	case enumerationKey:
+		_, err := parseEnumeration(value)
+		return err
+	case inlineCacheCleanupKey:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf(i18n.G("%q is not a boolean"), value)
+		}
+	case metricsDirKey:
+		return validateMetricsDir(value)
+	case localConflictsKey:
+		return validateLocalConflicts(value)
+	case strictDomainsKey:
+		return validateStrictDomains(value)
+	case allowedDomainsKey:
+		_, err := parseAllowedDomains(value)
+		return err
+	default:
+		return fmt.Errorf(i18n.G("unknown key, supported keys are: %s"), strings.Join(slices.Concat(knownKeys, globalKeys), ", "))
+	}
+	return nil
+}
+
+// ValidateShell checks that shell is an existing executable, listed in shellsPath if this one exists.
+func ValidateShell(shell, shellsPath string) error {
+	if !filepath.IsAbs(shell) {
+		return fmt.Errorf(i18n.G("%q is not an absolute path"), shell)
+	}
+	fi, err := os.Stat(shell)
+	if err != nil {
+		return fmt.Errorf(i18n.G("shell %q does not exist"), shell)
+	}
+	if fi.IsDir() || fi.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf(i18n.G("shell %q is not executable"), shell)
+	}
+
+	content, err := os.ReadFile(shellsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf(i18n.G("could not read valid shells from %s: %v"), shellsPath, err)
+	}
+	var shells []string
+	for _, l := range strings.Split(string(content), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		shells = append(shells, l)
+	}
+	if !slices.Contains(shells, shell) {
+		return fmt.Errorf(i18n.G("shell %q is not listed in %s"), shell, shellsPath)
+	}
+	return nil
+}
+
+// keyLines returns the line number of each key per section in the ini file p.
+// The line of the section header itself is stored under the empty key.
+func keyLines(p string) (map[string]map[string]int, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file %s: %w", p, err)
+	}
+	defer f.Close()
+
+	section := ini.DefaultSection
+	lines := map[string]map[string]int{section: {}}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || l[0] == '#' || l[0] == ';' {
+			continue
+		}
+		if l[0] == '[' {
+			if end := strings.LastIndexByte(l, ']'); end > 0 {
+				section = l[1:end]
+			}
+			if _, exists := lines[section]; !exists {
+				lines[section] = map[string]int{"": n}
+			}
+			continue
+		}
+		key, _, found := strings.Cut(l, "=")
+		if k, _, foundColon := strings.Cut(l, ":"); foundColon && (!found || len(k) < len(key)) {
+			key = k
+		}
+		lines[section][strings.Trim(strings.TrimSpace(key), "`\"")] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read file %s: %w", p, err)
+	}
+	return lines, nil
+}
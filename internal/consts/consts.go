@@ -12,6 +12,9 @@ const (
 	// DefaultConfigPath is the default path to the config file.
 	DefaultConfigPath = "/etc/aad.conf"
 
+	// DefaultSocketPath is the default path to the socket of the aad-authd daemon.
+	DefaultSocketPath = "/run/aad/aad-authd.sock"
+
 	// TEXTDOMAIN is the gettext domain for l10n.
 	TEXTDOMAIN = "aad-auth"
 
@@ -21,3 +24,13 @@ const (
 	// DefaultEditor is the default editor to use when no option is passed.
 	DefaultEditor = "sensible-editor"
 )
+
+// Message IDs of the events logged to the journal, to look them up with journalctl MESSAGE_ID=<id>.
+const (
+	// MessageIDAuthSucceeded is logged when a user is authenticated, online or offline.
+	MessageIDAuthSucceeded = "666f9efad170414283b2863396c9cc21"
+	// MessageIDAuthFailed is logged when a user is denied access.
+	MessageIDAuthFailed = "b015ab373d384774b6b38b5a77a9ba5b"
+	// MessageIDCredentialsRevoked is logged when the offline credentials of a user are revoked.
+	MessageIDCredentialsRevoked = "98b0b6027e7141f8add5996fb282f97a"
+)
@@ -0,0 +1,330 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strings"
+	"time"
+
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/decorate"
+)
+
+// ErrUnavailable is returned by Dial when the daemon is not running. Callers then access the cache directly.
+var ErrUnavailable = errors.New("aad-authd is not available")
+
+// dialTimeout is the maximum time to wait for the daemon to accept a connection.
+const dialTimeout = 5 * time.Second
+
+// Client is a connection to the daemon. Its methods mirror the ones of cache.Cache.
+type Client struct {
+	rpc       *rpc.Client
+	cacheOpts CacheOptions
+}
+
+// ClientOption allows to change the cache options requested by the client.
+type ClientOption func(*CacheOptions)
+
+// WithOfflineCredentialsExpiration requests the number of days users can authenticate offline.
+// It is only applied for root clients.
+func WithOfflineCredentialsExpiration(days int) ClientOption {
+	return func(o *CacheOptions) {
+		o.OfflineCredentialsExpiration = &days
+	}
+}
+
+// WithCleanUpOnOpen requests whether expired users are purged when the cache is opened.
+// It is only applied for root clients.
+func WithCleanUpOnOpen(enabled bool) ClientOption {
+	return func(o *CacheOptions) {
+		o.CleanUpOnOpen = enabled
+	}
+}
+
+// WithLocalConflicts requests the policy applied when a new user conflicts with a local account.
+// It is only applied for root clients.
+func WithLocalConflicts(policy string) ClientOption {
+	return func(o *CacheOptions) {
+		o.LocalConflicts = policy
+	}
+}
+
+// Dial connects to the daemon listening on socketPath.
+// It returns an error wrapping ErrUnavailable if the daemon is not running.
+func Dial(ctx context.Context, socketPath string, opts ...ClientOption) (c *Client, err error) {
+	var o CacheOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	logger.Debug(ctx, "Connected to aad-authd on %s", socketPath)
+
+	c = &Client{
+		rpc:       jsonrpc.NewClient(conn),
+		cacheOpts: o,
+	}
+
+	// The messages of the daemon for our requests are logged with our correlation ID.
+	if id := logger.CorrelationID(ctx); id != "" {
+		if err := c.call("SetCorrelationID", CorrelationRequest{ID: id}, &Empty{}); err != nil {
+			logger.Debug(ctx, "Can't pass correlation ID to aad-authd: %v", err)
+		}
+	}
+
+	return c, nil
+}
+
+// Close closes the connection to the daemon.
+func (c *Client) Close(ctx context.Context) error {
+	return c.rpc.Close()
+}
+
+// GetUserByName returns the user record of username.
+func (c *Client) GetUserByName(ctx context.Context, username string) (u cache.UserRecord, err error) {
+	defer decorate.OnError(&err, i18n.G("failed to get user %q from aad-authd"), username)
+
+	err = c.call("GetUserByName", NameRequest{Name: username}, &u)
+	return u, err
+}
+
+// GetUserByUID returns the user record of the user with uid.
+func (c *Client) GetUserByUID(ctx context.Context, uid uint) (u cache.UserRecord, err error) {
+	defer decorate.OnError(&err, i18n.G("failed to get user %d from aad-authd"), uid)
+
+	err = c.call("GetUserByUID", IDRequest{ID: uid}, &u)
+	return u, err
+}
+
+// GetUserByUPN returns the user record of the user with the user principal name upn.
+func (c *Client) GetUserByUPN(ctx context.Context, upn string) (u cache.UserRecord, err error) {
+	defer decorate.OnError(&err, i18n.G("failed to get UPN %q from aad-authd"), upn)
+
+	err = c.call("GetUserByUPN", NameRequest{Name: upn}, &u)
+	return u, err
+}
+
+// GetAllUserNames returns the names of all the cached users.
+func (c *Client) GetAllUserNames(ctx context.Context) (users []string, err error) {
+	defer decorate.OnError(&err, i18n.G("failed to get users from aad-authd"))
+
+	err = c.call("GetAllUserNames", Empty{}, &users)
+	return users, err
+}
+
+// GetAllUsers returns the user records allowed by the enumeration policy, without their shadow password.
+func (c *Client) GetAllUsers(ctx context.Context) (users []cache.UserRecord, err error) {
+	defer decorate.OnError(&err, i18n.G("failed to get users from aad-authd"))
+
+	err = c.call("GetAllUsers", Empty{}, &users)
+	return users, err
+}
+
+// GetAllGroups returns the group records allowed by the enumeration policy.
+func (c *Client) GetAllGroups(ctx context.Context) (groups []cache.GroupRecord, err error) {
+	defer decorate.OnError(&err, i18n.G("failed to get groups from aad-authd"))
+
+	err = c.call("GetAllGroups", Empty{}, &groups)
+	return groups, err
+}
+
+// GetGroupByName returns the group record of groupname.
+func (c *Client) GetGroupByName(ctx context.Context, groupname string) (g cache.GroupRecord, err error) {
+	defer decorate.OnError(&err, i18n.G("failed to get group %q from aad-authd"), groupname)
+
+	err = c.call("GetGroupByName", NameRequest{Name: groupname}, &g)
+	return g, err
+}
+
+// GetGroupByGID returns the group record of the group with gid.
+func (c *Client) GetGroupByGID(ctx context.Context, gid uint) (g cache.GroupRecord, err error) {
+	defer decorate.OnError(&err, i18n.G("failed to get group %d from aad-authd"), gid)
+
+	err = c.call("GetGroupByGID", IDRequest{ID: gid}, &g)
+	return g, err
+}
+
+// GetShadowByName returns the shadow record of username. Only root and the shadow group can read it.
+func (c *Client) GetShadowByName(ctx context.Context, username string) (s cache.ShadowRecord, err error) {
+	defer decorate.OnError(&err, i18n.G("failed to get shadow entry of %q from aad-authd"), username)
+
+	err = c.call("GetShadowByName", NameRequest{Name: username}, &s)
+	return s, err
+}
+
+// GetAllShadows returns the shadow records of the users allowed by the enumeration policy. Only root and the shadow
+// group can read them.
+func (c *Client) GetAllShadows(ctx context.Context) (shadows []cache.ShadowRecord, err error) {
+	defer decorate.OnError(&err, i18n.G("failed to get shadow entries from aad-authd"))
+
+	err = c.call("GetAllShadows", Empty{}, &shadows)
+	return shadows, err
+}
+
+// ShadowReadable returns true if the daemon serves shadow entries to this client.
+func (c *Client) ShadowReadable() bool {
+	var readable bool
+	if err := c.call("ShadowReadable", Empty{}, &readable); err != nil {
+		return false
+	}
+	return readable
+}
+
+// QueryPasswdAttribute returns the passwd attribute attr of login.
+// Integer attributes are returned as int64, as cache.Cache does.
+func (c *Client) QueryPasswdAttribute(ctx context.Context, login, attr string) (value any, err error) {
+	defer decorate.OnError(&err, i18n.G("could not query %s for %s"), attr, login)
+
+	var r AttributeReply
+	if err := c.call("QueryPasswdAttribute", AttributeRequest{Name: login, Attribute: attr}, &r); err != nil {
+		return "", err
+	}
+	if r.Integer != nil {
+		return *r.Integer, nil
+	}
+	return r.Value, nil
+}
+
+// UpdateUserAttribute sets the passwd attribute attr of login to value. Only root can update it.
+func (c *Client) UpdateUserAttribute(ctx context.Context, login, attr string, value any) (err error) {
+	defer decorate.OnError(&err, i18n.G("could not update %s for %s"), attr, login)
+
+	return c.call("UpdateUserAttribute", AttributeRequest{Name: login, Attribute: attr, Value: fmt.Sprint(value)}, &Empty{})
+}
+
+// CanAuthenticate authenticates username from the cache. Only root can authenticate users.
+func (c *Client) CanAuthenticate(ctx context.Context, username, password string) (err error) {
+	defer decorate.OnError(&err, i18n.G("authenticating user %q from aad-authd failed"), username)
+
+	return c.call("CanAuthenticate", AuthRequest{CacheOptions: c.cacheOpts, Name: username, Password: password}, &Empty{})
+}
+
+// OfflineCredentialsExpiry returns when username won't be able to authenticate offline anymore.
+// It returns the zero time if offline credentials never expire.
+func (c *Client) OfflineCredentialsExpiry(ctx context.Context, username string) (expiry time.Time, err error) {
+	defer decorate.OnError(&err, i18n.G("can't get offline credentials expiry of user %q from aad-authd"), username)
+
+	err = c.call("OfflineCredentialsExpiry", ExpiryRequest{CacheOptions: c.cacheOpts, Name: username}, &expiry)
+	return expiry, err
+}
+
+// Update stores username in the cache after a successful online authentication. Only root can update the cache.
+func (c *Client) Update(ctx context.Context, username, password, homeDirPattern, shell string, opts ...cache.UpdateOption) (err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't update user %q through aad-authd"), username)
+
+	objectID, upn, gecos, groups := cache.UpdateOptionsValues(opts...)
+	return c.call("Update", UpdateRequest{
+		CacheOptions:   c.cacheOpts,
+		Name:           username,
+		Password:       password,
+		HomeDirPattern: homeDirPattern,
+		Shell:          shell,
+		ObjectID:       objectID,
+		UPN:            upn,
+		GECOS:          gecos,
+		Groups:         groups,
+	}, &Empty{})
+}
+
+// Revoke locks the cached password of username after a definitive denial from Azure AD. Only root can revoke it.
+func (c *Client) Revoke(ctx context.Context, username, upn, reason string) (err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't revoke offline credentials of user %q through aad-authd"), username)
+
+	return c.call("Revoke", RevokeRequest{Name: username, UPN: upn, Reason: reason}, &Empty{})
+}
+
+// Revocation returns why the offline credentials of username were revoked. Only root and the shadow group can read it.
+func (c *Client) Revocation(ctx context.Context, username string) (r cache.RevocationRecord, err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't get revocation of user %q from aad-authd"), username)
+
+	err = c.call("Revocation", NameRequest{Name: username}, &r)
+	return r, err
+}
+
+// RecordLogin records that username opened a session from remoteHost. Only root can record it.
+func (c *Client) RecordLogin(ctx context.Context, username, remoteHost string) (err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't record login of user %q through aad-authd"), username)
+
+	return c.call("RecordLogin", RecordLoginRequest{Name: username, RemoteHost: remoteHost}, &Empty{})
+}
+
+// LoginHistory returns the sessions opened by username.
+func (c *Client) LoginHistory(ctx context.Context, username string) (h cache.LoginHistory, err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't get login history of user %q from aad-authd"), username)
+
+	err = c.call("LoginHistory", NameRequest{Name: username}, &h)
+	return h, err
+}
+
+// AddSSHKey adds the SSH public key, in the authorized_keys format, to username. Only root can add it.
+func (c *Client) AddSSHKey(ctx context.Context, username, key string) (k cache.SSHKey, err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't add SSH key of user %q through aad-authd"), username)
+
+	err = c.call("AddSSHKey", SSHKeyRequest{Name: username, Key: key}, &k)
+	return k, err
+}
+
+// RemoveSSHKey removes an SSH public key of username, passed in the authorized_keys format or as its fingerprint.
+// Only root can remove it.
+func (c *Client) RemoveSSHKey(ctx context.Context, username, key string) (err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't remove SSH key of user %q through aad-authd"), username)
+
+	return c.call("RemoveSSHKey", SSHKeyRequest{Name: username, Key: key}, &Empty{})
+}
+
+// SSHKeys returns the SSH public keys of username.
+func (c *Client) SSHKeys(ctx context.Context, username string) (keys []cache.SSHKey, err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't get SSH keys of user %q from aad-authd"), username)
+
+	var r SSHKeysReply
+	err = c.call("SSHKeys", NameRequest{Name: username}, &r)
+	return r.Keys, err
+}
+
+// AuthorizedKeys returns the SSH public keys username can log in with. Only root and the shadow group can read them.
+func (c *Client) AuthorizedKeys(ctx context.Context, username string) (keys []cache.SSHKey, err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't get authorized keys of user %q from aad-authd"), username)
+
+	var r SSHKeysReply
+	err = c.call("AuthorizedKeys", AuthorizedKeysRequest{CacheOptions: c.cacheOpts, Name: username}, &r)
+	return r.Keys, err
+}
+
+// call sends the request method to the daemon and decodes its error.
+func (c *Client) call(method string, args, reply any) error {
+	return decodeError(c.rpc.Call(serviceName+"."+method, args, reply))
+}
+
+// remoteError is an error returned by the daemon, matching one of the remoteErrors.
+type remoteError struct {
+	msg string
+	err error
+}
+
+func (e remoteError) Error() string { return e.msg }
+func (e remoteError) Unwrap() error { return e.err }
+
+// decodeError converts the errors encoded by the daemon back to the errors they match.
+func decodeError(err error) error {
+	var serverErr rpc.ServerError
+	if !errors.As(err, &serverErr) {
+		return err
+	}
+
+	msg := string(serverErr)
+	for _, e := range remoteErrors {
+		if m, ok := strings.CutPrefix(msg, "["+e.code+"] "); ok {
+			return remoteError{msg: m, err: e.err}
+		}
+	}
+	return errors.New(msg)
+}
@@ -0,0 +1,351 @@
+// Package daemon serves the cache to local processes over a Unix socket.
+//
+// The aad-authd daemon owns the cache databases, so that the PAM module, NSS and aad-cli do not need to open them
+// themselves. Clients are identified with the credentials of their socket peer: anyone can look up users and
+// groups, members of the shadow group can read shadow entries and only root can authenticate users and update the
+// cache, except for the shell and GECOS field users can change on their own account. The login history, SSH keys and
+// offline credentials expiry of an account are only served to root, the shadow group and the user themselves.
+// Clients fall back to opening the databases directly when the daemon is not running.
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"unsafe"
+
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/decorate"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// serviceName is the name the cache is served under.
+	serviceName = "Cache"
+
+	// socketPerm lets any local user connect: requests are then authorized with the peer credentials.
+	socketPerm = 0666
+	// socketDirPerm is the permission of the directory created for the socket.
+	socketDirPerm = 0755
+
+	// listenFDsStart is the first file descriptor passed by systemd on socket activation.
+	listenFDsStart = 3
+
+	// shellsPath lists the shells users can choose for their own account.
+	shellsPath = "/etc/shells"
+)
+
+// Server serves the cache over a Unix socket.
+type Server struct {
+	listener   net.Listener
+	cacheOpts  []cache.Option
+	rootUID    uint32
+	shadowGID  uint32
+	shellsPath string
+
+	// cache is kept opened for the lifetime of the server, so that requests reuse it.
+	cache *cache.Cache
+
+	// peerCreds and peerGroups override the credentials and supplementary groups of every peer, in tests.
+	peerCreds  *unix.Ucred
+	peerGroups []uint32
+
+	conns   map[net.Conn]struct{}
+	connsMu sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+type options struct {
+	cacheOpts  []cache.Option
+	rootUID    int
+	shadowGID  int
+	shellsPath string
+	peerCreds  *unix.Ucred
+	peerGroups []uint32
+}
+
+// Option allows to change the server behavior.
+type Option func(*options)
+
+// WithCacheOptions appends cache options applied to every cache opened by the server.
+func WithCacheOptions(cacheOpts []cache.Option) Option {
+	return func(o *options) {
+		o.cacheOpts = append(o.cacheOpts, cacheOpts...)
+	}
+}
+
+// WithRootUID overrides the uid of the peers allowed to authenticate users and update the cache.
+func WithRootUID(uid int) Option {
+	return func(o *options) {
+		o.rootUID = uid
+	}
+}
+
+// WithShadowGID overrides the gid of the shadow group, whose members can read shadow entries.
+// It is looked up from the system otherwise.
+func WithShadowGID(gid int) Option {
+	return func(o *options) {
+		o.shadowGID = gid
+	}
+}
+
+// WithShellsPath overrides the path of the shells users can choose for their own account, /etc/shells by default.
+func WithShellsPath(p string) Option {
+	return func(o *options) {
+		o.shellsPath = p
+	}
+}
+
+// New creates a server listening on socketPath, or on the socket passed by systemd on socket activation.
+// The cache is opened right away, so that the server fails early if it can't access it.
+func New(ctx context.Context, socketPath string, opts ...Option) (s *Server, err error) {
+	defer decorate.OnError(&err, i18n.G("can't create aad-authd server"))
+
+	o := options{shadowGID: -1, shellsPath: shellsPath}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.shadowGID < 0 {
+		shadowGrp, err := user.LookupGroup("shadow")
+		if err != nil {
+			return nil, fmt.Errorf(i18n.G("failed to find group id for group shadow: %w"), err)
+		}
+		if o.shadowGID, err = strconv.Atoi(shadowGrp.Gid); err != nil {
+			return nil, fmt.Errorf(i18n.G("failed to read shadow group id: %w"), err)
+		}
+	}
+
+	c, err := cache.New(ctx, o.cacheOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := systemdListener(ctx, os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"))
+	if err == nil && l == nil {
+		l, err = listen(ctx, socketPath)
+	}
+	if err != nil {
+		_ = c.Close(ctx)
+		return nil, err
+	}
+
+	return &Server{
+		listener:   l,
+		cacheOpts:  o.cacheOpts,
+		rootUID:    uint32(o.rootUID),
+		shadowGID:  uint32(o.shadowGID),
+		shellsPath: o.shellsPath,
+		cache:      c,
+		peerCreds:  o.peerCreds,
+		peerGroups: o.peerGroups,
+		conns:      make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Serve accepts connections until Stop is called. Each connection is served in its own goroutine.
+func (s *Server) Serve(ctx context.Context) error {
+	logger.Info(ctx, "Serving cache on %s", s.listener.Addr())
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.connsMu.Lock()
+			stopped := s.stopped
+			s.connsMu.Unlock()
+			if stopped {
+				return nil
+			}
+			return fmt.Errorf(i18n.G("can't accept connection: %w"), err)
+		}
+
+		s.connsMu.Lock()
+		if s.stopped {
+			s.connsMu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.connsMu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+// Stop stops accepting connections, closes the current ones and releases the cache.
+func (s *Server) Stop(ctx context.Context) error {
+	s.connsMu.Lock()
+	s.stopped = true
+	err := s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsMu.Unlock()
+
+	s.wg.Wait()
+
+	return errors.Join(err, s.cache.Close(ctx))
+}
+
+// serveConn serves the requests of a single client, authorized with its peer credentials.
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer func() {
+		s.connsMu.Lock()
+		delete(s.conns, conn)
+		s.connsMu.Unlock()
+		conn.Close()
+	}()
+
+	peer, err := peerCredentials(conn)
+	if err != nil {
+		logger.Warn(ctx, "Refusing connection: %v", err)
+		return
+	}
+	groups, err := peerGroups(conn)
+	if err != nil {
+		logger.Debug(ctx, "Only checking the primary group of the peer: %v", err)
+	}
+	if s.peerCreds != nil {
+		peer, groups = s.peerCreds, s.peerGroups
+	}
+	logger.Debug(ctx, "New connection from pid %d, uid %d, gid %d, groups %v", peer.Pid, peer.Uid, peer.Gid, groups)
+
+	srv := rpc.NewServer()
+	if err := srv.RegisterName(serviceName, &service{ctx: ctx, server: s, peer: *peer, peerGroups: groups}); err != nil {
+		logger.Err(ctx, "Can't register cache service: %v", err)
+		return
+	}
+	srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+}
+
+// listen creates the socket at socketPath, replacing any stale one.
+func listen(ctx context.Context, socketPath string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socketPath), socketDirPerm); err != nil {
+		return nil, err
+	}
+	if fi, err := os.Lstat(socketPath); err == nil && fi.Mode().Type() == os.ModeSocket {
+		logger.Debug(ctx, "Removing stale socket %s", socketPath)
+		if err := os.Remove(socketPath); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socketPath, socketPerm); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// systemdListener returns the socket passed by systemd on socket activation, as described by the LISTEN_PID and
+// LISTEN_FDS environment variables. It returns nil if the daemon was not socket activated.
+func systemdListener(ctx context.Context, listenPID, listenFDs string) (net.Listener, error) {
+	if listenPID == "" || listenFDs == "" {
+		return nil, nil
+	}
+	if pid, err := strconv.Atoi(listenPID); err != nil || pid != os.Getpid() {
+		logger.Debug(ctx, "Ignoring sockets passed to pid %s", listenPID)
+		return nil, nil
+	}
+	n, err := strconv.Atoi(listenFDs)
+	if err != nil || n != 1 {
+		return nil, fmt.Errorf(i18n.G("expected exactly one socket from systemd, got %q"), listenFDs)
+	}
+
+	unix.CloseOnExec(listenFDsStart)
+	f := os.NewFile(listenFDsStart, "systemd socket")
+	defer f.Close()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf(i18n.G("invalid socket from systemd: %w"), err)
+	}
+	logger.Debug(ctx, "Using socket activated by systemd")
+	return l, nil
+}
+
+// peerCredentials returns the credentials of the process at the other end of conn.
+func peerCredentials(conn net.Conn) (*unix.Ucred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("unexpected connection type %T", conn)
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, fmt.Errorf("can't read peer credentials: %w", credErr)
+	}
+	return cred, nil
+}
+
+// peerGroups returns the supplementary groups of the process at the other end of conn.
+func peerGroups(conn net.Conn) ([]uint32, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("unexpected connection type %T", conn)
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []uint32
+	var groupsErr error
+	if err := raw.Control(func(fd uintptr) {
+		groups, groupsErr = getsockoptPeerGroups(int(fd))
+	}); err != nil {
+		return nil, err
+	}
+	if groupsErr != nil {
+		return nil, fmt.Errorf("can't read peer groups: %w", groupsErr)
+	}
+	return groups, nil
+}
+
+// getsockoptPeerGroups returns the SO_PEERGROUPS option of socket fd, growing the buffer until the groups fit in.
+func getsockoptPeerGroups(fd int) ([]uint32, error) {
+	groups := make([]uint32, 64)
+	for {
+		size := uint32(len(groups) * 4)
+		// #nosec:G103 - getsockopt writes at most size bytes to groups, and the new size to size.
+		_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd), unix.SOL_SOCKET, unix.SO_PEERGROUPS,
+			uintptr(unsafe.Pointer(&groups[0])), uintptr(unsafe.Pointer(&size)), 0)
+		if errno == unix.ERANGE {
+			groups = make([]uint32, size/4)
+			continue
+		}
+		if errno != 0 {
+			return nil, errno
+		}
+		return groups[:size/4], nil
+	}
+}
@@ -0,0 +1,530 @@
+package daemon_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/daemon"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+const (
+	rootUID   = 0
+	userUID   = 1000
+	shadowGID = 4242
+
+	sshKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDnJ5xSY/GA53Oo4wEaJBbX8oZ/DeLeQ+yRxkmQ1U4bf a@example.com"
+)
+
+func TestLookups(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		peerUID uint32
+		peerGID uint32
+
+		wantShadowPasswd   bool
+		wantShadowReadable bool
+	}{
+		"root can read everything":              {peerUID: rootUID, wantShadowPasswd: true, wantShadowReadable: true},
+		"shadow group can read shadow entries":  {peerUID: userUID, peerGID: shadowGID, wantShadowPasswd: true, wantShadowReadable: true},
+		"other users can't read shadow entries": {peerUID: userUID, peerGID: userUID},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			socket := startServer(t, "users_in_db", daemon.WithPeerCredentials(tc.peerUID, tc.peerGID))
+			c := dial(t, socket)
+			ctx := context.Background()
+
+			u, err := c.GetUserByName(ctx, "myuser@domain.com")
+			require.NoError(t, err, "GetUserByName should succeed")
+			require.Equal(t, int64(1929326240), u.UID, "GetUserByName should return the requested user")
+			if tc.wantShadowPasswd {
+				require.NotEmpty(t, u.ShadowPasswd, "Shadow password should be returned to privileged peers")
+			} else {
+				require.Empty(t, u.ShadowPasswd, "Shadow password should not be returned to unprivileged peers")
+			}
+
+			u, err = c.GetUserByUID(ctx, 165119648)
+			require.NoError(t, err, "GetUserByUID should succeed")
+			require.Equal(t, "otheruser@domain.com", u.Name, "GetUserByUID should return the requested user")
+
+			_, err = c.GetUserByName(ctx, "doesnotexist@domain.com")
+			require.ErrorIs(t, err, cache.ErrNoEnt, "Unknown users should be reported as ErrNoEnt")
+
+			users, err := c.GetAllUserNames(ctx)
+			require.NoError(t, err, "GetAllUserNames should succeed")
+			require.ElementsMatch(t, []string{"myuser@domain.com", "otheruser@domain.com", "user@otherdomain.com"}, users,
+				"GetAllUserNames should return all cached users")
+
+			all, err := c.GetAllUsers(ctx)
+			require.NoError(t, err, "GetAllUsers should succeed")
+			require.Len(t, all, 3, "GetAllUsers should return all cached users")
+			for _, u := range all {
+				require.Empty(t, u.ShadowPasswd, "GetAllUsers should not return shadow passwords")
+			}
+
+			groups, err := c.GetAllGroups(ctx)
+			require.NoError(t, err, "GetAllGroups should succeed")
+			require.Len(t, groups, 3, "GetAllGroups should return all cached groups")
+
+			g, err := c.GetGroupByName(ctx, "myuser@domain.com")
+			require.NoError(t, err, "GetGroupByName should succeed")
+			require.Equal(t, []string{"myuser@domain.com"}, g.Members, "GetGroupByName should return the group members")
+
+			g, err = c.GetGroupByGID(ctx, 165119649)
+			require.NoError(t, err, "GetGroupByGID should succeed")
+			require.Equal(t, "user@otherdomain.com", g.Name, "GetGroupByGID should return the requested group")
+
+			_, err = c.GetGroupByGID(ctx, 4243)
+			require.ErrorIs(t, err, cache.ErrNoEnt, "Unknown groups should be reported as ErrNoEnt")
+
+			shell, err := c.QueryPasswdAttribute(ctx, "myuser@domain.com", "shell")
+			require.NoError(t, err, "QueryPasswdAttribute should succeed")
+			require.Equal(t, "/bin/bash", shell, "QueryPasswdAttribute should return string attributes")
+
+			uid, err := c.QueryPasswdAttribute(ctx, "myuser@domain.com", "uid")
+			require.NoError(t, err, "QueryPasswdAttribute should succeed")
+			require.Equal(t, int64(1929326240), uid, "QueryPasswdAttribute should return integer attributes as int64")
+
+			require.Equal(t, tc.wantShadowReadable, c.ShadowReadable(), "ShadowReadable should return if the peer is privileged")
+
+			s, err := c.GetShadowByName(ctx, "myuser@domain.com")
+			shadows, allErr := c.GetAllShadows(ctx)
+			if !tc.wantShadowReadable {
+				require.ErrorIs(t, err, daemon.ErrPermissionDenied, "GetShadowByName should be denied to unprivileged peers")
+				require.ErrorIs(t, allErr, daemon.ErrPermissionDenied, "GetAllShadows should be denied to unprivileged peers")
+				return
+			}
+			require.NoError(t, err, "GetShadowByName should succeed")
+			require.Equal(t, "myuser@domain.com", s.Name, "GetShadowByName should return the requested entry")
+			require.NoError(t, allErr, "GetAllShadows should succeed")
+			require.Len(t, shadows, 3, "GetAllShadows should return all cached entries")
+		})
+	}
+}
+
+func TestAuthenticateAndUpdate(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		peerUID    uint32
+		expiration *int
+
+		wantUpdateErr error
+		wantAuthErr   error
+	}{
+		"root can update and authenticate users": {peerUID: rootUID},
+
+		"error on offline authentication disabled": {peerUID: rootUID, expiration: ptr(-1), wantAuthErr: cache.ErrOfflineAuthDisabled},
+		"error on update by non root peer":         {peerUID: userUID, wantUpdateErr: daemon.ErrPermissionDenied},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			socket := startServer(t, "users_in_db", daemon.WithPeerCredentials(tc.peerUID, tc.peerUID))
+			var opts []daemon.ClientOption
+			if tc.expiration != nil {
+				opts = append(opts, daemon.WithOfflineCredentialsExpiration(*tc.expiration))
+			}
+			c := dial(t, socket, opts...)
+			ctx := context.Background()
+
+			err := c.Update(ctx, "newuser@domain.com", "my password", "/home/%f", "/bin/bash",
+				cache.WithObjectID("oid"), cache.WithUPN("newuser@domain.com"), cache.WithGECOS("New User"), cache.WithGroups([]string{"admins@domain.com"}))
+			if tc.wantUpdateErr != nil {
+				require.ErrorIs(t, err, tc.wantUpdateErr, "Update should have failed")
+
+				err = c.CanAuthenticate(ctx, "myuser@domain.com", "my password")
+				require.ErrorIs(t, err, daemon.ErrPermissionDenied, "CanAuthenticate should be denied to non root peers")
+				err = c.UpdateUserAttribute(ctx, "myuser@domain.com", "shell", "/bin/sh")
+				require.ErrorIs(t, err, daemon.ErrPermissionDenied, "UpdateUserAttribute should be denied to non root peers")
+				err = c.Revoke(ctx, "myuser@domain.com", "", "account disabled")
+				require.ErrorIs(t, err, daemon.ErrPermissionDenied, "Revoke should be denied to non root peers")
+				_, err = c.Revocation(ctx, "myuser@domain.com")
+				require.ErrorIs(t, err, daemon.ErrPermissionDenied, "Revocation should be denied to unprivileged peers")
+				err = c.RecordLogin(ctx, "myuser@domain.com", "")
+				require.ErrorIs(t, err, daemon.ErrPermissionDenied, "RecordLogin should be denied to non root peers")
+				_, err = c.LoginHistory(ctx, "myuser@domain.com")
+				require.ErrorIs(t, err, daemon.ErrPermissionDenied, "LoginHistory should be denied on the account of another user")
+				_, err = c.AddSSHKey(ctx, "myuser@domain.com", sshKey)
+				require.ErrorIs(t, err, daemon.ErrPermissionDenied, "AddSSHKey should be denied to non root peers")
+				err = c.RemoveSSHKey(ctx, "myuser@domain.com", sshKey)
+				require.ErrorIs(t, err, daemon.ErrPermissionDenied, "RemoveSSHKey should be denied to non root peers")
+				_, err = c.SSHKeys(ctx, "myuser@domain.com")
+				require.ErrorIs(t, err, daemon.ErrPermissionDenied, "SSHKeys should be denied on the account of another user")
+				_, err = c.AuthorizedKeys(ctx, "myuser@domain.com")
+				require.ErrorIs(t, err, daemon.ErrPermissionDenied, "AuthorizedKeys should be denied to unprivileged peers")
+				return
+			}
+			require.NoError(t, err, "Update should succeed")
+
+			u, err := c.GetUserByName(ctx, "newuser@domain.com")
+			require.NoError(t, err, "Updated user should be cached")
+			require.Equal(t, "newuser@domain.com", u.UPN, "Update should store the UPN of the user")
+			require.Equal(t, "New User", u.Gecos, "Update should store the GECOS of the user")
+			u, err = c.GetUserByUPN(ctx, "newuser@domain.com")
+			require.NoError(t, err, "GetUserByUPN should succeed")
+			require.Equal(t, "newuser@domain.com", u.Name, "GetUserByUPN should return the user with this UPN")
+			g, err := c.GetGroupByName(ctx, "admins@domain.com")
+			require.NoError(t, err, "Update should store the groups of the user")
+			require.Equal(t, []string{"newuser@domain.com"}, g.Members, "Update should add the user to its groups")
+
+			err = c.CanAuthenticate(ctx, "newuser@domain.com", "my password")
+			if tc.wantAuthErr != nil {
+				require.ErrorIs(t, err, tc.wantAuthErr, "CanAuthenticate should have failed")
+				return
+			}
+			require.NoError(t, err, "CanAuthenticate should succeed with the cached password")
+
+			expiry, err := c.OfflineCredentialsExpiry(ctx, "newuser@domain.com")
+			require.NoError(t, err, "OfflineCredentialsExpiry should succeed")
+			require.True(t, expiry.After(u.LastOnlineAuth), "Offline credentials should expire after the last online authentication")
+
+			err = c.CanAuthenticate(ctx, "newuser@domain.com", "wrong password")
+			require.Error(t, err, "CanAuthenticate should fail with a wrong password")
+
+			require.NoError(t, c.UpdateUserAttribute(ctx, "newuser@domain.com", "shell", "/bin/sh"), "UpdateUserAttribute should succeed")
+			shell, err := c.QueryPasswdAttribute(ctx, "newuser@domain.com", "shell")
+			require.NoError(t, err, "QueryPasswdAttribute should succeed")
+			require.Equal(t, "/bin/sh", shell, "UpdateUserAttribute should have changed the attribute")
+
+			require.NoError(t, c.RecordLogin(ctx, "newuser@domain.com", "remote.example.com"), "RecordLogin should succeed")
+			h, err := c.LoginHistory(ctx, "newuser@domain.com")
+			require.NoError(t, err, "LoginHistory should succeed")
+			require.Equal(t, int64(1), h.LoginCount, "RecordLogin should have counted the login")
+			require.Equal(t, "remote.example.com", h.LastRemoteHost, "RecordLogin should have stored the remote host")
+			err = c.RecordLogin(ctx, "unknown@domain.com", "")
+			require.ErrorIs(t, err, cache.ErrNoEnt, "RecordLogin should report unknown users as ErrNoEnt")
+
+			k, err := c.AddSSHKey(ctx, "newuser@domain.com", sshKey)
+			require.NoError(t, err, "AddSSHKey should succeed")
+			keys, err := c.AuthorizedKeys(ctx, "newuser@domain.com")
+			require.NoError(t, err, "AuthorizedKeys should succeed")
+			require.Equal(t, []cache.SSHKey{k}, keys, "AuthorizedKeys should return the added key")
+
+			require.NoError(t, c.Revoke(ctx, "newuser@domain.com", "newuser@domain.com", "account disabled"), "Revoke should succeed")
+			_, err = c.AuthorizedKeys(ctx, "newuser@domain.com")
+			require.ErrorIs(t, err, cache.ErrCredentialsRevoked, "AuthorizedKeys should fail once revoked")
+			require.NoError(t, c.RemoveSSHKey(ctx, "newuser@domain.com", k.Fingerprint), "RemoveSSHKey should succeed")
+			keys, err = c.SSHKeys(ctx, "newuser@domain.com")
+			require.NoError(t, err, "SSHKeys should succeed")
+			require.Empty(t, keys, "RemoveSSHKey should have removed the key")
+			err = c.CanAuthenticate(ctx, "newuser@domain.com", "my password")
+			require.ErrorIs(t, err, cache.ErrCredentialsRevoked, "CanAuthenticate should fail once revoked")
+			r, err := c.Revocation(ctx, "newuser@domain.com")
+			require.NoError(t, err, "Revocation should succeed")
+			require.Equal(t, "account disabled", r.Reason, "Revocation should return the reason")
+		})
+	}
+}
+
+func TestUpdateLocalConflicts(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		policy string
+
+		wantErrIs error
+	}{
+		// root is a local user of every system running the tests.
+		"error on name of a local user":                           {wantErrIs: cache.ErrLocalConflict},
+		"error on name of a local user with the requested policy": {policy: cache.LocalConflictsRefuse, wantErrIs: cache.ErrLocalConflict},
+		"error on unknown policy":                                 {policy: "share"},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			socket := startServer(t, "users_in_db", daemon.WithPeerCredentials(rootUID, rootUID))
+			var opts []daemon.ClientOption
+			if tc.policy != "" {
+				opts = append(opts, daemon.WithLocalConflicts(tc.policy))
+			}
+			c := dial(t, socket, opts...)
+
+			err := c.Update(context.Background(), "root", "my password", "/home/%f", "/bin/bash")
+			require.Error(t, err, "Update should have refused the user")
+			if tc.wantErrIs != nil {
+				require.ErrorIs(t, err, tc.wantErrIs, "Update should report the conflict to the client")
+			}
+			_, err = c.GetUserByName(context.Background(), "root")
+			require.ErrorIs(t, err, cache.ErrNoEnt, "Conflicting user should not have been created")
+		})
+	}
+}
+
+func TestAccountReads(t *testing.T) {
+	t.Parallel()
+
+	// myUserUID is the uid of myuser@domain.com in the users_in_db cache.
+	const myUserUID = 1929326240
+
+	tests := map[string]struct {
+		peerUID    uint32
+		peerGID    uint32
+		peerGroups []uint32
+
+		wantDenied bool
+	}{
+		"root can read any account":                      {peerUID: rootUID},
+		"shadow group can read any account":              {peerUID: userUID, peerGID: shadowGID},
+		"shadow group member can read any account":       {peerUID: userUID, peerGID: userUID, peerGroups: []uint32{27, shadowGID}},
+		"user can read their own account":                {peerUID: myUserUID, peerGID: myUserUID},
+		"other users can't read the account":             {peerUID: userUID, peerGID: userUID, wantDenied: true},
+		"other users in other groups can't read account": {peerUID: userUID, peerGID: userUID, peerGroups: []uint32{27}, wantDenied: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			socket := startServer(t, "users_in_db", daemon.WithPeerCredentials(tc.peerUID, tc.peerGID), daemon.WithPeerGroups(tc.peerGroups...))
+			c := dial(t, socket)
+			ctx := context.Background()
+
+			_, errExpiry := c.OfflineCredentialsExpiry(ctx, "myuser@domain.com")
+			_, errHistory := c.LoginHistory(ctx, "myuser@domain.com")
+			_, errKeys := c.SSHKeys(ctx, "myuser@domain.com")
+			_, errUPN := c.QueryPasswdAttribute(ctx, "myuser@domain.com", "upn")
+			_, errLastAuth := c.QueryPasswdAttribute(ctx, "myuser@domain.com", "last_online_auth")
+			for req, err := range map[string]error{"OfflineCredentialsExpiry": errExpiry, "LoginHistory": errHistory, "SSHKeys": errKeys,
+				"QueryPasswdAttribute upn": errUPN, "QueryPasswdAttribute last_online_auth": errLastAuth} {
+				if tc.wantDenied {
+					require.ErrorIs(t, err, daemon.ErrPermissionDenied, "%s should be denied on the account of another user", req)
+					continue
+				}
+				require.NoError(t, err, "%s should succeed", req)
+			}
+
+			_, err := c.QueryPasswdAttribute(ctx, "myuser@domain.com", "shell")
+			require.NoError(t, err, "QueryPasswdAttribute should succeed on attributes of the NSS passwd entries")
+		})
+	}
+}
+
+func TestEnumeration(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		policy string
+
+		wantUsers []string
+	}{
+		"all users are listed":        {policy: cache.EnumerateAll, wantUsers: []string{"myuser@domain.com", "otheruser@domain.com", "user@otherdomain.com"}},
+		"only listed users are shown": {policy: "myuser@domain.com", wantUsers: []string{"myuser@domain.com"}},
+		"no user is listed":           {policy: cache.EnumerateNone},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			socket := startServer(t, "users_in_db", daemon.WithCacheOptions([]cache.Option{cache.WithEnumeration(tc.policy)}))
+			c := dial(t, socket)
+
+			users, err := c.GetAllUserNames(context.Background())
+			require.NoError(t, err, "GetAllUserNames should succeed")
+			require.ElementsMatch(t, tc.wantUsers, users, "GetAllUserNames should return the enumerated users")
+
+			all, err := c.GetAllUsers(context.Background())
+			require.NoError(t, err, "GetAllUsers should succeed")
+			users = nil
+			for _, u := range all {
+				users = append(users, u.Name)
+			}
+			require.ElementsMatch(t, tc.wantUsers, users, "GetAllUsers should return the enumerated users")
+
+			_, err = c.GetUserByName(context.Background(), "otheruser@domain.com")
+			require.NoError(t, err, "GetUserByName should find users whatever the enumeration policy is")
+		})
+	}
+}
+
+func TestSelfServiceUpdate(t *testing.T) {
+	t.Parallel()
+
+	// myUserUID is the uid of myuser@domain.com in the users_in_db cache.
+	const myUserUID = 1929326240
+
+	tests := map[string]struct {
+		name      string
+		attribute string
+		value     string
+
+		wantErr   bool
+		wantErrIs error
+	}{
+		"user can change their shell": {attribute: "shell", value: "/bin/sh"},
+		"user can change their GECOS": {attribute: "gecos", value: "My New Name,Room 42"},
+
+		// error cases
+		"error on shell not listed":                {attribute: "shell", value: "/bin/true", wantErr: true},
+		"error on shell not existing":              {attribute: "shell", value: "/bin/doesnotexist", wantErr: true},
+		"error on relative shell":                  {attribute: "shell", value: "sh", wantErr: true},
+		"error on GECOS with a colon":              {attribute: "gecos", value: "My:Name", wantErr: true},
+		"error on GECOS with a newline":            {attribute: "gecos", value: "My\nName", wantErr: true},
+		"error on home change":                     {attribute: "home", value: "/tmp", wantErr: true, wantErrIs: daemon.ErrPermissionDenied},
+		"error on shell change of another account": {name: "otheruser@domain.com", attribute: "shell", value: "/bin/sh", wantErr: true, wantErrIs: daemon.ErrPermissionDenied},
+		"error on shell change of unknown user":    {name: "nouser@domain.com", attribute: "shell", value: "/bin/sh", wantErr: true, wantErrIs: cache.ErrNoEnt},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.name == "" {
+				tc.name = "myuser@domain.com"
+			}
+
+			socket := startServer(t, "users_in_db", daemon.WithPeerCredentials(myUserUID, myUserUID),
+				daemon.WithShellsPath(filepath.Join("testdata", "shells")))
+			c := dial(t, socket)
+			ctx := context.Background()
+
+			err := c.UpdateUserAttribute(ctx, tc.name, tc.attribute, tc.value)
+			if tc.wantErr {
+				require.Error(t, err, "UpdateUserAttribute should have failed")
+				if tc.wantErrIs != nil {
+					require.ErrorIs(t, err, tc.wantErrIs, "UpdateUserAttribute should have returned the expected error")
+				}
+				return
+			}
+			require.NoError(t, err, "UpdateUserAttribute should succeed on the account of the peer")
+
+			got, err := c.QueryPasswdAttribute(ctx, tc.name, tc.attribute)
+			require.NoError(t, err, "QueryPasswdAttribute should succeed")
+			require.Equal(t, tc.value, got, "UpdateUserAttribute should have changed the attribute")
+		})
+	}
+}
+
+func TestDial(t *testing.T) {
+	t.Parallel()
+
+	_, err := daemon.Dial(context.Background(), filepath.Join(t.TempDir(), "doesnotexist.sock"))
+	require.ErrorIs(t, err, daemon.ErrUnavailable, "Dial should report the daemon as unavailable when it isn't running")
+}
+
+func TestDialWithCorrelationID(t *testing.T) {
+	t.Parallel()
+
+	socket := startServer(t, "users_in_db")
+	ctx := logger.CtxWithCorrelationID(context.Background())
+
+	c, err := daemon.Dial(ctx, socket)
+	require.NoError(t, err, "Dial should pass the correlation ID to the server")
+	defer c.Close(ctx)
+
+	_, err = c.GetUserByName(ctx, "myuser@domain.com")
+	require.NoError(t, err, "Requests should succeed once the correlation ID is passed")
+}
+
+func TestStop(t *testing.T) {
+	t.Parallel()
+
+	cacheDir := t.TempDir()
+	testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+	socket := testutils.TempSocketPath(t)
+
+	s, err := daemon.New(context.Background(), socket, daemon.WithCacheOptions(testutils.CacheOptionsForTests(t, cacheDir)), daemon.WithShadowGID(shadowGID))
+	require.NoError(t, err, "New should succeed")
+
+	served := make(chan error)
+	go func() { served <- s.Serve(context.Background()) }()
+
+	c := dial(t, socket)
+	_, err = c.GetUserByName(context.Background(), "myuser@domain.com")
+	require.NoError(t, err, "GetUserByName should succeed while the server is running")
+
+	require.NoError(t, s.Stop(context.Background()), "Stop should succeed")
+	require.NoError(t, <-served, "Serve should return without error once stopped")
+
+	_, err = c.GetUserByName(context.Background(), "myuser@domain.com")
+	require.Error(t, err, "Requests should fail once the server is stopped")
+	_, err = daemon.Dial(context.Background(), socket)
+	require.ErrorIs(t, err, daemon.ErrUnavailable, "Dial should fail once the server is stopped")
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		cacheIsFile  bool
+		socketInFile bool
+	}{
+		"error on cache not accessible": {cacheIsFile: true},
+		"error on invalid socket path":  {socketInFile: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+			socket := testutils.TempSocketPath(t)
+
+			file := filepath.Join(t.TempDir(), "file")
+			require.NoError(t, os.WriteFile(file, nil, 0600), "Setup: could not create file")
+			if tc.cacheIsFile {
+				cacheDir = file
+			}
+			if tc.socketInFile {
+				socket = filepath.Join(file, "aad-authd.sock")
+			}
+
+			_, err := daemon.New(context.Background(), socket, daemon.WithCacheOptions(testutils.CacheOptionsForTests(t, cacheDir)), daemon.WithShadowGID(shadowGID))
+			require.Error(t, err, "New should have failed")
+		})
+	}
+}
+
+// startServer starts a server on a temporary socket, serving a cache loaded from the dump cacheDump.
+// It returns the path to the socket.
+func startServer(t *testing.T, cacheDump string, opts ...daemon.Option) string {
+	t.Helper()
+
+	cacheDir := t.TempDir()
+	testutils.PrepareDBsForTests(t, cacheDir, cacheDump)
+	socket := testutils.TempSocketPath(t)
+
+	opts = append([]daemon.Option{daemon.WithCacheOptions(testutils.CacheOptionsForTests(t, cacheDir)), daemon.WithShadowGID(shadowGID)}, opts...)
+	s, err := daemon.New(context.Background(), socket, opts...)
+	require.NoError(t, err, "Setup: could not create server")
+
+	served := make(chan error)
+	go func() { served <- s.Serve(context.Background()) }()
+	t.Cleanup(func() {
+		require.NoError(t, s.Stop(context.Background()), "Teardown: could not stop server")
+		require.NoError(t, <-served, "Teardown: Serve should return without error once stopped")
+	})
+
+	return socket
+}
+
+// dial connects to the server listening on socket.
+func dial(t *testing.T, socket string, opts ...daemon.ClientOption) *daemon.Client {
+	t.Helper()
+
+	c, err := daemon.Dial(context.Background(), socket, opts...)
+	require.NoError(t, err, "Setup: could not connect to server")
+	t.Cleanup(func() { c.Close(context.Background()) })
+
+	return c
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,17 @@
+package daemon
+
+import "golang.org/x/sys/unix"
+
+// WithPeerCredentials overrides the credentials of every peer connecting to the server.
+func WithPeerCredentials(uid, gid uint32) Option {
+	return func(o *options) {
+		o.peerCreds = &unix.Ucred{Uid: uid, Gid: gid}
+	}
+}
+
+// WithPeerGroups overrides the supplementary groups of every peer connecting to the server, with WithPeerCredentials.
+func WithPeerGroups(gids ...uint32) Option {
+	return func(o *options) {
+		o.peerGroups = gids
+	}
+}
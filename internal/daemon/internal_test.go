@@ -0,0 +1,84 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"golang.org/x/sys/unix"
+)
+
+func TestSystemdListener(t *testing.T) {
+	t.Parallel()
+
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := map[string]struct {
+		listenPID string
+		listenFDs string
+
+		wantErr bool
+	}{
+		"not socket activated":                 {},
+		"sockets passed to another process":    {listenPID: "1", listenFDs: "1"},
+		"sockets passed to an invalid process": {listenPID: "notapid", listenFDs: "1"},
+
+		// Error cases
+		"error on multiple sockets": {listenPID: pid, listenFDs: "2", wantErr: true},
+		"error on invalid count":    {listenPID: pid, listenFDs: "notanumber", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			l, err := systemdListener(context.Background(), tc.listenPID, tc.listenFDs)
+			if tc.wantErr {
+				require.Error(t, err, "systemdListener should have failed")
+				return
+			}
+			require.NoError(t, err, "systemdListener should not fail")
+			require.Nil(t, l, "systemdListener should not return a listener when not socket activated")
+		})
+	}
+}
+
+func TestSetCorrelationID(t *testing.T) {
+	t.Parallel()
+
+	s := &service{ctx: logger.CtxWithFields(context.Background(), "peer", "test")}
+	require.Empty(t, logger.CorrelationID(s.context()), "Requests should not have any correlation ID by default")
+
+	require.NoError(t, s.SetCorrelationID(CorrelationRequest{ID: "0123456789abcdef"}, &Empty{}), "SetCorrelationID should succeed")
+	require.Equal(t, "0123456789abcdef", logger.CorrelationID(s.context()), "Following requests should be logged with the correlation ID of the client")
+	require.Equal(t, []logger.Field{{Key: "peer", Value: "test"}, {Key: logger.CorrelationIDKey, Value: "0123456789abcdef"}},
+		logger.Fields(s.context()), "Fields of the connection should be kept")
+}
+
+func TestPeerGroups(t *testing.T) {
+	t.Parallel()
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	require.NoError(t, err, "Setup: could not create socket pair")
+	unix.Close(fds[1])
+	f := os.NewFile(uintptr(fds[0]), "socket")
+	defer f.Close()
+	conn, err := net.FileConn(f)
+	require.NoError(t, err, "Setup: could not create connection")
+	defer conn.Close()
+
+	groups, err := os.Getgroups()
+	require.NoError(t, err, "Setup: could not get groups of the current process")
+	var want []uint32
+	for _, g := range groups {
+		want = append(want, uint32(g))
+	}
+
+	got, err := peerGroups(conn)
+	require.NoError(t, err, "peerGroups should succeed")
+	require.ElementsMatch(t, want, got, "peerGroups should return the supplementary groups of the peer")
+}
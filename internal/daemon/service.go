@@ -0,0 +1,553 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/config"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"golang.org/x/sys/unix"
+)
+
+// ErrPermissionDenied is returned when the peer is not allowed to perform a request.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// remoteErrors are the errors identified across the socket, so that clients can still match them with errors.Is.
+var remoteErrors = []struct {
+	code string
+	err  error
+}{
+	{"ENOENT", cache.ErrNoEnt},
+	{"EXPIRED", cache.ErrOfflineCredentialsExpired},
+	{"OFFLINE_DISABLED", cache.ErrOfflineAuthDisabled},
+	{"UPN_MISMATCH", cache.ErrUPNMismatch},
+	{"OBJECT_ID_MISMATCH", cache.ErrObjectIDMismatch},
+	{"REVOKED", cache.ErrCredentialsRevoked},
+	{"INVALID_PASSWORD", cache.ErrInvalidPassword},
+	{"LOCAL_CONFLICT", cache.ErrLocalConflict},
+	{"EPERM", ErrPermissionDenied},
+}
+
+// CacheOptions are the cache options requested by root clients, applied on top of the server ones.
+type CacheOptions struct {
+	// OfflineCredentialsExpiration overrides the number of days users can authenticate offline, if set.
+	OfflineCredentialsExpiration *int
+	// CleanUpOnOpen purges expired users when the cache is opened, instead of leaving it to aad-cli cache gc.
+	CleanUpOnOpen bool
+	// LocalConflicts overrides the policy applied when a new user conflicts with a local account, if set.
+	LocalConflicts string
+}
+
+// Empty is the argument or reply of requests without any.
+type Empty struct{}
+
+// NameRequest is a request about the user or group Name.
+type NameRequest struct {
+	Name string
+}
+
+// IDRequest is a request about the user or group ID.
+type IDRequest struct {
+	ID uint
+}
+
+// AttributeRequest is a request about the passwd Attribute of user Name. Value is only used on updates.
+type AttributeRequest struct {
+	Name      string
+	Attribute string
+	Value     string
+}
+
+// AttributeReply is the value of a passwd attribute.
+type AttributeReply struct {
+	// Value is the value of the attribute, unless it is an integer.
+	Value string
+	// Integer is only set for integer attributes.
+	Integer *int64
+}
+
+// AuthRequest is a request to authenticate user Name from the cache.
+type AuthRequest struct {
+	CacheOptions
+	Name     string
+	Password string
+}
+
+// ExpiryRequest is a request about the offline credentials expiry of user Name.
+type ExpiryRequest struct {
+	CacheOptions
+	Name string
+}
+
+// UpdateRequest is a request to store user Name in the cache after a successful online authentication.
+// Groups are nil to leave the groups of the user unchanged.
+type UpdateRequest struct {
+	CacheOptions
+	Name           string
+	Password       string
+	HomeDirPattern string
+	Shell          string
+	ObjectID       string
+	UPN            string
+	GECOS          string
+	Groups         []string
+}
+
+// RevokeRequest is a request to revoke the offline credentials of user Name, if bound to UPN, for Reason.
+type RevokeRequest struct {
+	Name   string
+	UPN    string
+	Reason string
+}
+
+// RecordLoginRequest is a request to record that user Name opened a session from RemoteHost.
+type RecordLoginRequest struct {
+	Name       string
+	RemoteHost string
+}
+
+// SSHKeyRequest is a request to add or remove the SSH public Key of user Name.
+type SSHKeyRequest struct {
+	Name string
+	Key  string
+}
+
+// AuthorizedKeysRequest is a request about the SSH public keys user Name can log in with.
+type AuthorizedKeysRequest struct {
+	CacheOptions
+	Name string
+}
+
+// SSHKeysReply are the SSH public keys of a user. They are wrapped, as a nil slice can't be encoded as a reply.
+type SSHKeysReply struct {
+	Keys []cache.SSHKey
+}
+
+// CorrelationRequest is a request to log the following requests of the connection with the correlation ID of the
+// client.
+type CorrelationRequest struct {
+	ID string
+}
+
+// service is the cache served to a single peer.
+// Its exported methods are the requests clients can send.
+type service struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	server *Server
+	peer   unix.Ucred
+	// peerGroups are the supplementary groups of the peer.
+	peerGroups []uint32
+}
+
+// SetCorrelationID logs the following requests of the connection with the correlation ID req.ID, so that they can be
+// matched with the messages of the client.
+func (s *service) SetCorrelationID(req CorrelationRequest, _ *Empty) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ctx = logger.CtxWithFields(s.ctx, logger.CorrelationIDKey, req.ID)
+	return nil
+}
+
+// context returns the context the requests of the connection are served with.
+func (s *service) context() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ctx
+}
+
+// GetUserByName returns the user named req.Name. Its shadow password is only returned to privileged peers.
+func (s *service) GetUserByName(req NameRequest, reply *cache.UserRecord) error {
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		if *reply, err = c.GetUserByName(s.context(), req.Name); err != nil {
+			return err
+		}
+		if !s.canReadShadow() {
+			reply.ShadowPasswd = ""
+		}
+		return nil
+	})
+}
+
+// GetUserByUID returns the user with UID req.ID. Its shadow password is only returned to privileged peers.
+func (s *service) GetUserByUID(req IDRequest, reply *cache.UserRecord) error {
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		if *reply, err = c.GetUserByUID(s.context(), req.ID); err != nil {
+			return err
+		}
+		if !s.canReadShadow() {
+			reply.ShadowPasswd = ""
+		}
+		return nil
+	})
+}
+
+// GetUserByUPN returns the user with the user principal name req.Name. Its shadow password is only returned to
+// privileged peers.
+func (s *service) GetUserByUPN(req NameRequest, reply *cache.UserRecord) error {
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		if *reply, err = c.GetUserByUPN(s.context(), req.Name); err != nil {
+			return err
+		}
+		if !s.canReadShadow() {
+			reply.ShadowPasswd = ""
+		}
+		return nil
+	})
+}
+
+// GetAllUserNames returns the names of all the cached users.
+func (s *service) GetAllUserNames(_ Empty, reply *[]string) error {
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		*reply, err = c.GetAllUserNames(s.context())
+		return err
+	})
+}
+
+// GetAllUsers returns the users allowed by the enumeration policy, without their shadow password.
+func (s *service) GetAllUsers(_ Empty, reply *[]cache.UserRecord) error {
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		*reply, err = allEntries(s.context(), c.NextPasswdEntry)
+		return err
+	})
+}
+
+// GetAllGroups returns the groups allowed by the enumeration policy.
+func (s *service) GetAllGroups(_ Empty, reply *[]cache.GroupRecord) error {
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		*reply, err = allEntries(s.context(), c.NextGroupEntry)
+		return err
+	})
+}
+
+// GetGroupByName returns the group named req.Name.
+func (s *service) GetGroupByName(req NameRequest, reply *cache.GroupRecord) error {
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		*reply, err = c.GetGroupByName(s.context(), req.Name)
+		return err
+	})
+}
+
+// GetGroupByGID returns the group with GID req.ID.
+func (s *service) GetGroupByGID(req IDRequest, reply *cache.GroupRecord) error {
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		*reply, err = c.GetGroupByGID(s.context(), req.ID)
+		return err
+	})
+}
+
+// GetShadowByName returns the shadow entry of user req.Name to privileged peers.
+func (s *service) GetShadowByName(req NameRequest, reply *cache.ShadowRecord) error {
+	if !s.canReadShadow() {
+		return s.deny("read shadow entry of %q", req.Name)
+	}
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		*reply, err = c.GetShadowByName(s.context(), req.Name)
+		return err
+	})
+}
+
+// GetAllShadows returns the shadow entries of the users allowed by the enumeration policy to privileged peers.
+func (s *service) GetAllShadows(_ Empty, reply *[]cache.ShadowRecord) error {
+	if !s.canReadShadow() {
+		return s.deny("read shadow entries")
+	}
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		*reply, err = allEntries(s.context(), c.NextShadowEntry)
+		return err
+	})
+}
+
+// ShadowReadable returns whether the peer is allowed to read shadow entries.
+func (s *service) ShadowReadable(_ Empty, reply *bool) error {
+	*reply = s.canReadShadow()
+	return nil
+}
+
+// publicAttributes are the passwd attributes which any user can read, as they are in the NSS passwd entries.
+var publicAttributes = []string{"login", "password", "uid", "gid", "gecos", "home", "shell"}
+
+// QueryPasswdAttribute returns the passwd attribute req.Attribute of user req.Name. The attributes which are not
+// publicAttributes are only returned to privileged peers and to the user themselves.
+func (s *service) QueryPasswdAttribute(req AttributeRequest, reply *AttributeReply) error {
+	if !slices.Contains(publicAttributes, req.Attribute) && !s.canReadShadow() {
+		if err := s.checkOwnAccount(req.Name, "read %s of %q", req.Attribute, req.Name); err != nil {
+			return err
+		}
+	}
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) error {
+		v, err := c.QueryPasswdAttribute(s.context(), req.Name, req.Attribute)
+		if err != nil {
+			return err
+		}
+		if i, ok := v.(int64); ok {
+			reply.Integer = &i
+			return nil
+		}
+		reply.Value = fmt.Sprint(v)
+		return nil
+	})
+}
+
+// selfServiceAttributes are the passwd attributes users can change on their own account, as with chsh and chfn.
+var selfServiceAttributes = []string{"shell", "gecos"}
+
+// UpdateUserAttribute sets the passwd attribute req.Attribute of user req.Name to req.Value. Root can update any
+// attribute, and users can change the selfServiceAttributes of their own account.
+func (s *service) UpdateUserAttribute(req AttributeRequest, _ *Empty) error {
+	if !s.isRoot() {
+		if err := s.checkSelfService(req); err != nil {
+			return err
+		}
+		logger.Info(s.context(), "User with uid %d changes their %s to %q", s.peer.Uid, req.Attribute, req.Value)
+	}
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) error {
+		return c.UpdateUserAttribute(s.context(), req.Name, req.Attribute, req.Value)
+	})
+}
+
+// checkSelfService checks that the peer changes one of the selfServiceAttributes of its own account, to a value it
+// is allowed to set: a shell listed in /etc/shells, or a GECOS field which can be stored in a passwd entry.
+func (s *service) checkSelfService(req AttributeRequest) error {
+	if !slices.Contains(selfServiceAttributes, req.Attribute) {
+		return s.deny("update %s of %q", req.Attribute, req.Name)
+	}
+
+	if err := s.checkOwnAccount(req.Name, "update %s of %q", req.Attribute, req.Name); err != nil {
+		return err
+	}
+
+	switch req.Attribute {
+	case "shell":
+		if err := config.ValidateShell(req.Value, s.server.shellsPath); err != nil {
+			return err
+		}
+	case "gecos":
+		if strings.ContainsFunc(req.Value, func(r rune) bool { return r == ':' || unicode.IsControl(r) }) {
+			return fmt.Errorf("GECOS %q contains a colon or a control character", req.Value)
+		}
+	}
+	return nil
+}
+
+// CanAuthenticate authenticates user req.Name from the cache. Only root can do it.
+func (s *service) CanAuthenticate(req AuthRequest, _ *Empty) error {
+	if !s.isRoot() {
+		return s.deny("authenticate %q", req.Name)
+	}
+	return s.withCache(req.CacheOptions, func(c *cache.Cache) error {
+		return c.CanAuthenticate(s.context(), req.Name, req.Password)
+	})
+}
+
+// OfflineCredentialsExpiry returns when user req.Name won't be able to authenticate offline anymore, to privileged
+// peers and to the user themselves.
+func (s *service) OfflineCredentialsExpiry(req ExpiryRequest, reply *time.Time) error {
+	if !s.canReadShadow() {
+		if err := s.checkOwnAccount(req.Name, "read offline credentials expiry of %q", req.Name); err != nil {
+			return err
+		}
+	}
+	return s.withCache(req.CacheOptions, func(c *cache.Cache) (err error) {
+		*reply, err = c.OfflineCredentialsExpiry(s.context(), req.Name)
+		return err
+	})
+}
+
+// Update stores user req.Name in the cache after a successful online authentication. Only root can do it.
+func (s *service) Update(req UpdateRequest, _ *Empty) error {
+	if !s.isRoot() {
+		return s.deny("update %q", req.Name)
+	}
+	return s.withCache(req.CacheOptions, func(c *cache.Cache) error {
+		return c.Update(s.context(), req.Name, req.Password, req.HomeDirPattern, req.Shell, cache.WithObjectID(req.ObjectID), cache.WithUPN(req.UPN), cache.WithGECOS(req.GECOS),
+			cache.WithGroups(req.Groups))
+	})
+}
+
+// Revoke locks the cached password of user req.Name after a definitive denial from Azure AD. Only root can do it.
+func (s *service) Revoke(req RevokeRequest, _ *Empty) error {
+	if !s.isRoot() {
+		return s.deny("revoke %q", req.Name)
+	}
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) error {
+		return c.Revoke(s.context(), req.Name, req.UPN, req.Reason)
+	})
+}
+
+// Revocation returns why the offline credentials of user req.Name were revoked to privileged peers.
+func (s *service) Revocation(req NameRequest, reply *cache.RevocationRecord) error {
+	if !s.canReadShadow() {
+		return s.deny("read revocation of %q", req.Name)
+	}
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		*reply, err = c.Revocation(s.context(), req.Name)
+		return err
+	})
+}
+
+// RecordLogin records that user req.Name opened a session. Only root can do it.
+func (s *service) RecordLogin(req RecordLoginRequest, _ *Empty) error {
+	if !s.isRoot() {
+		return s.deny("record login of %q", req.Name)
+	}
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) error {
+		return c.RecordLogin(s.context(), req.Name, req.RemoteHost)
+	})
+}
+
+// LoginHistory returns the sessions opened by user req.Name, to privileged peers and to the user themselves.
+func (s *service) LoginHistory(req NameRequest, reply *cache.LoginHistory) error {
+	if !s.canReadShadow() {
+		if err := s.checkOwnAccount(req.Name, "read login history of %q", req.Name); err != nil {
+			return err
+		}
+	}
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		*reply, err = c.LoginHistory(s.context(), req.Name)
+		return err
+	})
+}
+
+// AddSSHKey adds the SSH public key req.Key to user req.Name. Only root can do it.
+func (s *service) AddSSHKey(req SSHKeyRequest, reply *cache.SSHKey) error {
+	if !s.isRoot() {
+		return s.deny("add SSH key of %q", req.Name)
+	}
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		*reply, err = c.AddSSHKey(s.context(), req.Name, req.Key)
+		return err
+	})
+}
+
+// RemoveSSHKey removes the SSH public key req.Key of user req.Name. Only root can do it.
+func (s *service) RemoveSSHKey(req SSHKeyRequest, _ *Empty) error {
+	if !s.isRoot() {
+		return s.deny("remove SSH key of %q", req.Name)
+	}
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) error {
+		return c.RemoveSSHKey(s.context(), req.Name, req.Key)
+	})
+}
+
+// SSHKeys returns the SSH public keys of user req.Name, to privileged peers and to the user themselves.
+func (s *service) SSHKeys(req NameRequest, reply *SSHKeysReply) error {
+	if !s.canReadShadow() {
+		if err := s.checkOwnAccount(req.Name, "read SSH keys of %q", req.Name); err != nil {
+			return err
+		}
+	}
+	return s.withCache(CacheOptions{}, func(c *cache.Cache) (err error) {
+		reply.Keys, err = c.SSHKeys(s.context(), req.Name)
+		return err
+	})
+}
+
+// AuthorizedKeys returns the SSH public keys user req.Name can log in with to privileged peers, as it depends on the
+// state of their account in the shadow database.
+func (s *service) AuthorizedKeys(req AuthorizedKeysRequest, reply *SSHKeysReply) error {
+	if !s.canReadShadow() {
+		return s.deny("read authorized keys of %q", req.Name)
+	}
+	return s.withCache(req.CacheOptions, func(c *cache.Cache) (err error) {
+		reply.Keys, err = c.AuthorizedKeys(s.context(), req.Name)
+		return err
+	})
+}
+
+// withCache runs f on the cache opened with the server options, and with o if the peer is root.
+// Errors returned by f are encoded so that clients can identify them.
+func (s *service) withCache(o CacheOptions, f func(c *cache.Cache) error) error {
+	opts := slices.Clone(s.server.cacheOpts)
+	if s.isRoot() {
+		if o.OfflineCredentialsExpiration != nil {
+			opts = append(opts, cache.WithOfflineCredentialsExpiration(*o.OfflineCredentialsExpiration))
+		}
+		if o.CleanUpOnOpen {
+			opts = append(opts, cache.WithCleanUpOnOpen(true))
+		}
+		if o.LocalConflicts != "" {
+			opts = append(opts, cache.WithLocalConflicts(o.LocalConflicts))
+		}
+	}
+
+	c, err := cache.New(s.context(), opts...)
+	if err != nil {
+		return encodeError(err)
+	}
+	defer c.Close(s.context())
+
+	return encodeError(f(c))
+}
+
+// allEntries returns the entries of the cache iterator next, which returns cache.ErrNoEnt once done.
+func allEntries[T any](ctx context.Context, next func(context.Context) (T, error)) ([]T, error) {
+	// Not nil, so that an empty list can be sent.
+	entries := []T{}
+	for {
+		e, err := next(ctx)
+		if errors.Is(err, cache.ErrNoEnt) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+// isRoot returns true if the peer runs as root.
+func (s *service) isRoot() bool {
+	return s.peer.Uid == s.server.rootUID
+}
+
+// canReadShadow returns true if the peer runs as root or as a member of the shadow group.
+func (s *service) canReadShadow() bool {
+	return s.isRoot() || s.peer.Gid == s.server.shadowGID || slices.Contains(s.peerGroups, s.server.shadowGID)
+}
+
+// checkOwnAccount returns a permission error for the request described by format if user name is not the account
+// of the peer.
+func (s *service) checkOwnAccount(name string, format string, a ...any) error {
+	var uid int64
+	if err := s.withCache(CacheOptions{}, func(c *cache.Cache) error {
+		u, err := c.GetUserByName(s.context(), name)
+		uid = u.UID
+		return err
+	}); err != nil {
+		return err
+	}
+	if uid != int64(s.peer.Uid) {
+		return s.deny(format+", which is not their account", a...)
+	}
+	return nil
+}
+
+// deny logs and returns a permission error for the request described by format.
+func (s *service) deny(format string, a ...any) error {
+	msg := fmt.Sprintf(format, a...)
+	logger.Warn(s.context(), "Denying request from pid %d, uid %d: %s", s.peer.Pid, s.peer.Uid, msg)
+	return encodeError(fmt.Errorf("can't %s: %w", msg, ErrPermissionDenied))
+}
+
+// encodeError prefixes err with the code of the remote error it matches, if any.
+func encodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, e := range remoteErrors {
+		if errors.Is(err, e.err) {
+			return fmt.Errorf("[%s] %v", e.code, err)
+		}
+	}
+	return err
+}
@@ -33,7 +33,12 @@ var (
 	// G is the shorthand for Gettext.
 	G = func(msgid string) string { return msgid }
 	// NG is the shorthand for NGettext.
-	NG = func(msgid string, msgidPlural string, n uint32) string { return msgid }
+	NG = func(msgid string, msgidPlural string, n uint32) string {
+		if n == 1 {
+			return msgid
+		}
+		return msgidPlural
+	}
 )
 
 // InitI18nDomain calls bind + set locale to system values.
@@ -0,0 +1,97 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CorrelationIDKey is the field identifying all the messages logged for a single authentication attempt.
+	CorrelationIDKey = "correlation_id"
+	// MessageIDKey is the field identifying the kind of event a message reports, mapped to the journal MESSAGE_ID.
+	MessageIDKey = "message_id"
+
+	ctxFieldsKey ctxKey = "fieldsCtxKey"
+)
+
+// Field is a key/value pair attached to the messages logged with a context.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// CtxWithFields returns a new context whose messages are logged with the key/value pairs kv, on top of the fields
+// already attached to ctx. A key which is already attached is overridden.
+func CtxWithFields(ctx context.Context, kv ...any) context.Context {
+	fields := slices.Clone(Fields(ctx))
+	for i := 0; i+1 < len(kv); i += 2 {
+		f := Field{Key: fmt.Sprint(kv[i]), Value: kv[i+1]}
+		if j := slices.IndexFunc(fields, func(e Field) bool { return e.Key == f.Key }); j >= 0 {
+			fields[j] = f
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return context.WithValue(ctx, ctxFieldsKey, fields)
+}
+
+// Fields returns the fields attached to ctx, in the order they were attached.
+func Fields(ctx context.Context) []Field {
+	fields, _ := ctx.Value(ctxFieldsKey).([]Field)
+	return fields
+}
+
+// CtxWithCorrelationID returns a new context with a newly generated correlation ID, so that all the messages logged
+// with it, down to the cache and Azure AD, can be told apart from the ones of other attempts.
+func CtxWithCorrelationID(ctx context.Context) context.Context {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		Warn(ctx, "Can't generate a correlation ID: %v", err)
+		return ctx
+	}
+	return CtxWithFields(ctx, CorrelationIDKey, hex.EncodeToString(b))
+}
+
+// CorrelationID returns the correlation ID attached to ctx, or an empty string if there is none.
+func CorrelationID(ctx context.Context) string {
+	for _, f := range Fields(ctx) {
+		if f.Key == CorrelationIDKey {
+			return fmt.Sprint(f.Value)
+		}
+	}
+	return ""
+}
+
+// CtxWithMessageID returns a new context whose messages report the event id, like a successful authentication.
+// ids are 128 bits written as 32 hexadecimal characters, as expected by the journal.
+func CtxWithMessageID(ctx context.Context, id string) context.Context {
+	return CtxWithFields(ctx, MessageIDKey, id)
+}
+
+// appendFields appends fields to msg, before its EOL, for the loggers which can't record them separately.
+func appendFields(msg string, fields []Field) string {
+	if len(fields) == 0 {
+		return msg
+	}
+
+	var kv []string
+	for _, f := range fields {
+		v := fmt.Sprint(f.Value)
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		kv = append(kv, f.Key+"="+v)
+	}
+
+	msg, eol := strings.CutSuffix(msg, "\n")
+	msg = fmt.Sprintf("%s [%s]", msg, strings.Join(kv, " "))
+	if eol {
+		msg += "\n"
+	}
+	return msg
+}
@@ -26,3 +26,50 @@ func TestNormalizeMsg(t *testing.T) {
 		})
 	}
 }
+
+func TestAppendFields(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		msg    string
+		fields []Field
+		want   string
+	}{
+		"fields are appended before EOL":  {msg: "My message\n", fields: []Field{{"user", "bob"}, {"count", 2}}, want: "My message [user=bob count=2]\n"},
+		"msg without EOL":                 {msg: "My message", fields: []Field{{"user", "bob"}}, want: "My message [user=bob]"},
+		"values with spaces are quoted":   {msg: "My message\n", fields: []Field{{"user", "bob smith"}}, want: "My message [user=\"bob smith\"]\n"},
+		"empty values are quoted":         {msg: "My message\n", fields: []Field{{"user", ""}}, want: "My message [user=\"\"]\n"},
+		"msg without fields is unchanged": {msg: "My message\n", want: "My message\n"},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := appendFields(tc.msg, tc.fields)
+			require.Equal(t, tc.want, got, "got expected message with fields")
+		})
+	}
+}
+
+func TestJournalFieldName(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		key  string
+		want string
+	}{
+		"key is upper cased":                    {key: "correlation_id", want: "CORRELATION_ID"},
+		"invalid characters are replaced":       {key: "remote-host.name", want: "REMOTE_HOST_NAME"},
+		"leading underscores are removed":       {key: "_pid", want: "PID"},
+		"leading digits are removed":            {key: "2fa", want: "FA"},
+		"key without valid characters is empty": {key: "-", want: ""},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := journalFieldName(tc.key)
+			require.Equal(t, tc.want, got, "got expected journal field name")
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+// JournalLogger sends the messages and their fields to the systemd journal, with its native protocol.
+// Fields are sent as journal fields, in upper case, and the message ID as MESSAGE_ID.
+type JournalLogger struct {
+	conn       *net.UnixConn
+	identifier string
+	priority   Priority
+}
+
+type journalOptions struct {
+	socket string
+}
+
+// JournalOption represents one functional option passed to NewJournalLogger.
+type JournalOption func(*journalOptions)
+
+// WithJournalSocket overrides the socket of the journal.
+func WithJournalSocket(p string) JournalOption {
+	return func(o *journalOptions) {
+		o.socket = p
+	}
+}
+
+// NewJournalLogger returns a logger sending the messages up to priority to the journal, as identifier.
+func NewJournalLogger(identifier string, priority Priority, opts ...JournalOption) (*JournalLogger, error) {
+	o := journalOptions{
+		socket: defaultJournalSocket,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: o.socket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to the journal: %w", err)
+	}
+
+	return &JournalLogger{
+		conn:       conn,
+		identifier: identifier,
+		priority:   priority,
+	}, nil
+}
+
+// JournalStream returns true if stderr is connected to the journal, as set by systemd for its services.
+func JournalStream() bool {
+	var dev, ino uint64
+	if _, err := fmt.Sscanf(os.Getenv("JOURNAL_STREAM"), "%d:%d", &dev, &ino); err != nil {
+		return false
+	}
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(os.Stderr.Fd()), &st); err != nil {
+		return false
+	}
+	return st.Dev == dev && st.Ino == ino
+}
+
+// Log sends a message of priority to the journal, with its fields.
+func (l JournalLogger) Log(priority Priority, msg string, fields []Field) {
+	if priority > l.priority {
+		return
+	}
+
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", strings.TrimSuffix(msg, "\n"))
+	writeJournalField(&b, "PRIORITY", fmt.Sprint(int(priority)))
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", l.identifier)
+	for _, f := range fields {
+		name := journalFieldName(f.Key)
+		if name == "" {
+			continue
+		}
+		writeJournalField(&b, name, fmt.Sprint(f.Value))
+	}
+
+	if _, err := l.conn.Write(b.Bytes()); err != nil {
+		log.Printf("%s: %s", priority, appendFields(msg, fields))
+	}
+}
+
+// Debug sends a debug level message to the journal.
+func (l JournalLogger) Debug(format string, a ...any) {
+	l.Log(PriorityDebug, fmt.Sprintf(format, a...), nil)
+}
+
+// Info sends an informational message to the journal.
+func (l JournalLogger) Info(format string, a ...any) {
+	l.Log(PriorityInfo, fmt.Sprintf(format, a...), nil)
+}
+
+// Warn sends a warning level message to the journal.
+func (l JournalLogger) Warn(format string, a ...any) {
+	l.Log(PriorityWarning, fmt.Sprintf(format, a...), nil)
+}
+
+// Err sends an error level message to the journal.
+func (l JournalLogger) Err(format string, a ...any) {
+	l.Log(PriorityErr, fmt.Sprintf(format, a...), nil)
+}
+
+// Crit sends a critical message to the journal.
+func (l JournalLogger) Crit(format string, a ...any) {
+	l.Log(PriorityCrit, fmt.Sprintf(format, a...), nil)
+}
+
+// Close closes the connection to the journal.
+func (l JournalLogger) Close() error {
+	return l.conn.Close()
+}
+
+// writeJournalField writes the field name with value to b.
+// Values spanning several lines are written with their size, as required by the protocol.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+		return
+	}
+	b.WriteString(name + "\n")
+	_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
+
+// journalFieldName returns key as a journal field name: upper case letters, digits and underscores, not starting with
+// an underscore which is reserved to the fields set by the journal itself.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+	return strings.TrimLeft(name, "_0123456789")
+}
@@ -0,0 +1,78 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/logger"
+)
+
+func TestJournalLogger(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		logFn    func(ctx context.Context, format string, a ...any)
+		priority logger.Priority
+		msg      string
+		kv       []any
+
+		want []byte
+	}{
+		"message with priority": {logFn: logger.Warn, priority: logger.PriorityInfo,
+			want: []byte("MESSAGE=my log message\nPRIORITY=4\nSYSLOG_IDENTIFIER=aad-test\n")},
+		"message with fields": {logFn: logger.Info, priority: logger.PriorityInfo, kv: []any{"user", "bob", logger.MessageIDKey, "0123456789abcdef0123456789abcdef"},
+			want: []byte("MESSAGE=my log message\nPRIORITY=6\nSYSLOG_IDENTIFIER=aad-test\nUSER=bob\nMESSAGE_ID=0123456789abcdef0123456789abcdef\n")},
+		"message on several lines": {logFn: logger.Err, priority: logger.PriorityInfo, msg: "my log\nmessage",
+			want: append(append([]byte("MESSAGE\n"), binary.LittleEndian.AppendUint64(nil, 14)...), []byte("my log\nmessage\nPRIORITY=3\nSYSLOG_IDENTIFIER=aad-test\n")...)},
+
+		"debug message filtered out by priority": {logFn: logger.Debug, priority: logger.PriorityInfo},
+		"debug message with debug priority": {logFn: logger.Debug, priority: logger.PriorityDebug,
+			want: []byte("MESSAGE=my log message\nPRIORITY=7\nSYSLOG_IDENTIFIER=aad-test\n")},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.msg == "" {
+				tc.msg = "my log message"
+			}
+
+			socket := filepath.Join(t.TempDir(), "journal.sock")
+			journal, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+			require.NoError(t, err, "Setup: could not listen on the journal socket")
+			defer journal.Close()
+
+			l, err := logger.NewJournalLogger("aad-test", tc.priority, logger.WithJournalSocket(socket))
+			require.NoError(t, err, "NewJournalLogger should connect to the journal")
+			ctx := logger.CtxWithFields(logger.CtxWithLogger(context.Background(), l), tc.kv...)
+			defer logger.CloseLoggerFromContext(ctx)
+
+			tc.logFn(ctx, "%s", tc.msg)
+			// Another message is always sent afterwards, so that filtered out ones can be told apart.
+			l.Crit("end")
+
+			got := make([]byte, 4096)
+			n, err := journal.Read(got)
+			require.NoError(t, err, "Reading from the journal socket should succeed")
+			got = got[:n]
+			if tc.want == nil {
+				require.True(t, bytes.HasPrefix(got, []byte("MESSAGE=end\n")), "Message should have been filtered out, got %q", got)
+				return
+			}
+			require.Equal(t, string(tc.want), string(got), "Journal should have received the expected fields")
+		})
+	}
+}
+
+func TestNewJournalLoggerWithoutJournal(t *testing.T) {
+	t.Parallel()
+
+	_, err := logger.NewJournalLogger("aad-test", logger.PriorityInfo, logger.WithJournalSocket(filepath.Join(t.TempDir(), "doesnotexist.sock")))
+	require.Error(t, err, "NewJournalLogger should fail when the journal is not running")
+}
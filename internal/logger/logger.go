@@ -25,6 +25,46 @@ type Logger interface {
 	Close() error
 }
 
+// StructuredLogger is a Logger which records the fields of the messages separately from them.
+type StructuredLogger interface {
+	Logger
+	// Log sends a message of priority to the logger, with its fields.
+	Log(priority Priority, msg string, fields []Field)
+}
+
+// Priority is the level of a message, matching the syslog levels.
+type Priority int
+
+const (
+	// PriorityCrit is the level of critical messages.
+	PriorityCrit Priority = 2
+	// PriorityErr is the level of error messages.
+	PriorityErr Priority = 3
+	// PriorityWarning is the level of warning messages.
+	PriorityWarning Priority = 4
+	// PriorityInfo is the level of informational messages.
+	PriorityInfo Priority = 6
+	// PriorityDebug is the level of debug messages.
+	PriorityDebug Priority = 7
+)
+
+// String returns the name the priority is printed with.
+func (p Priority) String() string {
+	switch p {
+	case PriorityCrit:
+		return "CRITICAL"
+	case PriorityErr:
+		return "ERROR"
+	case PriorityWarning:
+		return "WARNING"
+	case PriorityInfo:
+		return "INFO"
+	case PriorityDebug:
+		return "DEBUG"
+	}
+	return fmt.Sprintf("PRIORITY %d", int(p))
+}
+
 type ctxKey string
 
 const (
@@ -49,57 +89,58 @@ func CloseLoggerFromContext(ctx context.Context) error {
 
 // Debug calls the corresponding logger Debug() func from context.
 func Debug(ctx context.Context, format string, a ...any) {
-	msg := normalizeMsg(fmt.Sprintf(format, a...))
-	l, ok := ctx.Value(ctxloggerKey).(Logger)
-	if !ok {
-		log.Printf("DEBUG: %v", msg)
-		return
-	}
-	l.Debug(msg)
+	logWithFields(ctx, PriorityDebug, format, a...)
 }
 
 // Info calls the corresponding logger Info() func from context.
 func Info(ctx context.Context, format string, a ...any) {
-	msg := normalizeMsg(fmt.Sprintf(format, a...))
-	l, ok := ctx.Value(ctxloggerKey).(Logger)
-	if !ok {
-		log.Printf("INFO: %v", msg)
-		return
-	}
-	l.Info(msg)
+	logWithFields(ctx, PriorityInfo, format, a...)
 }
 
 // Warn calls the corresponding logger Warn() func from context.
 func Warn(ctx context.Context, format string, a ...any) {
-	msg := normalizeMsg(fmt.Sprintf(format, a...))
-	l, ok := ctx.Value(ctxloggerKey).(Logger)
-	if !ok {
-		log.Printf("WARNING: %v", msg)
-		return
-	}
-	l.Warn(msg)
+	logWithFields(ctx, PriorityWarning, format, a...)
 }
 
 // Err calls the corresponding logger Err() func from context.
 func Err(ctx context.Context, format string, a ...any) {
-	msg := normalizeMsg(fmt.Sprintf(format, a...))
-	l, ok := ctx.Value(ctxloggerKey).(Logger)
-	if !ok {
-		log.Printf("ERROR: %v", msg)
-		return
-	}
-	l.Err(msg)
+	logWithFields(ctx, PriorityErr, format, a...)
 }
 
 // Crit calls the corresponding logger Crit() func from context.
 func Crit(ctx context.Context, format string, a ...any) {
+	logWithFields(ctx, PriorityCrit, format, a...)
+}
+
+// logWithFields sends the message to the logger from context, with the fields attached to ctx.
+// Loggers which can't record fields separately get them appended to the message.
+func logWithFields(ctx context.Context, priority Priority, format string, a ...any) {
 	msg := normalizeMsg(fmt.Sprintf(format, a...))
+	fields := Fields(ctx)
+
 	l, ok := ctx.Value(ctxloggerKey).(Logger)
 	if !ok {
-		log.Printf("CRITICAL: %v", msg)
+		log.Printf("%s: %v", priority, appendFields(msg, fields))
 		return
 	}
-	l.Crit(msg)
+	if sl, ok := l.(StructuredLogger); ok {
+		sl.Log(priority, msg, fields)
+		return
+	}
+
+	msg = appendFields(msg, fields)
+	switch priority {
+	case PriorityDebug:
+		l.Debug("%s", msg)
+	case PriorityInfo:
+		l.Info("%s", msg)
+	case PriorityWarning:
+		l.Warn("%s", msg)
+	case PriorityErr:
+		l.Err("%s", msg)
+	default:
+		l.Crit("%s", msg)
+	}
 }
 
 // normalizeMsg use format to expand a to it.
@@ -111,3 +111,49 @@ func (d *dummyLogger) Crit(format string, a ...any) {
 func (d dummyLogger) Close() error {
 	return nil
 }
+
+func TestLoggingWithFields(t *testing.T) {
+	tests := map[string]struct {
+		kv                 []any
+		correlationID      bool
+		hasLoggerInContext bool
+
+		wantLoggerPrint string
+	}{
+		"fields, with logger": {kv: []any{"user", "bob"}, hasLoggerInContext: true, wantLoggerPrint: "INFO: my log message [user=bob]\n"},
+		"fields, on stderr":   {kv: []any{"user", "bob"}, wantLoggerPrint: "INFO: my log message [user=bob]\n"},
+
+		"overridden field": {kv: []any{"user", "bob", "user", "alice"}, hasLoggerInContext: true, wantLoggerPrint: "INFO: my log message [user=alice]\n"},
+		"correlation ID":   {correlationID: true, hasLoggerInContext: true, wantLoggerPrint: "INFO: my log message [correlation_id="},
+		"dangling key":     {kv: []any{"user", "bob", "count"}, hasLoggerInContext: true, wantLoggerPrint: "INFO: my log message [user=bob]\n"},
+		"no fields":        {hasLoggerInContext: true, wantLoggerPrint: "INFO: my log message\n"},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.correlationID {
+				ctx = logger.CtxWithCorrelationID(ctx)
+				require.Len(t, logger.CorrelationID(ctx), 16, "CorrelationID should return the generated correlation ID")
+			}
+			ctx = logger.CtxWithFields(ctx, tc.kv...)
+
+			l := &dummyLogger{}
+			var content string
+			if tc.hasLoggerInContext {
+				ctx = logger.CtxWithLogger(ctx, l)
+				logger.Info(ctx, "my %s message", "log")
+				content = l.content
+			} else {
+				var b strings.Builder
+				origOut := log.Writer()
+				log.SetOutput(&b)
+				defer log.SetOutput(origOut)
+				logger.Info(ctx, "my %s message", "log")
+				content = b.String()
+			}
+
+			require.Contains(t, content, tc.wantLoggerPrint, "Logged expected content")
+		})
+	}
+}
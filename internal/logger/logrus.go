@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -40,6 +41,27 @@ func (l LogrusLogger) Crit(format string, a ...any) {
 	l.Fatalf(format, a...)
 }
 
+// Log sends a message of priority to the logger, with fields as logrus fields.
+func (l LogrusLogger) Log(priority Priority, msg string, fields []Field) {
+	entry := l.WithFields(logrus.Fields{})
+	for _, f := range fields {
+		entry = entry.WithField(f.Key, f.Value)
+	}
+
+	switch priority {
+	case PriorityDebug:
+		entry.Debug(msg)
+	case PriorityInfo:
+		entry.Info(msg)
+	case PriorityWarning:
+		entry.Warning(msg)
+	case PriorityErr:
+		entry.Error(msg)
+	default:
+		entry.Fatal(msg)
+	}
+}
+
 // Close is a no-op for logrus.
 func (l LogrusLogger) Close() error { return nil } // no-op
 
@@ -63,23 +85,44 @@ func (f *LogrusFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	b.WriteString(strings.ToUpper(entry.Level.String()))
 
 	if logrus.StandardLogger().ReportCaller {
-		// We have to go up the stack to get the actual function name.
-		// Maybe not the best way, but this gets us out of logrus land.
-		pc, _, line, ok := runtime.Caller(9)
-		caller := runtime.FuncForPC(pc)
-
-		if ok {
-			b.WriteString(fmt.Sprintf(":%s:%d", caller.Name(), line))
+		if f, ok := loggingCaller(); ok {
+			b.WriteString(fmt.Sprintf(":%s:%d", f.Function, f.Line))
 		}
 	}
 	b.WriteString(": ")
 
 	if entry.Message != "" {
-		b.WriteString(entry.Message)
+		b.WriteString(appendFields(entry.Message, sortedFields(entry.Data)))
 	}
 	return b.Bytes(), nil
 }
 
+// loggingCaller returns the frame which logged the message, the first one out of logrus and of this package.
+func loggingCaller() (runtime.Frame, bool) {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "github.com/sirupsen/logrus.") &&
+			!strings.HasPrefix(f.Function, "github.com/ubuntu/aad-auth/internal/logger.") {
+			return f, true
+		}
+		if !more {
+			return runtime.Frame{}, false
+		}
+	}
+}
+
+// sortedFields returns the logrus fields data, sorted by key so that they are always printed in the same order.
+func sortedFields(data logrus.Fields) []Field {
+	fields := make([]Field, 0, len(data))
+	for k, v := range data {
+		fields = append(fields, Field{Key: k, Value: v})
+	}
+	slices.SortFunc(fields, func(a, b Field) int { return strings.Compare(a.Key, b.Key) })
+	return fields
+}
+
 // SetVerboseMode changes the error format and logs between very, middly and non verbose.
 func SetVerboseMode(level int) {
 	switch level {
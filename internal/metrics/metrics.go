@@ -0,0 +1,369 @@
+// Package metrics maintains the authentication metrics in a Prometheus textfile, read by the node exporter.
+//
+// Every process adds its samples to the ones already in the file: the PAM module records each login, and aad-cli
+// the size of the cache. Metrics are best effort: they are dropped rather than failing a login, or delaying it for
+// more than lockTimeout.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ubuntu/aad-auth/internal/logger"
+)
+
+const (
+	// fileName is the textfile the metrics are written to. The node exporter only reads files ending in .prom.
+	fileName = "aad_auth.prom"
+	// lockName is the file locked while the metrics are written, so that concurrent logins don't lose samples.
+	lockName = ".aad_auth.prom.lock"
+
+	// lockTimeout is how long a process waits for the others to write the textfile before dropping its samples.
+	lockTimeout = 250 * time.Millisecond
+	// lockRetryInterval is how often the lock is tried again until lockTimeout.
+	lockRetryInterval = 10 * time.Millisecond
+)
+
+// Login modes.
+const (
+	// ModeOnline is the mode of logins checked against Azure AD.
+	ModeOnline = "online"
+	// ModeOffline is the mode of logins checked against the cache, when Azure AD is unreachable.
+	ModeOffline = "offline"
+)
+
+// Login results.
+const (
+	// ResultSuccess is the result of successful logins.
+	ResultSuccess = "success"
+	// ResultFailure is the result of denied logins.
+	ResultFailure = "failure"
+)
+
+type metricType string
+
+const (
+	counter   metricType = "counter"
+	gauge     metricType = "gauge"
+	histogram metricType = "histogram"
+)
+
+// family describes a metric and its samples.
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	buckets []float64
+}
+
+var (
+	logins = family{
+		name: "aad_auth_logins_total",
+		help: "Number of logins of Azure AD users, by mode and result.",
+		typ:  counter,
+	}
+	denials = family{
+		name: "aad_auth_denials_total",
+		help: "Number of denied logins of Azure AD users, by reason.",
+		typ:  counter,
+	}
+	aadRequestDuration = family{
+		name:    "aad_auth_aad_request_duration_seconds",
+		help:    "Duration of the authentication requests to Azure AD.",
+		typ:     histogram,
+		buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}
+	cacheUsers = family{
+		name: "aad_auth_cache_users",
+		help: "Number of Azure AD users in the cache.",
+		typ:  gauge,
+	}
+	cacheSize = family{
+		name: "aad_auth_cache_size_bytes",
+		help: "Size of the cache databases.",
+		typ:  gauge,
+	}
+	cachePurgedUsers = family{
+		name: "aad_auth_cache_purged_users_total",
+		help: "Number of expired users purged from the cache.",
+		typ:  counter,
+	}
+
+	// families are the metrics written to the textfile, in this order.
+	families = []family{logins, denials, aadRequestDuration, cacheUsers, cacheSize, cachePurgedUsers}
+)
+
+// Metrics are the samples recorded by a process, until they are written with Flush.
+// A nil *Metrics records nothing, so that callers don't have to check whether metrics are enabled.
+type Metrics struct {
+	dir string
+
+	// added are the values added to counters and histograms.
+	added map[string]float64
+	// set are the values of gauges.
+	set map[string]float64
+}
+
+// New returns the metrics written to the textfile in dir. It returns nil if dir is empty, disabling metrics.
+func New(dir string) *Metrics {
+	if dir == "" {
+		return nil
+	}
+	return &Metrics{
+		dir:   dir,
+		added: make(map[string]float64),
+		set:   make(map[string]float64),
+	}
+}
+
+// AddLogin counts a login in mode with result.
+func (m *Metrics) AddLogin(mode, result string) {
+	if m == nil {
+		return
+	}
+	m.added[series(logins.name, "mode", mode, "result", result)]++
+}
+
+// AddDenial counts a login denied for reason.
+func (m *Metrics) AddDenial(reason string) {
+	if m == nil {
+		return
+	}
+	m.added[series(denials.name, "reason", reason)]++
+}
+
+// ObserveAADRequest records the duration of an authentication request to Azure AD.
+func (m *Metrics) ObserveAADRequest(d time.Duration) {
+	if m == nil {
+		return
+	}
+	// Buckets are cumulative, and all written even when empty.
+	for _, b := range aadRequestDuration.buckets {
+		var n float64
+		if d.Seconds() <= b {
+			n = 1
+		}
+		m.added[series(aadRequestDuration.name+"_bucket", "le", formatValue(b))] += n
+	}
+	m.added[series(aadRequestDuration.name+"_bucket", "le", "+Inf")]++
+	m.added[series(aadRequestDuration.name+"_sum")] += d.Seconds()
+	m.added[series(aadRequestDuration.name+"_count")]++
+}
+
+// SetCache records the number of users in the cache and the size of its databases, by database name.
+func (m *Metrics) SetCache(users int, sizes map[string]int64) {
+	if m == nil {
+		return
+	}
+	m.set[series(cacheUsers.name)] = float64(users)
+	for db, size := range sizes {
+		m.set[series(cacheSize.name, "db", db)] = float64(size)
+	}
+}
+
+// AddPurgedUsers counts users purged from the cache.
+func (m *Metrics) AddPurgedUsers(n int) {
+	if m == nil {
+		return
+	}
+	m.added[series(cachePurgedUsers.name)] += float64(n)
+}
+
+// Flush adds the recorded samples to the ones of the textfile, and atomically replaces it.
+// Failures are only logged: the samples are dropped if the textfile is still being written by another process after
+// lockTimeout.
+func (m *Metrics) Flush(ctx context.Context) {
+	if m == nil || (len(m.added) == 0 && len(m.set) == 0) {
+		return
+	}
+	if err := m.flush(); err != nil {
+		logger.Debug(ctx, "Not writing metrics: %v", err)
+		return
+	}
+	clear(m.added)
+	clear(m.set)
+}
+
+func (m *Metrics) flush() (err error) {
+	lock, err := os.OpenFile(filepath.Join(m.dir, lockName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("metrics are being written by another process: %w", err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	p := filepath.Join(m.dir, fileName)
+	samples, err := readSamples(p)
+	if err != nil {
+		return err
+	}
+	for k, v := range m.added {
+		samples[k] += v
+	}
+	for k, v := range m.set {
+		samples[k] = v
+	}
+
+	// Write to a temporary file in the same directory, so that it can be renamed atomically over the textfile.
+	f, err := os.CreateTemp(m.dir, "."+fileName+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if err := writeSamples(f, samples); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// lockFile takes the exclusive lock of f, trying again until lockTimeout. Writing the textfile only takes a few
+// milliseconds, but a blocking lock would delay the login for as long as another process holds it.
+func lockFile(f *os.File) error {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if !errors.Is(err, syscall.EWOULDBLOCK) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// readSamples returns the samples of the textfile p, by series. A missing textfile has no samples.
+func readSamples(p string) (map[string]float64, error) {
+	samples := make(map[string]float64)
+
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return samples, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		if i < 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			continue
+		}
+		samples[line[:i]] = v
+	}
+	return samples, s.Err()
+}
+
+// writeSamples writes samples in the Prometheus text format, by family with their help and type.
+func writeSamples(f *os.File, samples map[string]float64) error {
+	w := bufio.NewWriter(f)
+	for _, fam := range families {
+		var names []string
+		for k := range samples {
+			if name, _, _ := strings.Cut(k, "{"); name == fam.name || (fam.typ == histogram && isHistogramSeries(name, fam.name)) {
+				names = append(names, k)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		slices.SortFunc(names, compareSeries)
+
+		fmt.Fprintf(w, "# HELP %s %s\n", fam.name, fam.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", fam.name, fam.typ)
+		for _, k := range names {
+			fmt.Fprintf(w, "%s %s\n", k, formatValue(samples[k]))
+		}
+	}
+	return w.Flush()
+}
+
+// isHistogramSeries returns true if name is one of the series of the histogram fam.
+func isHistogramSeries(name, fam string) bool {
+	return name == fam+"_bucket" || name == fam+"_sum" || name == fam+"_count"
+}
+
+// compareSeries orders series by name, then by bucket bound for histograms, and by labels otherwise.
+func compareSeries(a, b string) int {
+	an, al, _ := strings.Cut(a, "{")
+	bn, bl, _ := strings.Cut(b, "{")
+	if an != bn {
+		// Buckets come before the sum and the count.
+		return strings.Compare(strings.Replace(an, "_bucket", "_a", 1), strings.Replace(bn, "_bucket", "_a", 1))
+	}
+	ale, aok := bucketBound(al)
+	ble, bok := bucketBound(bl)
+	if aok && bok {
+		switch {
+		case ale < ble:
+			return -1
+		case ale > ble:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(al, bl)
+}
+
+// bucketBound returns the upper bound of a bucket from its labels.
+func bucketBound(labels string) (float64, bool) {
+	v, ok := strings.CutPrefix(labels, `le="`)
+	if !ok {
+		return 0, false
+	}
+	v = strings.TrimSuffix(v, `"}`)
+	if v == "+Inf" {
+		return math.Inf(1), true
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	return f, err == nil
+}
+
+// series returns the name of the series of metric name with the label/value pairs.
+func series(name string, labels ...string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	var l []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		l = append(l, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return fmt.Sprintf("%s{%s}", name, strings.Join(l, ","))
+}
+
+// formatValue formats v as Prometheus does.
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
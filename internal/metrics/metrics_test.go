@@ -0,0 +1,129 @@
+package metrics_test
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/metrics"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+func TestFlush(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		existing   string
+		locked     bool
+		missingDir bool
+		noSample   bool
+		flushTwice bool
+		wantNoFile bool
+		// releaseLockAfter releases the lock of the metrics while Flush waits for it, if set.
+		releaseLockAfter time.Duration
+	}{
+		"write new metrics":                    {},
+		"add to existing metrics":              {existing: "existing.prom"},
+		"add samples recorded after a flush":   {flushTwice: true},
+		"keep existing metrics without sample": {existing: "existing.prom", noSample: true},
+
+		"samples are dropped when the metrics are locked": {existing: "existing.prom", locked: true},
+		"nothing is written to a missing directory":       {missingDir: true, wantNoFile: true},
+
+		"samples are written when the metrics are unlocked in time": {existing: "existing.prom", locked: true, releaseLockAfter: 50 * time.Millisecond},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			if tc.missingDir {
+				dir = filepath.Join(dir, "missing")
+			}
+			if tc.existing != "" {
+				data, err := os.ReadFile(filepath.Join("testdata", tc.existing))
+				require.NoError(t, err, "Setup: could not read existing metrics")
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "aad_auth.prom"), data, 0600), "Setup: could not write existing metrics")
+			}
+			if tc.locked {
+				f, err := os.OpenFile(filepath.Join(dir, ".aad_auth.prom.lock"), os.O_CREATE|os.O_RDWR, 0600)
+				require.NoError(t, err, "Setup: could not create lock file")
+				defer f.Close()
+				require.NoError(t, syscall.Flock(int(f.Fd()), syscall.LOCK_EX), "Setup: could not lock metrics")
+				if tc.releaseLockAfter > 0 {
+					time.AfterFunc(tc.releaseLockAfter, func() { _ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN) })
+				}
+			}
+
+			m := metrics.New(dir)
+			record := func() {
+				if tc.noSample {
+					return
+				}
+				m.AddLogin(metrics.ModeOnline, metrics.ResultSuccess)
+				m.AddLogin(metrics.ModeOnline, metrics.ResultFailure)
+				m.AddLogin(metrics.ModeOffline, metrics.ResultSuccess)
+				m.AddDenial("invalid_credentials")
+				m.ObserveAADRequest(300 * time.Millisecond)
+				m.ObserveAADRequest(3 * time.Second)
+				m.SetCache(5, map[string]int64{"passwd": 8192, "shadow": 4096})
+				m.AddPurgedUsers(2)
+			}
+			record()
+			m.Flush(context.Background())
+			if tc.flushTwice {
+				record()
+				m.Flush(context.Background())
+			}
+
+			got, err := os.ReadFile(filepath.Join(dir, "aad_auth.prom"))
+			if tc.wantNoFile {
+				require.ErrorIs(t, err, os.ErrNotExist, "Flush should not have written metrics")
+				return
+			}
+			require.NoError(t, err, "Flush should have written metrics")
+
+			fi, err := os.Stat(filepath.Join(dir, "aad_auth.prom"))
+			require.NoError(t, err, "Setup: could not stat metrics")
+			if (!tc.locked || tc.releaseLockAfter > 0) && !tc.noSample {
+				require.Equal(t, os.FileMode(0644), fi.Mode().Perm(), "Metrics should be readable by the node exporter")
+			}
+
+			want := testutils.LoadWithUpdateFromGolden(t, string(got))
+			require.Equal(t, want, string(got), "Flush should have written the expected metrics")
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err, "Setup: could not read metrics directory")
+			for _, e := range entries {
+				require.Contains(t, []string{"aad_auth.prom", ".aad_auth.prom.lock"}, e.Name(), "Flush should not leave temporary files")
+			}
+		})
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.New("")
+	require.Nil(t, m, "Metrics should be disabled without a directory")
+
+	// Recording and flushing disabled metrics is a no-op.
+	m.AddLogin(metrics.ModeOnline, metrics.ResultSuccess)
+	m.AddDenial("invalid_credentials")
+	m.ObserveAADRequest(time.Second)
+	m.SetCache(1, nil)
+	m.AddPurgedUsers(1)
+	m.Flush(context.Background())
+}
+
+func TestMain(m *testing.M) {
+	testutils.InstallUpdateFlag()
+	flag.Parse()
+	m.Run()
+}
@@ -106,10 +106,13 @@ func TestNextEntry(t *testing.T) {
 		numNextIteration int
 		hasNoGroup       bool
 		noIterationInit  bool
+		enumeration      string
 
 		wantEndErrType error
 	}{
 		"get all groups":                    {numNextIteration: 3, wantEndErrType: nss.ErrNotFoundENoEnt},
+		"get only enumerated groups":        {enumeration: "myuser@domain.com", numNextIteration: 1, wantEndErrType: nss.ErrNotFoundENoEnt},
+		"enumeration disabled":              {enumeration: cache.EnumerateNone, numNextIteration: 0, wantEndErrType: nss.ErrNotFoundENoEnt},
 		"no group in db does not fail":      {hasNoGroup: true, numNextIteration: 0, wantEndErrType: nss.ErrNotFoundENoEnt},
 		"partial iteration then ends works": {numNextIteration: 1, wantEndErrType: nil},
 
@@ -126,6 +129,9 @@ func TestNextEntry(t *testing.T) {
 
 			uid, gid := testutils.GetCurrentUIDGID(t)
 			opts := []cache.Option{cache.WithCacheDir(cacheDir), cache.WithRootUID(uid), cache.WithRootGID(gid), cache.WithShadowGID(gid)}
+			if tc.enumeration != "" {
+				opts = append(opts, cache.WithEnumeration(tc.enumeration))
+			}
 
 			if !tc.noIterationInit {
 				err := group.StartEntryIteration(context.Background(), opts...)
@@ -10,6 +10,7 @@ import (
 	"github.com/ubuntu/aad-auth/internal/i18n"
 	"github.com/ubuntu/aad-auth/internal/logger"
 	"github.com/ubuntu/aad-auth/internal/nss"
+	"github.com/ubuntu/aad-auth/internal/user"
 	"github.com/ubuntu/decorate"
 )
 
@@ -36,7 +37,16 @@ func NewByName(ctx context.Context, name string, cacheOpts ...cache.Option) (p P
 	}
 	defer c.Close(ctx)
 
-	u, err := c.GetUserByName(ctx, name)
+	// Users are stored in the cache under their normalized POSIX name, which can differ from the one computed
+	// here with the default normalisation. Fallback then on their UPN.
+	var u cache.UserRecord
+	err = cache.ErrNoEnt
+	if posixName, errName := user.PosixName(name); errName == nil {
+		u, err = c.GetUserByName(ctx, posixName)
+	}
+	if errors.Is(err, cache.ErrNoEnt) {
+		u, err = c.GetUserByUPN(ctx, user.NormalizeName(name))
+	}
 	if err != nil {
 		return Passwd{}, nss.ConvertErr(err)
 	}
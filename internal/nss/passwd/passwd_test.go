@@ -18,11 +18,15 @@ func TestNewByName(t *testing.T) {
 
 	tests := map[string]struct {
 		name         string
+		initialCache string
 		failingCache bool
 
 		wantErrType error
 	}{
-		"get existing user by name": {name: "myuser@domain.com"},
+		"get existing user by name":       {name: "myuser@domain.com"},
+		"get existing guest user by name": {name: "success_guest.com", initialCache: "users_with_upn"},
+		"get existing guest user by UPN":  {name: "Success_Guest.com#EXT#@otherdomain.com", initialCache: "users_with_upn"},
+		"get existing user by UPN only":   {name: "Foo Bar@Domain.com", initialCache: "users_with_upn"},
 
 		// error cases
 		"error on non existing user":   {name: "notexists@domain.com", wantErrType: nss.ErrNotFoundENoEnt},
@@ -33,8 +37,12 @@ func TestNewByName(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
+			if tc.initialCache == "" {
+				tc.initialCache = "users_in_db"
+			}
+
 			cacheDir := t.TempDir()
-			testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+			testutils.PrepareDBsForTests(t, cacheDir, tc.initialCache)
 
 			uid, gid := testutils.GetCurrentUIDGID(t)
 			opts := []cache.Option{cache.WithCacheDir(cacheDir), cache.WithRootUID(uid), cache.WithRootGID(gid), cache.WithShadowGID(gid)}
@@ -105,10 +113,13 @@ func TestNextEntry(t *testing.T) {
 		numNextIteration int
 		hasNoUser        bool
 		noIterationInit  bool
+		enumeration      string
 
 		wantEndErrType error
 	}{
 		"get all users":                     {numNextIteration: 3, wantEndErrType: nss.ErrNotFoundENoEnt},
+		"get only enumerated users":         {enumeration: "myuser@domain.com", numNextIteration: 1, wantEndErrType: nss.ErrNotFoundENoEnt},
+		"enumeration disabled":              {enumeration: cache.EnumerateNone, numNextIteration: 0, wantEndErrType: nss.ErrNotFoundENoEnt},
 		"no user in db does not fail":       {hasNoUser: true, numNextIteration: 0, wantEndErrType: nss.ErrNotFoundENoEnt},
 		"partial iteration then ends works": {numNextIteration: 1, wantEndErrType: nil},
 
@@ -125,6 +136,9 @@ func TestNextEntry(t *testing.T) {
 
 			uid, gid := testutils.GetCurrentUIDGID(t)
 			opts := []cache.Option{cache.WithCacheDir(cacheDir), cache.WithRootUID(uid), cache.WithRootGID(gid), cache.WithShadowGID(gid)}
+			if tc.enumeration != "" {
+				opts = append(opts, cache.WithEnumeration(tc.enumeration))
+			}
 
 			if !tc.noIterationInit {
 				err := passwd.StartEntryIteration(context.Background(), opts...)
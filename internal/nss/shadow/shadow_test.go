@@ -60,10 +60,13 @@ func TestNextEntry(t *testing.T) {
 		numNextIteration int
 		hasNoUser        bool
 		noIterationInit  bool
+		enumeration      string
 
 		wantEndErrType error
 	}{
 		"get all users":                     {numNextIteration: 3, wantEndErrType: nss.ErrNotFoundENoEnt},
+		"get only enumerated users":         {enumeration: "myuser@domain.com", numNextIteration: 1, wantEndErrType: nss.ErrNotFoundENoEnt},
+		"enumeration disabled":              {enumeration: cache.EnumerateNone, numNextIteration: 0, wantEndErrType: nss.ErrNotFoundENoEnt},
 		"no user in db does not fail":       {hasNoUser: true, numNextIteration: 0, wantEndErrType: nss.ErrNotFoundENoEnt},
 		"partial iteration then ends works": {numNextIteration: 1, wantEndErrType: nil},
 
@@ -80,6 +83,9 @@ func TestNextEntry(t *testing.T) {
 
 			uid, gid := testutils.GetCurrentUIDGID(t)
 			opts := []cache.Option{cache.WithCacheDir(cacheDir), cache.WithRootUID(uid), cache.WithRootGID(gid), cache.WithShadowGID(gid)}
+			if tc.enumeration != "" {
+				opts = append(opts, cache.WithEnumeration(tc.enumeration))
+			}
 
 			if !tc.noIterationInit {
 				err := shadow.StartEntryIteration(context.Background(), opts...)
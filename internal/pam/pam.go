@@ -5,13 +5,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
+	"time"
 
 	"github.com/ubuntu/aad-auth/internal/aad"
 	"github.com/ubuntu/aad-auth/internal/cache"
 	"github.com/ubuntu/aad-auth/internal/config"
+	"github.com/ubuntu/aad-auth/internal/consts"
+	"github.com/ubuntu/aad-auth/internal/daemon"
 	"github.com/ubuntu/aad-auth/internal/i18n"
 	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/aad-auth/internal/metrics"
 	"github.com/ubuntu/aad-auth/internal/user"
 )
 
@@ -20,18 +25,44 @@ var (
 	ErrPamSystem = errors.New("PAM SYSTEM ERROR")
 	// ErrPamAuth represents a PAM auth error.
 	ErrPamAuth = errors.New("PAM AUTH ERROR")
+	// ErrInvalidCredentials is wrapped in ErrPamAuth when the password was rejected, rather than the user or their login.
+	ErrInvalidCredentials = errors.New("invalid credentials")
 	// ErrPamIgnore represents a PAM ignore return code.
 	ErrPamIgnore = errors.New("PAM IGNORE")
+	// ErrPamPermDenied represents a PAM permission denied return code.
+	ErrPamPermDenied = errors.New("PAM PERM DENIED")
+	// ErrPamSession represents a PAM session error return code.
+	ErrPamSession = errors.New("PAM SESSION ERR")
+	// ErrPamUserUnknown represents a PAM user unknown return code.
+	ErrPamUserUnknown = errors.New("PAM USER UNKNOWN")
 )
 
 // Authenticator is a interface that wraps the Authenticate method.
 type Authenticator interface {
-	Authenticate(ctx context.Context, cfg config.AAD, username, password string) error
+	Authenticate(ctx context.Context, cfg config.AAD, username, password string) (aad.UserInfo, error)
+}
+
+// cacher is the cache users are authenticated against: the aad-authd daemon if it is running,
+// or the cache databases otherwise.
+type cacher interface {
+	CanAuthenticate(ctx context.Context, username, password string) error
+	OfflineCredentialsExpiry(ctx context.Context, username string) (time.Time, error)
+	Revoke(ctx context.Context, username, upn, reason string) error
+	Update(ctx context.Context, username, password, homeDirPattern, shell string, opts ...cache.UpdateOption) error
+	RecordLogin(ctx context.Context, username, remoteHost string) error
+	Close(ctx context.Context) error
 }
 
 type option struct {
-	auth      Authenticator
-	cacheOpts []cache.Option
+	auth       Authenticator
+	cacheOpts  []cache.Option
+	cache      *cache.Cache
+	socketPath string
+	login      config.Login
+	config     *config.Config
+	metricsDir *string
+	steps      func(step, outcome string)
+	dryRun     bool
 }
 
 // Option allows to change Authenticate for mocking in tests.
@@ -51,70 +82,575 @@ func WithCacheOptions(cacheOpts []cache.Option) Option {
 	}
 }
 
+// WithSocketPath overrides the path to the socket of the aad-authd daemon.
+func WithSocketPath(p string) Option {
+	return func(o *option) {
+		o.socketPath = p
+	}
+}
+
+// WithLogin sets the PAM service and the remote host the user is logging in through, to apply the matching
+// configuration policies.
+func WithLogin(service, remoteHost string) Option {
+	return func(o *option) {
+		o.login = config.Login{Service: service, RemoteHost: remoteHost}
+	}
+}
+
+// WithConfig uses cfg, parsed with the login set by WithLogin, rather than parsing the configuration file again.
+func WithConfig(cfg *config.Config) Option {
+	return func(o *option) {
+		o.config = cfg
+	}
+}
+
+// WithMetricsDir overrides the directory the metrics are written to, set in the configuration.
+func WithMetricsDir(p string) Option {
+	return func(o *option) {
+		o.metricsDir = &p
+	}
+}
+
+// WithCache uses c rather than connecting to aad-authd or opening the cache databases. c is closed when done.
+func WithCache(c *cache.Cache) Option {
+	return func(o *option) {
+		o.cache = c
+	}
+}
+
+// WithSteps reports each step of the authentication decision path to report, with its outcome, to troubleshoot it.
+// The messages for the user are reported as steps too, rather than displayed through PAM.
+func WithSteps(report func(step, outcome string)) Option {
+	return func(o *option) {
+		o.steps = report
+	}
+}
+
+// WithDryRun authenticates without modifying the cache: it is only opened read-only for offline authentication,
+// credentials are neither stored nor revoked, and expired users are not purged.
+func WithDryRun() Option {
+	return func(o *option) {
+		o.dryRun = true
+	}
+}
+
+// Denial reasons, as reported in the metrics.
+const (
+	reasonConfig             = "configuration"
+	reasonInvalidName        = "invalid_name"
+	reasonLoginPolicy        = "login_policy"
+	reasonGuestUser          = "guest_user"
+	reasonInvalidCredentials = "invalid_credentials"
+	reasonNoSuchUser         = "no_such_user"
+	reasonPasswordExpired    = "password_expired"
+	reasonAccountLocked      = "account_locked"
+	reasonAccountDisabled    = "account_disabled"
+	reasonNotAssignedToApp   = "not_assigned_to_app"
+	reasonConditionalAccess  = "conditional_access"
+	reasonInvalidClaims      = "invalid_claims"
+	reasonLocalConflict      = "local_conflict"
+	reasonOfflineExpired     = "offline_credentials_expired"
+	reasonOfflineDisabled    = "offline_auth_disabled"
+	reasonRevoked            = "credentials_revoked"
+	reasonNotCached          = "user_not_cached"
+	reasonAADError           = "aad_error"
+	reasonCacheError         = "cache_error"
+)
+
+// attempt is the outcome of an authentication, reported in the metrics.
+type attempt struct {
+	offline bool
+	// reason is why the authentication was denied.
+	reason string
+	// aadDuration is how long Azure AD took to answer, zero if it was not requested.
+	aadDuration time.Duration
+	// notHandled is true if the user is left to the other modules, and the attempt is not reported.
+	notHandled bool
+	// invalidCredentials is true if the password was rejected, online or offline.
+	invalidCredentials bool
+}
+
 // Authenticate tries to authenticate user with the given Authenticater.
-// It’s passing specific configuration, per domain, so that that Authenticater can use them.
+// It’s passing specific configuration, per domain and per login, so that that Authenticater can use them.
+// All the messages logged for this attempt, down to the cache and Azure AD, share a new correlation ID.
 func Authenticate(ctx context.Context, username, password, conf string, opts ...Option) error {
-	username = user.NormalizeName(username)
+	o := option{
+		auth:       aad.AAD{},
+		socketPath: consts.DefaultSocketPath,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
 
-	// Load configuration.
+	ctx = logger.CtxWithFields(logger.CtxWithCorrelationID(ctx), "user", username)
+	if o.login.Service != "" {
+		ctx = logger.CtxWithFields(ctx, "service", o.login.Service)
+	}
+	if o.login.Remote() {
+		ctx = logger.CtxWithFields(ctx, "remote_host", o.login.RemoteHost)
+	}
+
+	cfg, err := o.config, error(nil)
+	if cfg == nil {
+		cfg, err = config.Parse(ctx, conf, config.WithLogin(o.login))
+	}
+	if err != nil {
+		logger.Err(ctx, i18n.G("No valid configuration found: %v"), err)
+		o.report("Configuration", "invalid: %v", err)
+	}
+	m := metrics.New(metricsDir(cfg, o))
+	defer m.Flush(ctx)
+
+	var a attempt
+	if err != nil {
+		a.reason, err = reasonConfig, ErrPamSystem
+	} else {
+		err = authenticate(ctx, username, password, cfg, o, &a)
+	}
+	if a.notHandled {
+		return err
+	}
+
+	mode := metrics.ModeOnline
+	if a.offline {
+		mode = metrics.ModeOffline
+	}
+	if a.aadDuration != 0 {
+		m.ObserveAADRequest(a.aadDuration)
+	}
+	if err != nil {
+		if a.invalidCredentials {
+			err = fmt.Errorf("%w: %w", err, ErrInvalidCredentials)
+		}
+		m.AddLogin(mode, metrics.ResultFailure)
+		m.AddDenial(a.reason)
+		logger.Info(logger.CtxWithMessageID(ctx, consts.MessageIDAuthFailed), "Authentication of %q failed: %v", username, err)
+		return err
+	}
+	m.AddLogin(mode, metrics.ResultSuccess)
+	logger.Info(logger.CtxWithMessageID(ctx, consts.MessageIDAuthSucceeded), "Authentication of %q succeeded", username)
+	return nil
+}
+
+// authenticate is Authenticate with its options and the parsed configuration applied. It reports the outcome of the
+// authentication in a.
+func authenticate(ctx context.Context, username, password string, conf *config.Config, o option, a *attempt) error {
+	n := conf.NameNormalization
+	// username is authenticated against Azure AD while posixName is the name stored in the cache.
+	username = user.NormalizeName(username, n.UserOptions()...)
+	o.report("User", "%s", username)
 	_, domain, _ := strings.Cut(username, "@")
-	cfg, err := config.Load(ctx, conf, domain)
+	if err := checkDomain(ctx, conf.Domains, username, domain); err != nil {
+		o.report("Domain", "%q is not configured and strict_domains is %s, the user is left to the other PAM modules", domain, conf.Domains.Strict)
+		a.notHandled = errors.Is(err, ErrPamIgnore) || errors.Is(err, ErrPamUserUnknown)
+		a.reason = reasonConfig
+		return err
+	}
+	posixName, err := user.PosixName(username, n.UserOptions()...)
+	if err != nil {
+		logError(ctx, i18n.G("%w. Denying access."), err)
+		o.report("User name", "invalid: %v", err)
+		a.reason = reasonInvalidName
+		return ErrPamAuth
+	}
+	if posixName != username {
+		o.report("POSIX name", "%s", posixName)
+	}
+
+	// Load configuration.
+	cfg, err := conf.Domain(ctx, domain)
 	if err != nil {
 		logger.Err(ctx, i18n.G("No valid configuration found: %v"), err)
+		o.report("Configuration", "invalid: %v", err)
+		a.reason = reasonConfig
 		return ErrPamSystem
 	}
-
-	// Apply options and config
-	o := option{
-		auth: aad.AAD{},
+	o.report("Configuration", "loaded for domain %q (tenant_id %s, app_id %s)", domain, cfg.TenantID, cfg.AppID)
+	if o.login.Service != "" || o.login.Remote() {
+		o.report("Login", "service %q, remote host %q", o.login.Service, o.login.RemoteHost)
 	}
+	if cfg.Denied() {
+		logger.Warn(ctx, i18n.G("Azure AD access is denied for %s. Denying access to %q."), loginDescription(o.login, domain), username)
+		o.report("Access", "denied by the configuration for this domain and login")
+		a.reason = reasonLoginPolicy
+		return ErrPamPermDenied
+	}
+	if _, guest := user.GuestName(username); guest && !cfg.AllowsGuestUsers() {
+		logger.Warn(ctx, i18n.G("Guest users are not allowed for domain %q. Denying access to %q."), domain, username)
+		o.report("Guest user", "denied, guest users are not allowed for domain %q", domain)
+		a.reason = reasonGuestUser
+		return ErrPamAuth
+	}
+
+	// Apply config, before the cache options passed to Authenticate so that they can override it.
+	var cacheOpts []cache.Option
+	var daemonOpts []daemon.ClientOption
 	if cfg.OfflineCredentialsExpiration != nil {
-		o.cacheOpts = append(o.cacheOpts, cache.WithOfflineCredentialsExpiration(*cfg.OfflineCredentialsExpiration))
+		cacheOpts = append(cacheOpts, cache.WithOfflineCredentialsExpiration(*cfg.OfflineCredentialsExpiration))
+		daemonOpts = append(daemonOpts, daemon.WithOfflineCredentialsExpiration(*cfg.OfflineCredentialsExpiration))
 	}
-	for _, opt := range opts {
-		opt(&o)
+	if conf.InlineCacheCleanup && !o.dryRun {
+		cacheOpts = append(cacheOpts, cache.WithCleanUpOnOpen(true))
+		daemonOpts = append(daemonOpts, daemon.WithCleanUpOnOpen(true))
 	}
+	cacheOpts = append(cacheOpts, cache.WithLocalConflicts(conf.LocalConflicts), cache.WithEnumeration(conf.Enumeration))
+	daemonOpts = append(daemonOpts, daemon.WithLocalConflicts(conf.LocalConflicts))
+	o.cacheOpts = append(cacheOpts, o.cacheOpts...)
 
 	// Authentication. Note that the errors are AAD errors for now, but we can decorelate them in the future.
-	errAAD := o.auth.Authenticate(ctx, cfg, username, password)
+	start := time.Now()
+	userInfo, errAAD := o.auth.Authenticate(ctx, cfg, username, password)
+	a.aadDuration = time.Since(start)
+	o.report("Online authentication", "%s", onlineOutcome(errAAD))
 	if errors.Is(errAAD, aad.ErrDeny) {
-		return ErrPamAuth
+		if reason, ok := aad.DefinitiveDenial(errAAD); ok {
+			revokeOfflineCredentials(ctx, o, posixName, username, reason, daemonOpts...)
+		}
+		a.reason = denialReason(errAAD)
+		a.invalidCredentials = errors.Is(errAAD, aad.ErrInvalidCredentials)
+		return denialError(ctx, o, errAAD)
 	} else if errAAD != nil && !errors.Is(errAAD, aad.ErrNoNetwork) {
 		logger.Warn(ctx, i18n.G("Unhandled error of type: %v. Denying access."), errAAD)
+		a.reason = reasonAADError
 		return ErrPamAuth
 	}
+	a.offline = errors.Is(errAAD, aad.ErrNoNetwork)
+	if !a.offline && o.dryRun {
+		o.report("Cache update", "skipped in dry run")
+		return nil
+	}
 
-	c, err := cache.New(ctx, o.cacheOpts...)
+	c, err := openCache(ctx, o, daemonOpts...)
 	if err != nil {
 		logError(ctx, i18n.G("%w. Denying access."), err)
+		o.report("Cache", "can't be opened: %v", err)
+		a.reason = reasonCacheError
 		return ErrPamSystem
 	}
 	defer c.Close(ctx)
 
 	// No network: try validate user from cache.
-	if errors.Is(errAAD, aad.ErrNoNetwork) {
-		if err := c.CanAuthenticate(ctx, username, password); err != nil {
+	if a.offline {
+		if err := c.CanAuthenticate(ctx, posixName, password); err != nil {
 			if errors.Is(err, cache.ErrOfflineCredentialsExpired) {
-				Info(ctx, i18n.G("Machine is offline and cached credentials expired. Please try again when the machine is online."))
+				o.info(ctx, i18n.G("Machine is offline and cached credentials expired. Please try again when the machine is online."))
 			}
 			if errors.Is(err, cache.ErrOfflineAuthDisabled) {
-				Info(ctx, i18n.G("Machine is offline and offline authentication is disabled. Please try again when the machine is online."))
+				o.info(ctx, i18n.G("Machine is offline and offline authentication is disabled. Please try again when the machine is online."))
+			}
+			if errors.Is(err, cache.ErrCredentialsRevoked) {
+				o.info(ctx, i18n.G("Cached credentials were revoked. Please try again when the machine is online."))
 			}
 			logError(ctx, i18n.G("%w. Denying access."), err)
+			o.report("Offline authentication", "denied: %v", err)
+			a.reason = denialReason(err)
+			a.invalidCredentials = errors.Is(err, cache.ErrInvalidPassword)
 			return ErrPamAuth
 		}
+		o.report("Offline authentication", "success")
+		warnOfflineExpiry(ctx, o, c, posixName, cfg.OfflineExpirationWarning)
 		return nil
 	}
 
-	// Successful online login, update cache.
-	if err := c.Update(ctx, username, password, cfg.HomeDirPattern, cfg.Shell); err != nil {
+	// Successful online login, update cache with the canonical UPN of the token when we got one.
+	upn := username
+	if userInfo.UPN != "" {
+		upn = userInfo.UPN
+	}
+	groups := groupNames(ctx, userInfo.Groups, domain, n)
+	if groups != nil {
+		o.report("Groups", "%s", strings.Join(groups, ", "))
+	}
+	if err := c.Update(ctx, posixName, password, cfg.HomeDirPattern, cfg.Shell, cache.WithObjectID(userInfo.ObjectID), cache.WithUPN(upn),
+		cache.WithGECOS(userInfo.GECOS(cfg.GECOSClaimNames())), cache.WithGroups(groups)); errors.Is(err, cache.ErrLocalConflict) {
+		o.info(ctx, i18n.G("Your account conflicts with a local account of this machine. Please contact your administrator."))
+		logError(ctx, i18n.G("%w. Denying access."), err)
+		o.report("Cache update", "failed: %v", err)
+		a.reason = reasonLocalConflict
+		return ErrPamAuth
+	} else if err != nil {
 		logError(ctx, i18n.G("%w. Denying access."), err)
+		o.report("Cache update", "failed: %v", err)
+		a.reason = reasonCacheError
 		return ErrPamAuth
 	}
+	o.report("Cache update", "success")
 
 	return nil
 }
 
+// groupNames returns the names in the cache of the Azure AD groups of the groups claim: they are normalized with
+// domain, as user names are. Groups which can't be named are skipped. It returns nil if there was no groups claim.
+func groupNames(ctx context.Context, groups []string, domain string, n config.NameNormalization) []string {
+	if groups == nil {
+		return nil
+	}
+	names := []string{}
+	for _, g := range groups {
+		name, err := user.PosixName(g+"@"+domain, n.UserOptions()...)
+		if err != nil {
+			logger.Warn(ctx, "Ignoring Azure AD group %q: %v", g, err)
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// CheckDomain returns ErrPamIgnore or ErrPamUserUnknown if the domain of username is not handled in strict domain
+// mode by cfg, so that the user is left to the other modules without being prompted for a password.
+func CheckDomain(ctx context.Context, username string, cfg *config.Config) error {
+	username = user.NormalizeName(username, cfg.NameNormalization.UserOptions()...)
+	_, domain, _ := strings.Cut(username, "@")
+	return checkDomain(ctx, cfg.Domains, username, domain)
+}
+
+// checkDomain returns ErrPamIgnore or ErrPamUserUnknown, depending on the strict domain mode of p, if the users of
+// domain are not authenticated.
+func checkDomain(ctx context.Context, p config.DomainPolicy, username, domain string) error {
+	if p.Accepts(domain) {
+		return nil
+	}
+	logger.Debug(ctx, "Domain %q is not configured, leaving %q to the other modules", domain, username)
+	if p.Strict == config.StrictDomainsUserUnknown {
+		return ErrPamUserUnknown
+	}
+	return ErrPamIgnore
+}
+
+// OpenSession records that username opened a session, in the login history of the cache.
+// Users which are not in the cache, like local users, are ignored.
+func OpenSession(ctx context.Context, username, conf string, opts ...Option) error {
+	o := option{
+		socketPath: consts.DefaultSocketPath,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cfg, err := config.Parse(ctx, conf)
+	if err != nil {
+		logger.Warn(ctx, "Not recording login of %q: %v", username, err)
+		return ErrPamIgnore
+	}
+	n := cfg.NameNormalization
+	posixName, err := user.PosixName(user.NormalizeName(username, n.UserOptions()...), n.UserOptions()...)
+	if err != nil {
+		logger.Debug(ctx, "Not recording login of %q: %v", username, err)
+		return ErrPamIgnore
+	}
+
+	c, err := openCache(ctx, o)
+	if err != nil {
+		logError(ctx, i18n.G("%w. Can't record login."), err)
+		return ErrPamSession
+	}
+	defer c.Close(ctx)
+
+	if err := c.RecordLogin(ctx, posixName, o.login.RemoteHost); errors.Is(err, cache.ErrNoEnt) {
+		logger.Debug(ctx, "%q is not an Azure AD user in the cache, not recording its login", posixName)
+		return ErrPamIgnore
+	} else if err != nil {
+		logError(ctx, i18n.G("%w. Can't record login."), err)
+		return ErrPamSession
+	}
+
+	return nil
+}
+
+// loginDescription describes the login and domain the configuration was loaded for, for logging.
+func loginDescription(l config.Login, domain string) string {
+	d := fmt.Sprintf("domain %q", domain)
+	if l.Service != "" {
+		d += fmt.Sprintf(", service %q", l.Service)
+	}
+	if l.Remote() {
+		d += fmt.Sprintf(", remote host %q", l.RemoteHost)
+	}
+	return d
+}
+
+// onlineOutcome describes the outcome of the online authentication, which failed with err if not nil.
+func onlineOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, aad.ErrNoNetwork):
+		return "Azure AD unreachable, falling back to offline authentication"
+	case errors.Is(err, aad.ErrPasswordExpired):
+		return "denied by Azure AD, the password expired"
+	case errors.As(err, new(*aad.AccountError)):
+		return "denied by Azure AD, account state: " + strings.ToLower(err.Error())
+	case errors.Is(err, aad.ErrNoSuchUser):
+		return "denied by Azure AD, the user doesn't exist"
+	case errors.Is(err, aad.ErrInvalidClaims):
+		return fmt.Sprintf("denied, the ID token doesn't match the tenant or the user: %v", err)
+	case errors.Is(err, aad.ErrDeny):
+		return "denied by Azure AD"
+	}
+	return fmt.Sprintf("unhandled error, denying access: %v", err)
+}
+
+// denialError tells the user why AAD denied the authentication when it is due to the state of their account,
+// and returns the matching PAM error. Expired passwords can only be changed online, so they are authentication
+// errors: PAM_NEW_AUTHTOK_REQD is only valid from the account management.
+func denialError(ctx context.Context, o option, err error) error {
+	switch {
+	case errors.Is(err, aad.ErrPasswordExpired):
+		o.info(ctx, i18n.G("Your password has expired. Please change it online before logging in."))
+		return ErrPamAuth
+	case errors.Is(err, aad.ErrAccountLocked):
+		o.info(ctx, i18n.G("Your account is locked after too many failed sign-in attempts. Please try again later or contact your administrator."))
+		return ErrPamPermDenied
+	case errors.Is(err, aad.ErrAccountDisabled):
+		o.info(ctx, i18n.G("Your account is disabled. Please contact your administrator."))
+		return ErrPamPermDenied
+	case errors.Is(err, aad.ErrNotAssignedToApp):
+		o.info(ctx, i18n.G("Your account is not allowed to log in on this machine. Please contact your administrator."))
+		return ErrPamPermDenied
+	case errors.Is(err, aad.ErrConditionalAccess):
+		o.info(ctx, i18n.G("Sign-in is blocked by a Conditional Access policy. Please contact your administrator."))
+		return ErrPamPermDenied
+	}
+	return ErrPamAuth
+}
+
+// denialReason returns the reason reported in the metrics for a denial by Azure AD or the cache.
+func denialReason(err error) string {
+	switch {
+	case errors.Is(err, aad.ErrNoSuchUser):
+		return reasonNoSuchUser
+	case errors.Is(err, aad.ErrPasswordExpired):
+		return reasonPasswordExpired
+	case errors.Is(err, aad.ErrAccountLocked):
+		return reasonAccountLocked
+	case errors.Is(err, aad.ErrAccountDisabled):
+		return reasonAccountDisabled
+	case errors.Is(err, aad.ErrNotAssignedToApp):
+		return reasonNotAssignedToApp
+	case errors.Is(err, aad.ErrConditionalAccess):
+		return reasonConditionalAccess
+	case errors.Is(err, aad.ErrInvalidClaims):
+		return reasonInvalidClaims
+	case errors.Is(err, cache.ErrOfflineCredentialsExpired):
+		return reasonOfflineExpired
+	case errors.Is(err, cache.ErrOfflineAuthDisabled):
+		return reasonOfflineDisabled
+	case errors.Is(err, cache.ErrCredentialsRevoked):
+		return reasonRevoked
+	case errors.Is(err, cache.ErrNoEnt):
+		return reasonNotCached
+	}
+	return reasonInvalidCredentials
+}
+
+// revokeOfflineCredentials locks the cached password of username, bound to upn, so that they can't authenticate
+// offline anymore. Failures are only logged, as access is denied anyway.
+func revokeOfflineCredentials(ctx context.Context, o option, username, upn, reason string, daemonOpts ...daemon.ClientOption) {
+	if o.dryRun {
+		o.report("Cache update", "skipped in dry run, offline credentials would be revoked")
+		return
+	}
+
+	c, err := openCache(ctx, o, daemonOpts...)
+	if err != nil {
+		logger.Warn(ctx, "Can't revoke offline credentials of %q: %v", username, err)
+		o.report("Cache", "can't be opened: %v", err)
+		return
+	}
+	defer c.Close(ctx)
+
+	if err := c.Revoke(ctx, username, upn, reason); errors.Is(err, cache.ErrNoEnt) {
+		logger.Debug(ctx, "No offline credentials to revoke for %q", username)
+		o.report("Cache update", "no offline credentials to revoke")
+	} else if err != nil {
+		logger.Warn(ctx, "%v", err)
+		o.report("Cache update", "failed to revoke offline credentials: %v", err)
+	} else {
+		o.report("Cache update", "offline credentials revoked, %s", reason)
+	}
+}
+
+// warnOfflineExpiry tells the user how many days they have left to authenticate online, if their offline credentials
+// expire within warningDays.
+func warnOfflineExpiry(ctx context.Context, o option, c cacher, username string, warningDays int) {
+	if warningDays <= 0 && o.steps == nil {
+		return
+	}
+	expiry, err := c.OfflineCredentialsExpiry(ctx, username)
+	if err != nil {
+		logger.Warn(ctx, "Can't check offline credentials expiry: %v", err)
+		o.report("Offline credentials", "can't check expiry: %v", err)
+		return
+	}
+	if expiry.IsZero() {
+		o.report("Offline credentials", "never expire")
+		return
+	}
+
+	days := int(math.Ceil(time.Until(expiry).Hours() / 24))
+	if warningDays <= 0 || days > warningDays {
+		o.report("Offline credentials", "expire in %d days", days)
+		return
+	}
+	o.report("Offline credentials", "expire in %d days, the user is warned at login", days)
+	o.info(ctx, i18n.NG("Offline credentials expire in %d day. Please log in while the machine is online to renew them.",
+		"Offline credentials expire in %d days. Please log in while the machine is online to renew them.", uint32(days)), days)
+}
+
+// openCache connects to the aad-authd daemon, and falls back to opening the cache databases if it is not running.
+// The cache passed with WithCache is used instead if any. In dry run, the databases are opened read-only.
+func openCache(ctx context.Context, o option, daemonOpts ...daemon.ClientOption) (cacher, error) {
+	if o.cache != nil {
+		return o.cache, nil
+	}
+
+	c, err := daemon.Dial(ctx, o.socketPath, daemonOpts...)
+	if err == nil {
+		return c, nil
+	}
+	logger.Debug(ctx, "Accessing the cache directly: %v", err)
+
+	if o.dryRun {
+		return cache.New(ctx, append(o.cacheOpts, cache.WithReadOnly())...)
+	}
+	return cache.New(ctx, o.cacheOpts...)
+}
+
+// metricsDir returns the directory the metrics are written to, as set in cfg if the configuration could be parsed.
+// It is empty if they are disabled.
+func metricsDir(cfg *config.Config, o option) string {
+	if o.metricsDir != nil {
+		return *o.metricsDir
+	}
+	if cfg == nil {
+		return ""
+	}
+	return cfg.MetricsDir
+}
+
+// PosixName returns the name username is known as in the cache, normalized with the configuration cfg.
+func PosixName(username string, cfg *config.Config) (string, error) {
+	return user.PosixName(username, cfg.NameNormalization.UserOptions()...)
+}
+
+// report reports the outcome of a step of the authentication, if steps are reported.
+func (o option) report(step, format string, a ...any) {
+	if o.steps == nil {
+		return
+	}
+	o.steps(step, fmt.Sprintf(format, a...))
+}
+
+// info displays a message to the user through PAM, or reports it as a step if steps are reported.
+func (o option) info(ctx context.Context, format string, a ...any) {
+	if o.steps != nil {
+		o.report("Message", format, a...)
+		return
+	}
+	Info(ctx, format, a...)
+}
+
 func logError(ctx context.Context, format string, err error) {
 	err = fmt.Errorf(format, err)
 	logger.Err(ctx, err.Error())
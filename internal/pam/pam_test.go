@@ -2,12 +2,20 @@ package pam_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
+	pamCom "github.com/msteinert/pam"
 	"github.com/stretchr/testify/require"
 	"github.com/ubuntu/aad-auth/internal/aad"
 	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/config"
+	"github.com/ubuntu/aad-auth/internal/consts"
+	"github.com/ubuntu/aad-auth/internal/logger"
 	"github.com/ubuntu/aad-auth/internal/pam"
 	"github.com/ubuntu/aad-auth/internal/testutils"
 )
@@ -23,32 +31,101 @@ func TestAuthenticate(t *testing.T) {
 		conf                string
 		initialCache        string
 		wrongCacheOwnership bool
+		throughDaemon       bool
+		userCached          bool
+		service             string
+		remoteHost          string
 
-		wantErrType error
+		wantRevoked            bool
+		wantInvalidCredentials bool
+
+		wantInfo       []string
+		wantPurgedUser *bool
+		wantErrType    error
 	}{
 		"authenticate successfully (online)": {},
 		"specified offline expiration":       {conf: "withoffline-expiration.conf"},
+		"homedir with object ID":             {conf: "homedir-with-object-id.conf"},
 
 		// offline cases
 		"Offline, connect existing user from cache": {conf: "forceoffline.conf", initialCache: "users_in_db", username: "myuser@domain.com"},
 		"offline, connect expired user from cache":  {conf: "forceoffline-no-expiration.conf", initialCache: "db_with_expired_users", username: "expireduser@domain.com"},
 		"offline, connect purged user from cache":   {conf: "forceoffline-no-expiration.conf", initialCache: "db_with_expired_users", username: "purgeduser@domain.com"},
 
+		// offline expiry warnings
+		"offline, warn about credentials expiring soon":              {conf: "forceoffline-expire-soon.conf", initialCache: "users_in_db", username: "myuser@domain.com", wantInfo: []string{"Offline credentials expire in 3 days. Please log in while the machine is online to renew them."}},
+		"offline, warn about credentials expiring tomorrow":          {conf: "forceoffline-expire-tomorrow.conf", initialCache: "users_in_db", username: "myuser@domain.com", wantInfo: []string{"Offline credentials expire in 1 day. Please log in while the machine is online to renew them."}},
+		"offline, no warning if disabled":                            {conf: "forceoffline-expire-soon-no-warning.conf", initialCache: "users_in_db", username: "myuser@domain.com"},
+		"offline, warn about credentials expiring through aad-authd": {conf: "forceoffline-expire-soon.conf", initialCache: "users_in_db", username: "myuser@domain.com", throughDaemon: true, wantInfo: []string{"Offline credentials expire in 3 days. Please log in while the machine is online to renew them."}},
+
 		// special cases
 		"authenticate successfully with unmatched case (online)":                  {username: "Success@Domain.COM"},
+		"authenticate successfully with down-level logon name (online)":           {conf: "name-normalization.conf", username: `DOMAIN\Success`},
+		"offline, connect existing user with unmatched case from cache":           {conf: "forceoffline.conf", initialCache: "users_in_db", username: "MyUser@Domain.com"},
 		"authenticate successfully (online) with offline authentication disabled": {username: "success@domain.com"},
+		"authenticate successfully guest user (online)":                           {username: "Success_Guest.com#EXT#@domain.com"},
+		"authenticate successfully with an alias storing its UPN (online)":        {username: "alias@domain.com"},
+		"authenticate successfully member user with guest users denied (online)":  {conf: "guest-users-denied.conf"},
+		"authenticate successfully on configured domain in strict domain mode":    {conf: "strict-domains.conf"},
+		"authenticate successfully on allowed domain in strict domain mode":       {conf: "strict-domains-user-unknown.conf", username: "success@otherdomain.com"},
+		"authenticate successfully through aad-authd (online)":                    {throughDaemon: true},
+		"offline, connect existing user from cache through aad-authd":             {conf: "forceoffline.conf", initialCache: "users_in_db", username: "myuser@domain.com", throughDaemon: true},
+		"expired users are not purged on login by default":                        {initialCache: "db_with_expired_users", wantPurgedUser: ptr(false)},
+		"expired users are purged on login with inline cache cleanup":             {conf: "inline-cache-cleanup.conf", initialCache: "db_with_expired_users", wantPurgedUser: ptr(true)},
+		"expired users are purged with inline cache cleanup through aad-authd":    {conf: "inline-cache-cleanup.conf", initialCache: "db_with_expired_users", throughDaemon: true, wantPurgedUser: ptr(true)},
+
+		// login policies
+		"authenticate successfully through a service which is not denied":            {conf: "login-policies.conf", service: "sshd"},
+		"offline, connect existing user locally with offline auth disabled remotely": {conf: "forceoffline-login-policies.conf", initialCache: "users_in_db", username: "myuser@domain.com", service: "gdm-password"},
 
 		// error cases
 		"error on invalid conf":                                 {conf: "invalid-aad.conf", wantErrType: pam.ErrPamSystem},
 		"error on unexisting conf":                              {conf: "doesnotexist.conf", wantErrType: pam.ErrPamSystem},
 		"error on unexisting users":                             {username: "no such user", wantErrType: pam.ErrPamAuth},
-		"error on invalid password":                             {username: "invalid credentials", wantErrType: pam.ErrPamAuth},
+		"error on invalid password":                             {username: "invalid credentials", wantErrType: pam.ErrPamAuth, wantInvalidCredentials: true},
 		"error on offline with user online user not in cache":   {conf: "forceoffline.conf", initialCache: "db_with_expired_users", wantErrType: pam.ErrPamAuth},
-		"error on offline with expired user":                    {conf: "forceoffline.conf", initialCache: "db_with_expired_users", username: "expireduser@domain.com", wantErrType: pam.ErrPamAuth},
-		"error on offline with purged user":                     {conf: "forceoffline-expire-right-away.conf", initialCache: "db_with_expired_users", username: "purgeduser@domain.com", wantErrType: pam.ErrPamAuth},
-		"error on offline with offline authentication disabled": {conf: "forceoffline-offline-auth-disabled.conf", initialCache: "users_in_db", username: "myuser@domain.com", wantErrType: pam.ErrPamAuth},
+		"error on offline with expired user":                    {conf: "forceoffline.conf", initialCache: "db_with_expired_users", username: "expireduser@domain.com", wantErrType: pam.ErrPamAuth, wantInfo: []string{"Machine is offline and cached credentials expired. Please try again when the machine is online."}},
+		"error on offline with purged user":                     {conf: "forceoffline-expire-right-away.conf", initialCache: "db_with_expired_users", username: "purgeduser@domain.com", wantErrType: pam.ErrPamAuth, wantInfo: []string{"Machine is offline and cached credentials expired. Please try again when the machine is online."}},
+		"error on offline with offline authentication disabled": {conf: "forceoffline-offline-auth-disabled.conf", initialCache: "users_in_db", username: "myuser@domain.com", wantErrType: pam.ErrPamAuth, wantInfo: []string{"Machine is offline and offline authentication is disabled. Please try again when the machine is online."}},
 		"error on server error":                                 {username: "unreadable server response", wantErrType: pam.ErrPamAuth},
+		"error on invalid characters without replacement":       {conf: "name-normalization.conf", username: "invalid user@domain.com", wantErrType: pam.ErrPamAuth},
+		"error on homedir with object ID not returned":          {conf: "homedir-with-object-id.conf", username: "requireMFA@domain.com", wantErrType: pam.ErrPamAuth},
+		"error on guest users denied":                           {conf: "guest-users-denied.conf", username: "Success_Guest.com#EXT#@domain.com", wantErrType: pam.ErrPamAuth},
+		"error on guest user name bound to another UPN":         {initialCache: "users_with_upn", username: "Success_Guest.com#EXT#@domain.com", wantErrType: pam.ErrPamAuth},
 		"error on cache can't be created/opened":                {wrongCacheOwnership: true, wantErrType: pam.ErrPamSystem},
+		"error on offline with expired user through aad-authd":  {conf: "forceoffline.conf", initialCache: "db_with_expired_users", username: "expireduser@domain.com", throughDaemon: true, wantErrType: pam.ErrPamAuth, wantInfo: []string{"Machine is offline and cached credentials expired. Please try again when the machine is online."}},
+
+		"error on denied service": {conf: "login-policies.conf", service: "cron", wantErrType: pam.ErrPamPermDenied},
+		"error on offline remote login with offline auth disabled remotely": {conf: "forceoffline-login-policies.conf", initialCache: "users_in_db", username: "myuser@domain.com", service: "sshd", remoteHost: "192.0.2.1", wantErrType: pam.ErrPamAuth, wantInfo: []string{"Machine is offline and offline authentication is disabled. Please try again when the machine is online."}},
+
+		// revocation of offline credentials
+		"error on unknown user revokes their offline credentials":                 {username: "no such user", userCached: true, wantErrType: pam.ErrPamAuth, wantRevoked: true},
+		"error on disabled account revokes their offline credentials":             {username: "account disabled", userCached: true, wantErrType: pam.ErrPamPermDenied, wantInfo: []string{"Your account is disabled. Please contact your administrator."}, wantRevoked: true},
+		"error on disabled account revokes offline credentials through aad-authd": {username: "account disabled", userCached: true, throughDaemon: true, wantErrType: pam.ErrPamPermDenied, wantInfo: []string{"Your account is disabled. Please contact your administrator."}, wantRevoked: true},
+		"error on locked account keeps offline credentials":                       {username: "account locked", userCached: true, wantErrType: pam.ErrPamPermDenied, wantInfo: []string{"Your account is locked after too many failed sign-in attempts. Please try again later or contact your administrator."}},
+		"error on invalid password keeps offline credentials":                     {username: "invalid credentials", userCached: true, wantErrType: pam.ErrPamAuth, wantInvalidCredentials: true},
+		"error on offline with revoked user":                                      {conf: "forceoffline.conf", initialCache: "users_with_revoked_user", username: "myuser@domain.com", wantErrType: pam.ErrPamAuth, wantInfo: []string{"Cached credentials were revoked. Please try again when the machine is online."}},
+
+		// account state error cases
+		"error on password expired":              {username: "password expired", wantErrType: pam.ErrPamAuth, wantInfo: []string{"Your password has expired. Please change it online before logging in."}},
+		"error on account locked":                {username: "account locked", wantErrType: pam.ErrPamPermDenied, wantInfo: []string{"Your account is locked after too many failed sign-in attempts. Please try again later or contact your administrator."}},
+		"error on account disabled":              {username: "account disabled", wantErrType: pam.ErrPamPermDenied, wantInfo: []string{"Your account is disabled. Please contact your administrator."}},
+		"error on not assigned to application":   {username: "not assigned to application", wantErrType: pam.ErrPamPermDenied, wantInfo: []string{"Your account is not allowed to log in on this machine. Please contact your administrator."}},
+		"error on blocked by conditional access": {username: "blocked by conditional access", wantErrType: pam.ErrPamPermDenied, wantInfo: []string{"Sign-in is blocked by a Conditional Access policy. Please contact your administrator."}},
+
+		// strict domain mode
+		"ignore users of unconfigured domains in strict domain mode":    {conf: "strict-domains.conf", username: "success@otherdomain.com", wantErrType: pam.ErrPamIgnore},
+		"ignore local users in strict domain mode":                      {conf: "strict-domains.conf", username: "localuser", wantErrType: pam.ErrPamIgnore},
+		"unknown users of unconfigured domains in strict domain mode":   {conf: "strict-domains-user-unknown.conf", username: "success@domain.com", wantErrType: pam.ErrPamUserUnknown},
+		"error on invalid name of allowed domain in strict domain mode": {conf: "strict-domains-user-unknown.conf", username: "invalid user@otherdomain.com", wantErrType: pam.ErrPamAuth},
+
+		// offline invalid credentials
+		"error on offline with invalid password":                   {conf: "forceoffline.conf", initialCache: "users_in_db", username: "myuser@domain.com", password: "wrong password", wantErrType: pam.ErrPamAuth, wantInvalidCredentials: true},
+		"error on offline with invalid password through aad-authd": {conf: "forceoffline.conf", initialCache: "users_in_db", username: "myuser@domain.com", password: "wrong password", throughDaemon: true, wantErrType: pam.ErrPamAuth, wantInvalidCredentials: true},
+
+		// invalid ID token cases
+		"error on token of another tenant": {username: "token of another tenant", wantErrType: pam.ErrPamAuth},
+		"error on token of another user":   {username: "token of another user", wantErrType: pam.ErrPamAuth},
 	}
 	for name, tc := range tests {
 		tc := tc
@@ -80,16 +157,374 @@ func TestAuthenticate(t *testing.T) {
 				cacheOpts = append(cacheOpts, cache.WithRootUID(4242))
 			}
 
-			err := pam.Authenticate(context.Background(), tc.username, tc.password, tc.conf,
+			// The cache is accessed directly, unless served by aad-authd.
+			socket := testutils.TempSocketPath(t)
+			if tc.throughDaemon {
+				testutils.StartDaemon(t, socket, cacheOpts)
+			}
+
+			var posixName string
+			if tc.userCached {
+				var err error
+				cfg, err := config.Parse(context.Background(), tc.conf)
+				require.NoError(t, err, "Setup: could not parse configuration")
+				posixName, err = pam.PosixName(tc.username, cfg)
+				require.NoError(t, err, "Setup: PosixName should succeed")
+				c := testutils.NewCacheForTests(t, cacheDir)
+				require.NoError(t, c.Update(context.Background(), posixName, tc.password, "/home/%f", "/bin/bash"), "Setup: could not cache user")
+			}
+
+			// Messages displayed to the user are collected through the PAM conversation.
+			var gotInfo []string
+			tx, err := pamCom.StartFunc("", "", func(s pamCom.Style, msg string) (string, error) {
+				if s == pamCom.TextInfo {
+					gotInfo = append(gotInfo, msg)
+				}
+				return "", nil
+			})
+			require.NoError(t, err, "Setup: pam should start a transaction with no error")
+			// The transaction must outlive Authenticate: its finalizer ends it and unregisters the conversation.
+			defer runtime.KeepAlive(tx)
+			ctx := pam.CtxWithPamh(context.Background(), pam.Handle(tx.Handle))
+
+			err = pam.Authenticate(ctx, tc.username, tc.password, tc.conf,
 				pam.WithAuthenticator(auth),
-				pam.WithCacheOptions(cacheOpts))
+				pam.WithCacheOptions(cacheOpts),
+				pam.WithSocketPath(socket),
+				pam.WithLogin(tc.service, tc.remoteHost))
+			require.Equal(t, tc.wantInfo, gotInfo, "Authenticate should have displayed the expected messages")
+			if tc.userCached {
+				c := testutils.NewCacheForTests(t, cacheDir)
+				err := c.CanAuthenticate(context.Background(), posixName, tc.password)
+				if tc.wantRevoked {
+					require.ErrorIs(t, err, cache.ErrCredentialsRevoked, "Offline credentials should have been revoked")
+					_, err = c.GetUserByName(context.Background(), posixName)
+					require.NoError(t, err, "Revoked user should be kept in the cache")
+				} else {
+					require.NoError(t, err, "Offline credentials should not have been revoked")
+				}
+			}
 			if tc.wantErrType != nil {
 				require.Error(t, err, "Authenticate should have returned an error but did not")
 				require.ErrorIs(t, err, tc.wantErrType, "Authenticate has not returned expected error type")
+				require.Equal(t, tc.wantInvalidCredentials, errors.Is(err, pam.ErrInvalidCredentials), "Authenticate should only report invalid credentials when the password was rejected")
 				return
 			}
 
 			require.NoError(t, err, "Authenticate should not have returned an error but did")
+
+			if tc.wantPurgedUser == nil {
+				return
+			}
+			c := testutils.NewCacheForTests(t, cacheDir)
+			_, err = c.GetUserByName(context.Background(), "purgeduser@domain.com")
+			if *tc.wantPurgedUser {
+				require.ErrorIs(t, err, cache.ErrNoEnt, "Very old user should have been purged on login")
+			} else {
+				require.NoError(t, err, "Very old user should have been kept on login")
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestOpenSession(t *testing.T) {
+	t.Parallel()
+
+	uid, gid := testutils.GetCurrentUIDGID(t)
+
+	tests := map[string]struct {
+		username            string
+		remoteHost          string
+		conf                string
+		throughDaemon       bool
+		wrongCacheOwnership bool
+
+		wantLoginCount int64
+		wantErrType    error
+	}{
+		"record login of cached user":                   {wantLoginCount: 1},
+		"record remote login of cached user":            {remoteHost: "remote.example.com", wantLoginCount: 1},
+		"record login of cached user through aad-authd": {throughDaemon: true, wantLoginCount: 1},
+		"record login of user with unnormalized name":   {username: "MyUser@Domain.COM", wantLoginCount: 1},
+
+		"ignore user not in cache":        {username: "localuser", wantErrType: pam.ErrPamIgnore},
+		"ignore on invalid configuration": {conf: "doesnotexist.conf", wantErrType: pam.ErrPamIgnore},
+
+		// error cases
+		"error on cache not accessible": {wrongCacheOwnership: true, wantErrType: pam.ErrPamSession},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.username == "" {
+				tc.username = "myuser@domain.com"
+			}
+			if tc.conf == "" {
+				tc.conf = "simple-aad.conf"
+			}
+			tc.conf = filepath.Join("testdata", tc.conf)
+
+			cacheDir := t.TempDir()
+			testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+
+			cacheOpts := []cache.Option{cache.WithCacheDir(cacheDir),
+				cache.WithRootUID(uid), cache.WithRootGID(gid), cache.WithShadowGID(gid)}
+			if tc.wrongCacheOwnership {
+				cacheOpts = append(cacheOpts, cache.WithRootUID(4242))
+			}
+
+			// The cache is accessed directly, unless served by aad-authd.
+			socket := testutils.TempSocketPath(t)
+			if tc.throughDaemon {
+				testutils.StartDaemon(t, socket, cacheOpts)
+			}
+
+			err := pam.OpenSession(context.Background(), tc.username, tc.conf,
+				pam.WithCacheOptions(cacheOpts),
+				pam.WithSocketPath(socket),
+				pam.WithLogin("sshd", tc.remoteHost))
+			if tc.wantErrType != nil {
+				require.ErrorIs(t, err, tc.wantErrType, "OpenSession has not returned expected error type")
+				return
+			}
+			require.NoError(t, err, "OpenSession should not have returned an error but did")
+
+			c := testutils.NewCacheForTests(t, cacheDir)
+			h, err := c.LoginHistory(context.Background(), "myuser@domain.com")
+			require.NoError(t, err, "LoginHistory should succeed")
+			require.Equal(t, tc.wantLoginCount, h.LoginCount, "OpenSession should have counted the login")
+			require.Equal(t, tc.remoteHost, h.LastRemoteHost, "OpenSession should have recorded the remote host")
+		})
+	}
+}
+
+func TestAuthenticateCorrelationID(t *testing.T) {
+	t.Parallel()
+
+	uid, gid := testutils.GetCurrentUIDGID(t)
+
+	tests := map[string]struct {
+		username string
+
+		wantMessageID string
+	}{
+		"successful authentication": {username: "success@domain.com", wantMessageID: consts.MessageIDAuthSucceeded},
+		"failed authentication":     {username: "invalid credentials", wantMessageID: consts.MessageIDAuthFailed},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			cacheOpts := []cache.Option{cache.WithCacheDir(cacheDir),
+				cache.WithRootUID(uid), cache.WithRootGID(gid), cache.WithShadowGID(gid)}
+
+			l := &recordingLogger{}
+			ctx := logger.CtxWithLogger(context.Background(), l)
+
+			// Each attempt gets its own correlation ID.
+			var ids []string
+			for i := 0; i < 2; i++ {
+				l.fields = nil
+				_ = pam.Authenticate(ctx, tc.username, "my password", filepath.Join("testdata", "simple-aad.conf"),
+					pam.WithAuthenticator(aad.NewWithMockClient()),
+					pam.WithCacheOptions(cacheOpts),
+					pam.WithSocketPath(testutils.TempSocketPath(t)),
+					pam.WithLogin("sshd", "192.0.2.1"))
+
+				require.NotEmpty(t, l.fields, "Authenticate should have logged messages")
+				id := fieldValue(l.fields[0], logger.CorrelationIDKey)
+				require.NotEmpty(t, id, "Messages should have a correlation ID")
+				for _, fields := range l.fields {
+					require.Equal(t, id, fieldValue(fields, logger.CorrelationIDKey), "All the messages of an attempt should share the correlation ID")
+					require.Equal(t, tc.username, fieldValue(fields, "user"), "All the messages of an attempt should have the user")
+					require.Equal(t, "sshd", fieldValue(fields, "service"), "All the messages of an attempt should have the service")
+					require.Equal(t, "192.0.2.1", fieldValue(fields, "remote_host"), "All the messages of an attempt should have the remote host")
+				}
+				last := l.fields[len(l.fields)-1]
+				require.Equal(t, tc.wantMessageID, fieldValue(last, logger.MessageIDKey), "The outcome of the attempt should be logged with its message ID")
+				ids = append(ids, id)
+			}
+			require.NotEqual(t, ids[0], ids[1], "Each attempt should have its own correlation ID")
+		})
+	}
+}
+
+func TestAuthenticateDryRun(t *testing.T) {
+	t.Parallel()
+
+	uid, gid := testutils.GetCurrentUIDGID(t)
+
+	tests := map[string]struct {
+		username string
+		dryRun   bool
+
+		conf string
+
+		wantStep    string
+		wantInCache bool
+	}{
+		"cache is updated":                       {username: "success@domain.com", wantStep: "Cache update: success", wantInCache: true},
+		"cache is not updated in dry run":        {username: "success@domain.com", dryRun: true, wantStep: "Cache update: skipped in dry run"},
+		"messages are reported as steps":         {username: "password expired", wantStep: "Message: Your password has expired. Please change it online before logging in."},
+		"credentials are not revoked in dry run": {username: "no such user", dryRun: true, wantStep: "Cache update: skipped in dry run, offline credentials would be revoked"},
+		"cache is not created in dry run":        {username: "success@domain.com", dryRun: true, conf: "forceoffline.conf", wantStep: "Cache: can't be opened: couldn't open/create cache: couldn't initiate database: cache doesn't exist and can't be created read-only"},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir := t.TempDir()
+			cacheOpts := []cache.Option{cache.WithCacheDir(cacheDir),
+				cache.WithRootUID(uid), cache.WithRootGID(gid), cache.WithShadowGID(gid)}
+
+			var steps []string
+			opts := []pam.Option{
+				pam.WithAuthenticator(aad.NewWithMockClient()),
+				pam.WithCacheOptions(cacheOpts),
+				pam.WithSocketPath(testutils.TempSocketPath(t)),
+				pam.WithSteps(func(step, outcome string) { steps = append(steps, step+": "+outcome) }),
+			}
+			if tc.dryRun {
+				opts = append(opts, pam.WithDryRun())
+			}
+			if tc.conf == "" {
+				tc.conf = "simple-aad.conf"
+			}
+			_ = pam.Authenticate(context.Background(), tc.username, "my password", filepath.Join("testdata", tc.conf), opts...)
+			require.Contains(t, steps, tc.wantStep, "Authenticate should have reported the expected step")
+
+			if tc.dryRun {
+				entries, err := os.ReadDir(cacheDir)
+				require.NoError(t, err, "Setup: could not read the cache directory")
+				require.Empty(t, entries, "Nothing should have been written to the cache directory in dry run")
+			}
+
+			c := testutils.NewCacheForTests(t, cacheDir)
+			_, err := c.GetUserByName(context.Background(), tc.username)
+			if tc.wantInCache {
+				require.NoError(t, err, "User should have been cached")
+				return
+			}
+			require.ErrorIs(t, err, cache.ErrNoEnt, "User should not have been cached")
+		})
+	}
+}
+
+func TestAuthenticateMetrics(t *testing.T) {
+	t.Parallel()
+
+	uid, gid := testutils.GetCurrentUIDGID(t)
+
+	tests := map[string]struct {
+		username     string
+		conf         string
+		initialCache string
+		noMetrics    bool
+
+		wantMetrics   []string
+		wantNoMetrics bool
+	}{
+		"count online login": {wantMetrics: []string{
+			`aad_auth_logins_total{mode="online",result="success"} 1`,
+			`aad_auth_aad_request_duration_seconds_count 1`,
+		}},
+		"count offline login": {conf: "forceoffline.conf", initialCache: "users_in_db", username: "myuser@domain.com", wantMetrics: []string{
+			`aad_auth_logins_total{mode="offline",result="success"} 1`,
+		}},
+		"count denial by Azure AD with its reason": {username: "account locked", wantMetrics: []string{
+			`aad_auth_logins_total{mode="online",result="failure"} 1`,
+			`aad_auth_denials_total{reason="account_locked"} 1`,
+		}},
+		"count offline denial with its reason": {conf: "forceoffline.conf", initialCache: "db_with_expired_users", username: "expireduser@domain.com", wantMetrics: []string{
+			`aad_auth_logins_total{mode="offline",result="failure"} 1`,
+			`aad_auth_denials_total{reason="offline_credentials_expired"} 1`,
+		}},
+		"count denial on invalid ID token": {username: "token of another user", wantMetrics: []string{
+			`aad_auth_denials_total{reason="invalid_claims"} 1`,
+		}},
+		"count denial by login policy": {conf: "login-policies.conf", wantMetrics: []string{
+			`aad_auth_denials_total{reason="login_policy"} 1`,
+		}},
+
+		"no metrics for users left to the other modules": {conf: "strict-domains.conf", username: "localuser", wantNoMetrics: true},
+
+		"no metrics if disabled": {noMetrics: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.username == "" {
+				tc.username = "success@domain.com"
+			}
+			if tc.conf == "" {
+				tc.conf = "simple-aad.conf"
+			}
+
+			cacheDir := t.TempDir()
+			if tc.initialCache != "" {
+				testutils.PrepareDBsForTests(t, cacheDir, tc.initialCache)
+			}
+			cacheOpts := []cache.Option{cache.WithCacheDir(cacheDir),
+				cache.WithRootUID(uid), cache.WithRootGID(gid), cache.WithShadowGID(gid)}
+
+			metricsDir := t.TempDir()
+			opts := []pam.Option{
+				pam.WithAuthenticator(aad.NewWithMockClient()),
+				pam.WithCacheOptions(cacheOpts),
+				pam.WithSocketPath(testutils.TempSocketPath(t)),
+				pam.WithLogin("cron", ""),
+			}
+			if !tc.noMetrics {
+				opts = append(opts, pam.WithMetricsDir(metricsDir))
+			}
+
+			_ = pam.Authenticate(context.Background(), tc.username, "my password", filepath.Join("testdata", tc.conf), opts...)
+
+			got, err := os.ReadFile(filepath.Join(metricsDir, "aad_auth.prom"))
+			if tc.noMetrics || tc.wantNoMetrics {
+				require.ErrorIs(t, err, os.ErrNotExist, "Authenticate should not have written metrics")
+				return
+			}
+			require.NoError(t, err, "Authenticate should have written metrics")
+			for _, w := range tc.wantMetrics {
+				require.Contains(t, string(got), w+"\n", "Authenticate should have counted the attempt")
+			}
 		})
 	}
 }
+
+// recordingLogger records the fields of the messages it logs.
+type recordingLogger struct {
+	fields [][]logger.Field
+}
+
+func (l *recordingLogger) Log(_ logger.Priority, _ string, fields []logger.Field) {
+	l.fields = append(l.fields, fields)
+}
+func (l *recordingLogger) Debug(string, ...any) {}
+func (l *recordingLogger) Info(string, ...any)  {}
+func (l *recordingLogger) Warn(string, ...any)  {}
+func (l *recordingLogger) Err(string, ...any)   {}
+func (l *recordingLogger) Crit(string, ...any)  {}
+func (l *recordingLogger) Close() error         { return nil }
+
+// fieldValue returns the value of the field key, or an empty string if it is not set.
+func fieldValue(fields []logger.Field, key string) string {
+	for _, f := range fields {
+		if f.Key == key {
+			return fmt.Sprint(f.Value)
+		}
+	}
+	return ""
+}
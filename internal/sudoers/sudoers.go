@@ -0,0 +1,130 @@
+// Package sudoers installs the sudo rules granted to Azure AD groups and users in a managed sudoers file.
+package sudoers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/ubuntu/aad-auth/internal/config"
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/aad-auth/internal/logger"
+	"github.com/ubuntu/decorate"
+)
+
+const (
+	// DefaultPath is the managed sudoers file. sudo reads it as it is in /etc/sudoers.d and has no dot in its name.
+	DefaultPath = "/etc/sudoers.d/aad"
+
+	// header explains where the rules come from, at the top of the managed file.
+	header = `# Managed by aad-cli from the [sudo:...] sections of the Azure AD configuration.
+# Do not edit: this file is regenerated whenever the groups and users of the Azure AD cache change.
+`
+)
+
+type options struct {
+	path      string
+	visudoCmd string
+}
+
+// Option represents one functional option passed to Update.
+type Option func(*options)
+
+// WithPath overrides the path of the managed sudoers file.
+func WithPath(p string) Option {
+	return func(o *options) {
+		o.path = p
+	}
+}
+
+// WithVisudoCmd overrides the visudo command checking the rules before they are installed.
+func WithVisudoCmd(cmd string) Option {
+	return func(o *options) {
+		o.visudoCmd = cmd
+	}
+}
+
+// Render returns the content of the sudoers file granting rules.
+// Group names and logins are quoted, as they contain characters which sudo would otherwise interpret, like @.
+// The % marking groups goes inside the quotes. They can't contain quotes themselves, as they are valid POSIX names.
+func Render(rules []config.SudoRule) []byte {
+	var b bytes.Buffer
+	b.WriteString(header)
+	for _, r := range rules {
+		if r.Group != "" {
+			fmt.Fprintf(&b, "\"%%%s\" ALL=(ALL:ALL) %s\n", r.Group, r.Commands)
+			continue
+		}
+		fmt.Fprintf(&b, "\"%s\" ALL=(ALL:ALL) %s\n", r.Login, r.Commands)
+	}
+	return b.Bytes()
+}
+
+// Update installs the sudoers file granting rules, if it changed. The file is removed if there is no rule.
+// The rules are checked with visudo before replacing the file atomically, so that an invalid rule never breaks sudo.
+// It returns true if the file was changed.
+func Update(ctx context.Context, rules []config.SudoRule, opts ...Option) (changed bool, err error) {
+	o := options{
+		path:      DefaultPath,
+		visudoCmd: "visudo",
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	defer decorate.OnError(&err, i18n.G("could not update sudo rules in %s"), o.path)
+
+	if len(rules) == 0 {
+		logger.Debug(ctx, "No sudo rule, removing %s", o.path)
+		if err := os.Remove(o.path); errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	content := Render(rules)
+	if current, err := os.ReadFile(o.path); err == nil && bytes.Equal(current, content) {
+		logger.Debug(ctx, "Sudo rules in %s are up to date", o.path)
+		return false, nil
+	}
+
+	// sudo ignores the files with a dot in their name, so the temporary file is never read before being checked.
+	f, err := os.CreateTemp(filepath.Dir(o.path), "."+filepath.Base(o.path)+".*")
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return false, err
+	}
+	if err := f.Chmod(0440); err != nil {
+		f.Close()
+		return false, err
+	}
+	if err := f.Close(); err != nil {
+		return false, err
+	}
+
+	// #nosec:G204 - visudoCmd is only overridden in tests.
+	if out, err := exec.Command(o.visudoCmd, "-c", "-q", "-f", f.Name()).CombinedOutput(); err != nil {
+		return false, fmt.Errorf(i18n.G("rules rejected by visudo: %v: %s"), err, bytes.TrimSpace(out))
+	}
+
+	logger.Info(ctx, "Installing sudo rules in %s", o.path)
+	if err := os.Rename(f.Name(), o.path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
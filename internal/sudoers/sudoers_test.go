@@ -0,0 +1,165 @@
+package sudoers_test
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/config"
+	"github.com/ubuntu/aad-auth/internal/sudoers"
+	"github.com/ubuntu/aad-auth/internal/testutils"
+)
+
+var rules = []config.SudoRule{
+	{Group: "linux_admins@domain.com", Commands: "ALL"},
+	{Login: "developer@domain.com", Commands: "NOPASSWD: /usr/bin/apt, /usr/bin/systemctl restart nginx"},
+	{Login: "linux-admin@domain.com", Commands: "ALL"},
+}
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		rules []config.SudoRule
+	}{
+		"rules of groups and users": {rules: rules},
+		"no rule":                   {},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := string(sudoers.Render(tc.rules))
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "Render should return the expected sudoers file")
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		rules    []config.SudoRule
+		existing string
+		rejected bool
+
+		wantChanged bool
+		wantFile    bool
+		wantErr     bool
+	}{
+		"install rules":                       {rules: rules, wantChanged: true, wantFile: true},
+		"replace outdated rules":              {rules: rules, existing: "outdated", wantChanged: true, wantFile: true},
+		"keep up to date rules without check": {rules: rules, existing: "up to date", rejected: true, wantFile: true},
+		"remove file without rules":           {existing: "outdated", wantChanged: true},
+		"nothing to do without rules":         {},
+
+		// error cases
+		"error on rules rejected by visudo":                      {rules: rules, rejected: true, wantErr: true},
+		"error on rules rejected by visudo keeps existing rules": {rules: rules, existing: "outdated", rejected: true, wantFile: true, wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			p := filepath.Join(dir, "aad")
+			switch tc.existing {
+			case "outdated":
+				require.NoError(t, os.WriteFile(p, []byte("\"old@domain.com\" ALL=(ALL:ALL) ALL\n"), 0440), "Setup: could not write existing rules")
+			case "up to date":
+				require.NoError(t, os.WriteFile(p, sudoers.Render(tc.rules), 0440), "Setup: could not write existing rules")
+			}
+			var before []byte
+			if tc.existing != "" {
+				var err error
+				before, err = os.ReadFile(p)
+				require.NoError(t, err, "Setup: could not read existing rules")
+			}
+
+			visudo := "true"
+			if tc.rejected {
+				visudo = "false"
+			}
+
+			changed, err := sudoers.Update(context.Background(), tc.rules, sudoers.WithPath(p), sudoers.WithVisudoCmd(visudo))
+			if tc.wantErr {
+				require.Error(t, err, "Update should have failed")
+			} else {
+				require.NoError(t, err, "Update should succeed")
+			}
+			require.Equal(t, tc.wantChanged, changed, "Update should report whether the file changed")
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err, "Setup: could not read sudoers directory")
+			got, err := os.ReadFile(p)
+			if !tc.wantFile {
+				require.ErrorIs(t, err, os.ErrNotExist, "Update should not leave a sudoers file")
+				require.Empty(t, entries, "Update should not leave temporary files")
+				return
+			}
+			require.NoError(t, err, "Update should leave a sudoers file")
+			require.Len(t, entries, 1, "Update should not leave temporary files")
+			if tc.rejected {
+				require.Equal(t, string(before), string(got), "Rejected rules should not replace the existing ones")
+				return
+			}
+			require.Equal(t, string(sudoers.Render(tc.rules)), string(got), "Update should install the rules")
+			fi, err := os.Stat(p)
+			require.NoError(t, err, "Setup: could not stat sudoers file")
+			require.Equal(t, os.FileMode(0440), fi.Mode().Perm(), "Sudoers file should only be readable")
+		})
+	}
+}
+
+func TestUpdateWithVisudo(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("visudo"); err != nil {
+		t.Skip("visudo is not installed")
+	}
+
+	tests := map[string]struct {
+		rules []config.SudoRule
+
+		wantErr bool
+	}{
+		"install rules accepted by visudo": {rules: rules},
+
+		// error cases
+		"error on rules rejected by visudo": {rules: []config.SudoRule{{Login: "developer@domain.com", Commands: "NOPASSWD:"}}, wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p := filepath.Join(t.TempDir(), "aad")
+
+			changed, err := sudoers.Update(context.Background(), tc.rules, sudoers.WithPath(p))
+			if tc.wantErr {
+				require.Error(t, err, "Update should have failed")
+				require.NoFileExists(t, p, "Rejected rules should not be installed")
+				return
+			}
+			require.NoError(t, err, "Update should succeed")
+			require.True(t, changed, "Update should report that the file changed")
+
+			got, err := os.ReadFile(p)
+			require.NoError(t, err, "Update should leave a sudoers file")
+			require.Equal(t, string(sudoers.Render(tc.rules)), string(got), "Update should install the rules")
+		})
+	}
+}
+
+func TestMain(m *testing.M) {
+	testutils.InstallUpdateFlag()
+	flag.Parse()
+	m.Run()
+}
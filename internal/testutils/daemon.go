@@ -0,0 +1,27 @@
+package testutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/daemon"
+)
+
+// StartDaemon serves the cache opened with cacheOpts on socket until the test ends.
+// The user running the tests is allowed to authenticate users and to read shadow entries, as root would.
+func StartDaemon(t *testing.T, socket string, cacheOpts []cache.Option) {
+	t.Helper()
+
+	uid, gid := GetCurrentUIDGID(t)
+	s, err := daemon.New(context.Background(), socket, daemon.WithCacheOptions(cacheOpts), daemon.WithRootUID(uid), daemon.WithShadowGID(gid))
+	require.NoError(t, err, "Setup: could not start aad-authd")
+
+	served := make(chan error)
+	go func() { served <- s.Serve(context.Background()) }()
+	t.Cleanup(func() {
+		require.NoError(t, s.Stop(context.Background()), "Teardown: could not stop aad-authd")
+		require.NoError(t, <-served, "Teardown: aad-authd should stop without error")
+	})
+}
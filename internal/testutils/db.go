@@ -3,6 +3,7 @@ package testutils
 import (
 	"context"
 	"database/sql"
+	"encoding/csv"
 	"fmt"
 	"io"
 	"os"
@@ -72,7 +73,7 @@ func ReadDumpAsTables(t *testing.T, r io.Reader) (map[string]Table, error) {
 			break
 		}
 
-		require.GreaterOrEqual(t, len(lines), 3, "%q should contain 3 lines at least: name/row names/data", lines)
+		require.GreaterOrEqual(t, len(lines), 2, "%q should contain 2 lines at least: name/row names, followed by the data", lines)
 
 		// Each group of data is one table with its content.
 		table := Table{}
@@ -82,10 +83,12 @@ func ReadDumpAsTables(t *testing.T, r io.Reader) (map[string]Table, error) {
 		cols := lines[1]
 		table.Cols = strings.Split(cols, ",")
 
-		// Content.
+		// Content. Values containing commas, like GECOS fields, are quoted.
 		for _, data := range lines[2:] {
+			values, err := csv.NewReader(strings.NewReader(data)).Read()
+			require.NoError(t, err, "%q should be a CSV row", data)
 			row := make(map[string]string)
-			for i, v := range strings.Split(data, ",") {
+			for i, v := range values {
 				row[table.Cols[i]] = v
 			}
 			table.Rows = append(table.Rows, row)
@@ -174,8 +177,11 @@ func dumpTable(t *testing.T, db *sql.DB, name string, w io.Writer, usePredicatab
 		}
 
 		// Write the entire row with its fields in CSV format.
-		_, err = w.Write([]byte(strings.Join(data, ",") + "\n"))
+		cw := csv.NewWriter(w)
+		err = cw.Write(data)
 		require.NoError(t, err, "Failed to write row")
+		cw.Flush()
+		require.NoError(t, cw.Error(), "Failed to write row")
 	}
 
 	return nil
@@ -200,6 +206,13 @@ func predicatableFieldValues(name string, data, cols []string) {
 				break
 			}
 		}
+
+	case "login_history":
+		for i, col := range cols {
+			if col == "first_login" || col == "last_login" {
+				data[i] = "4242"
+			}
+		}
 	}
 }
 
@@ -224,19 +237,25 @@ func PrepareDBsForTests(t *testing.T, cacheDir, initialCache string, options ...
 func NewCacheForTests(t *testing.T, cacheDir string, options ...cache.Option) (c *cache.Cache) {
 	t.Helper()
 
-	uid, gid := GetCurrentUIDGID(t)
-	opts := append([]cache.Option{}, cache.WithCacheDir(cacheDir),
-		cache.WithRootUID(uid), cache.WithRootGID(gid), cache.WithShadowGID(gid), cache.WithTeardownDuration(0))
-
-	opts = append(opts, options...)
-
-	c, err := cache.New(context.Background(), opts...)
+	c, err := cache.New(context.Background(), CacheOptionsForTests(t, cacheDir, options...)...)
 	require.NoError(t, err, "Setup: should be able to create a cache")
 	t.Cleanup(func() { c.Close(context.Background()) })
 
 	return c
 }
 
+// CacheOptionsForTests returns the options to open the cache in cacheDir, owned by the user running the tests,
+// followed by options.
+func CacheOptionsForTests(t *testing.T, cacheDir string, options ...cache.Option) []cache.Option {
+	t.Helper()
+
+	uid, gid := GetCurrentUIDGID(t)
+	opts := append([]cache.Option{}, cache.WithCacheDir(cacheDir),
+		cache.WithRootUID(uid), cache.WithRootGID(gid), cache.WithShadowGID(gid), cache.WithTeardownDuration(0))
+
+	return append(opts, options...)
+}
+
 // loadDumpIntoDB reads the specified dump file and inserts its contents into the database.
 func loadDumpIntoDB(t *testing.T, dumpPath, dbPath string) {
 	t.Helper()
@@ -254,7 +273,8 @@ func loadDumpIntoDB(t *testing.T, dumpPath, dbPath string) {
 	defer db.Close()
 
 	for name, table := range dump {
-		st := fmt.Sprintf("INSERT INTO %s VALUES (%s)", name, "%s")
+		// Columns are named, so that the columns missing from the dump get their default values.
+		st := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", name, strings.Join(table.Cols, ","), "%s")
 
 		for _, row := range table.Rows {
 			values := make([]any, len(row))
@@ -2,7 +2,9 @@
 package testutils
 
 import (
+	"os"
 	"os/user"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
@@ -37,3 +39,15 @@ func TimeBetweenOrEquals(tt, start, end time.Time) bool {
 
 	return true
 }
+
+// TempSocketPath returns the path to a socket in a new temporary directory, removed when the test ends.
+// Unlike t.TempDir(), the path does not contain the test name, so that it fits in the Unix socket path limit.
+func TempSocketPath(t *testing.T) string {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "aad-auth-")
+	require.NoError(t, err, "Setup: could not create socket directory")
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return filepath.Join(dir, "aad-authd.sock")
+}
@@ -0,0 +1,4 @@
+package user
+
+// LetterMarkDigit are the characters which are letters, marks or decimal digits.
+var LetterMarkDigit = letterMarkDigit
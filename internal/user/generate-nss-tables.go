@@ -0,0 +1,145 @@
+//go:build tools
+// +build tools
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ubuntu/aad-auth/internal/generators"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const usage = `Usage of %s:
+
+   RUSTFILE GOFILE
+     Generate the Rust tables used by the NSS module to normalize user names into RUSTFILE and the tables used by
+     PosixName to normalize them the same way into GOFILE.
+
+The tables are generated from the Unicode version of golang.org/x/text, which is pinned by go.mod. The Go
+toolchain must use the same Unicode version.
+`
+
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatalf(usage, os.Args[0])
+	}
+	if generators.InstallOnlyMode() {
+		return
+	}
+
+	// Case folding comes from golang.org/x/text while letters, marks and digits come from the toolchain: mixing
+	// Unicode versions would make the tables depend on the toolchain used to generate them.
+	if unicode.Version != norm.Version {
+		log.Fatalf("Error when generating tables: the Go toolchain uses Unicode %s while golang.org/x/text uses Unicode %s",
+			unicode.Version, norm.Version)
+	}
+
+	ranges := letterMarkDigitRanges()
+	if err := os.WriteFile(os.Args[2], goTables(ranges), 0600); err != nil {
+		log.Fatalf("Error when generating tables: %v", err)
+	}
+	if err := os.WriteFile(os.Args[1], rustTables(ranges), 0600); err != nil {
+		log.Fatalf("Error when generating tables: %v", err)
+	}
+}
+
+// letterMarkDigitRanges returns the ranges of characters which are letters, marks or decimal digits.
+func letterMarkDigitRanges() [][2]rune {
+	var ranges [][2]rune
+	start := rune(-1)
+	for r := rune(0); r <= unicode.MaxRune+1; r++ {
+		in := r <= unicode.MaxRune && utf8.ValidRune(r) && (unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r))
+		switch {
+		case in && start < 0:
+			start = r
+		case !in && start >= 0:
+			ranges = append(ranges, [2]rune{start, r - 1})
+			start = -1
+		}
+	}
+	return ranges
+}
+
+// goTables returns the Go source of the range table of letters, marks and digits used by PosixName.
+func goTables(ranges [][2]rune) []byte {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by generate-nss-tables.go. DO NOT EDIT.\n\n")
+	b.WriteString("package user\n\n")
+	b.WriteString("import \"unicode\"\n\n")
+	b.WriteString("// letterMarkDigit are the characters which are letters, marks or decimal digits in Unicode ")
+	fmt.Fprintf(&b, "%s.\n", unicode.Version)
+	b.WriteString("// They are the same as in the NSS module, whatever the Unicode version of the toolchain is.\n")
+	b.WriteString("var letterMarkDigit = &unicode.RangeTable{\n")
+
+	var r16, r32 [][2]rune
+	var latinOffset int
+	for _, r := range ranges {
+		if r[0] > 0xffff {
+			r32 = append(r32, r)
+			continue
+		}
+		if r[1] > 0xffff {
+			r16 = append(r16, [2]rune{r[0], 0xffff})
+			r32 = append(r32, [2]rune{0x10000, r[1]})
+			continue
+		}
+		r16 = append(r16, r)
+		if r[1] <= unicode.MaxLatin1 {
+			latinOffset++
+		}
+	}
+	b.WriteString("\tR16: []unicode.Range16{\n")
+	for _, r := range r16 {
+		fmt.Fprintf(&b, "\t\t{Lo: 0x%04x, Hi: 0x%04x, Stride: 1},\n", r[0], r[1])
+	}
+	b.WriteString("\t},\n")
+	b.WriteString("\tR32: []unicode.Range32{\n")
+	for _, r := range r32 {
+		fmt.Fprintf(&b, "\t\t{Lo: 0x%x, Hi: 0x%x, Stride: 1},\n", r[0], r[1])
+	}
+	b.WriteString("\t},\n")
+	fmt.Fprintf(&b, "\tLatinOffset: %d,\n", latinOffset)
+	b.WriteString("}\n")
+
+	return b.Bytes()
+}
+
+// rustTables returns the Rust source of the case folding table and of the ranges of letters, marks and digits.
+func rustTables(ranges [][2]rune) []byte {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by internal/user/generate-nss-tables.go. DO NOT EDIT.\n")
+	fmt.Fprintf(&b, "// Unicode version: %s.\n\n", unicode.Version)
+
+	b.WriteString("/// FOLD maps the characters changed by the case folding of golang.org/x/text/cases to their folded string.\n")
+	b.WriteString("pub static FOLD: &[(char, &str)] = &[\n")
+	fold := cases.Fold()
+	for r := rune(0); r <= unicode.MaxRune; r++ {
+		if !utf8.ValidRune(r) {
+			continue
+		}
+		if folded := fold.String(string(r)); folded != string(r) {
+			fmt.Fprintf(&b, "    ('\\u{%x}', \"", r)
+			for _, f := range folded {
+				fmt.Fprintf(&b, "\\u{%x}", f)
+			}
+			b.WriteString("\"),\n")
+		}
+	}
+	b.WriteString("];\n\n")
+
+	b.WriteString("/// LETTERS_MARKS_DIGITS are the ranges of characters which are letters, marks or decimal digits.\n")
+	b.WriteString("pub static LETTERS_MARKS_DIGITS: &[(char, char)] = &[\n")
+	for _, r := range ranges {
+		fmt.Fprintf(&b, "    ('\\u{%x}', '\\u{%x}'),\n", r[0], r[1])
+	}
+	b.WriteString("];\n")
+
+	return b.Bytes()
+}
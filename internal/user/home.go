@@ -0,0 +1,135 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"github.com/ubuntu/decorate"
+)
+
+// guestMarkerRegexp matches the marker Azure AD adds to the user name of B2B guests.
+var guestMarkerRegexp = regexp.MustCompile(`(?i)#EXT#`)
+
+// HomeDir returns the home directory generated by parsing pattern for the user name, with its uid, gid and Azure AD
+// objectID. Substituted values are sanitised so that they can't add path components.
+// In case there are any invalid modifiers or if the result escapes the base directory of the pattern, returns an error.
+func HomeDir(pattern, name string, uid, gid int64, objectID string) (home string, err error) {
+	defer decorate.OnError(&err, i18n.G("couldn't parse home directory"))
+
+	// base is the literal part of the pattern before the first modifier.
+	var base string
+	var hasModifier bool
+	p := []rune(pattern)
+	for i := 0; i < len(p); i++ {
+		// append normal characters to the path, as is.
+		if p[i] != '%' {
+			home += string(p[i])
+			continue
+		}
+
+		i++
+		if i == len(p) {
+			return "", errors.New(i18n.G("pattern ends with an incomplete % modifier"))
+		}
+		// treat %% case: second % is now considered as a "normal" character to append.
+		if p[i] == '%' {
+			home += "%"
+			continue
+		}
+
+		if !hasModifier {
+			base, hasModifier = home, true
+		}
+
+		// treat case transforms, prefixing the special modifiers.
+		transform := func(s string) string { return s }
+		switch p[i] {
+		case '^':
+			transform = strings.ToUpper
+		case ',':
+			transform = strings.ToLower
+		}
+		if p[i] == '^' || p[i] == ',' {
+			i++
+			if i == len(p) {
+				return "", errors.New(i18n.G("pattern ends with an incomplete % modifier"))
+			}
+		}
+
+		// treat special modifiers.
+		s, err := homeDirModifier(string(p[i]), name, uid, gid, objectID)
+		if err != nil {
+			return "", err
+		}
+		home += sanitizeHomeDirValue(transform(s))
+	}
+
+	if !hasModifier {
+		return home, nil
+	}
+
+	// Ensure that the substituted values did not escape the base directory.
+	baseDir := filepath.Dir(base)
+	home = filepath.Clean(home)
+	rel, err := filepath.Rel(baseDir, home)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf(i18n.G("%q escapes the base directory %q"), home, baseDir)
+	}
+
+	return home, nil
+}
+
+// ValidateHomeDirPattern checks that pattern only contains supported modifiers.
+func ValidateHomeDirPattern(pattern string) error {
+	_, err := HomeDir(pattern, "user@domain.com", 0, 0, "00000000-0000-0000-0000-000000000000")
+	return err
+}
+
+// homeDirModifier returns the value substituted to the modifier of a home directory pattern.
+// If the modifier is not recognized, an error is returned.
+func homeDirModifier(modifier, name string, uid, gid int64, objectID string) (string, error) {
+	switch modifier {
+	case "f":
+		return name, nil
+	case "U":
+		return strconv.FormatInt(uid, 10), nil
+	case "g":
+		return strconv.FormatInt(gid, 10), nil
+	case "l":
+		for _, c := range name {
+			return string(c), nil
+		}
+		return "", nil
+	case "u", "d":
+		n, domain, _ := strings.Cut(name, "@")
+		if modifier == "u" {
+			return n, nil
+		}
+		return domain, nil
+	case "o":
+		if objectID == "" {
+			return "", errors.New(i18n.G("%o requires the Azure AD object ID of the user, which is unknown"))
+		}
+		return objectID, nil
+	}
+	return "", fmt.Errorf("%%%s is not a valid pattern", modifier)
+}
+
+// sanitizeHomeDirValue makes a value substituted in a home directory pattern safe to use in a path component.
+// The guest marker #EXT# is removed, and any character other than letters, digits, '.', '_', '-', '@' and '+' is
+// replaced by '_'.
+func sanitizeHomeDirValue(s string) string {
+	s = guestMarkerRegexp.ReplaceAllString(s, "")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-@+", r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,88 @@
+package user_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/user"
+)
+
+func TestHomeDir(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		path       string
+		username   string
+		noObjectID bool
+
+		want    string
+		wantErr bool
+	}{
+		"handle %f":                         {path: "/home/%f", want: "/home/user1@test.com"},
+		"handle %u":                         {path: "/home/%u", want: "/home/user1"},
+		"handle %U":                         {path: "/home/%U", want: "/home/42"},
+		"handle %g":                         {path: "/home/%g", want: "/home/43"},
+		"handle %d":                         {path: "/home/%d", want: "/home/test.com"},
+		"handle %o":                         {path: "/home/%o", want: "/home/11111111-2222-3333-4444-555555555555"},
+		"handle %f without domain attached": {username: "userWithoutDomain", path: "/home/%f", want: "/home/userWithoutDomain"},
+		"handle %l":                         {path: "/home/%l", want: "/home/u"},
+		"handle %l on multibyte character":  {username: "élodie@test.com", path: "/home/%l", want: "/home/é"},
+		"handle %%":                         {path: "/home/user%%test.com", want: "/home/user%test.com"},
+		"pattern after string":              {path: "/home/whyDoThis%u", want: "/home/whyDoThisuser1"},
+
+		// case transforms
+		"handle uppercase modifier": {username: "User1@Test.com", path: "/home/%^d/%^u", want: "/home/TEST.COM/USER1"},
+		"handle lowercase modifier": {username: "User1@Test.com", path: "/home/%,d/%,f", want: "/home/test.com/user1@test.com"},
+		"handle case on %l":         {path: "/home/%^l/%u", want: "/home/U/user1"},
+
+		// multiple patterns
+		"multiple consecutive patterns":               {path: "/home/%d/%l/%u%U", want: "/home/test.com/u/user142"},
+		"multiple patterns separated with characters": {path: "/home/%u-%d", want: "/home/user1-test.com"},
+
+		// sanitising
+		"guest marker is removed":                   {username: "john_contoso.com#EXT#@test.onmicrosoft.com", path: "/home/%u", want: "/home/john_contoso.com"},
+		"guest marker is removed whatever its case": {username: "john_contoso.com#EXT#@test.onmicrosoft.com", path: "/home/%,u", want: "/home/john_contoso.com"},
+		"spaces are replaced":                       {username: "john doe@test.com", path: "/home/%u", want: "/home/john_doe"},
+		"slashes are replaced":                      {username: "../../etc@test.com", path: "/home/%u", want: "/home/.._.._etc"},
+		"other unsafe characters are replaced":      {username: "a:b\\c#d\te@test.com", path: "/home/%u", want: "/home/a_b_c_d_e"},
+		"empty value is cleaned from the path":      {username: "userWithoutDomain", path: "/home/%d/%u", want: "/home/userWithoutDomain"},
+
+		// special cases
+		"full path without modifier is returned as is": {path: "/home/username", want: "/home/username"},
+		"literal parent directory in base is allowed":  {path: "/home/../srv/%u", want: "/srv/user1"},
+
+		// error cases
+		"error out on path with invalid pattern":        {path: "/home/%a", wantErr: true},
+		"error out on path ending with a modifier":      {path: "/home/user%", wantErr: true},
+		"error out on path ending with a case modifier": {path: "/home/user%^", wantErr: true},
+		"error out on case modifier on invalid pattern": {path: "/home/%^a", wantErr: true},
+		"error out on %o with unknown object ID":        {path: "/home/%o", noObjectID: true, wantErr: true},
+		"error out on value escaping to parent":         {username: "..@test.com", path: "/home/%u/data", wantErr: true},
+		"error out on value being the base directory":   {username: ".@test.com", path: "/home/%u", wantErr: true},
+		"error out on empty value being the base":       {username: "userWithoutDomain", path: "/home/%d", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			name := "user1@test.com"
+			if tc.username != "" {
+				name = tc.username
+			}
+			objectID := "11111111-2222-3333-4444-555555555555"
+			if tc.noObjectID {
+				objectID = ""
+			}
+
+			got, err := user.HomeDir(tc.path, name, 42, 43, objectID)
+			if tc.wantErr {
+				require.Error(t, err, "HomeDir should have returned an error but did not")
+				return
+			}
+			require.NoError(t, err, "HomeDir should have not have errored out but did")
+			require.Equal(t, tc.want, got, "Should get expected parsed path but did not")
+		})
+	}
+}
@@ -1,6 +1,8 @@
 // Package user contains some helpers for user normalization.
 package user
 
+//go:generate go run generate-nss-tables.go ../../nss/src/user/tables.rs tables.go
+
 import (
 	"bufio"
 	"fmt"
@@ -9,12 +11,130 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"unicode"
+
+	"github.com/ubuntu/aad-auth/internal/i18n"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// downLevelSeparator separates the NetBIOS domain name from the user name in down-level logon names.
+	downLevelSeparator = `\`
+	// validSpecialChars are the characters, other than letters and digits, which are valid in POSIX user names.
+	validSpecialChars = "._-@+#'!^~"
+	// defaultInvalidCharsReplacement is the default replacement for invalid characters in POSIX user names.
+	defaultInvalidCharsReplacement = "_"
+	// guestMarker separates the external identity from the tenant domain in the UPN of Azure AD B2B guest users.
+	// It is case folded, as UPNs are only compared once normalized.
+	guestMarker = "#ext#@"
 )
 
-// NormalizeName returns a normalized, lowercase version of the username as
-// AnYCaSe@DomAIN is accepted by aad.
-func NormalizeName(name string) string {
-	return strings.ToLower(name)
+type options struct {
+	netBIOSDomains          map[string]string
+	invalidCharsReplacement string
+}
+
+// Option represents the functional option passed to the name normalisation functions.
+type Option func(*options)
+
+// WithNetBIOSDomains maps NetBIOS domain names, case insensitively, to domains.
+// It is used to convert down-level logon names like CONTOSO\user to user@contoso.com.
+func WithNetBIOSDomains(domains map[string]string) Option {
+	return func(o *options) {
+		o.netBIOSDomains = make(map[string]string, len(domains))
+		for netBIOS, domain := range domains {
+			o.netBIOSDomains[cases.Fold().String(netBIOS)] = domain
+		}
+	}
+}
+
+// WithInvalidCharsReplacement overrides the string replacing invalid characters in POSIX user names.
+// An empty replacement makes names with invalid characters an error.
+func WithInvalidCharsReplacement(replacement string) Option {
+	return func(o *options) {
+		o.invalidCharsReplacement = replacement
+	}
+}
+
+// NormalizeName returns a normalized version of the username as AnYCaSe@DomAIN is accepted by aad.
+// Down-level logon names of known NetBIOS domains are converted to user@domain, the name is case folded
+// and converted to the Unicode Normalization Form C.
+// The returned name is the one to authenticate against Azure AD.
+func NormalizeName(name string, opts ...Option) string {
+	o := newOptions(opts...)
+
+	name = norm.NFC.String(name)
+
+	// Convert down-level logon names.
+	if netBIOS, u, found := strings.Cut(name, downLevelSeparator); found && !strings.Contains(name, "@") {
+		if domain, ok := o.netBIOSDomains[cases.Fold().String(netBIOS)]; ok {
+			name = u + "@" + domain
+		}
+	}
+
+	// Case folding can produce decomposed characters.
+	return norm.NFC.String(cases.Fold().String(name))
+}
+
+// GuestName returns the friendly name of an Azure AD B2B guest user from its normalized UPN, like bob_gmail.com
+// for bob_gmail.com#ext#@contoso.onmicrosoft.com. ok is false if upn is not the one of a guest user.
+func GuestName(upn string) (name string, ok bool) {
+	name, _, found := strings.Cut(upn, guestMarker)
+	if !found || name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+// PosixName returns the normalized username, with characters which are invalid in POSIX user names replaced.
+// Valid characters are letters, digits and ._-@+#'!^~ with the exception of a leading -.
+// Azure AD B2B guest users are named after their friendly name, as returned by GuestName.
+// The returned name is the one to store in the cache and to look up.
+func PosixName(name string, opts ...Option) (string, error) {
+	o := newOptions(opts...)
+
+	name = NormalizeName(name, opts...)
+	if guest, ok := GuestName(name); ok {
+		name = guest
+	}
+
+	var b strings.Builder
+	var invalid bool
+	for i, r := range name {
+		if unicode.Is(letterMarkDigit, r) || (strings.ContainsRune(validSpecialChars, r) && (i > 0 || r != '-')) {
+			b.WriteRune(r)
+			continue
+		}
+		invalid = true
+		b.WriteString(o.invalidCharsReplacement)
+	}
+	if invalid && o.invalidCharsReplacement == "" {
+		return "", fmt.Errorf(i18n.G("%q contains characters which are invalid in user names"), name)
+	}
+
+	return b.String(), nil
+}
+
+// ValidateInvalidCharsReplacement returns an error if replacement can't replace invalid characters in POSIX user
+// names: it must only contain valid characters, which are left unchanged by the normalisation.
+func ValidateInvalidCharsReplacement(replacement string) error {
+	for _, n := range []string{replacement, "a" + replacement} {
+		if got, err := PosixName(n, WithInvalidCharsReplacement("")); err != nil || got != n {
+			return fmt.Errorf(i18n.G("%q can't replace invalid characters in user names"), replacement)
+		}
+	}
+	return nil
+}
+
+func newOptions(opts ...Option) options {
+	o := options{
+		invalidCharsReplacement: defaultInvalidCharsReplacement,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
 }
 
 // IsBusy returns an error if the given UID is in use by any running process.
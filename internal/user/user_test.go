@@ -1,35 +1,318 @@
 package user_test
 
 import (
+	"context"
+	"flag"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"testing"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/config"
+	"github.com/ubuntu/aad-auth/internal/testutils"
 	"github.com/ubuntu/aad-auth/internal/user"
+	"golang.org/x/text/cases"
 )
 
 func TestNormalizeName(t *testing.T) {
 	t.Parallel()
 
 	tests := map[string]struct {
-		name string
+		name           string
+		netBIOSDomains map[string]string
+
 		want string
 	}{
 		"name with mixed case is lowercase": {name: "fOo@dOmAiN.com", want: "foo@domain.com"},
 		"lowercase named is unchanged":      {name: "foo@domain.com", want: "foo@domain.com"},
+
+		// Unicode
+		"name is case folded":                   {name: "STRAẞE@domain.com", want: "strasse@domain.com"},
+		"non ascii name is case folded":         {name: "ÉLODIE@domain.com", want: "élodie@domain.com"},
+		"decomposed name is composed":           {name: "e\u0301lodie@domain.com", want: "élodie@domain.com"},
+		"decomposed uppercase name is composed": {name: "E\u0301LODIE@domain.com", want: "élodie@domain.com"},
+		"composed name is unchanged":            {name: "\u00e9lodie@domain.com", want: "élodie@domain.com"},
+
+		// Down-level logon names
+		"down-level name of known domain is converted":         {name: `CONTOSO\Alice`, netBIOSDomains: map[string]string{"CONTOSO": "contoso.com"}, want: "alice@contoso.com"},
+		"down-level domain is matched case insensitively":      {name: `Contoso\alice`, netBIOSDomains: map[string]string{"CONTOSO": "Contoso.com"}, want: "alice@contoso.com"},
+		"down-level name of unknown domain is kept":            {name: `FABRIKAM\alice`, netBIOSDomains: map[string]string{"CONTOSO": "contoso.com"}, want: `fabrikam\alice`},
+		"down-level name without any known domain is kept":     {name: `CONTOSO\alice`, want: `contoso\alice`},
+		"name with backslash and domain is not down-level one": {name: `CONTOSO\alice@domain.com`, netBIOSDomains: map[string]string{"CONTOSO": "contoso.com"}, want: `contoso\alice@domain.com`},
 	}
 	for name, tc := range tests {
 		tc := tc
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 
-			got := user.NormalizeName(tc.name)
+			got := user.NormalizeName(tc.name, user.WithNetBIOSDomains(tc.netBIOSDomains))
 			require.Equal(t, tc.want, got, "got expected normalized name")
+			require.Equal(t, got, user.NormalizeName(got, user.WithNetBIOSDomains(tc.netBIOSDomains)), "normalizing a normalized name should not change it")
+		})
+	}
+}
+
+func TestPosixName(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		name        string
+		replacement *string
+
+		want    string
+		wantErr bool
+	}{
+		"valid name is only normalized":          {name: "Foo@Domain.com", want: "foo@domain.com"},
+		"valid special characters are kept":      {name: "f.o-o_b+a'r!^~@domain.com", want: "f.o-o_b+a'r!^~@domain.com"},
+		"non ascii letters are kept":             {name: "Élodie@domain.com", want: "élodie@domain.com"},
+		"guest user gets its friendly name":      {name: "John_Contoso.com#EXT#@domain.onmicrosoft.com", want: "john_contoso.com"},
+		"guest marker not before domain is kept": {name: "john#EXT#foo@domain.com", want: "john#ext#foo@domain.com"},
+
+		// Replacement
+		"invalid characters are replaced":                   {name: "foo bar:baz/qux,quux@domain.com", want: "foo_bar_baz_qux_quux@domain.com"},
+		"control characters are replaced":                   {name: "foo\tbar\n@domain.com", want: "foo_bar_@domain.com"},
+		"unknown down-level name separator is replaced":     {name: `CONTOSO\alice`, want: "contoso_alice"},
+		"leading dash is replaced":                          {name: "-foo@domain.com", want: "_foo@domain.com"},
+		"invalid characters are replaced with custom":       {name: "foo bar@domain.com", replacement: ptr("."), want: "foo.bar@domain.com"},
+		"invalid characters are replaced with multiple":     {name: "foo bar@domain.com", replacement: ptr("__"), want: "foo__bar@domain.com"},
+		"valid name without replacement is only normalized": {name: "Foo@domain.com", replacement: ptr(""), want: "foo@domain.com"},
+
+		// Error cases
+		"error on invalid characters without replacement": {name: "foo bar@domain.com", replacement: ptr(""), wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var opts []user.Option
+			if tc.replacement != nil {
+				opts = append(opts, user.WithInvalidCharsReplacement(*tc.replacement))
+			}
+
+			got, err := user.PosixName(tc.name, opts...)
+			if tc.wantErr {
+				require.Error(t, err, "PosixName should have returned an error but hasn't")
+				return
+			}
+			require.NoError(t, err, "PosixName should not have returned an error but has")
+			require.Equal(t, tc.want, got, "PosixName should return the expected name")
+
+			// Round trip: the POSIX name is stable when normalized again.
+			require.Equal(t, got, user.NormalizeName(got), "normalizing a POSIX name should not change it")
+			again, err := user.PosixName(got, opts...)
+			require.NoError(t, err, "PosixName on a POSIX name should not return an error")
+			require.Equal(t, got, again, "PosixName on a POSIX name should not change it")
+		})
+	}
+}
+
+func TestGuestName(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		upn string
+
+		want   string
+		wantOk bool
+	}{
+		"guest user":                         {upn: "bob_gmail.com#ext#@contoso.onmicrosoft.com", want: "bob_gmail.com", wantOk: true},
+		"guest user with marker in its name": {upn: "bob#ext#_gmail.com#ext#@contoso.onmicrosoft.com", want: "bob#ext#_gmail.com", wantOk: true},
+		"member user is not a guest":         {upn: "bob@contoso.com"},
+		"marker not before domain":           {upn: "bob#ext#foo@contoso.com"},
+		"marker without external identity":   {upn: "#ext#@contoso.onmicrosoft.com"},
+		"marker is only matched once folded": {upn: "bob_gmail.com#EXT#@contoso.onmicrosoft.com"},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := user.GuestName(tc.upn)
+			require.Equal(t, tc.wantOk, ok, "GuestName should detect guest users")
+			require.Equal(t, tc.want, got, "GuestName should return the expected friendly name")
 		})
 	}
 }
 
+// TestNameNormalizationParity normalizes names with the configured options. The golden files are also the
+// expectations of the NSS module tests, so that both implementations normalize names the same way.
+func TestNameNormalizationParity(t *testing.T) {
+	t.Parallel()
+
+	names := []string{
+		"fOo@dOmAiN.com",
+		"f.o-o_b+a'r!^~@domain.com",
+		// Case folding and composition
+		"STRAẞE@domain.com",
+		"E\u0301LODIE@domain.com",
+		"a\u0308\u0301@domain.com",
+		"ǅemal@domain.com",
+		"ΣΊΣΥΦΟΣ@domain.com",
+		"İstanbul@domain.com",
+		"ﬁle@domain.com",
+		"Ｆｕｌｌ@domain.com",
+		"\u212bngstr\u00f6m@domain.com",
+		"ᾼ@domain.com",
+		// Down-level logon names
+		`CONTOSO\Alice`,
+		`contoso\ALICE`,
+		`FABRIKAM\bob`,
+		`UNKNOWN\carol`,
+		`CONTOSO\alice@domain.com`,
+		// Guest users
+		"John_Contoso.com#EXT#@domain.onmicrosoft.com",
+		"#EXT#@domain.onmicrosoft.com",
+		// Letters, marks and digits
+		"١٢٣@domain.com",
+		"Ⅻ@domain.com",
+		"x²@domain.com",
+		"ﾊﾟ@domain.com",
+		"user\u200d@domain.com",
+		"😀@domain.com",
+		// Invalid characters
+		"foo bar:baz/qux@domain.com",
+		"foo\tbar@domain.com",
+		"-foo@domain.com",
+	}
+
+	tests := map[string]struct {
+		configFile string
+	}{
+		"default normalization":                {configFile: "default.conf"},
+		"with NetBIOS domains and replacement": {configFile: "netbios-domains.conf"},
+		"without replacement":                  {configFile: "no-replacement.conf"},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := config.Parse(context.Background(), filepath.Join("testdata", "TestNameNormalizationParity", tc.configFile))
+			require.NoError(t, err, "Setup: could not parse configuration")
+			opts := c.NameNormalization.UserOptions()
+
+			type normalizedName struct {
+				Name       string
+				Normalized string
+				Posix      string
+				Invalid    bool
+			}
+			var got []normalizedName
+			for _, n := range names {
+				posix, err := user.PosixName(n, opts...)
+				got = append(got, normalizedName{Name: n, Normalized: user.NormalizeName(n, opts...), Posix: posix, Invalid: err != nil})
+			}
+
+			want := testutils.LoadYAMLWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "Names should be normalized as in the golden file")
+		})
+	}
+}
+
+// TestNSSTables checks that the tables of the NSS module are the ones of PosixName, so that a regeneration with
+// only one of them updated is caught.
+func TestNSSTables(t *testing.T) {
+	t.Parallel()
+
+	src, err := os.ReadFile(filepath.Join("..", "..", "nss", "src", "user", "tables.rs"))
+	require.NoError(t, err, "Setup: could not read the NSS tables")
+
+	char := `'\\u\{([0-9a-f]+)\}'`
+	var rustRanges [][2]rune
+	for _, m := range regexp.MustCompile(`\(`+char+`, `+char+`\)`).FindAllStringSubmatch(string(src), -1) {
+		rustRanges = append(rustRanges, [2]rune{parseHexRune(t, m[1]), parseHexRune(t, m[2])})
+	}
+	var goRanges [][2]rune
+	for _, r := range user.LetterMarkDigit.R16 {
+		goRanges = appendRange(goRanges, rune(r.Lo), rune(r.Hi))
+	}
+	for _, r := range user.LetterMarkDigit.R32 {
+		goRanges = appendRange(goRanges, rune(r.Lo), rune(r.Hi))
+	}
+	require.Equal(t, goRanges, rustRanges, "Letters, marks and digits should be the same in the NSS module")
+
+	rustFold := make(map[rune]string)
+	for _, m := range regexp.MustCompile(char+`, "((?:\\u\{[0-9a-f]+\})+)"`).FindAllStringSubmatch(string(src), -1) {
+		var folded []rune
+		for _, f := range regexp.MustCompile(`[0-9a-f]+`).FindAllString(m[2], -1) {
+			folded = append(folded, parseHexRune(t, f))
+		}
+		rustFold[parseHexRune(t, m[1])] = string(folded)
+	}
+	goFold := make(map[rune]string)
+	fold := cases.Fold()
+	for r := rune(0); r <= unicode.MaxRune; r++ {
+		if !utf8.ValidRune(r) {
+			continue
+		}
+		if folded := fold.String(string(r)); folded != string(r) {
+			goFold[r] = folded
+		}
+	}
+	require.Equal(t, goFold, rustFold, "Case folding should be the same in the NSS module")
+}
+
+// appendRange appends the range lo-hi to ranges, merging it with the last one if they are contiguous.
+func appendRange(ranges [][2]rune, lo, hi rune) [][2]rune {
+	if len(ranges) > 0 && ranges[len(ranges)-1][1] == lo-1 {
+		ranges[len(ranges)-1][1] = hi
+		return ranges
+	}
+	return append(ranges, [2]rune{lo, hi})
+}
+
+// parseHexRune returns the rune of the hexadecimal code point s.
+func parseHexRune(t *testing.T, s string) rune {
+	t.Helper()
+
+	r, err := strconv.ParseInt(s, 16, 32)
+	require.NoError(t, err, "Setup: invalid code point in the NSS tables")
+	return rune(r)
+}
+
+func TestValidateInvalidCharsReplacement(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		replacement string
+
+		wantErr bool
+	}{
+		"empty replacement":            {replacement: ""},
+		"underscore":                   {replacement: "_"},
+		"multiple valid characters":    {replacement: "x_"},
+		"dash not in leading position": {replacement: "_-"},
+
+		// Error cases
+		"error on invalid character":            {replacement: ":", wantErr: true},
+		"error on uppercase character":          {replacement: "X", wantErr: true},
+		"error on leading dash":                 {replacement: "-", wantErr: true},
+		"error on decomposed unicode character": {replacement: "e\u0301", wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := user.ValidateInvalidCharsReplacement(tc.replacement)
+			if tc.wantErr {
+				require.Error(t, err, "ValidateInvalidCharsReplacement should have returned an error but hasn't")
+				return
+			}
+			require.NoError(t, err, "ValidateInvalidCharsReplacement should not have returned an error but has")
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
 func TestIsBusy(t *testing.T) {
 	t.Parallel()
 
@@ -78,3 +361,9 @@ func TestIsBusy(t *testing.T) {
 		})
 	}
 }
+
+func TestMain(m *testing.M) {
+	testutils.InstallUpdateFlag()
+	flag.Parse()
+	m.Run()
+}
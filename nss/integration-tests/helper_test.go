@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/aad-auth/internal/daemon"
 	"github.com/ubuntu/aad-auth/internal/testutils"
 )
 
@@ -21,8 +23,9 @@ var rustCovEnv []string
 var libPath string
 
 // outNSSCommandForLib returns the specific part for the nss command, filtering originOut.
-// It uses the locally build aad nss module for the integration tests.
-func outNSSCommandForLib(t *testing.T, rootUID, rootGID, shadowMode int, cacheDir string, originOut string, cmds ...string) (got string, err error) {
+// It uses the locally build aad nss module for the integration tests, which connects to aad-authd on socketPath if
+// it is listening.
+func outNSSCommandForLib(t *testing.T, rootUID, rootGID, shadowMode int, cacheDir, socketPath string, originOut string, cmds ...string) (got string, err error) {
 	t.Helper()
 
 	// #nosec:G204 - we control the command arguments in tests
@@ -34,6 +37,7 @@ func outNSSCommandForLib(t *testing.T, rootUID, rootGID, shadowMode int, cacheDi
 		fmt.Sprintf("NSS_AAD_ROOT_GID=%d", rootGID),
 		fmt.Sprintf("NSS_AAD_SHADOW_GID=%d", rootGID),
 		fmt.Sprintf("NSS_AAD_CACHEDIR=%s", cacheDir),
+		fmt.Sprintf("NSS_AAD_SOCKET=%s", socketPath),
 		// nss needs both LD_PRELOAD and LD_LIBRARY_PATH to load the nss module lib
 		fmt.Sprintf("LD_PRELOAD=%s:%s", libPath, os.Getenv("LD_PRELOAD")),
 		fmt.Sprintf("LD_LIBRARY_PATH=%s:%s", filepath.Dir(libPath), os.Getenv("LD_LIBRARY_PATH")),
@@ -95,3 +99,28 @@ func buildRustNSSLib(t *testing.T) {
 	err = os.Symlink(filepath.Join(target, "debug", "libnss_aad.so"), libPath)
 	require.NoError(t, err, "Setup: failed to create versioned link to the library")
 }
+
+// startDaemon serves the cache in cacheDir with aad-authd on a new socket, whose path is returned.
+// The current user is allowed to read shadow entries only if privileged is true.
+func startDaemon(t *testing.T, cacheDir string, privileged bool) string {
+	t.Helper()
+
+	rootUID, shadowGID := 4242, 4242
+	if privileged {
+		rootUID, shadowGID = testutils.GetCurrentUIDGID(t)
+	}
+
+	socket := testutils.TempSocketPath(t)
+	s, err := daemon.New(context.Background(), socket, daemon.WithCacheOptions(testutils.CacheOptionsForTests(t, cacheDir)),
+		daemon.WithRootUID(rootUID), daemon.WithShadowGID(shadowGID))
+	require.NoError(t, err, "Setup: could not create aad-authd server")
+
+	served := make(chan error)
+	go func() { served <- s.Serve(context.Background()) }()
+	t.Cleanup(func() {
+		require.NoError(t, s.Stop(context.Background()), "Teardown: could not stop aad-authd server")
+		require.NoError(t, <-served, "Teardown: Serve should return without error once stopped")
+	})
+
+	return socket
+}
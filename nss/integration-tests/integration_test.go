@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -32,6 +33,10 @@ func TestIntegration(t *testing.T) {
 		cacheDB    string
 		rootUID    int
 		shadowMode *int
+		// daemon serves the cache with aad-authd, unprivileged if daemonUnprivileged is set, while the module
+		// has no cache to read directly.
+		daemon             bool
+		daemonUnprivileged bool
 
 		wantErr bool
 	}{
@@ -98,6 +103,18 @@ func TestIntegration(t *testing.T) {
 		"returns nothing when listing group without permission on cache":  {db: "group", rootUID: 4242},
 		"returns nothing when listing shadow without permission on cache": {db: "shadow", rootUID: 4242},
 
+		// List entries through aad-authd
+		"list entry from passwd by name through aad-authd":               {db: "passwd", key: "myuser@domain.com", daemon: true},
+		"list entry from passwd with capitalized name through aad-authd": {db: "passwd", key: "MyUser@Domain.Com", daemon: true},
+		"list entry from group by gid through aad-authd":                 {db: "group", key: "165119649", daemon: true},
+		"list entry from shadow by name through aad-authd":               {db: "shadow", key: "myuser@domain.com", daemon: true},
+		"list passwd through aad-authd":                                  {db: "passwd", daemon: true},
+		"list group through aad-authd":                                   {db: "group", daemon: true},
+		"list shadow through aad-authd":                                  {db: "shadow", daemon: true},
+
+		"error when listing entry from shadow through aad-authd without access": {db: "shadow", key: "myuser@domain.com", daemon: true, daemonUnprivileged: true, wantErr: true},
+		"returns nothing when listing shadow through aad-authd without access":  {db: "shadow", daemon: true, daemonUnprivileged: true},
+
 		// Error when trying to list from unsupported database
 		"error on trying to list entry by name from unsupported db": {db: "unsupported", key: "myuser@domain.com", wantErr: true},
 		"error on trying to list unsupported db":                    {db: "unsupported", wantErr: true},
@@ -131,6 +148,13 @@ func TestIntegration(t *testing.T) {
 				t.Fatalf("Unexpected value used for cacheDB: %q", tc.cacheDB)
 			}
 
+			// Without aad-authd, the module falls back to reading the cache directly.
+			socket := filepath.Join(cacheDir, "aad-authd.sock")
+			if tc.daemon {
+				socket = startDaemon(t, cacheDir, !tc.daemonUnprivileged)
+				cacheDir = t.TempDir()
+			}
+
 			shadowMode := -1
 			if tc.shadowMode != nil {
 				shadowMode = *tc.shadowMode
@@ -143,7 +167,7 @@ func TestIntegration(t *testing.T) {
 				cmds = append(cmds, tc.key)
 			}
 
-			got, err := outNSSCommandForLib(t, uid, gid, shadowMode, cacheDir, originOuts[tc.db], cmds...)
+			got, err := outNSSCommandForLib(t, uid, gid, shadowMode, cacheDir, socket, originOuts[tc.db], cmds...)
 			if tc.wantErr {
 				require.Error(t, err, "Expected an error but got none: %v", got)
 				return
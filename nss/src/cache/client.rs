@@ -0,0 +1,319 @@
+use serde::{de::DeserializeOwned, Deserialize, Serialize};
+use std::{
+    cell::{Cell, RefCell},
+    io::{self, BufRead, BufReader, Write},
+    os::unix::net::UnixStream,
+    time::Duration,
+};
+
+use super::{by_name_or_upn, CacheError, Group, Passwd, Shadow};
+use crate::debug;
+use crate::user::NameNormalization;
+
+pub const SOCKET_PATH: &str = "/run/aad/aad-authd.sock"; // Must match DefaultSocketPath in internal/consts.
+const SERVICE_NAME: &str = "Cache"; // Must match serviceName in internal/daemon.
+const ERR_NO_ENT: &str = "[ENOENT]"; // Must match the code of cache.ErrNoEnt in internal/daemon.
+const TIMEOUT: Duration = Duration::from_secs(5); // Same as dialTimeout in internal/daemon.
+
+/// RpcRequest struct represents a request of the JSON-RPC codec of Go net/rpc, which takes a single parameter.
+#[derive(Serialize)]
+struct RpcRequest<P> {
+    method: String,
+    params: [P; 1],
+    id: u64,
+}
+
+/// RpcResponse struct represents a response of the JSON-RPC codec of Go net/rpc. Only one of result and error is set.
+#[derive(Deserialize)]
+struct RpcResponse<R> {
+    id: u64,
+    result: Option<R>,
+    error: Option<String>,
+}
+
+/// Empty struct is the argument of requests without any. Must match Empty in internal/daemon.
+#[derive(Serialize)]
+struct Empty {}
+
+/// NameRequest struct is a request about a user or group name. Must match NameRequest in internal/daemon.
+#[derive(Serialize)]
+#[serde(rename_all = "PascalCase")]
+struct NameRequest<'a> {
+    name: &'a str,
+}
+
+/// IdRequest struct is a request about a user or group id. Must match IDRequest in internal/daemon.
+#[derive(Serialize)]
+struct IdRequest {
+    #[serde(rename = "ID")]
+    id: u32,
+}
+
+/// UserRecord struct represents the fields we use of a cache.UserRecord served by aad-authd.
+#[derive(Deserialize)]
+#[serde(rename_all = "PascalCase")]
+struct UserRecord {
+    name: String,
+    passwd: String,
+    #[serde(rename = "UID")]
+    uid: u32,
+    #[serde(rename = "GID")]
+    gid: u32,
+    gecos: String,
+    home: String,
+    shell: String,
+}
+
+impl From<UserRecord> for Passwd {
+    fn from(u: UserRecord) -> Self {
+        Passwd {
+            name: u.name,
+            passwd: u.passwd,
+            uid: u.uid,
+            gid: u.gid,
+            gecos: u.gecos,
+            home: u.home,
+            shell: u.shell,
+        }
+    }
+}
+
+/// GroupRecord struct represents a cache.GroupRecord served by aad-authd.
+#[derive(Deserialize)]
+#[serde(rename_all = "PascalCase")]
+struct GroupRecord {
+    name: String,
+    password: String,
+    #[serde(rename = "GID")]
+    gid: u32,
+    members: Vec<String>,
+}
+
+impl From<GroupRecord> for Group {
+    fn from(g: GroupRecord) -> Self {
+        Group {
+            name: g.name,
+            passwd: g.password,
+            gid: g.gid,
+            members: g.members,
+        }
+    }
+}
+
+/// ShadowRecord struct represents a cache.ShadowRecord served by aad-authd.
+#[derive(Deserialize)]
+#[serde(rename_all = "PascalCase")]
+struct ShadowRecord {
+    name: String,
+    password: String,
+    last_pwd_change: isize,
+    min_pwd_age: isize,
+    max_pwd_age: isize,
+    pwd_warn_period: isize,
+    pwd_inactivity: isize,
+    expiration_date: isize,
+}
+
+impl From<ShadowRecord> for Shadow {
+    fn from(s: ShadowRecord) -> Self {
+        Shadow {
+            name: s.name,
+            passwd: s.password,
+            last_pwd_change: s.last_pwd_change,
+            min_pwd_age: s.min_pwd_age,
+            max_pwd_age: s.max_pwd_age,
+            pwd_warn_period: s.pwd_warn_period,
+            pwd_inactivity: s.pwd_inactivity,
+            expiration_date: s.expiration_date,
+        }
+    }
+}
+
+/// Client struct represents a connection to aad-authd, which serves the cache with the permissions of the caller.
+#[cfg_attr(test, derive(Debug))]
+pub struct Client {
+    conn: RefCell<BufReader<UnixStream>>,
+    next_id: Cell<u64>,
+
+    /// name_normalization converts the names looked up to the names users are stored under.
+    name_normalization: NameNormalization,
+}
+
+impl Client {
+    /// connect connects to aad-authd listening on socket_path. It returns None if the daemon is not running,
+    /// so that the cache databases are read directly instead.
+    pub fn connect(
+        socket_path: &str,
+        name_normalization: NameNormalization,
+    ) -> Result<Option<Client>, CacheError> {
+        let stream = match UnixStream::connect(socket_path) {
+            Ok(stream) => stream,
+            // A socket left behind by a daemon which is not running anymore refuses connections.
+            Err(err)
+                if matches!(
+                    err.kind(),
+                    io::ErrorKind::NotFound | io::ErrorKind::ConnectionRefused
+                ) =>
+            {
+                debug!("aad-authd is not running on {socket_path}: {err}");
+                return Ok(None);
+            }
+            Err(err) => {
+                return Err(CacheError::DatabaseError(format!(
+                    "could not connect to aad-authd on {socket_path}: {err}"
+                )))
+            }
+        };
+
+        if let Err(err) = stream
+            .set_read_timeout(Some(TIMEOUT))
+            .and_then(|_| stream.set_write_timeout(Some(TIMEOUT)))
+        {
+            return Err(CacheError::DatabaseError(err.to_string()));
+        }
+
+        debug!("connected to aad-authd on {socket_path}");
+        Ok(Some(Client {
+            conn: RefCell::new(BufReader::new(stream)),
+            next_id: Cell::new(0),
+            name_normalization,
+        }))
+    }
+
+    /* Passwd */
+    /// get_passwd_by_uid requests the passwd entry with matching uid.
+    pub fn get_passwd_by_uid(&self, uid: u32) -> Result<Passwd, CacheError> {
+        let u: UserRecord = self.call("GetUserByUID", IdRequest { id: uid })?;
+        Ok(u.into())
+    }
+
+    /// get_passwd_by_name requests the passwd entry with matching name or UPN.
+    pub fn get_passwd_by_name(&self, name: &str) -> Result<Passwd, CacheError> {
+        self.by_name_or_upn(name, |login| {
+            let u: UserRecord = self.call("GetUserByName", NameRequest { name: login })?;
+            Ok(u.into())
+        })
+    }
+
+    /// get_all_passwds requests all the passwd entries allowed by the enumeration policy of the daemon.
+    pub fn get_all_passwds(&self) -> Result<Vec<Passwd>, CacheError> {
+        let users: Vec<UserRecord> = self.call("GetAllUsers", Empty {})?;
+        Ok(users.into_iter().map(Passwd::from).collect())
+    }
+
+    /* Group */
+    /// get_group_by_gid requests the group entry with matching gid.
+    pub fn get_group_by_gid(&self, gid: u32) -> Result<Group, CacheError> {
+        let g: GroupRecord = self.call("GetGroupByGID", IdRequest { id: gid })?;
+        Ok(g.into())
+    }
+
+    /// get_group_by_name requests the group with matching name, or the group of the user with matching UPN.
+    pub fn get_group_by_name(&self, name: &str) -> Result<Group, CacheError> {
+        self.by_name_or_upn(name, |login| {
+            let g: GroupRecord = self.call("GetGroupByName", NameRequest { name: login })?;
+            Ok(g.into())
+        })
+    }
+
+    /// get_all_groups requests all the groups allowed by the enumeration policy of the daemon.
+    pub fn get_all_groups(&self) -> Result<Vec<Group>, CacheError> {
+        let groups: Vec<GroupRecord> = self.call("GetAllGroups", Empty {})?;
+        Ok(groups.into_iter().map(Group::from).collect())
+    }
+
+    /* Shadow */
+    /// get_shadow_by_name requests the shadow entry with matching name or UPN. The daemon only serves it to root
+    /// and the shadow group.
+    pub fn get_shadow_by_name(&self, name: &str) -> Result<Shadow, CacheError> {
+        self.by_name_or_upn(name, |login| {
+            let s: ShadowRecord = self.call("GetShadowByName", NameRequest { name: login })?;
+            Ok(s.into())
+        })
+    }
+
+    /// get_all_shadows requests all the shadow entries allowed by the enumeration policy of the daemon. The
+    /// daemon only serves them to root and the shadow group.
+    pub fn get_all_shadows(&self) -> Result<Vec<Shadow>, CacheError> {
+        let shadows: Vec<ShadowRecord> = self.call("GetAllShadows", Empty {})?;
+        Ok(shadows.into_iter().map(Shadow::from).collect())
+    }
+
+    /* Common */
+    /// by_name_or_upn calls get with the POSIX name users are stored under, and with the login of the user with
+    /// a matching UPN otherwise, as the cache databases are queried.
+    fn by_name_or_upn<T>(
+        &self,
+        name: &str,
+        get: impl Fn(&str) -> Result<T, CacheError>,
+    ) -> Result<T, CacheError> {
+        by_name_or_upn(&self.name_normalization, name, get, |upn| {
+            let u: UserRecord = self.call("GetUserByUPN", NameRequest { name: upn })?;
+            Ok(u.name)
+        })
+    }
+
+    /// call sends the request method of the cache service with params, and decodes its result. Errors of the
+    /// daemon reporting that the entry does not exist are returned as NoRecord.
+    fn call<P: Serialize, R: DeserializeOwned>(
+        &self,
+        method: &str,
+        params: P,
+    ) -> Result<R, CacheError> {
+        let id = self.next_id.get();
+        self.next_id.set(id + 1);
+
+        let req = RpcRequest {
+            method: format!("{SERVICE_NAME}.{method}"),
+            params: [params],
+            id,
+        };
+        let mut data = match serde_json::to_vec(&req) {
+            Ok(data) => data,
+            Err(err) => return Err(CacheError::QueryError(err.to_string())),
+        };
+        data.push(b'\n');
+
+        let mut conn = self.conn.borrow_mut();
+        if let Err(err) = conn.get_mut().write_all(&data) {
+            return Err(CacheError::DatabaseError(format!(
+                "could not send {method} to aad-authd: {err}"
+            )));
+        }
+
+        // Responses are encoded one per line.
+        let mut line = String::new();
+        if let Err(err) = conn.read_line(&mut line) {
+            return Err(CacheError::DatabaseError(format!(
+                "could not read {method} response from aad-authd: {err}"
+            )));
+        }
+
+        let resp: RpcResponse<R> = match serde_json::from_str(&line) {
+            Ok(resp) => resp,
+            Err(err) => {
+                return Err(CacheError::QueryError(format!(
+                    "invalid {method} response from aad-authd: {err}"
+                )))
+            }
+        };
+        if resp.id != id {
+            return Err(CacheError::QueryError(format!(
+                "unexpected response {} from aad-authd to request {id}",
+                resp.id
+            )));
+        }
+
+        match (resp.result, resp.error) {
+            (_, Some(err)) if err.starts_with(ERR_NO_ENT) => {
+                debug!("{err}");
+                Err(CacheError::NoRecord)
+            }
+            (_, Some(err)) => Err(CacheError::QueryError(err)),
+            (Some(result), None) => Ok(result),
+            (None, None) => Err(CacheError::QueryError(format!(
+                "empty {method} response from aad-authd"
+            ))),
+        }
+    }
+}
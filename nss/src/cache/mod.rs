@@ -1,5 +1,5 @@
 use faccess::PathExt;
-use rusqlite::{Connection, OpenFlags, Rows, Statement};
+use rusqlite::{params_from_iter, Connection, OpenFlags, Rows, Statement};
 use serde::Serialize;
 use std::{
     fmt::Debug,
@@ -10,7 +10,12 @@ use std::{
 };
 use time::{Duration, OffsetDateTime};
 
+use crate::config::{self, Ini, CONFIG_PATH};
 use crate::debug;
+use crate::user::NameNormalization;
+
+mod client;
+use client::{Client, SOCKET_PATH};
 
 #[cfg(test)]
 #[allow(clippy::too_many_arguments)]
@@ -30,6 +35,11 @@ const DB_CONN_PREFIX: &str = "file:"; // Specify "file" as access mode, so that
 const DB_CONN_OPT_RW: &str = "?journal_mode=wal"; // Use Write Ahead Log journaling mode, so that we can operate paralell with the PAM module.
 const DB_CONN_OPT_RO: &str = "?immutable=1"; // When using immutable=1, we can still read the passwd_db, even if there is an db lock.
 
+const ENUMERATION_KEY: &str = "enumeration"; // Must match enumerationKey in internal/config.
+const INLINE_CACHE_CLEANUP_KEY: &str = "inline_cache_cleanup"; // Must match inlineCacheCleanupKey in internal/config.
+const ENUMERATE_ALL: &str = "all"; // Must match EnumerateAll in internal/cache.
+const ENUMERATE_NONE: &str = "none"; // Must match EnumerateNone in internal/cache.
+
 /// ShadowMode enum represents the status of the shadow database.
 #[derive(PartialEq, PartialOrd, Debug, Clone, Copy)]
 pub enum ShadowMode {
@@ -102,6 +112,102 @@ impl Debug for Shadow {
     }
 }
 
+/// Enumeration enum represents which users and groups are returned when listing all the entries.
+/// Lookups by name or id are not affected.
+#[derive(PartialEq, Debug, Clone)]
+pub enum Enumeration {
+    All,
+    None,
+    /// Only the listed users and the members of the listed groups are enumerated, with their groups.
+    Only(Vec<String>),
+}
+impl From<&str> for Enumeration {
+    /// from parses a policy in the format of the cache of the Go implementation, where names are already
+    /// normalized.
+    fn from(value: &str) -> Self {
+        match value {
+            "" | ENUMERATE_ALL => return Enumeration::All,
+            ENUMERATE_NONE => return Enumeration::None,
+            _ => (),
+        }
+        let names: Vec<String> = value
+            .split(',')
+            .map(str::trim)
+            .filter(|n| !n.is_empty())
+            .map(str::to_string)
+            .collect();
+        if names.is_empty() {
+            return Enumeration::None;
+        }
+        Enumeration::Only(names)
+    }
+}
+
+impl Enumeration {
+    /// from_config reads the enumeration policy from the default section of the configuration and
+    /// normalizes the listed names as user names. All entries are enumerated if the policy is not set or
+    /// invalid, or if the configuration can't be read, as for the Go implementation.
+    fn from_config(ini: Option<&Ini>, normalization: &NameNormalization) -> Enumeration {
+        let Some(value) = ini.and_then(|ini| ini.get("", ENUMERATION_KEY)) else {
+            return Enumeration::All;
+        };
+
+        let names: Vec<&str> = value
+            .split(',')
+            .map(str::trim)
+            .filter(|n| !n.is_empty())
+            .collect();
+        if names.is_empty() {
+            debug!("no user or group listed in enumeration policy, enumerating all entries");
+            return Enumeration::All;
+        }
+        if let [n @ (ENUMERATE_ALL | ENUMERATE_NONE)] = names.as_slice() {
+            return Enumeration::from(*n);
+        }
+        if names
+            .iter()
+            .any(|n| [ENUMERATE_ALL, ENUMERATE_NONE].contains(n))
+        {
+            debug!("invalid enumeration policy {value:?}, enumerating all entries");
+            return Enumeration::All;
+        }
+
+        match names
+            .iter()
+            .map(|n| normalization.posix_name(n))
+            .collect::<Result<Vec<String>, String>>()
+        {
+            Ok(names) => Enumeration::from(names.join(",").as_str()),
+            Err(err) => {
+                debug!("invalid enumeration policy {value:?}, enumerating all entries: {err}");
+                Enumeration::All
+            }
+        }
+    }
+
+    /// filter returns the SQL condition on uid_column restricting the enumeration to the allowed users,
+    /// with its parameters.
+    fn filter(&self, uid_column: &str) -> (String, Vec<String>) {
+        match self {
+            Enumeration::All => ("1".to_string(), vec![]),
+            Enumeration::None => ("0".to_string(), vec![]),
+            Enumeration::Only(names) => {
+                let placeholders = vec!["?"; names.len()].join(",");
+                (
+                    format!(
+                        "{uid_column} IN (
+                            SELECT uid FROM passwd WHERE login IN ({placeholders})
+                            UNION
+                            SELECT uid FROM uid_gid WHERE gid IN (SELECT gid FROM groups WHERE name IN ({placeholders}))
+                        )"
+                    ),
+                    [names.clone(), names.clone()].concat(),
+                )
+            }
+        }
+    }
+}
+
 /// CacheError enum represents the list of errors supported by the cache.
 #[derive(Debug)]
 pub enum CacheError {
@@ -111,6 +217,108 @@ pub enum CacheError {
     NoRecord,
 }
 
+/// inline_cache_cleanup_from_config returns whether expired users are purged when the cache is opened,
+/// instead of only by aad-cli cache gc. It is disabled if the value is not set or invalid.
+fn inline_cache_cleanup_from_config(ini: Option<&Ini>) -> bool {
+    ini.and_then(|ini| ini.get("", INLINE_CACHE_CLEANUP_KEY))
+        .and_then(config::parse_bool)
+        .unwrap_or(false)
+}
+
+/// load_config loads the configuration and its name normalization options. The configuration is None if
+/// it can't be read or if the name normalization is invalid, which makes the whole configuration invalid
+/// as for the Go implementation.
+fn load_config(path: &str) -> (Option<Ini>, NameNormalization) {
+    let ini = match Ini::load(path) {
+        Ok(ini) => ini,
+        Err(err) => {
+            debug!("could not load configuration, using defaults: {err:?}");
+            return (None, NameNormalization::default());
+        }
+    };
+    match NameNormalization::from_config(&ini) {
+        Ok(n) => (Some(ini), n),
+        Err(err) => {
+            debug!("invalid configuration, using defaults: {err}");
+            (None, NameNormalization::default())
+        }
+    }
+}
+
+/// Cache enum represents where the entries are read from: aad-authd when it is running, so that the cache is
+/// served with the permissions of the caller, and the cache databases otherwise.
+#[cfg_attr(test, derive(Debug))]
+pub enum Cache {
+    Daemon(Client),
+    Database(CacheDB),
+}
+
+impl Cache {
+    /// get_passwd_by_uid returns the passwd entry with matching uid.
+    pub fn get_passwd_by_uid(&self, uid: u32) -> Result<Passwd, CacheError> {
+        match self {
+            Cache::Daemon(c) => c.get_passwd_by_uid(uid),
+            Cache::Database(db) => db.get_passwd_by_uid(uid),
+        }
+    }
+
+    /// get_passwd_by_name returns the passwd entry with matching name or UPN.
+    pub fn get_passwd_by_name(&self, name: &str) -> Result<Passwd, CacheError> {
+        match self {
+            Cache::Daemon(c) => c.get_passwd_by_name(name),
+            Cache::Database(db) => db.get_passwd_by_name(name),
+        }
+    }
+
+    /// get_all_passwds returns all the enumerated passwd entries.
+    pub fn get_all_passwds(&self) -> Result<Vec<Passwd>, CacheError> {
+        match self {
+            Cache::Daemon(c) => c.get_all_passwds(),
+            Cache::Database(db) => db.get_all_passwds(),
+        }
+    }
+
+    /// get_group_by_gid returns the group entry with matching gid.
+    pub fn get_group_by_gid(&self, gid: u32) -> Result<Group, CacheError> {
+        match self {
+            Cache::Daemon(c) => c.get_group_by_gid(gid),
+            Cache::Database(db) => db.get_group_by_gid(gid),
+        }
+    }
+
+    /// get_group_by_name returns the group with matching name, or the group of the user with matching UPN.
+    pub fn get_group_by_name(&self, name: &str) -> Result<Group, CacheError> {
+        match self {
+            Cache::Daemon(c) => c.get_group_by_name(name),
+            Cache::Database(db) => db.get_group_by_name(name),
+        }
+    }
+
+    /// get_all_groups returns all the enumerated groups.
+    pub fn get_all_groups(&self) -> Result<Vec<Group>, CacheError> {
+        match self {
+            Cache::Daemon(c) => c.get_all_groups(),
+            Cache::Database(db) => db.get_all_groups(),
+        }
+    }
+
+    /// get_shadow_by_name returns the shadow entry with matching name or UPN.
+    pub fn get_shadow_by_name(&self, name: &str) -> Result<Shadow, CacheError> {
+        match self {
+            Cache::Daemon(c) => c.get_shadow_by_name(name),
+            Cache::Database(db) => db.get_shadow_by_name(name),
+        }
+    }
+
+    /// get_all_shadows returns all the enumerated shadow entries.
+    pub fn get_all_shadows(&self) -> Result<Vec<Shadow>, CacheError> {
+        match self {
+            Cache::Daemon(c) => c.get_all_shadows(),
+            Cache::Database(db) => db.get_all_shadows(),
+        }
+    }
+}
+
 /// CacheDB struct represents the cache database.
 #[cfg_attr(test, derive(Debug))]
 pub struct CacheDB {
@@ -124,6 +332,12 @@ pub struct CacheDB {
     /// from offline authentication and purged from the cache if the days without online authentication
     /// exceed twice this ammount.
     offline_credentials_expiration: i32,
+
+    /// enumeration restricts the users and groups returned by the get_all_* functions.
+    enumeration: Enumeration,
+
+    /// name_normalization converts the names looked up to the names users are stored under.
+    name_normalization: NameNormalization,
 }
 
 /// CacheDBBuilder struct is the struct for the builder pattern and change the parameters of the cache.
@@ -149,6 +363,14 @@ pub struct CacheDBBuilder {
     passwd_perms: Permissions,
     /// shadow_perms is the default expected permissions for the shadow db file.
     shadow_perms: Permissions,
+    /// enumeration restricts the users and groups returned when listing all entries.
+    enumeration: Enumeration,
+    /// cleanup_on_open purges the expired users when the cache is opened with write access.
+    cleanup_on_open: bool,
+    /// name_normalization converts the names looked up to the names users are stored under.
+    name_normalization: NameNormalization,
+    /// socket_path is the path of the socket aad-authd listens on.
+    socket_path: String,
 }
 
 /// DbFileInfo struct represents the expected ownership and permissions for the database file.
@@ -233,6 +455,43 @@ impl CacheDBBuilder {
         self
     }
 
+    // This is a function to be used in tests, so we need to annotate it.
+    #[cfg(any(feature = "integration-tests", test))]
+    /// with_enumeration overrides the enumeration policy read from the configuration.
+    pub fn with_enumeration(&mut self, policy: &str) -> &mut Self {
+        debug!("using custom enumeration policy '{policy}'");
+        self.enumeration = Enumeration::from(policy);
+        self
+    }
+
+    // This is a function to be used in tests, so we need to annotate it.
+    #[cfg(any(feature = "integration-tests", test))]
+    /// with_cleanup_on_open overrides whether expired users are purged when the cache is opened.
+    pub fn with_cleanup_on_open(&mut self, value: bool) -> &mut Self {
+        debug!("using custom cleanup on open '{value}'");
+        self.cleanup_on_open = value;
+        self
+    }
+
+    // This is a function to be used in tests, so we need to annotate it.
+    #[cfg(any(feature = "integration-tests", test))]
+    /// with_socket_path overrides the path of the socket aad-authd listens on.
+    pub fn with_socket_path(&mut self, socket_path: &str) -> &mut Self {
+        debug!("using custom socket path: {}", socket_path);
+        self.socket_path = socket_path.to_string();
+        self
+    }
+
+    /// open connects to aad-authd if it is running, and falls back to opening the cache databases only when
+    /// it is not.
+    pub fn open(&mut self) -> Result<Cache, CacheError> {
+        if let Some(c) = Client::connect(&self.socket_path, self.name_normalization.clone())? {
+            return Ok(Cache::Daemon(c));
+        }
+
+        Ok(Cache::Database(self.build()?))
+    }
+
     /// build initializes and opens a connection to the cache database.
     pub fn build(&mut self) -> Result<CacheDB, CacheError> {
         debug!("opening database connection from {}", self.db_path);
@@ -305,9 +564,9 @@ impl CacheDBBuilder {
         let passwd_db = &db_path.join(PASSWD_DB);
 
         let mut passwd_db_args = DB_CONN_OPT_RO;
-        if passwd_db.writable(){ 
+        if passwd_db.writable() {
             // db_path must also be writeable for 'journal_mode=wal';
-            if db_path.writable(){
+            if db_path.writable() {
                 passwd_db_args = DB_CONN_OPT_RW;
             }
         }
@@ -334,9 +593,11 @@ impl CacheDBBuilder {
             conn,
             shadow_mode,
             offline_credentials_expiration: self.offline_credentials_expiration,
+            enumeration: self.enumeration.clone(),
+            name_normalization: self.name_normalization.clone(),
         };
 
-        if shadow_mode >= ShadowMode::ReadWrite {
+        if self.cleanup_on_open && shadow_mode >= ShadowMode::ReadWrite {
             if let Err(err) = c.cleanup_expired_entries() {
                 return Err(CacheError::DatabaseError(err.to_string()));
             }
@@ -387,6 +648,7 @@ impl CacheDB {
     /// new creates a new CacheDBBuilder object.
     #[allow(clippy::new_ret_no_self)] // builder pattern
     pub fn new() -> CacheDBBuilder {
+        let (ini, name_normalization) = load_config(CONFIG_PATH);
         CacheDBBuilder {
             db_path: DB_PATH.to_string(),
             offline_credentials_expiration: OFFLINE_CREDENTIALS_EXPIRATION,
@@ -396,6 +658,10 @@ impl CacheDB {
             shadow_mode: ShadowMode::AutoDetect,
             passwd_perms: Permissions::from_mode(PASSWD_PERMS),
             shadow_perms: Permissions::from_mode(SHADOW_PERMS),
+            enumeration: Enumeration::from_config(ini.as_ref(), &name_normalization),
+            cleanup_on_open: inline_cache_cleanup_from_config(ini.as_ref()),
+            name_normalization,
+            socket_path: SOCKET_PATH.to_string(),
         }
     }
 
@@ -408,8 +674,15 @@ impl CacheDB {
             return Self::new();
         }
 
+        let db_path = std::env::var("NSS_AAD_CACHEDIR").unwrap();
         let mut builder = CacheDBBuilder {
-            db_path: std::env::var("NSS_AAD_CACHEDIR").unwrap(),
+            // There is no daemon listening in the cache directory, unless a test starts one.
+            socket_path: Path::new(&db_path)
+                .join("aad-authd.sock")
+                .to_str()
+                .unwrap()
+                .to_string(),
+            db_path,
             offline_credentials_expiration: OFFLINE_CREDENTIALS_EXPIRATION,
             root_uid: users::get_current_uid(),
             root_gid: users::get_current_gid(),
@@ -417,6 +690,9 @@ impl CacheDB {
             shadow_mode: ShadowMode::AutoDetect,
             passwd_perms: Permissions::from_mode(PASSWD_PERMS),
             shadow_perms: Permissions::from_mode(SHADOW_PERMS),
+            enumeration: Enumeration::All,
+            cleanup_on_open: false,
+            name_normalization: NameNormalization::default(),
         };
 
         if let Ok(v) = std::env::var("NSS_AAD_SHADOW_MODE") {
@@ -444,13 +720,18 @@ impl CacheDB {
         Self::expect_one_row(&mut entries)
     }
 
-    /// get_passwd_by_name queries the database for a passwd row with matching name.
-    pub fn get_passwd_by_name(&self, login: &str) -> Result<Passwd, CacheError> {
+    /// get_passwd_by_name queries the database for a passwd row with matching name or UPN.
+    pub fn get_passwd_by_name(&self, name: &str) -> Result<Passwd, CacheError> {
+        self.by_name_or_upn(name, |login| self.get_passwd_by_login(login))
+    }
+
+    /// get_passwd_by_login queries the database for a passwd row with matching login.
+    fn get_passwd_by_login(&self, login: &str) -> Result<Passwd, CacheError> {
         let mut stmt = self.prepare_statement(
             "SELECT login, password, uid, gid, gecos, home, shell FROM passwd WHERE login = ?", // Last empty field is the shadow password
         )?;
 
-        let rows = match stmt.query([&Self::normalize_username(login)]) {
+        let rows = match stmt.query([login]) {
             Ok(rows) => rows,
             Err(err) => return Err(CacheError::QueryError(err.to_string())),
         };
@@ -462,11 +743,12 @@ impl CacheDB {
 
     /// get_all_passwds queries the database for all passwd rows.
     pub fn get_all_passwds(&self) -> Result<Vec<Passwd>, CacheError> {
-        let mut stmt = self.prepare_statement(
-            "SELECT login, password, uid, gid, gecos, home, shell FROM passwd ORDER BY login", // Last empty field is the shadow password
-        )?;
+        let (filter, params) = self.enumeration.filter("uid");
+        let mut stmt = self.prepare_statement(&format!(
+            "SELECT login, password, uid, gid, gecos, home, shell FROM passwd WHERE {filter} ORDER BY login", // Last empty field is the shadow password
+        ))?;
 
-        let rows = match stmt.query([]) {
+        let rows = match stmt.query(params_from_iter(params)) {
             Ok(rows) => rows,
             Err(err) => return Err(CacheError::QueryError(err.to_string())),
         };
@@ -500,8 +782,14 @@ impl CacheDB {
         Self::expect_one_row(&mut entries)
     }
 
-    /// get_group_by_name queries the database for a group with matching name.
+    /// get_group_by_name queries the database for a group with matching name, or for the group of the user with
+    /// matching UPN.
     pub fn get_group_by_name(self: &CacheDB, name: &str) -> Result<Group, CacheError> {
+        self.by_name_or_upn(name, |login| self.get_group_by_login(login))
+    }
+
+    /// get_group_by_login queries the database for a group with matching name.
+    fn get_group_by_login(self: &CacheDB, name: &str) -> Result<Group, CacheError> {
         // Nested query to avoid the case where the user is not found,
         // then all the values are NULL due to the call to GROUP_CONCAT
         let mut stmt = self.prepare_statement(
@@ -516,7 +804,7 @@ impl CacheDB {
             ",
         )?;
 
-        let rows = match stmt.query([&Self::normalize_username(name)]) {
+        let rows = match stmt.query([name]) {
             Ok(rows) => rows,
             Err(err) => return Err(CacheError::QueryError(err.to_string())),
         };
@@ -527,20 +815,23 @@ impl CacheDB {
 
     /// get_all_groups queries the database for all groups.
     pub fn get_all_groups(self: &CacheDB) -> Result<Vec<Group>, CacheError> {
-        let mut stmt = self.prepare_statement(
+        // Members which are not enumerated are not listed either.
+        let (filter, params) = self.enumeration.filter("u.uid");
+        let mut stmt = self.prepare_statement(&format!(
             "
             SELECT * FROM (
                 SELECT g.name, g.password, g.gid, group_concat(p.login, ',') as members
                 FROM groups g, uid_gid u, passwd p
                 WHERE u.gid = g.gid
                 AND p.uid = u.uid
+                AND {filter}
                 GROUP BY g.name
             ) WHERE name IS NOT NULL
             ORDER BY name
             ",
-        )?;
+        ))?;
 
-        let rows = match stmt.query([]) {
+        let rows = match stmt.query(params_from_iter(params)) {
             Ok(rows) => rows,
             Err(err) => return Err(CacheError::QueryError(err.to_string())),
         };
@@ -549,7 +840,7 @@ impl CacheDB {
     }
 
     /* Shadow */
-    /// get_shadow_by_name queries the database for a shadow row with matching name.
+    /// get_shadow_by_name queries the database for a shadow row with matching name or UPN.
     pub fn get_shadow_by_name(&self, name: &str) -> Result<Shadow, CacheError> {
         if self.shadow_mode < ShadowMode::ReadOnly {
             return Err(CacheError::DatabaseError(
@@ -557,6 +848,11 @@ impl CacheDB {
             ));
         }
 
+        self.by_name_or_upn(name, |login| self.get_shadow_by_login(login))
+    }
+
+    /// get_shadow_by_login queries the database for a shadow row with matching login.
+    fn get_shadow_by_login(&self, login: &str) -> Result<Shadow, CacheError> {
         let mut stmt = self.prepare_statement(
             "
             SELECT p.login, s.password, s.last_pwd_change, s.min_pwd_age, s.max_pwd_age, s.pwd_warn_period, s.pwd_inactivity, s.expiration_date
@@ -566,7 +862,7 @@ impl CacheDB {
             "
         )?;
 
-        let rows = match stmt.query([&Self::normalize_username(name)]) {
+        let rows = match stmt.query([login]) {
             Ok(rows) => rows,
             Err(err) => return Err(CacheError::QueryError(err.to_string())),
         };
@@ -584,16 +880,18 @@ impl CacheDB {
             ));
         }
 
-        let mut stmt = self.prepare_statement(
+        let (filter, params) = self.enumeration.filter("p.uid");
+        let mut stmt = self.prepare_statement(&format!(
             "
             SELECT p.login, s.password, s.last_pwd_change, s.min_pwd_age, s.max_pwd_age, s.pwd_warn_period, s.pwd_inactivity, s.expiration_date
             FROM passwd p, shadow.shadow s
             WHERE p.uid = s.uid
+            AND {filter}
             ORDER BY p.login
             "
-        )?;
+        ))?;
 
-        let rows = match stmt.query([]) {
+        let rows = match stmt.query(params_from_iter(params)) {
             Ok(rows) => rows,
             Err(err) => return Err(CacheError::QueryError(err.to_string())),
         };
@@ -720,8 +1018,64 @@ impl CacheDB {
         Ok(())
     }
 
-    /// normalize_username lowercases the username that is going to be used in a cache query.
-    fn normalize_username(username: &str) -> String {
-        username.to_lowercase()
+    /// by_name_or_upn calls get with the POSIX name users are stored under, or with the login of the user with
+    /// a matching UPN.
+    fn by_name_or_upn<T>(
+        &self,
+        name: &str,
+        get: impl Fn(&str) -> Result<T, CacheError>,
+    ) -> Result<T, CacheError> {
+        by_name_or_upn(&self.name_normalization, name, get, |upn| {
+            self.login_by_upn(upn)
+        })
+    }
+
+    /// login_by_upn returns the login of the user with the normalized user principal name upn.
+    fn login_by_upn(&self, upn: &str) -> Result<String, CacheError> {
+        // Caches created by previous versions are only upgraded by the PAM module, as we open them read only.
+        let mut stmt = self.prepare_statement(
+            "SELECT EXISTS(SELECT 1 FROM pragma_table_info('passwd') WHERE name = 'upn')",
+        )?;
+        let has_upn = stmt
+            .query_row([], |row| row.get::<_, bool>(0))
+            .map_err(|err| CacheError::QueryError(err.to_string()))?;
+        if !has_upn {
+            return Err(CacheError::NoRecord);
+        }
+
+        let mut stmt = self.prepare_statement("SELECT login FROM passwd WHERE upn = ?")?;
+        let mut rows = match stmt.query([upn]) {
+            Ok(rows) => rows,
+            Err(err) => return Err(CacheError::QueryError(err.to_string())),
+        };
+
+        let mut logins: Vec<String> = Vec::new();
+        while let Ok(Some(row)) = rows.next() {
+            logins.push(row.get(0).expect("invalid login"));
+        }
+        Self::expect_one_row(&mut logins)
+    }
+}
+
+/// by_name_or_upn calls get with the POSIX name users are stored under. Users cached with another name, like the
+/// ones normalized with other options, are then looked up by their UPN, as in internal/nss/passwd.
+fn by_name_or_upn<T>(
+    normalization: &NameNormalization,
+    name: &str,
+    get: impl Fn(&str) -> Result<T, CacheError>,
+    login_by_upn: impl Fn(&str) -> Result<String, CacheError>,
+) -> Result<T, CacheError> {
+    let res = match normalization.posix_name(name) {
+        Ok(login) => get(&login),
+        Err(err) => {
+            // Names which can't be normalized are not in the cache under their POSIX name.
+            debug!("{err}");
+            Err(CacheError::NoRecord)
+        }
+    };
+
+    match res {
+        Err(CacheError::NoRecord) => get(&login_by_upn(&normalization.normalize_name(name))?),
+        res => res,
     }
 }
@@ -1,8 +1,15 @@
+use serde_json::{json, Value};
+use std::collections::HashMap;
 use std::fs::{self, Permissions};
+use std::io::{BufRead, BufReader, Write};
+use std::os::unix::net::UnixListener;
 use std::os::unix::prelude::PermissionsExt;
+use std::path::Path;
+use std::thread;
 
 use test_case::test_case;
 
+use super::{inline_cache_cleanup_from_config, load_config, Cache, CacheError, Enumeration};
 use crate::testutils;
 use crate::CacheDB;
 
@@ -120,7 +127,11 @@ fn test_get_passwd_by_uid(
 }
 
 #[test_case("myuser@domain.com", Some("users_in_db".to_string()), -1, false; "Get existing user by name")]
+#[test_case("MyUser@Domain.COM", Some("users_in_db".to_string()), -1, false; "Get existing user by unnormalized name")]
 #[test_case("myuser@domain.com", Some("users_in_db".to_string()), 0, false; "Get existing user by name without access to shadow")]
+#[test_case("success_guest.com", Some("users_with_upn".to_string()), -1, false; "Get existing guest user by name")]
+#[test_case("Success_Guest.com#EXT#@otherdomain.com", Some("users_with_upn".to_string()), -1, false; "Get existing guest user by UPN")]
+#[test_case("Foo Bar@Domain.com", Some("users_with_upn".to_string()), -1, false; "Get existing user by UPN only")]
 #[test_case("does not exist", Some("users_in_db".to_string()), -1, true; "Error when user does not exist")]
 fn test_get_passwd_by_name(
     name: &str,
@@ -176,6 +187,7 @@ fn test_get_all_passwd(
         .with_root_gid(current_gid)
         .with_shadow_gid(current_gid)
         .with_offline_credentials_expiration(credentials_expiration)
+        .with_cleanup_on_open(true)
         .with_shadow_mode(force_shadow_mode)
         .build()
         .expect("Setup: could not create cache object");
@@ -227,6 +239,8 @@ fn test_get_group_by_gid(
 
 #[test_case("myuser@domain.com", Some("users_in_db".to_string()), -1, false; "Get existing group by name")]
 #[test_case("myuser@domain.com", Some("users_in_db".to_string()), 0, false; "Get existing group by name without access to shadow")]
+#[test_case("Success_Guest.com#EXT#@otherdomain.com", Some("users_with_upn".to_string()), -1, false; "Get existing group of guest user by UPN")]
+#[test_case("Foo Bar@Domain.com", Some("users_with_upn".to_string()), -1, false; "Get existing group of user by UPN only")]
 #[test_case("does not exist", Some("users_in_db".to_string()), -1, true; "Error when group does not exist")]
 fn test_get_group_by_name(
     name: &str,
@@ -283,6 +297,7 @@ fn test_get_all_groups(
         .with_root_gid(gid)
         .with_shadow_gid(gid)
         .with_offline_credentials_expiration(credentials_expiration)
+        .with_cleanup_on_open(true)
         .with_shadow_mode(force_shadow_mode)
         .build()
         .expect("Setup: could not create cache object");
@@ -298,6 +313,8 @@ fn test_get_all_groups(
 
 /* SHADOW TESTS */
 #[test_case("myuser@domain.com", Some("users_in_db".to_string()), -1, false ; "Get existing shadow by name")]
+#[test_case("Success_Guest.com#EXT#@otherdomain.com", Some("users_with_upn".to_string()), -1, false ; "Get existing shadow of guest user by UPN")]
+#[test_case("Foo Bar@Domain.com", Some("users_with_upn".to_string()), -1, false ; "Get existing shadow of user by UPN only")]
 #[test_case("does not exist", Some("users_in_db".to_string()), -1, true ; "Error when user does not exist")]
 #[test_case("myuser@domain.com", Some("users_in_db".to_string()), 0, true ; "Error when shadow is unavailable")]
 fn test_get_shadow_by_name(
@@ -356,6 +373,7 @@ fn test_get_all_shadows(
         .with_root_gid(gid)
         .with_shadow_gid(gid)
         .with_offline_credentials_expiration(credentials_expiration)
+        .with_cleanup_on_open(true)
         .with_shadow_mode(force_shadow_mode)
         .build()
         .expect("Setup: could not create cache object");
@@ -368,3 +386,224 @@ fn test_get_all_shadows(
     testutils::require_no_error(got.as_ref(), "get_all_shadows");
     testutils::load_and_update_golden(&module_path, got.unwrap());
 }
+
+/* AAD-AUTHD TESTS */
+#[test_case(true, Some("no_cache".to_string()), true, false; "Reads entries from aad-authd when it is running")]
+#[test_case(false, Some("users_in_db".to_string()), false, false; "Reads the databases when aad-authd is not running")]
+#[test_case(false, Some("no_cache".to_string()), false, true; "Error when aad-authd is not running and there is no cache")]
+fn test_open(
+    daemon_running: bool,
+    initial_state: Option<String>,
+    want_daemon: bool,
+    want_err: bool,
+) {
+    let opts = vec![testutils::with_initial_state(initial_state)];
+    let cache_dir = testutils::prepare_db_for_tests(opts)
+        .expect("Setup: failed to prepare db for tests")
+        .unwrap();
+    let socket_path = cache_dir.path().join("aad-authd.sock");
+    if daemon_running {
+        start_fake_daemon(&socket_path, HashMap::new());
+    }
+
+    let (uid, gid) = (users::get_current_uid(), users::get_current_gid());
+    let got = CacheDB::new()
+        .with_db_path(cache_dir.path().to_str().unwrap())
+        .with_socket_path(socket_path.to_str().unwrap())
+        .with_root_uid(uid)
+        .with_root_gid(gid)
+        .with_shadow_gid(gid)
+        .open();
+    if want_err {
+        testutils::require_error(got.as_ref(), "open");
+        return;
+    }
+    testutils::require_no_error(got.as_ref(), "open");
+    assert_eq!(
+        matches!(got.unwrap(), Cache::Daemon(_)),
+        want_daemon,
+        "open should only connect to aad-authd when it is running"
+    );
+}
+
+#[test_case("myuser@domain.com", Some("myuser@domain.com"); "Get existing user by name")]
+#[test_case("MyUser@Domain.COM", Some("myuser@domain.com"); "Get existing user by unnormalized name")]
+#[test_case("Foo Bar@Domain.com", Some("foobar@domain.com"); "Get existing user by UPN only")]
+#[test_case("does not exist", None; "Error when user does not exist")]
+fn test_get_passwd_by_name_from_daemon(name: &str, want: Option<&str>) {
+    let user = |login: &str| {
+        json!({"Name": login, "Passwd": "x", "UID": 4242, "GID": 4242, "Gecos": "", "Home": format!("/home/{login}"),
+            "Shell": "/bin/bash", "LastOnlineAuth": "2023-01-01T00:00:00Z", "UPN": "", "ShadowPasswd": ""})
+    };
+    let replies = HashMap::from([
+        (
+            r#"Cache.GetUserByName{"Name":"myuser@domain.com"}"#.to_string(),
+            Ok(user("myuser@domain.com")),
+        ),
+        (
+            r#"Cache.GetUserByUPN{"Name":"foo bar@domain.com"}"#.to_string(),
+            Ok(user("foobar@domain.com")),
+        ),
+        (
+            r#"Cache.GetUserByName{"Name":"foobar@domain.com"}"#.to_string(),
+            Ok(user("foobar@domain.com")),
+        ),
+    ]);
+
+    let c = new_cache_from_fake_daemon(replies);
+
+    let got = c.get_passwd_by_name(name);
+    let Some(want) = want else {
+        assert!(
+            matches!(got, Err(CacheError::NoRecord)),
+            "get_passwd_by_name should return NoRecord, but got {got:?}"
+        );
+        return;
+    };
+    testutils::require_no_error(got.as_ref(), "get_passwd_by_name");
+    assert_eq!(got.unwrap().name, want);
+}
+
+#[test]
+fn test_get_all_groups_from_daemon() {
+    let replies = HashMap::from([(
+        "Cache.GetAllGroups{}".to_string(),
+        Ok(json!([
+            {"Name": "admins@domain.com", "GID": 4243, "Password": "x", "Members": ["myuser@domain.com", "otheruser@domain.com"]},
+            {"Name": "myuser@domain.com", "GID": 4242, "Password": "x", "Members": ["myuser@domain.com"]},
+        ])),
+    )]);
+
+    let c = new_cache_from_fake_daemon(replies);
+
+    let got = c.get_all_groups();
+    testutils::require_no_error(got.as_ref(), "get_all_groups");
+    let got = got.unwrap();
+    assert_eq!(got.len(), 2);
+    assert_eq!(got[0].name, "admins@domain.com");
+    assert_eq!(got[0].gid, 4243);
+    assert_eq!(
+        got[0].members,
+        vec![
+            "myuser@domain.com".to_string(),
+            "otheruser@domain.com".to_string()
+        ]
+    );
+}
+
+#[test]
+fn test_get_shadow_by_name_from_daemon_without_permission() {
+    let replies = HashMap::from([(
+        r#"Cache.GetShadowByName{"Name":"myuser@domain.com"}"#.to_string(),
+        Err(
+            "[EPERM] can't read shadow entry of \"myuser@domain.com\": permission denied"
+                .to_string(),
+        ),
+    )]);
+
+    let c = new_cache_from_fake_daemon(replies);
+
+    let got = c.get_shadow_by_name("myuser@domain.com");
+    assert!(
+        matches!(got, Err(CacheError::QueryError(_))),
+        "get_shadow_by_name should return the error of the daemon, but got {got:?}"
+    );
+}
+
+/// new_cache_from_fake_daemon returns a cache connected to a fake aad-authd answering with replies.
+fn new_cache_from_fake_daemon(replies: HashMap<String, Result<Value, String>>) -> Cache {
+    // The databases are not needed when the daemon is running.
+    let cache_dir = tempfile::tempdir().expect("Setup: could not create temporary directory");
+    let socket_path = cache_dir.path().join("aad-authd.sock");
+    start_fake_daemon(&socket_path, replies);
+
+    let c = CacheDB::new()
+        .with_db_path(cache_dir.path().to_str().unwrap())
+        .with_socket_path(socket_path.to_str().unwrap())
+        .open()
+        .expect("Setup: could not connect to fake aad-authd");
+    assert!(
+        matches!(c, Cache::Daemon(_)),
+        "Setup: cache should be read from the fake aad-authd"
+    );
+
+    c
+}
+
+/// start_fake_daemon listens on socket_path and answers the requests of the first connection, speaking the
+/// JSON-RPC codec of Go net/rpc as aad-authd. replies are indexed by the method followed by the parameter of
+/// the request, and unknown requests are answered as unknown entries.
+fn start_fake_daemon(socket_path: &Path, replies: HashMap<String, Result<Value, String>>) {
+    let listener = UnixListener::bind(socket_path).expect("Setup: could not listen on socket");
+
+    thread::spawn(move || {
+        let Ok((mut conn, _)) = listener.accept() else {
+            return;
+        };
+        let mut reader = BufReader::new(conn.try_clone().unwrap());
+
+        let mut line = String::new();
+        while let Ok(n) = reader.read_line(&mut line) {
+            if n == 0 {
+                return;
+            }
+            let req: Value = serde_json::from_str(&line).expect("Fake daemon: invalid request");
+            line.clear();
+
+            let key = format!("{}{}", req["method"].as_str().unwrap(), req["params"][0]);
+            let resp = match replies.get(&key) {
+                Some(Ok(result)) => json!({"id": req["id"], "result": result, "error": null}),
+                Some(Err(err)) => json!({"id": req["id"], "result": null, "error": err}),
+                None => {
+                    json!({"id": req["id"], "result": null, "error": format!("[ENOENT] {key} not found")})
+                }
+            };
+            if writeln!(conn, "{resp}").is_err() {
+                return;
+            }
+        }
+    });
+}
+
+// The fixtures are shared with the Go configuration tests, so that both implementations apply the same policies.
+const GO_CONFIG_TESTDATA: &str =
+    concat!(env!("CARGO_MANIFEST_DIR"), "/../internal/config/testdata");
+
+#[test_case("no-values.conf", Enumeration::All; "All entries are enumerated by default")]
+#[test_case("none.conf", Enumeration::None; "Enumeration is disabled")]
+#[test_case("with-drop-in.conf", Enumeration::None; "Value overridden from drop-in")]
+#[test_case("inline-comment.conf", Enumeration::None; "Inline comments are ignored")]
+#[test_case("colon-delimiter.conf", Enumeration::None; "Colon is a key-value delimiter")]
+#[test_case("default-section-header.conf", Enumeration::None; "Explicit default section header")]
+#[test_case("quoted.conf", Enumeration::Only(vec!["myuser@domain.com".to_string(), "otheruser@domain.com".to_string()]); "Surrounding quotes are removed")]
+#[test_case("continuation.conf", Enumeration::Only(vec!["myuser@domain.com".to_string(), "otheruser@domain.com".to_string()]); "Value continued on the next line")]
+#[test_case("names.conf", Enumeration::Only(vec!["myuser@domain.com".to_string(), "admins".to_string(), "otheruser@contoso.com".to_string()]); "Listed names are normalized")]
+#[test_case("empty-list.conf", Enumeration::All; "All entries are enumerated on empty list")]
+#[test_case("all-with-names.conf", Enumeration::All; "All entries are enumerated on all mixed with names")]
+#[test_case("invalid-syntax.conf", Enumeration::All; "All entries are enumerated on invalid syntax")]
+#[test_case("invalid-netbios-domains.conf", Enumeration::All; "All entries are enumerated on invalid name normalization")]
+#[test_case("doesnotexist.conf", Enumeration::All; "All entries are enumerated on missing file")]
+fn test_enumeration_from_config(config_file: &str, want: Enumeration) {
+    let (ini, name_normalization) = load_config(&format!(
+        "{GO_CONFIG_TESTDATA}/TestParseEnumeration/{config_file}"
+    ));
+
+    assert_eq!(
+        Enumeration::from_config(ini.as_ref(), &name_normalization),
+        want
+    );
+}
+
+#[test_case("no-values.conf", false; "Inline cleanup is disabled by default")]
+#[test_case("enabled.conf", true; "Inline cleanup is enabled")]
+#[test_case("with-drop-in.conf", true; "Value overridden from drop-in")]
+#[test_case("invalid-value.conf", false; "Inline cleanup is disabled on invalid value")]
+#[test_case("inline-comment.conf", true; "Inline comments are ignored")]
+#[test_case("doesnotexist.conf", false; "Inline cleanup is disabled on missing file")]
+fn test_inline_cache_cleanup_from_config(config_file: &str, want: bool) {
+    let (ini, _) = load_config(&format!(
+        "{GO_CONFIG_TESTDATA}/TestParseInlineCacheCleanup/{config_file}"
+    ));
+
+    assert_eq!(inline_cache_cleanup_from_config(ini.as_ref()), want);
+}
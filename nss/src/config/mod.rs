@@ -0,0 +1,236 @@
+use std::{collections::HashMap, fs, path::PathBuf};
+
+use crate::debug;
+
+#[cfg(test)]
+mod mod_tests;
+
+pub const CONFIG_PATH: &str = "/etc/aad.conf";
+const CONFIG_DROP_IN_SUFFIX: &str = ".d"; // Drop-in directory is the configuration path followed by this suffix.
+const CONFIG_DROP_IN_EXTENSION: &str = ".conf"; // Only the drop-in files with this extension are merged.
+
+const DEFAULT_SECTION: &str = "DEFAULT"; // Must match ini.DefaultSection.
+const KEY_VALUE_DELIMITERS: &[char] = &['=', ':'];
+const COMMENT_CHARS: &[char] = &['#', ';'];
+
+/// ConfigError enum represents the errors when loading the configuration.
+#[derive(Debug, PartialEq)]
+pub enum ConfigError {
+    ReadError(String),
+    ParseError(String),
+}
+
+/// Ini struct represents the configuration file merged with its drop-in directory.
+///
+/// Files are parsed as the Go implementation does with go-ini and its default options, so that both
+/// read the same values: the default section is the one before any section header or named [DEFAULT],
+/// keys and values are separated by "=" or ":", inline comments start with "#" or ";", surrounding
+/// quotes are removed and lines ending with "\" are continued on the next one.
+#[derive(Debug, Default)]
+pub struct Ini {
+    sections: HashMap<String, HashMap<String, String>>,
+}
+
+impl Ini {
+    /// load parses the configuration file at path, then merges on top of it the *.conf files of its
+    /// drop-in directory in lexical order. A missing drop-in directory is not an error.
+    pub fn load(path: &str) -> Result<Ini, ConfigError> {
+        let mut files = vec![PathBuf::from(path)];
+        if let Ok(entries) = fs::read_dir(format!("{path}{CONFIG_DROP_IN_SUFFIX}")) {
+            let mut drop_ins: Vec<PathBuf> = entries
+                .filter_map(|e| e.ok().map(|e| e.path()))
+                .filter(|p| {
+                    p.file_name()
+                        .and_then(|n| n.to_str())
+                        .is_some_and(|n| n.ends_with(CONFIG_DROP_IN_EXTENSION))
+                })
+                .collect();
+            drop_ins.sort();
+            files.append(&mut drop_ins);
+        }
+        if files.len() > 1 {
+            debug!("Merging configuration fragments: {:?}", &files[1..]);
+        }
+
+        let mut ini = Ini::default();
+        for file in files {
+            let content = fs::read_to_string(&file).map_err(|err| {
+                ConfigError::ReadError(format!("could not open file {file:?}: {err}"))
+            })?;
+            ini.parse(&content)
+                .map_err(|err| ConfigError::ParseError(format!("{file:?}: {err}")))?;
+        }
+        Ok(ini)
+    }
+
+    /// get returns the value of key in section, or None if it is not set. The empty section name is the
+    /// default section.
+    pub fn get(&self, section: &str, key: &str) -> Option<&str> {
+        let section = if section.is_empty() {
+            DEFAULT_SECTION
+        } else {
+            section
+        };
+        self.sections
+            .get(section)
+            .and_then(|s| s.get(key))
+            .map(String::as_str)
+    }
+
+    /// parse merges the content of an ini file, overriding the values already set.
+    fn parse(&mut self, content: &str) -> Result<(), String> {
+        let content = content.strip_prefix('\u{feff}').unwrap_or(content);
+        let mut lines = content.split_inclusive('\n');
+        let mut section = DEFAULT_SECTION.to_string();
+
+        while let Some(line) = lines.next() {
+            let line = line.trim_start();
+            if line.is_empty() || line.starts_with(COMMENT_CHARS) {
+                continue;
+            }
+
+            if line.starts_with('[') {
+                // The section name runs to the last "]" of the line.
+                let close = line
+                    .rfind(']')
+                    .ok_or_else(|| format!("unclosed section: {line}"))?;
+                section = line[1..close].to_string();
+                if section.is_empty() {
+                    return Err("empty section name".to_string());
+                }
+                continue;
+            }
+
+            let (key, offset) = read_key_name(line)?;
+            let value = read_value(&line[offset..], &mut lines)?;
+            self.sections
+                .entry(section.clone())
+                .or_default()
+                .insert(key, value);
+        }
+        Ok(())
+    }
+}
+
+/// read_key_name returns the key name of line and the offset of its value.
+fn read_key_name(line: &str) -> Result<(String, usize), String> {
+    let key_quote = if line.len() > 6 && line.starts_with(r#"""""#) {
+        r#"""""#
+    } else if line.starts_with('"') {
+        r#"""#
+    } else if line.starts_with('`') {
+        "`"
+    } else {
+        ""
+    };
+
+    if !key_quote.is_empty() {
+        let start = key_quote.len();
+        let pos = line[start..]
+            .find(key_quote)
+            .ok_or_else(|| format!("missing closing key quote: {line}"))?
+            + start;
+        let i = line[pos + start..]
+            .find(KEY_VALUE_DELIMITERS)
+            .ok_or_else(|| format!("key-value delimiter not found: {line}"))?;
+        let key = line[start..pos].trim();
+        if key.is_empty() {
+            return Err("key name cannot be empty".to_string());
+        }
+        return Ok((key.to_string(), pos + i + start + 1));
+    }
+
+    match line.find(KEY_VALUE_DELIMITERS) {
+        None => Err(format!("key-value delimiter not found: {line}")),
+        Some(0) => Err(format!("empty key name: {line}")),
+        Some(end) => Ok((line[..end].trim().to_string(), end + 1)),
+    }
+}
+
+/// read_value returns the value starting at line. Quoted multi-line values and continuation lines are
+/// read from next_lines.
+fn read_value<'a>(
+    line: &str,
+    next_lines: &mut impl Iterator<Item = &'a str>,
+) -> Result<String, String> {
+    let line = line.trim_start();
+    if line.is_empty() {
+        return Ok(String::new());
+    }
+
+    let value_quote = if line.len() > 3 && line.starts_with(r#"""""#) {
+        r#"""""#
+    } else if line.starts_with('`') {
+        "`"
+    } else {
+        ""
+    };
+    if !value_quote.is_empty() {
+        let start = value_quote.len();
+        if let Some(pos) = line[start..].rfind(value_quote) {
+            return Ok(line[start..start + pos].to_string());
+        }
+
+        // The value continues until the closing quote.
+        let mut value = line[start..].to_string();
+        loop {
+            let next = next_lines.next().unwrap_or_default();
+            if let Some(pos) = next.rfind(value_quote) {
+                value.push_str(&next[..pos]);
+                return Ok(value);
+            }
+            value.push_str(next);
+            if !next.ends_with('\n') {
+                return Err(format!(
+                    "missing closing key quote from {line:?} to {next:?}"
+                ));
+            }
+        }
+    }
+
+    let mut line = line.trim();
+    if let Some(value) = line.strip_suffix('\\') {
+        let mut value = value.to_string();
+        for next in next_lines.by_ref() {
+            let next = next.trim();
+            if next.is_empty() {
+                break;
+            }
+            value.push_str(next);
+            match value.strip_suffix('\\') {
+                Some(v) => value = v.to_string(),
+                None => break,
+            }
+        }
+        return Ok(value);
+    }
+
+    if let Some(i) = line.find(COMMENT_CHARS) {
+        line = line[..i].trim();
+    }
+
+    if has_surrounded_quote(line, '\'') || has_surrounded_quote(line, '"') {
+        line = &line[1..line.len() - 1];
+    }
+
+    Ok(line.to_string())
+}
+
+/// has_surrounded_quote returns true if value starts and ends with quote, without any other quote inside.
+fn has_surrounded_quote(value: &str, quote: char) -> bool {
+    value.len() >= 2
+        && value.starts_with(quote)
+        && value.ends_with(quote)
+        && value[1..].find(quote) == Some(value.len() - 2)
+}
+
+/// parse_bool parses a boolean value as go-ini does.
+pub fn parse_bool(value: &str) -> Option<bool> {
+    match value {
+        "1" | "t" | "T" | "true" | "TRUE" | "True" | "YES" | "yes" | "Yes" | "y" | "ON" | "on"
+        | "On" => Some(true),
+        "0" | "f" | "F" | "false" | "FALSE" | "False" | "NO" | "no" | "No" | "n" | "OFF"
+        | "off" | "Off" => Some(false),
+        _ => None,
+    }
+}
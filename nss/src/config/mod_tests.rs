@@ -0,0 +1,46 @@
+use test_case::test_case;
+
+use super::{parse_bool, ConfigError, Ini};
+
+// The fixtures are shared with the Go configuration tests, so that both implementations read the same values.
+const GO_TESTDATA: &str = concat!(env!("CARGO_MANIFEST_DIR"), "/../internal/config/testdata");
+
+#[test_case("TestParseEnumeration/no-values.conf", "", "enumeration", None; "Unset key")]
+#[test_case("TestParseEnumeration/none.conf", "", "enumeration", Some("none"); "Value of the default section")]
+#[test_case("TestParseEnumeration/with-drop-in.conf", "", "enumeration", Some("none"); "Value overridden from drop-in")]
+#[test_case("TestParseEnumeration/inline-comment.conf", "", "enumeration", Some("none"); "Inline comments are ignored")]
+#[test_case("TestParseEnumeration/colon-delimiter.conf", "", "enumeration", Some("none"); "Colon is a key-value delimiter")]
+#[test_case("TestParseEnumeration/default-section-header.conf", "", "enumeration", Some("none"); "Explicit default section header")]
+#[test_case("TestParseEnumeration/default-section-header.conf", "domain.com", "offline_credentials_expiration", Some("30"); "Value of a named section")]
+#[test_case("TestParseEnumeration/default-section-header.conf", "domain.com", "enumeration", None; "Named sections do not inherit the default section")]
+#[test_case("TestParseEnumeration/quoted.conf", "", "enumeration", Some("myuser@domain.com, otheruser@domain.com"); "Surrounding quotes are removed")]
+#[test_case("TestParseEnumeration/continuation.conf", "", "enumeration", Some("myuser@domain.com, otheruser@domain.com"); "Value continued on the next line")]
+#[test_case("TestParseEnumeration/names.conf", "", "enumeration", Some("MyUser@Domain.com, admins, CONTOSO\\OtherUser,"); "Backslashes inside values are kept")]
+#[test_case("TestParseInlineCacheCleanup/inline-comment.conf", "", "inline_cache_cleanup", Some("yes"); "Inline comments are ignored after any value")]
+fn test_get(config_file: &str, section: &str, key: &str, want: Option<&str>) {
+    let ini = Ini::load(&format!("{GO_TESTDATA}/{config_file}"))
+        .expect("Setup: could not load configuration");
+
+    assert_eq!(ini.get(section, key), want);
+}
+
+#[test_case("TestParseEnumeration/invalid-syntax.conf", true; "Error on line without delimiter")]
+#[test_case("TestParseEnumeration/doesnotexist.conf", false; "Error on missing file")]
+fn test_load_errors(config_file: &str, want_parse_error: bool) {
+    let err =
+        Ini::load(&format!("{GO_TESTDATA}/{config_file}")).expect_err("Load should have failed");
+
+    match err {
+        ConfigError::ParseError(_) => assert!(want_parse_error, "Unexpected parse error: {err:?}"),
+        ConfigError::ReadError(_) => assert!(!want_parse_error, "Unexpected read error: {err:?}"),
+    }
+}
+
+#[test_case("true", Some(true); "True value")]
+#[test_case("yes", Some(true); "Yes value")]
+#[test_case("0", Some(false); "Zero value")]
+#[test_case("Off", Some(false); "Off value")]
+#[test_case("sometimes", None; "Invalid value")]
+fn test_parse_bool(value: &str, want: Option<bool>) {
+    assert_eq!(parse_bool(value), want);
+}
@@ -22,7 +22,11 @@ use shadow::AADShadow;
 libnss_shadow_hooks!(aad, AADShadow);
 
 mod cache;
-use crate::cache::{CacheDB, CacheError};
+use crate::cache::{Cache, CacheDB, CacheError};
+
+mod config;
+
+mod user;
 
 mod logs;
 
@@ -51,8 +55,9 @@ fn cache_result_to_nss_status<T>(r: Result<T, CacheError>) -> Response<T> {
     }
 }
 
-// new_cache initializes the cache with an optional cache directory for integration testing.
-fn new_cache() -> Result<CacheDB, CacheError> {
+// new_cache initializes the cache with an optional cache directory for integration testing. Entries are
+// read through aad-authd when it is running, and from the cache databases otherwise.
+fn new_cache() -> Result<Cache, CacheError> {
     let mut c = CacheDB::new();
 
     #[cfg(feature = "integration-tests")]
@@ -68,7 +73,7 @@ fn new_cache() -> Result<CacheDB, CacheError> {
         c = CacheDB::new_for_tests();
     }
 
-    c.build()
+    c.open()
 }
 
 #[ctor]
@@ -88,6 +93,10 @@ fn override_cache_options(c: &mut CacheDBBuilder) {
         c.with_db_path(&cache_dir);
     }
 
+    if let Ok(socket_path) = env::var("NSS_AAD_SOCKET") {
+        c.with_socket_path(&socket_path);
+    }
+
     if let Ok(root_uid) = env::var("NSS_AAD_ROOT_UID") {
         c.with_root_uid(root_uid.parse().unwrap());
     }
@@ -213,7 +213,12 @@ fn load_dump_into_db(dump_path: &Path, db_path: &Path) -> Result<(), Error> {
     for (name, table) in tables {
         let s = vec!["?,"; table.col_names.len()].concat();
 
-        let stmt_str = format!("INSERT INTO {name} VALUES ({})", s.trim_end_matches(','));
+        // Columns are named, so that the columns missing from the dump get their default values.
+        let stmt_str = format!(
+            "INSERT INTO {name} ({}) VALUES ({})",
+            table.col_names.join(","),
+            s.trim_end_matches(',')
+        );
         let mut stmt = match conn.prepare(&stmt_str) {
             Ok(stmt) => stmt,
             Err(err) => return Err(Error::LoadDump(err.to_string())),
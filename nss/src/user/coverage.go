@@ -0,0 +1,2 @@
+// Package coverageuser file is only here so that it’s recognized as a go package when computing coverage
+package coverageuser
@@ -0,0 +1,149 @@
+use std::collections::HashMap;
+
+use unicode_normalization::UnicodeNormalization;
+
+use crate::config::Ini;
+
+#[cfg(test)]
+mod mod_tests;
+
+mod tables;
+
+const NETBIOS_DOMAINS_KEY: &str = "netbios_domains"; // Must match netBIOSDomainsKey in internal/config.
+const INVALID_CHARS_REPLACEMENT_KEY: &str = "invalid_chars_replacement"; // Must match invalidCharsReplacementKey in internal/config.
+
+const DOWN_LEVEL_SEPARATOR: char = '\\'; // Must match downLevelSeparator in internal/user.
+const VALID_SPECIAL_CHARS: &str = "._-@+#'!^~"; // Must match validSpecialChars in internal/user.
+const DEFAULT_INVALID_CHARS_REPLACEMENT: &str = "_"; // Must match defaultInvalidCharsReplacement in internal/user.
+const GUEST_MARKER: &str = "#ext#@"; // Must match guestMarker in internal/user.
+
+/// NameNormalization struct represents how user names are converted to the POSIX names they are stored
+/// under in the cache. It is a port of NormalizeName and PosixName in internal/user, with the case folding
+/// and character classes generated from the Go implementation.
+#[derive(Debug, Clone, PartialEq)]
+pub struct NameNormalization {
+    /// netbios_domains maps the case folded NetBIOS domain names of down-level logon names to domains.
+    netbios_domains: HashMap<String, String>,
+    /// invalid_chars_replacement replaces the characters which are invalid in POSIX user names.
+    /// Names with invalid characters can't be normalized if it is empty.
+    invalid_chars_replacement: String,
+}
+
+impl Default for NameNormalization {
+    fn default() -> Self {
+        NameNormalization {
+            netbios_domains: HashMap::new(),
+            invalid_chars_replacement: DEFAULT_INVALID_CHARS_REPLACEMENT.to_string(),
+        }
+    }
+}
+
+impl NameNormalization {
+    /// from_config reads the name normalization options from the default section of the configuration.
+    /// It returns an error if the NetBIOS domains are invalid, as the Go implementation does.
+    pub fn from_config(ini: &Ini) -> Result<NameNormalization, String> {
+        let mut n = NameNormalization::default();
+
+        if let Some(value) = ini.get("", NETBIOS_DOMAINS_KEY) {
+            for pair in value.split(',').map(str::trim).filter(|p| !p.is_empty()) {
+                let (netbios, domain) = pair
+                    .split_once('=')
+                    .map(|(n, d)| (n.trim(), d.trim()))
+                    .filter(|(n, d)| !n.is_empty() && !d.is_empty())
+                    .ok_or_else(|| format!("{pair:?} is not a NETBIOS=domain pair"))?;
+                n.netbios_domains.insert(fold(netbios), domain.to_string());
+            }
+        }
+        if let Some(value) = ini.get("", INVALID_CHARS_REPLACEMENT_KEY) {
+            n.invalid_chars_replacement = value.to_string();
+        }
+
+        Ok(n)
+    }
+
+    /// normalize_name returns the name to authenticate against Azure AD: down-level logon names of known
+    /// NetBIOS domains are converted to user@domain, the name is case folded and converted to the Unicode
+    /// Normalization Form C.
+    pub fn normalize_name(&self, name: &str) -> String {
+        let mut name: String = name.nfc().collect();
+
+        // Convert down-level logon names.
+        if !name.contains('@') {
+            if let Some((netbios, user)) = name.split_once(DOWN_LEVEL_SEPARATOR) {
+                if let Some(domain) = self.netbios_domains.get(&fold(netbios)) {
+                    name = format!("{user}@{domain}");
+                }
+            }
+        }
+
+        // Case folding can produce decomposed characters.
+        fold(&name).nfc().collect()
+    }
+
+    /// posix_name returns the name users are stored under in the cache: the normalized name, with the
+    /// characters which are invalid in POSIX user names replaced. Azure AD B2B guest users are named after
+    /// their friendly name, as returned by guest_name.
+    pub fn posix_name(&self, name: &str) -> Result<String, String> {
+        let mut name = self.normalize_name(name);
+        if let Some(guest) = guest_name(&name) {
+            name = guest.to_string();
+        }
+
+        let mut posix = String::with_capacity(name.len());
+        let mut invalid = false;
+        for (i, c) in name.chars().enumerate() {
+            if is_letter_mark_or_digit(c)
+                || (VALID_SPECIAL_CHARS.contains(c) && (i > 0 || c != '-'))
+            {
+                posix.push(c);
+                continue;
+            }
+            invalid = true;
+            posix.push_str(&self.invalid_chars_replacement);
+        }
+        if invalid && self.invalid_chars_replacement.is_empty() {
+            return Err(format!(
+                "{name:?} contains characters which are invalid in user names"
+            ));
+        }
+
+        Ok(posix)
+    }
+}
+
+/// guest_name returns the friendly name of an Azure AD B2B guest user from its normalized UPN, like
+/// bob_gmail.com for bob_gmail.com#ext#@contoso.onmicrosoft.com, or None if upn is not the one of a guest
+/// user.
+pub fn guest_name(upn: &str) -> Option<&str> {
+    upn.split_once(GUEST_MARKER)
+        .map(|(name, _)| name)
+        .filter(|name| !name.is_empty())
+}
+
+/// fold returns the case folding of s, as done by golang.org/x/text/cases.
+fn fold(s: &str) -> String {
+    let mut folded = String::with_capacity(s.len());
+    for c in s.chars() {
+        match tables::FOLD.binary_search_by_key(&c, |&(from, _)| from) {
+            Ok(i) => folded.push_str(tables::FOLD[i].1),
+            Err(_) => folded.push(c),
+        }
+    }
+    folded
+}
+
+/// is_letter_mark_or_digit returns true if c is a letter, a mark or a decimal digit, as done by the
+/// unicode package of Go.
+fn is_letter_mark_or_digit(c: char) -> bool {
+    tables::LETTERS_MARKS_DIGITS
+        .binary_search_by(|&(lo, hi)| {
+            if hi < c {
+                std::cmp::Ordering::Less
+            } else if lo > c {
+                std::cmp::Ordering::Greater
+            } else {
+                std::cmp::Ordering::Equal
+            }
+        })
+        .is_ok()
+}
@@ -0,0 +1,75 @@
+use serde::Deserialize;
+use test_case::test_case;
+
+use super::{guest_name, NameNormalization};
+use crate::config::Ini;
+
+// The configurations and the expected names are the ones of TestNameNormalizationParity in internal/user,
+// so that both implementations normalize names the same way.
+const GO_TESTDATA: &str = concat!(env!("CARGO_MANIFEST_DIR"), "/../internal/user/testdata");
+
+#[derive(Deserialize)]
+struct NormalizedName {
+    name: String,
+    normalized: String,
+    posix: String,
+    invalid: bool,
+}
+
+#[test_case("default.conf", "default_normalization"; "Default normalization")]
+#[test_case("netbios-domains.conf", "with_NetBIOS_domains_and_replacement"; "With NetBIOS domains and replacement")]
+#[test_case("no-replacement.conf", "without_replacement"; "Without replacement")]
+fn test_name_normalization_parity(config_file: &str, golden: &str) {
+    let ini = Ini::load(&format!(
+        "{GO_TESTDATA}/TestNameNormalizationParity/{config_file}"
+    ))
+    .expect("Setup: could not load configuration");
+    let n = NameNormalization::from_config(&ini).expect("Setup: invalid name normalization");
+
+    let golden = std::fs::read_to_string(format!(
+        "{GO_TESTDATA}/golden/TestNameNormalizationParity/{golden}"
+    ))
+    .expect("Setup: could not read golden file");
+    let want: Vec<NormalizedName> =
+        serde_yaml::from_str(&golden).expect("Setup: could not parse golden file");
+
+    for w in want {
+        assert_eq!(
+            n.normalize_name(&w.name),
+            w.normalized,
+            "normalize_name({:?})",
+            w.name
+        );
+        match n.posix_name(&w.name) {
+            Ok(posix) => {
+                assert!(!w.invalid, "posix_name({:?}) should fail", w.name);
+                assert_eq!(posix, w.posix, "posix_name({:?})", w.name);
+            }
+            Err(err) => assert!(w.invalid, "posix_name({:?}) failed: {err}", w.name),
+        }
+    }
+}
+
+#[test_case("CONTOSO=contoso.com, FABRIKAM=fabrikam.com", false; "Valid NetBIOS domains")]
+#[test_case("CONTOSO", true; "Error on NetBIOS domain without separator")]
+#[test_case("CONTOSO=", true; "Error on NetBIOS domain without domain")]
+#[test_case("=contoso.com", true; "Error on domain without NetBIOS domain")]
+fn test_from_config(netbios_domains: &str, want_err: bool) {
+    let dir = tempfile::tempdir().expect("Setup: could not create temporary directory");
+    let path = dir.path().join("aad.conf");
+    std::fs::write(&path, format!("netbios_domains = {netbios_domains}\n"))
+        .expect("Setup: could not write configuration");
+    let ini = Ini::load(path.to_str().unwrap()).expect("Setup: could not load configuration");
+
+    let got = NameNormalization::from_config(&ini);
+    assert_eq!(got.is_err(), want_err, "from_config returned {got:?}");
+}
+
+#[test_case("bob_gmail.com#ext#@contoso.onmicrosoft.com", Some("bob_gmail.com"); "Guest user")]
+#[test_case("bob#ext#_gmail.com#ext#@contoso.onmicrosoft.com", Some("bob#ext#_gmail.com"); "Guest user with marker in its name")]
+#[test_case("bob@contoso.com", None; "Member user is not a guest")]
+#[test_case("#ext#@contoso.onmicrosoft.com", None; "Marker without external identity")]
+#[test_case("bob_gmail.com#EXT#@contoso.onmicrosoft.com", None; "Marker is only matched once folded")]
+fn test_guest_name(upn: &str, want: Option<&str>) {
+    assert_eq!(guest_name(upn), want);
+}
@@ -30,8 +30,18 @@ func TestPamSmAuthenticate(t *testing.T) {
 		initialCache        string
 		wrongCacheOwnership bool
 		offline             bool
-
-		wantErr bool
+		// moduleArgs are the password arguments passed to the module.
+		moduleArgs string
+		// firstPassword is the password answered to the first prompt, by pam_unix if in the stack, if set.
+		firstPassword string
+		// noPreviousModule removes pam_unix from the stack, so that no password is set before our module.
+		noPreviousModule bool
+		// remoteHost is set as PAM_RHOST, for remote logins.
+		remoteHost string
+
+		wantErr                  bool
+		wantNoPasswordPrompt     bool
+		wantSinglePasswordPrompt bool
 	}{
 		"authenticate successfully (online)": {},
 		"specified offline expiration":       {conf: "withoffline-expiration.conf"},
@@ -40,6 +50,9 @@ func TestPamSmAuthenticate(t *testing.T) {
 		"correctly set homedir and shell values for a new user":                                          {conf: "aad-with-homedir-and-shell.conf"},
 		"correctly set homedir and shell values specified at domain for a new user with matching domain": {conf: "aad-with-homedir-and-shell-domain.conf"},
 
+		// aad.conf with custom GECOS claims
+		"correctly set GECOS from the configured claims for a new user": {conf: "aad-with-gecos-claims.conf"},
+
 		// offline cases
 		"offline, connect existing user from cache":                                     {conf: "forceoffline.conf", offline: true, initialCache: "users_in_db", username: "myuser@domain.com"},
 		"homedir and shell values should not change for user that was already on cache": {conf: "forceoffline-with-homedir-and-shell.conf", offline: true, initialCache: "users_in_db", username: "myuser@domain.com"},
@@ -48,11 +61,29 @@ func TestPamSmAuthenticate(t *testing.T) {
 
 		// special cases
 		"authenticate successfully with unmatched case (online)":                  {username: "Success@Domain.COM"},
+		"authenticate successfully with an alias storing its UPN (online)":        {username: "alias@domain.com"},
 		"authenticate successfully on config with values only in matching domain": {conf: "with-domain.conf"},
 		"authenticate successfully on config with offline auth disabled (online)": {conf: "offline-auth-disabled.conf"},
+		"authenticate successfully on configured domain in strict domain mode":    {conf: "strict-domains.conf"},
+
+		// password prompting
+		"authenticate successfully prompting for the password":                         {noPreviousModule: true},
+		"authenticate successfully with use_first_pass":                                {moduleArgs: "use_first_pass"},
+		"authenticate successfully with use_authtok":                                   {moduleArgs: "use_authtok"},
+		"offline, try_first_pass prompts again if the previous password is wrong":      {conf: "forceoffline.conf", offline: true, initialCache: "users_in_db", username: "myuser@domain.com", moduleArgs: "try_first_pass", firstPassword: "wrong password"},
+		"offline, try_first_pass prompts for the password if there is no previous one": {conf: "forceoffline.conf", offline: true, initialCache: "users_in_db", username: "myuser@domain.com", moduleArgs: "try_first_pass", noPreviousModule: true},
+
+		// login policies
+		"offline, connect existing user locally with offline auth disabled remotely": {conf: "forceoffline-login-policies.conf", offline: true, initialCache: "users_in_db", username: "myuser@domain.com"},
 
 		// error cases
+		"error on denied service": {conf: "login-policies.conf", wantErr: true},
+		"error on offline remote login with offline auth disabled remotely": {conf: "forceoffline-login-policies.conf", offline: true, initialCache: "users_in_db", username: "myuser@domain.com", remoteHost: "192.0.2.1", wantErr: true},
+		"error on use_first_pass without previous password":                 {moduleArgs: "use_first_pass", noPreviousModule: true, wantErr: true},
+		"error on offline with wrong previous password by default":          {conf: "forceoffline.conf", offline: true, initialCache: "users_in_db", username: "myuser@domain.com", firstPassword: "wrong password", wantErr: true},
+		"error on offline with wrong previous password and use_first_pass":  {conf: "forceoffline.conf", offline: true, initialCache: "users_in_db", username: "myuser@domain.com", moduleArgs: "use_first_pass", firstPassword: "wrong password", wantErr: true},
 		"error on invalid conf":                               {conf: "invalid-aad.conf", wantErr: true},
+		"error on token of another user":                      {username: "token of another user", wantErr: true},
 		"error on unexisting conf":                            {conf: "doesnotexist.conf", wantErr: true},
 		"error on unexisting users":                           {username: "no such user", wantErr: true},
 		"error on invalid password":                           {username: "invalid credentials", wantErr: true},
@@ -63,6 +94,13 @@ func TestPamSmAuthenticate(t *testing.T) {
 		"error on offline with offline auth disabled":         {conf: "forceoffline-offline-auth-disabled.conf", offline: true, initialCache: "users_in_db", username: "myuser@domain.com", password: "my password", wantErr: true},
 		"error on server error":                               {username: "unreadable server response", wantErr: true},
 		"error on cache can't be created/opened":              {wrongCacheOwnership: true, wantErr: true},
+
+		// try_first_pass only prompts again for rejected passwords
+		"error on try_first_pass with offline auth disabled without prompting again": {conf: "forceoffline-offline-auth-disabled.conf", offline: true, initialCache: "users_in_db", username: "myuser@domain.com", moduleArgs: "try_first_pass", wantErr: true, wantSinglePasswordPrompt: true},
+
+		// users left to the other modules, denied by pam_deny
+		"local users are ignored without password prompt in strict domain mode":     {conf: "strict-domains.conf", username: "localuser", noPreviousModule: true, wantErr: true, wantNoPasswordPrompt: true},
+		"unknown domains are ignored without password prompt in strict domain mode": {conf: "strict-domains.conf", username: "success@otherdomain.com", noPreviousModule: true, wantErr: true, wantNoPasswordPrompt: true},
 	}
 	for name, tc := range tests {
 		tc := tc
@@ -97,30 +135,50 @@ func TestPamSmAuthenticate(t *testing.T) {
 			}
 
 			// pam service configuration
+			previousModule := "auth	[success=2 default=ignore]	pam_unix.so nullok debug"
+			if tc.noPreviousModule {
+				previousModule = ""
+			}
 			err = os.WriteFile(filepath.Join(pamConfDir, "aadtest"), []byte(fmt.Sprintf(`
-			auth	[success=2 default=ignore]	pam_unix.so nullok debug
-			auth    [success=1 default=ignore]  %s conf=%s debug reset logswithdebugonstderr rootUID=%d rootGID=%d shadowGID=%d cachedir=%s mockaad
+			%s
+			auth    [success=1 default=ignore]  %s conf=%s debug %s reset logswithdebugonstderr rootUID=%d rootGID=%d shadowGID=%d cachedir=%s mockaad
 			auth	requisite			pam_deny.so
 			auth	required			pam_permit.so`,
-				libPath, tc.conf, testUID, gid, gid, cacheDir)), 0600)
+				previousModule, libPath, tc.conf, tc.moduleArgs, testUID, gid, gid, cacheDir)), 0600)
 			require.NoError(t, err, "Setup: could not create pam stack config file")
 
 			// pam communication
+			var prompts int
 			start := time.Now()
 			tx, err := pamCom.StartFunc("aadtest", "", func(s pamCom.Style, msg string) (string, error) {
 				switch s {
 				case pamCom.PromptEchoOn:
 					return tc.username, nil
 				case pamCom.PromptEchoOff:
+					prompts++
+					if prompts == 1 && tc.firstPassword != "" {
+						return tc.firstPassword, nil
+					}
 					return tc.password, nil
+				case pamCom.TextInfo:
+					return "", nil
 				}
 
 				return "", errors.New("unexpected request")
 			}, pamCom.WithConfDir(pamConfDir))
 			require.NoError(t, err, "Setup: pam should start a transaction with no error")
+			if tc.remoteHost != "" {
+				require.NoError(t, tx.SetItem(pamCom.Rhost, tc.remoteHost), "Setup: could not set the remote host")
+			}
 
 			// run pam_sm_authenticate
 			err = tx.Authenticate(0)
+			if tc.wantNoPasswordPrompt {
+				require.Zero(t, prompts, "Authenticate should not have prompted for a password")
+			}
+			if tc.wantSinglePasswordPrompt {
+				require.Equal(t, 1, prompts, "Authenticate should not have prompted for the password again")
+			}
 			if tc.wantErr {
 				require.Error(t, err, "Authenticate should have returned an error but did not")
 				return
@@ -161,6 +219,92 @@ func TestPamSmAuthenticate(t *testing.T) {
 	}
 }
 
+func TestPamSmOpenSession(t *testing.T) {
+	uid, gid := testutils.GetCurrentUIDGID(t)
+
+	tests := map[string]struct {
+		username            string
+		conf                string
+		wrongCacheOwnership bool
+		// remoteHost is set as PAM_RHOST, for remote logins.
+		remoteHost string
+
+		wantErr bool
+	}{
+		"record login of cached user":              {},
+		"record remote login of cached user":       {remoteHost: "192.0.2.1"},
+		"record login of user with unmatched case": {username: "MyUser@Domain.COM"},
+		"ignore user not in cache":                 {username: "localuser"},
+		"ignore user on unexisting conf":           {conf: "doesnotexist.conf"},
+
+		// error cases
+		"error on cache can't be opened": {wrongCacheOwnership: true, wantErr: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			if tc.username == "" {
+				tc.username = "myuser@domain.com"
+			}
+			if tc.conf == "" {
+				tc.conf = "simple-aad.conf"
+			}
+			tc.conf = filepath.Join("testdata", tc.conf)
+
+			testUID := uid
+			if tc.wrongCacheOwnership {
+				testUID = 4242
+			}
+
+			tmp := t.TempDir()
+
+			pamConfDir := filepath.Join(tmp, "pam.d")
+			err := os.MkdirAll(pamConfDir, 0700)
+			require.NoError(t, err, "Setup: could not create pam.d temporary directory")
+
+			cacheDir := filepath.Join(tmp, "cache")
+			testutils.PrepareDBsForTests(t, cacheDir, "users_in_db")
+
+			// pam service configuration: ignored sessions are left to the next module.
+			err = os.WriteFile(filepath.Join(pamConfDir, "aadtest"), []byte(fmt.Sprintf(`
+			session [success=ok ignore=ignore default=bad] %s conf=%s debug reset logswithdebugonstderr rootUID=%d rootGID=%d shadowGID=%d cachedir=%s
+			session required                               pam_permit.so`,
+				libPath, tc.conf, testUID, gid, gid, cacheDir)), 0600)
+			require.NoError(t, err, "Setup: could not create pam stack config file")
+
+			start := time.Now()
+			tx, err := pamCom.StartFunc("aadtest", tc.username, func(s pamCom.Style, msg string) (string, error) {
+				return "", errors.New("unexpected request")
+			}, pamCom.WithConfDir(pamConfDir))
+			require.NoError(t, err, "Setup: pam should start a transaction with no error")
+			if tc.remoteHost != "" {
+				require.NoError(t, tx.SetItem(pamCom.Rhost, tc.remoteHost), "Setup: could not set the remote host")
+			}
+
+			// run pam_sm_open_session
+			err = tx.OpenSession(0)
+			if tc.wantErr {
+				require.Error(t, err, "OpenSession should have returned an error but did not")
+				return
+			}
+			require.NoError(t, err, "OpenSession should succeed")
+			end := time.Now()
+
+			// Logins are recorded in the shadow database.
+			ref := filepath.Join(cacheDir, "shadow.db")
+			want := testutils.LoadAndUpdateFromGoldenDump(t, ref)
+			b := &bytes.Buffer{}
+			err = testutils.DumpDb(t, ref, b, false)
+			require.NoError(t, err, "Setup: can't deserialize temporary dump")
+			got, err := testutils.ReadDumpAsTables(t, b)
+			require.NoError(t, err, "Could not read temporary dump file for shadow.db")
+
+			// Opening a session never counts as an online authentication.
+			requireEqualDumps(t, want, got, true, start, end)
+		})
+	}
+}
+
 func requireEqualDumps(t *testing.T, want, got map[string]testutils.Table, offline bool, start, end time.Time) {
 	t.Helper()
 
@@ -192,6 +336,12 @@ func requireEqualDumps(t *testing.T, want, got map[string]testutils.Table, offli
 					}
 					require.True(t, testutils.TimeBetweenOrEquals(time.Unix(n, 0), start, end), "Expected time to be between start and end")
 
+				case "first_login", "last_login":
+					// Logins are recorded with the time of the session opening, which must happen during the test.
+					n, err := strconv.ParseInt(gotData, 10, 64)
+					require.NoError(t, err, "%s should be a valid timestamp", colName)
+					require.True(t, testutils.TimeBetweenOrEquals(time.Unix(n, 0), start, end), "Expected %s to be between start and end", colName)
+
 				default:
 					// Handles comparison for most columns.
 					require.Equal(t, wantData, gotData, "Contents of col %s from %s must be the same", colName, tableName)
@@ -18,6 +18,7 @@ import (
 	"strings"
 
 	"github.com/ubuntu/aad-auth/internal/cache"
+	"github.com/ubuntu/aad-auth/internal/config"
 	"github.com/ubuntu/aad-auth/internal/consts"
 	"github.com/ubuntu/aad-auth/internal/i18n"
 	"github.com/ubuntu/aad-auth/internal/logger"
@@ -38,26 +39,7 @@ func pam_sm_authenticate(pamh *C.pam_handle_t, flags, argc C.int, argv **C.char)
 
 	// Attach logger and info handler.
 	ctx := pam.CtxWithPamh(context.Background(), pam.Handle(pamh))
-	pamLogger := pam.NewLogger(pam.Handle(pamh), pam.LogInfo)
-
-	// Get options.
-	conf := consts.DefaultConfigPath
-	for _, arg := range sliceFromArgv(argc, argv) {
-		opt, optarg, _ := strings.Cut(arg, "=")
-		switch opt {
-		case "conf":
-			conf = optarg
-		case "debug":
-			pamLogger = pam.NewLogger(pam.Handle(pamh), pam.LogDebug)
-			pamLogger.Debug("PAM AAD DEBUG enabled")
-		default:
-			// we have additional supported option when built for integration tests
-			if supportedOption(&pamLogger, opt, optarg) {
-				continue
-			}
-			pamLogger.Warn(i18n.G("unknown option: %s\n"), opt)
-		}
-	}
+	conf, passMode, pamLogger := parseArgs(pamh, argc, argv)
 	if !logsOnStderr {
 		ctx = logger.CtxWithLogger(ctx, pamLogger)
 		defer logger.CloseLoggerFromContext(ctx)
@@ -68,23 +50,74 @@ func pam_sm_authenticate(pamh *C.pam_handle_t, flags, argc C.int, argv **C.char)
 		pamLogger.Err(err.Error())
 		return C.PAM_SYSTEM_ERR
 	}
-	password, err := getPassword(pamh)
+	// Policies of the configuration depend on how the user is logging in. It is parsed once for the whole login.
+	service, remoteHost := getLogin(pamh)
+	login := config.Login{Service: service, RemoteHost: remoteHost}
+	cfg, err := config.Parse(ctx, conf, config.WithLogin(login))
+	if err != nil {
+		logger.Err(ctx, i18n.G("No valid configuration found: %v"), err)
+		return C.PAM_SYSTEM_ERR
+	}
+	authOpts := append([]pam.Option{pam.WithLogin(service, remoteHost), pam.WithConfig(cfg)}, opts...)
+
+	// Users of domains which are not handled are left to the other modules, before prompting for their password.
+	switch err := pam.CheckDomain(ctx, username, cfg); {
+	case errors.Is(err, pam.ErrPamIgnore):
+		return C.PAM_IGNORE
+	case errors.Is(err, pam.ErrPamUserUnknown):
+		return C.PAM_USER_UNKNOWN
+	case err != nil:
+		return C.PAM_SYSTEM_ERR
+	}
+
+	password, prompted, err := getPassword(pamh, passMode)
 	if err != nil {
 		pamLogger.Err(err.Error())
+		if passMode == passwordUseFirstPass {
+			return C.PAM_AUTH_ERR
+		}
 		return C.PAM_SYSTEM_ERR
 	}
 
-	if err := pam.Authenticate(ctx, username, password, conf, opts...); err != nil {
-		if errors.Is(err, pam.ErrPamSystem) {
+	err = pam.Authenticate(ctx, username, password, conf, authOpts...)
+	// Only a rejected password is prompted for again: the user can't do anything about the other denials.
+	if errors.Is(err, pam.ErrInvalidCredentials) && passMode == passwordTryFirstPass && !prompted {
+		pamLogger.Debug("Password of previous module denied, prompting for it")
+		if password, err = promptPassword(pamh); err != nil {
+			pamLogger.Err(err.Error())
 			return C.PAM_SYSTEM_ERR
 		}
-		if errors.Is(err, pam.ErrPamAuth) {
-			return C.PAM_AUTH_ERR
-		}
-		if errors.Is(err, pam.ErrPamIgnore) {
-			return C.PAM_IGNORE
+		err = pam.Authenticate(ctx, username, password, conf, authOpts...)
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, pam.ErrPamSystem):
+		return C.PAM_SYSTEM_ERR
+	case errors.Is(err, pam.ErrPamIgnore):
+		return C.PAM_IGNORE
+	case errors.Is(err, pam.ErrPamUserUnknown):
+		return C.PAM_USER_UNKNOWN
+	case errors.Is(err, pam.ErrPamPermDenied):
+		return C.PAM_PERM_DENIED
+	default:
+		// Any other error must deny the authentication.
+		return C.PAM_AUTH_ERR
+	}
+
+	// Next modules and the NSS lookups must use the name the user is known as in the cache.
+	posixName, err := pam.PosixName(username, cfg)
+	if err != nil {
+		pamLogger.Err(err.Error())
+		return C.PAM_SYSTEM_ERR
+	}
+	if posixName != username {
+		pamLogger.Debug("Setting user to %q", posixName)
+		if err := setUser(pamh, posixName); err != nil {
+			pamLogger.Err(err.Error())
+			return C.PAM_SYSTEM_ERR
 		}
 	}
+
 	return C.PAM_SUCCESS
 }
 
@@ -95,6 +128,34 @@ func pam_sm_setcred(pamh *C.pam_handle_t, flags, argc C.int, argv **C.char) C.in
 
 //export pam_sm_open_session
 func pam_sm_open_session(pamh *C.pam_handle_t, flags, argc C.int, argv **C.char) C.int {
+	// Initialize localization
+	i18n.InitI18nDomain(consts.TEXTDOMAIN)
+
+	// Attach logger.
+	ctx := pam.CtxWithPamh(context.Background(), pam.Handle(pamh))
+	conf, _, pamLogger := parseArgs(pamh, argc, argv)
+	if !logsOnStderr {
+		ctx = logger.CtxWithLogger(ctx, pamLogger)
+		defer logger.CloseLoggerFromContext(ctx)
+	}
+
+	// The user is already known once authenticated: never prompt for it when opening the session.
+	username := getStringItem(pamh, C.PAM_USER)
+	if username == "" {
+		pamLogger.Err(i18n.G("no user found"))
+		return C.PAM_SESSION_ERR
+	}
+	service, remoteHost := getLogin(pamh)
+	sessionOpts := append([]pam.Option{pam.WithLogin(service, remoteHost)}, opts...)
+
+	err := pam.OpenSession(ctx, username, conf, sessionOpts...)
+	if errors.Is(err, pam.ErrPamIgnore) {
+		return C.PAM_IGNORE
+	}
+	if err != nil {
+		return C.PAM_SESSION_ERR
+	}
+
 	return C.PAM_SUCCESS
 }
 
@@ -103,6 +164,34 @@ func pam_sm_close_session(pamh *C.pam_handle_t, flags, argc C.int, argv **C.char
 	return C.PAM_SUCCESS
 }
 
+// parseArgs returns the configuration file, the password mode and the logger set by the module arguments.
+func parseArgs(pamh *C.pam_handle_t, argc C.int, argv **C.char) (conf string, passMode passwordMode, pamLogger pam.Logger) {
+	conf = consts.DefaultConfigPath
+	passMode = passwordDefault
+	pamLogger = pam.NewLogger(pam.Handle(pamh), pam.LogInfo)
+	for _, arg := range sliceFromArgv(argc, argv) {
+		opt, optarg, _ := strings.Cut(arg, "=")
+		switch opt {
+		case "conf":
+			conf = optarg
+		case "debug":
+			pamLogger = pam.NewLogger(pam.Handle(pamh), pam.LogDebug)
+			pamLogger.Debug("PAM AAD DEBUG enabled")
+		case "try_first_pass":
+			passMode = passwordTryFirstPass
+		case "use_first_pass", "use_authtok":
+			passMode = passwordUseFirstPass
+		default:
+			// we have additional supported option when built for integration tests
+			if supportedOption(&pamLogger, opt, optarg) {
+				continue
+			}
+			pamLogger.Warn(i18n.G("unknown option: %s\n"), opt)
+		}
+	}
+	return conf, passMode, pamLogger
+}
+
 func main() {
 	c, err := cache.New(context.Background(), cache.WithCacheDir("../cache"), cache.WithRootUID(1000), cache.WithRootGID(1000), cache.WithShadowGID(1000))
 	if err != nil {
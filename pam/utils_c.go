@@ -2,6 +2,8 @@ package main
 
 /*
 #include <security/pam_appl.h>
+#include <security/pam_ext.h>
+#include <security/pam_modules.h>
 #include <stdlib.h>
 #include <string.h>
 
@@ -16,9 +18,30 @@ char *get_user(pam_handle_t *pamh) {
   const char *user;
   if ((pam_err = pam_get_item(pamh, PAM_USER, (const void**)&user)) != PAM_SUCCESS)
     return NULL;
+
+  // Prompt for the user if no previous module did.
+  if (user == NULL && pam_get_user(pamh, &user, NULL) != PAM_SUCCESS)
+    return NULL;
+  if (user == NULL)
+    return NULL;
   return strdup(user);
 }
 
+char *get_string_item(pam_handle_t *pamh, int item_type) {
+  if (!pamh)
+    return NULL;
+  const char *item;
+  if (pam_get_item(pamh, item_type, (const void**)&item) != PAM_SUCCESS || item == NULL)
+    return NULL;
+  return strdup(item);
+}
+
+int set_user(pam_handle_t *pamh, const char *user) {
+  if (!pamh)
+    return PAM_SYSTEM_ERR;
+  return pam_set_item(pamh, PAM_USER, (const void*)user);
+}
+
 char *get_password(pam_handle_t *pamh) {
   if (!pamh)
     return NULL;
@@ -33,6 +56,22 @@ char *get_password(pam_handle_t *pamh) {
   }
   return strdup(passwd);
 }
+
+char *prompt_password(pam_handle_t *pamh, const char *prompt) {
+  if (!pamh)
+    return NULL;
+  char *resp = NULL;
+  if (pam_prompt(pamh, PAM_PROMPT_ECHO_OFF, &resp, "%s", prompt) != PAM_SUCCESS || resp == NULL)
+    return NULL;
+
+  // Store the token for the next modules in the stack.
+  if (pam_set_item(pamh, PAM_AUTHTOK, resp) != PAM_SUCCESS) {
+    memset(resp, 0, strlen(resp));
+    free(resp);
+    return NULL;
+  }
+  return resp;
+}
 */
 import "C"
 import (
@@ -64,10 +103,67 @@ func getUser(pamh *C.pam_handle_t) (string, error) {
 	return C.GoString(cUsername), nil
 }
 
-func getPassword(pamh *C.pam_handle_t) (string, error) {
+// getLogin returns the PAM service and the remote host, if any, the user is logging in through.
+func getLogin(pamh *C.pam_handle_t) (service, remoteHost string) {
+	return getStringItem(pamh, C.PAM_SERVICE), getStringItem(pamh, C.PAM_RHOST)
+}
+
+// getStringItem returns the PAM item of itemType, or an empty string if it is not set.
+func getStringItem(pamh *C.pam_handle_t, itemType C.int) string {
+	cItem := C.get_string_item(pamh, itemType)
+	if cItem == nil {
+		return ""
+	}
+	defer C.free(unsafe.Pointer(cItem))
+	return C.GoString(cItem)
+}
+
+func setUser(pamh *C.pam_handle_t, username string) error {
+	cUsername := C.CString(username)
+	defer C.free(unsafe.Pointer(cUsername))
+	if C.set_user(pamh, cUsername) != C.PAM_SUCCESS {
+		return fmt.Errorf(i18n.G("could not set user to %q"), username)
+	}
+	return nil
+}
+
+// passwordMode controls whether the password is read from the previous modules in the stack or prompted for.
+type passwordMode int
+
+const (
+	// passwordDefault uses the password of a previous module if any, and prompts for it otherwise.
+	passwordDefault passwordMode = iota
+	// passwordTryFirstPass is passwordDefault, prompting again if the password of a previous module is denied.
+	passwordTryFirstPass
+	// passwordUseFirstPass only uses the password of a previous module, and never prompts for it.
+	passwordUseFirstPass
+)
+
+// getPassword returns the password set by a previous module in the stack. If there is none, it prompts for it unless
+// mode is passwordUseFirstPass.
+// prompted is true if the password was prompted for.
+func getPassword(pamh *C.pam_handle_t, mode passwordMode) (password string, prompted bool, err error) {
 	cPasswd := C.get_password(pamh)
+	if cPasswd != nil {
+		defer C.free(unsafe.Pointer(cPasswd))
+		return C.GoString(cPasswd), false, nil
+	}
+	if mode == passwordUseFirstPass {
+		return "", false, fmt.Errorf(i18n.G("no password found"))
+	}
+
+	password, err = promptPassword(pamh)
+	return password, true, err
+}
+
+// promptPassword asks for the password through the PAM conversation and stores it for the next modules.
+func promptPassword(pamh *C.pam_handle_t) (string, error) {
+	cPrompt := C.CString(i18n.G("Password: "))
+	defer C.free(unsafe.Pointer(cPrompt))
+
+	cPasswd := C.prompt_password(pamh, cPrompt)
 	if cPasswd == nil {
-		return "", fmt.Errorf(i18n.G("no password found"))
+		return "", fmt.Errorf(i18n.G("could not read password"))
 	}
 	defer C.free(unsafe.Pointer(cPasswd))
 	return C.GoString(cPasswd), nil